@@ -3,16 +3,26 @@ package main
 import (
 	"cctv-api/internal/config"
 	"cctv-api/internal/database"
+	"cctv-api/internal/events"
 	"cctv-api/internal/handlers"
+	"cctv-api/internal/health"
+	"cctv-api/internal/motion"
+	"cctv-api/internal/netguard"
+	"cctv-api/internal/payments"
+	"cctv-api/internal/playback"
+	"cctv-api/internal/ratelimit"
+	"cctv-api/internal/realtime"
 	"cctv-api/internal/services"
+	"cctv-api/internal/storage"
+	"cctv-api/internal/streamproxy"
 	"cctv-api/internal/utils"
+	"context"
 	"log"
 	"net/http"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/rs/cors"
-	"golang.org/x/time/rate"
 )
 
 func main() {
@@ -29,13 +39,202 @@ func main() {
 	// Initialize JWT utility
 	jwtUtil := utils.NewJWTUtil(cfg.JWTSecret, cfg.JWTExpiration, db.DB)
 
+	// Initialize password hasher
+	if cfg.Argon2Parallelism < 1 || cfg.Argon2Parallelism > 255 {
+		log.Fatalf("Invalid ARGON2_PARALLELISM %d: must be between 1 and 255", cfg.Argon2Parallelism)
+	}
+	if cfg.Argon2MemoryKiB < 1 || cfg.Argon2Iterations < 1 {
+		log.Fatal("ARGON2_MEMORY_KIB and ARGON2_ITERATIONS must be positive")
+	}
+	argon2Params := utils.Argon2Params{
+		Memory:      uint32(cfg.Argon2MemoryKiB),
+		Iterations:  uint32(cfg.Argon2Iterations),
+		Parallelism: uint8(cfg.Argon2Parallelism),
+	}
+	if cfg.Argon2CalibrateTarget > 0 {
+		argon2Params = utils.CalibrateArgon2(cfg.Argon2CalibrateTarget, argon2Params.Memory, argon2Params.Parallelism)
+		log.Printf("Calibrated argon2id: m=%d t=%d p=%d", argon2Params.Memory, argon2Params.Iterations, argon2Params.Parallelism)
+	}
+	if err := argon2Params.Validate(); err != nil {
+		log.Fatalf("Invalid argon2 parameters: %v", err)
+	}
+	passwordHasher := utils.NewArgon2idHasher(argon2Params)
+
+	// Initialize password policy
+	passwordPolicy := utils.PasswordPolicy{
+		MinLength:        cfg.PasswordMinLength,
+		MaxLength:        128,
+		RequireUpper:     cfg.PasswordRequireUpper,
+		RequireLower:     cfg.PasswordRequireLower,
+		RequireDigit:     cfg.PasswordRequireDigit,
+		RequireSymbol:    cfg.PasswordRequireSymbol,
+		DisallowIdentity: cfg.PasswordDisallowIdentity,
+	}
+	if cfg.BreachedPasswordsPath != "" {
+		breached, err := utils.LoadBreachedPasswords(cfg.BreachedPasswordsPath)
+		if err != nil {
+			log.Fatalf("Failed to load breached password list: %v", err)
+		}
+		passwordPolicy.Breached = breached
+	}
+
 	// Initialize email service
 	emailService := services.NewEmailService(cfg)
 
+	// Initialize audit log and login protection
+	auditService := services.NewAuditService(db.DB)
+	loginGuard := services.NewLoginGuard(db.DB, cfg)
+
+	// Outbound fetches of camera, webhook and alert URLs stay off internal networks
+	outboundGuard, err := netguard.Parse(cfg.OutboundAllowedNetworks)
+	if err != nil {
+		log.Fatalf("Invalid OUTBOUND_ALLOWED_NETWORKS: %v", err)
+	}
+
+	// Domain events, fanned out to webhook subscriptions and live streams
+	bus := events.NewBus()
+	webhookService := services.NewWebhookService(db.DB, outboundGuard, cfg.WebhookMaxAttempts, cfg.WebhookRetryBase, cfg.WebhookConcurrency, cfg.WebhookDeliveryRetention)
+	bus.Subscribe(webhookService.Enqueue)
+	broker := realtime.NewBroker(cfg.RealtimeBufferSize, cfg.RealtimeQueueSize)
+	bus.Subscribe(broker.Publish)
+	viewers := realtime.NewViewers()
+
+	// Signed playback URLs stand in for camera source URLs
+	playbackSigner := playback.NewSigner(cfg.PlaybackSecret, cfg.PlaybackURLTTL, cfg.PlaybackSessionTTL, cfg.PlaybackBaseURL, cfg.MediaServerURL)
+	streamProxy := streamproxy.New(streamproxy.Options{
+		Timeout:             cfg.StreamProxyTimeout,
+		MaxIdleConnsPerHost: cfg.StreamProxyIdleConns,
+		CacheBytes:          int64(cfg.StreamProxyCacheBytes),
+		MaxObjectBytes:      int64(cfg.StreamProxyMaxObjectBytes),
+		PlaylistTTL:         cfg.StreamProxyPlaylistTTL,
+		SegmentTTL:          cfg.StreamProxySegmentTTL,
+		Secret:              cfg.PlaybackSecret,
+		Guard:               outboundGuard,
+	})
+	go webhookService.RunDispatcher(context.Background(), cfg.WebhookDispatchInterval)
+
+	// Initialize subscription plans and downgrade expired subscriptions
+	planService := services.NewPlanService(db.DB)
+	go planService.RunExpiryJob(context.Background(), cfg.SubscriptionCheckInterval)
+	sessionService := services.NewSessionService(db.DB, planService)
+	notificationService := services.NewNotificationService(db.DB)
+	apiKeyService := services.NewAPIKeyService(db.DB)
+	streamService := services.NewStreamService(db.DB)
+	allotmentService := services.NewAllotmentService(db.DB, planService, notificationService)
+
+	// Stream health monitor
+	prober := health.NewProber(health.Options{
+		Timeout:           cfg.HealthCheckTimeout,
+		MaxTargetDuration: cfg.HealthMaxTargetDuration,
+		StaleSegments:     cfg.HealthStaleSegments,
+		MaxFrameBytes:     int64(cfg.HealthMaxFrameBytes),
+		Guard:             outboundGuard,
+	})
+	healthMonitor := services.NewHealthMonitor(db.DB, prober, bus, cfg.HealthCheckConcurrency, cfg.HealthHistoryRetention)
+	if cfg.HealthCheckInterval > 0 {
+		go healthMonitor.RunMonitor(context.Background(), cfg.HealthCheckInterval)
+	}
+
+	// File storage; local files are downloaded through signed /files/ links
+	fileLinks := storage.NewURLSigner(cfg.StorageURLSecret, cfg.StorageBaseURL)
+	var store storage.Store
+	switch cfg.StorageBackend {
+	case "local":
+		store, err = storage.NewLocal(cfg.StorageDir, fileLinks)
+	case "s3":
+		store, err = storage.NewS3(storage.S3Options{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+			PathStyle: cfg.S3PathStyle,
+		})
+	default:
+		log.Fatalf("Unknown STORAGE_BACKEND %q; use local or s3", cfg.StorageBackend)
+	}
+	if err != nil {
+		log.Fatalf("Failed to open storage: %v", err)
+	}
+
+	// Motion detection compares consecutive snapshots
+	activityService := services.NewActivityService(db.DB, bus, motion.NewDetector(motion.Options{
+		Size:      cfg.MotionFrameSize,
+		BlockSize: cfg.MotionBlockSize,
+		Threshold: cfg.MotionPixelThreshold,
+	}), cfg.MotionScoreThreshold, cfg.ActivityHistoryRetention)
+	go activityService.RunPruneJob(context.Background(), 24*time.Hour)
+	var frameAnalysis *services.ActivityService
+	if cfg.MotionDetection {
+		frameAnalysis = activityService
+	}
+
+	// Snapshot capture; frames become camera thumbnails
+	snapshotService := services.NewSnapshotService(db.DB, store, prober, frameAnalysis, cfg.AppBaseURL, int64(cfg.ImageUploadMaxPixels), cfg.SnapshotConcurrency,
+		handlers.ThumbnailPublisher(db.DB, bus))
+	if cfg.SnapshotCaptureInterval > 0 {
+		go snapshotService.RunCaptureJob(context.Background(), cfg.SnapshotCaptureInterval)
+	}
+
+	// Uploaded profile photos and camera thumbnails
+	imageService := services.NewImageService(db.DB, store, cfg.AppBaseURL, int64(cfg.ImageUploadMaxBytes), int64(cfg.ImageUploadMaxPixels))
+
+	// Uptime reports; a check counts for up to three monitor intervals
+	uptimeService := services.NewUptimeService(db.DB, 3*cfg.HealthCheckInterval, cfg.SLATargetPercent)
+	go uptimeService.RunRollupJob(context.Background(), cfg.UptimeRollupInterval)
+
+	// Outage alerts
+	alertLocation := time.Local
+	if cfg.AlertTimezone != "" {
+		alertLocation, err = time.LoadLocation(cfg.AlertTimezone)
+		if err != nil {
+			log.Fatalf("Invalid ALERT_TIMEZONE: %v", err)
+		}
+	}
+	alertService := services.NewAlertService(db.DB, outboundGuard, emailService, bus, alertLocation)
+	if cfg.AlertCheckInterval > 0 {
+		go alertService.RunAlertJob(context.Background(), cfg.AlertCheckInterval)
+	}
+
+	// Initialize payment provider
+	var paymentProvider payments.Provider
+	var fakePaymentProvider *payments.FakeProvider
+	if cfg.PaymentProvider == "" || cfg.PaymentWebhookSecret == "" {
+		log.Fatal("PAYMENT_PROVIDER and PAYMENT_WEBHOOK_SECRET are required")
+	}
+	if cfg.PaymentProvider == "fake" {
+		if !cfg.PaymentFakeEnabled {
+			log.Fatal("The fake payment provider is for development only; set PAYMENT_FAKE_ENABLED=true to use it")
+		}
+		fakePaymentProvider = payments.NewFakeProvider(cfg.PaymentWebhookSecret, cfg.AppBaseURL)
+		paymentProvider = fakePaymentProvider
+		log.Println("Using fake payment provider - admins can simulate payments")
+	} else {
+		if cfg.PaymentCheckoutURL == "" {
+			log.Fatal("PAYMENT_CHECKOUT_URL is required for payment provider " + cfg.PaymentProvider)
+		}
+		paymentProvider = payments.NewHMACProvider(cfg.PaymentProvider, cfg.PaymentWebhookSecret, cfg.PaymentCheckoutURL)
+	}
+	paymentService := services.NewPaymentService(db.DB, paymentProvider, planService, auditService, bus)
+	voucherService := services.NewVoucherService(db.DB, planService, auditService, bus)
+
 	// Create router
 	router := mux.NewRouter()
 
-	resetLimiter := rate.NewLimiter(rate.Every(time.Hour), 3) // 3 requests per hour// Health check endpoint
+	// Per-client rate limiting
+	utils.TrustProxyHeaders = cfg.TrustProxyHeaders
+	if utils.TrustedProxies, err = netguard.ParseNetworks(cfg.TrustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+	limiterStore := ratelimit.NewStore(cfg.RateLimitMaxKeys)
+	limit := func(name string) func(http.HandlerFunc) http.HandlerFunc {
+		return handlers.RateLimitMiddleware(limiterStore, cfg.RateLimits[name])
+	}
+	// Camera and location changes set the URLs the server fetches, so they
+	// stay with admins even on the shared /api routes
+	adminOnly := handlers.AdminMiddleware()
+
+	// Health check endpoint
 	router.HandleFunc("/api/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
@@ -45,49 +244,168 @@ func main() {
 	// Auth routes tanpa middleware
 	authRouter := router.PathPrefix("/api/auth").Subrouter()
 	{
-		authRouter.HandleFunc("/login", handlers.Login(db.DB, jwtUtil)).Methods("POST")
-		authRouter.HandleFunc("/register", handlers.Register(db.DB)).Methods("POST")
-		authRouter.HandleFunc("/request-device-reset", handlers.RateLimitMiddleware(resetLimiter)(handlers.RequestDeviceReset(db.DB, emailService))).Methods("POST")
-		authRouter.HandleFunc("/confirm-device-reset", handlers.RateLimitMiddleware(resetLimiter)(handlers.ConfirmDeviceReset(db.DB))).Methods("POST")
+		authRouter.HandleFunc("/login", limit("login")(handlers.Login(db.DB, jwtUtil, planService, sessionService, passwordHasher, loginGuard, auditService, emailService))).Methods("POST")
+		authRouter.HandleFunc("/register", limit("register")(handlers.Register(db.DB, passwordHasher, passwordPolicy))).Methods("POST")
+		authRouter.HandleFunc("/request-device-reset", limit("device-reset-request-ip")(limit("device-reset-request")(handlers.RequestDeviceReset(db.DB, emailService)))).Methods("POST")
+		authRouter.HandleFunc("/confirm-device-reset", limit("device-reset-confirm")(handlers.ConfirmDeviceReset(db.DB, passwordHasher, loginGuard, auditService, emailService))).Methods("POST")
 	}
 
 	// Logout dengan middleware JWT
 	authRouterWithMiddleware := router.PathPrefix("/api/auth").Subrouter()
-	authRouterWithMiddleware.Use(handlers.JWTMiddleware(jwtUtil))
+	authRouterWithMiddleware.Use(handlers.JWTMiddleware(jwtUtil, sessionService))
 	{
-		authRouterWithMiddleware.HandleFunc("/logout", handlers.Logout(db.DB)).Methods("POST")
+		authRouterWithMiddleware.HandleFunc("/logout", handlers.Logout(sessionService)).Methods("POST")
 	}
 
 	// Pindahkan endpoint /cctvs dari publicRouter ke apiRouter (authenticated)
 	apiRouter := router.PathPrefix("/api").Subrouter()
-	apiRouter.Use(handlers.JWTMiddleware(jwtUtil))
+	apiRouter.Use(handlers.JWTMiddleware(jwtUtil, sessionService))
 	{
 		// Locations
-		apiRouter.HandleFunc("/locations", handlers.CreateLocation(db.DB)).Methods("POST")
-		apiRouter.HandleFunc("/locations/{id:[0-9]+}", handlers.DeleteLocation(db.DB)).Methods("DELETE")
+		apiRouter.Handle("/locations", adminOnly(handlers.CreateLocation(db.DB, bus))).Methods("POST")
+		apiRouter.Handle("/locations/{id:[0-9]+}", adminOnly(handlers.UpdateLocation(db.DB, bus))).Methods("PUT")
+		apiRouter.Handle("/locations/{id:[0-9]+}", adminOnly(handlers.DeleteLocation(db.DB, bus))).Methods("DELETE")
 
 		// CCTVs
-		apiRouter.HandleFunc("/cctvs", handlers.GetAllCCTVs(db.DB)).Methods("GET") // Dipindahkan ke sini
-		apiRouter.HandleFunc("/cctvs", handlers.CreateCCTV(db.DB)).Methods("POST")
-		apiRouter.HandleFunc("/cctvs/{id:[0-9]+}", handlers.UpdateCCTV(db.DB)).Methods("PUT")
-		apiRouter.HandleFunc("/cctvs/{id:[0-9]+}", handlers.DeleteCCTV(db.DB)).Methods("DELETE")
+		apiRouter.HandleFunc("/cctvs", limit("cctv-list")(handlers.GetAllCCTVs(db.DB, planService, allotmentService, streamService, playbackSigner))).Methods("GET") // Dipindahkan ke sini
+		apiRouter.Handle("/cctvs", adminOnly(handlers.CreateCCTV(db.DB, prober, bus))).Methods("POST")
+		apiRouter.HandleFunc("/cctvs/{id:[0-9]+}", handlers.GetCCTV(db.DB, planService, allotmentService, streamService, playbackSigner)).Methods("GET")
+		apiRouter.HandleFunc("/cctvs/{id:[0-9]+}/snapshot", handlers.GetCCTVSnapshot(db.DB, planService, allotmentService, snapshotService)).Methods("GET", "HEAD")
+		apiRouter.HandleFunc("/cctvs/{id:[0-9]+}/thumbnail", handlers.GetCCTVThumbnail(db.DB, planService, allotmentService, imageService)).Methods("GET", "HEAD")
+		apiRouter.Handle("/cctvs/{id:[0-9]+}/thumbnail", adminOnly(handlers.UploadCCTVThumbnail(db.DB, imageService, bus))).Methods("PUT")
+		apiRouter.Handle("/cctvs/{id:[0-9]+}/thumbnail", adminOnly(handlers.DeleteCCTVThumbnail(db.DB, imageService, bus))).Methods("DELETE")
+		apiRouter.HandleFunc("/cctvs/{id:[0-9]+}/activity", handlers.GetCCTVActivity(db.DB, planService, allotmentService, activityService)).Methods("GET")
+		apiRouter.HandleFunc("/cctvs/{id:[0-9]+}/playback", handlers.GetPlaybackURL(db.DB, planService, allotmentService, streamService, playbackSigner)).Methods("GET")
+		apiRouter.Handle("/cctvs/{id:[0-9]+}", adminOnly(handlers.UpdateCCTV(db.DB, prober, allotmentService, imageService, bus))).Methods("PUT")
+		apiRouter.Handle("/cctvs/{id:[0-9]+}", adminOnly(handlers.DeleteCCTV(db.DB, allotmentService, snapshotService, imageService, bus))).Methods("DELETE")
 
-		apiRouter.HandleFunc("/account/upgrade", handlers.UpgradeAccount(db.DB)).Methods("POST")
+		apiRouter.HandleFunc("/account/upgrade", handlers.UpgradeAccount(paymentService)).Methods("POST")
+		apiRouter.HandleFunc("/account/redeem", limit("voucher-redeem")(handlers.RedeemVoucher(voucherService))).Methods("POST")
+		apiRouter.HandleFunc("/account/orders", handlers.GetMyOrders(paymentService)).Methods("GET")
+		apiRouter.HandleFunc("/account/orders/{reference}/cancel", handlers.CancelMyOrder(paymentService)).Methods("POST")
+		apiRouter.HandleFunc("/account/subscription", handlers.GetMySubscription(planService)).Methods("GET")
+		apiRouter.HandleFunc("/account/cameras", handlers.GetMyCameras(planService, allotmentService)).Methods("GET")
+		apiRouter.HandleFunc("/account/cameras", handlers.SetMyCameras(planService, allotmentService)).Methods("PUT")
+		apiRouter.HandleFunc("/account/cameras/swap", handlers.SwapMyCamera(planService, allotmentService)).Methods("POST")
+		apiRouter.HandleFunc("/account/photo", handlers.UploadMyPhoto(imageService, auditService)).Methods("PUT")
+		apiRouter.HandleFunc("/account/photo", handlers.DeleteMyPhoto(imageService)).Methods("DELETE")
+		apiRouter.HandleFunc("/users/{id:[0-9]+}/photo", handlers.GetUserPhoto(imageService)).Methods("GET", "HEAD")
+		apiRouter.HandleFunc("/account/home-location", handlers.SetHomeLocation(db.DB)).Methods("PUT")
+		apiRouter.HandleFunc("/account/notifications", handlers.GetMyNotifications(notificationService)).Methods("GET")
+		apiRouter.HandleFunc("/account/notifications/read-all", handlers.MarkAllNotificationsRead(notificationService)).Methods("POST")
+		apiRouter.HandleFunc("/account/notifications/{id:[0-9]+}/read", handlers.MarkNotificationRead(notificationService)).Methods("POST")
+		apiRouter.HandleFunc("/account/api-keys", handlers.GetMyAPIKeys(apiKeyService)).Methods("GET")
+		apiRouter.HandleFunc("/account/api-keys", handlers.CreateMyAPIKey(apiKeyService, auditService)).Methods("POST")
+		apiRouter.HandleFunc("/account/api-keys/{id:[0-9]+}", handlers.RevokeMyAPIKey(apiKeyService, auditService)).Methods("DELETE")
+
+		// Live events
+		apiRouter.HandleFunc("/events", handlers.StreamEvents(jwtUtil, sessionService, broker, planService, allotmentService, cfg.SSEHeartbeatInterval)).Methods("GET")
+		apiRouter.HandleFunc("/ws", handlers.ServeWebSocket(jwtUtil, sessionService, broker, viewers, planService, allotmentService, alertService, cfg.WSPingInterval)).Methods("GET")
+	}
+
+	// Payment provider callbacks (authenticated by signature, not JWT)
+	paymentRouter := router.PathPrefix("/api/payments").Subrouter()
+	{
+		paymentRouter.HandleFunc("/webhook", handlers.PaymentWebhook(paymentService)).Methods("POST")
+	}
+
+	// Admin routes
+	adminRouter := router.PathPrefix("/api/admin").Subrouter()
+	adminRouter.Use(handlers.JWTMiddleware(jwtUtil, sessionService))
+	adminRouter.Use(handlers.AdminMiddleware())
+	{
+		adminRouter.HandleFunc("/users/{id:[0-9]+}/devices", handlers.GetUserDevices(db.DB)).Methods("GET")
+		adminRouter.HandleFunc("/users/{id:[0-9]+}/devices", handlers.ResetUserDevices(db.DB)).Methods("DELETE")
+		adminRouter.HandleFunc("/users/{id:[0-9]+}/unlock", handlers.UnlockUser(db.DB, loginGuard, auditService)).Methods("POST")
+		adminRouter.HandleFunc("/audit-logs", handlers.GetAuditLogs(db.DB)).Methods("GET")
+		adminRouter.HandleFunc("/users/{id:[0-9]+}/subscription", handlers.GrantSubscription(db.DB, planService, auditService, bus)).Methods("POST")
+
+		// Plans
+		adminRouter.HandleFunc("/plans", handlers.GetAllPlans(planService)).Methods("GET")
+		adminRouter.HandleFunc("/plans", handlers.CreatePlan(db.DB)).Methods("POST")
+		adminRouter.HandleFunc("/plans/{id:[0-9]+}", handlers.UpdatePlan(db.DB)).Methods("PUT")
+
+		// Vouchers
+		adminRouter.HandleFunc("/vouchers", handlers.GetVouchers(voucherService)).Methods("GET")
+		adminRouter.HandleFunc("/vouchers", handlers.CreateVoucher(db.DB, auditService)).Methods("POST")
+		adminRouter.HandleFunc("/vouchers/{id:[0-9]+}", handlers.UpdateVoucher(db.DB)).Methods("PUT")
+		adminRouter.HandleFunc("/vouchers/{id:[0-9]+}/redemptions", handlers.GetVoucherRedemptions(db.DB)).Methods("GET")
+
+		// Development payments: settle or fail an order without a real gateway
+		if fakePaymentProvider != nil {
+			adminRouter.HandleFunc("/payments/fake/{reference}", handlers.SimulateFakePayment(paymentService, fakePaymentProvider)).Methods("POST")
+		}
+
+		// Stream health
+		adminRouter.HandleFunc("/cctvs/{id:[0-9]+}/status-history", handlers.GetCCTVStatusHistory(healthMonitor)).Methods("GET")
+		adminRouter.HandleFunc("/cctvs/{id:[0-9]+}/check", handlers.CheckCCTVHealth(db.DB, healthMonitor)).Methods("POST")
+		adminRouter.HandleFunc("/cctvs/{id:[0-9]+}/motion-mask", handlers.GetMotionMask(activityService)).Methods("GET")
+		adminRouter.HandleFunc("/cctvs/{id:[0-9]+}/motion-mask", handlers.SetMotionMask(db.DB, activityService, bus)).Methods("PUT")
+		adminRouter.HandleFunc("/cctvs/{id:[0-9]+}/streams", handlers.GetCCTVStreams(db.DB, streamService)).Methods("GET")
+		adminRouter.HandleFunc("/cctvs/{id:[0-9]+}/streams", handlers.CreateCCTVStream(db.DB, prober, streamService, bus)).Methods("POST")
+		adminRouter.HandleFunc("/cctvs/{id:[0-9]+}/streams/{streamId:[0-9]+}", handlers.UpdateCCTVStream(db.DB, prober, streamService, bus)).Methods("PUT")
+		adminRouter.HandleFunc("/cctvs/{id:[0-9]+}/streams/{streamId:[0-9]+}", handlers.DeleteCCTVStream(db.DB, streamService, bus)).Methods("DELETE")
+
+		// Uptime / SLA
+		adminRouter.HandleFunc("/uptime", handlers.GetUptimeReport(uptimeService, store, "network")).Methods("GET")
+		adminRouter.HandleFunc("/uptime/locations/{id:[0-9]+}", handlers.GetUptimeReport(uptimeService, store, "location")).Methods("GET")
+		adminRouter.HandleFunc("/uptime/cctvs/{id:[0-9]+}", handlers.GetUptimeReport(uptimeService, store, "cctv")).Methods("GET")
+
+		// Outage alerts
+		adminRouter.HandleFunc("/alert-rules", handlers.GetAlertRules(alertService)).Methods("GET")
+		adminRouter.HandleFunc("/alert-rules", handlers.CreateAlertRule(alertService, auditService)).Methods("POST")
+		adminRouter.HandleFunc("/alert-rules/{id:[0-9]+}", handlers.UpdateAlertRule(alertService, auditService)).Methods("PUT")
+		adminRouter.HandleFunc("/alert-rules/{id:[0-9]+}", handlers.DeleteAlertRule(alertService, auditService)).Methods("DELETE")
+		adminRouter.HandleFunc("/alert-incidents", handlers.GetAlertIncidents(alertService)).Methods("GET")
+		adminRouter.HandleFunc("/alert-incidents/{id:[0-9]+}/ack", handlers.AcknowledgeAlertIncident(alertService, auditService)).Methods("POST")
+		adminRouter.HandleFunc("/maintenance-windows", handlers.GetMaintenanceWindows(alertService)).Methods("GET")
+		adminRouter.HandleFunc("/maintenance-windows", handlers.CreateMaintenanceWindow(alertService, auditService)).Methods("POST")
+		adminRouter.HandleFunc("/maintenance-windows/{id:[0-9]+}", handlers.DeleteMaintenanceWindow(alertService)).Methods("DELETE")
+
+		// Outbound webhooks
+		adminRouter.HandleFunc("/webhooks", handlers.GetWebhooks(webhookService)).Methods("GET")
+		adminRouter.HandleFunc("/webhooks", handlers.CreateWebhook(webhookService, auditService)).Methods("POST")
+		adminRouter.HandleFunc("/webhooks/event-types", handlers.GetWebhookEventTypes()).Methods("GET")
+		adminRouter.HandleFunc("/webhooks/{id:[0-9]+}", handlers.GetWebhook(webhookService)).Methods("GET")
+		adminRouter.HandleFunc("/webhooks/{id:[0-9]+}", handlers.UpdateWebhook(webhookService, auditService)).Methods("PUT")
+		adminRouter.HandleFunc("/webhooks/{id:[0-9]+}", handlers.DeleteWebhook(webhookService, auditService)).Methods("DELETE")
+		adminRouter.HandleFunc("/webhooks/{id:[0-9]+}/deliveries", handlers.GetWebhookDeliveries(webhookService)).Methods("GET")
+		adminRouter.HandleFunc("/webhooks/deliveries/{id:[0-9]+}/redeliver", handlers.RedeliverWebhook(webhookService)).Methods("POST")
+
+		// Live connections
+		adminRouter.HandleFunc("/realtime", handlers.GetRealtimeStats(broker, viewers)).Methods("GET")
+
+		// Settings
+		adminRouter.HandleFunc("/settings/allotment", handlers.GetAllotmentSettings(allotmentService)).Methods("GET")
+		adminRouter.HandleFunc("/settings/allotment", handlers.UpdateAllotmentSettings(allotmentService, auditService)).Methods("PUT")
 	}
 
 	// Public routes
 	publicRouter := router.PathPrefix("/api/public").Subrouter()
 	{
-		publicRouter.HandleFunc("/locations", handlers.GetAllLocations(db.DB)).Methods("GET")
+		publicRouter.HandleFunc("/plans", handlers.GetPlans(planService)).Methods("GET")
+		publicRouter.HandleFunc("/locations", limit("location-list")(handlers.GetAllLocations(db.DB))).Methods("GET")
 		// Hapus endpoint cctvs dari sini
 		publicRouter.HandleFunc("/cctvs/{id:[0-9]+}", handlers.GetCCTVByID(db.DB)).Methods("GET")
+		// Media servers check playback tokens here
+		publicRouter.HandleFunc("/playback/verify", handlers.VerifyPlaybackToken(db.DB, playbackSigner)).Methods("GET")
 	}
 
+	// Auth hook for media servers (MediaMTX external auth, nginx auth_request)
+	router.HandleFunc("/api/media/auth", handlers.MediaAuth(db.DB, jwtUtil, sessionService, apiKeyService, planService, allotmentService, playbackSigner)).Methods("GET", "POST")
+
+	// Signed download links for stored files
+	router.HandleFunc(storage.LinkPath+"{key:.+}", handlers.ServeFile(store, fileLinks)).Methods("GET", "HEAD")
+
+	// HLS proxy for playback URLs, authorized by the playback token
+	router.HandleFunc("/stream/{id:[0-9]+}/{path:.+}", handlers.ProxyStream(db.DB, planService, allotmentService, streamService, playbackSigner, streamProxy)).Methods("GET", "HEAD")
+
 	// CORS configuration
 	corsHandler := cors.New(cors.Options{
 		AllowedOrigins:   []string{"*"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Content-Type", "Authorization"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization", "X-API-Key", "Last-Event-ID", "X-Playback-Token"},
+		ExposedHeaders:   []string{"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Retry-After"},
 		AllowCredentials: true,
 	})
 
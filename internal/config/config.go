@@ -3,8 +3,11 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
 	"time"
 
+	"cctv-api/internal/ratelimit"
+
 	"github.com/joho/godotenv"
 )
 
@@ -24,6 +27,153 @@ type Config struct {
 	SMTPUsername string
 	SMTPPassword string
 	EmailFrom    string
+
+	// Public base URL of this API, used in links we hand out
+	AppBaseURL string
+
+	// Signed playback URLs handed out instead of camera source URLs: the
+	// signing secret (defaults to JWT_SECRET), how long a URL stays valid
+	// to start playing, how long a player may then keep watching, and the
+	// public address streams are served from
+	PlaybackSecret     string
+	PlaybackURLTTL     time.Duration
+	PlaybackSessionTTL time.Duration
+	PlaybackBaseURL    string
+	// Public HLS address of the media server (e.g. MediaMTX) that restreams
+	// RTSP cameras; without it RTSP cameras get no playback URL
+	MediaServerURL string
+
+	// HLS proxy under /stream: upstream timeout and idle connections per
+	// origin, in-memory cache size and largest cached object, and how long
+	// playlists and segments are served from the cache
+	StreamProxyTimeout        time.Duration
+	StreamProxyIdleConns      int
+	StreamProxyCacheBytes     int
+	StreamProxyMaxObjectBytes int
+	StreamProxyPlaylistTTL    time.Duration
+	StreamProxySegmentTTL     time.Duration
+
+	// Payment gateway name and webhook secret, both required. Any name selects
+	// an HMAC-signed gateway with a hosted checkout page; "fake" simulates one
+	// offline and is refused unless PAYMENT_FAKE_ENABLED is set
+	PaymentProvider      string
+	PaymentWebhookSecret string
+	PaymentCheckoutURL   string
+	PaymentFakeEnabled   bool
+
+	// How often expired subscriptions are downgraded
+	SubscriptionCheckInterval time.Duration
+
+	// Camera sources, stream proxy upstreams, snapshot fetches, webhook
+	// deliveries and alert webhooks may not reach loopback, link-local or
+	// private addresses; list CIDR ranges or addresses here (comma-separated)
+	// to allow them, e.g. a camera VLAN
+	OutboundAllowedNetworks string
+
+	// Stream health monitor; a zero interval disables it
+	HealthCheckInterval     time.Duration
+	HealthCheckConcurrency  int
+	HealthCheckTimeout      time.Duration
+	HealthMaxTargetDuration time.Duration
+	HealthStaleSegments     int
+	HealthMaxFrameBytes     int
+	HealthHistoryRetention  time.Duration
+
+	// Snapshot capture from snapshot and MJPEG sources; a zero interval
+	// disables it
+	SnapshotCaptureInterval time.Duration
+	SnapshotConcurrency     int
+
+	// File storage for snapshots, photos and exports: "local" keeps files
+	// below StorageDir, "s3" in an S3-compatible bucket. Local download
+	// links are signed with StorageURLSecret (defaults to JWT_SECRET) and
+	// served from StorageBaseURL (defaults to APP_BASE_URL).
+	StorageBackend   string
+	StorageDir       string
+	StorageURLSecret string
+	StorageBaseURL   string
+	S3Endpoint       string
+	S3Region         string
+	S3Bucket         string
+	S3AccessKey      string
+	S3SecretKey      string
+	S3PathStyle      bool
+
+	// Motion detection on captured snapshots: frames are scaled down to fit
+	// MotionFrameSize pixels and compared in blocks of MotionBlockSize; a
+	// block has changed when its brightness moved by more than
+	// MotionPixelThreshold (0-255), and MotionScoreThreshold percent of
+	// changed blocks is motion
+	MotionDetection          bool
+	MotionFrameSize          int
+	MotionBlockSize          int
+	MotionPixelThreshold     float64
+	MotionScoreThreshold     float64
+	ActivityHistoryRetention time.Duration
+
+	// Uploaded profile photos and camera thumbnails: largest file and
+	// largest image, in pixels. The pixel limit also applies to captured
+	// snapshot frames
+	ImageUploadMaxBytes  int
+	ImageUploadMaxPixels int
+
+	// Uptime reporting
+	SLATargetPercent     float64
+	UptimeRollupInterval time.Duration
+
+	// Outage alerts; a zero interval disables them. Quiet hours are read in
+	// AlertTimezone (an IANA name, empty for the server's local time).
+	AlertCheckInterval time.Duration
+	AlertTimezone      string
+
+	// Outbound webhooks: failed deliveries are retried after WebhookRetryBase,
+	// doubling each time, up to WebhookMaxAttempts attempts in total
+	WebhookDispatchInterval  time.Duration
+	WebhookMaxAttempts       int
+	WebhookRetryBase         time.Duration
+	WebhookConcurrency       int
+	WebhookDeliveryRetention time.Duration
+
+	// Live event streams: events kept for Last-Event-ID resume, events
+	// queued per connection before a slow client is dropped, and how often
+	// idle SSE connections get a heartbeat. WebSocket clients are pinged
+	// every WSPingInterval and dropped after two intervals of silence
+	RealtimeBufferSize   int
+	RealtimeQueueSize    int
+	SSEHeartbeatInterval time.Duration
+	WSPingInterval       time.Duration
+
+	// Rate limiting: per-route policies keyed by route name
+	RateLimits        map[string]ratelimit.Policy
+	RateLimitMaxKeys  int
+	TrustProxyHeaders bool
+	// Proxies (comma-separated CIDR ranges or addresses) whose
+	// X-Forwarded-For / X-Real-IP headers are believed
+	TrustedProxies string
+
+	// Login brute-force protection
+	LoginMaxFailures   int
+	LoginIPMaxFailures int
+	LoginLockDuration  time.Duration
+	LoginFailureWindow time.Duration
+	LoginDelayBase     time.Duration
+	LoginDelayMax      time.Duration
+
+	// Password hashing (argon2id). A non-zero calibrate target benchmarks
+	// the iteration count at startup instead of using Argon2Iterations.
+	Argon2MemoryKiB       int
+	Argon2Iterations      int
+	Argon2Parallelism     int
+	Argon2CalibrateTarget time.Duration
+
+	// Password policy
+	PasswordMinLength        int
+	PasswordRequireUpper     bool
+	PasswordRequireLower     bool
+	PasswordRequireDigit     bool
+	PasswordRequireSymbol    bool
+	PasswordDisallowIdentity bool
+	BreachedPasswordsPath    string // file or directory of SHA-1 hashes; empty disables the check
 }
 
 func LoadConfig() *Config {
@@ -35,6 +185,13 @@ func LoadConfig() *Config {
 		log.Fatal("Invalid JWT_EXPIRATION format. Use format like '24h'")
 	}
 
+	// Device limits are set per plan (deviceLimit) since plans were introduced
+	for _, key := range []string{"DEVICE_LIMIT_FREE", "DEVICE_LIMIT_PAID"} {
+		if os.Getenv(key) != "" {
+			log.Printf("%s is no longer used; set deviceLimit on the plans instead", key)
+		}
+	}
+
 	return &Config{
 		AppPort:       getEnv("APP_PORT", "8080"),
 		DBHost:        getEnv("DB_HOST", "localhost"),
@@ -50,6 +207,113 @@ func LoadConfig() *Config {
 		SMTPUsername: getEnv("SMTP_USERNAME", "satsat1410@gmail.com"),
 		SMTPPassword: getEnv("SMTP_PASSWORD", "ugzs vdly dptv aekc"),
 		EmailFrom:    getEnv("EMAIL_FROM", "satsat1410@gmail.com"),
+
+		AppBaseURL: getEnv("APP_BASE_URL", "http://localhost:"+getEnv("APP_PORT", "8080")),
+
+		PlaybackSecret:     getEnv("PLAYBACK_SECRET", getEnv("JWT_SECRET", "default-secret")),
+		PlaybackURLTTL:     getEnvDuration("PLAYBACK_URL_TTL", 10*time.Minute),
+		PlaybackSessionTTL: getEnvDuration("PLAYBACK_SESSION_TTL", 12*time.Hour),
+		PlaybackBaseURL:    getEnv("PLAYBACK_BASE_URL", getEnv("APP_BASE_URL", "http://localhost:"+getEnv("APP_PORT", "8080"))),
+		MediaServerURL:     getEnv("MEDIA_SERVER_URL", ""),
+
+		StreamProxyTimeout:        getEnvDuration("STREAM_PROXY_TIMEOUT", 15*time.Second),
+		StreamProxyIdleConns:      getEnvInt("STREAM_PROXY_IDLE_CONNS", 32),
+		StreamProxyCacheBytes:     getEnvInt("STREAM_PROXY_CACHE_BYTES", 64<<20),
+		StreamProxyMaxObjectBytes: getEnvInt("STREAM_PROXY_MAX_OBJECT_BYTES", 8<<20),
+		StreamProxyPlaylistTTL:    getEnvDuration("STREAM_PROXY_PLAYLIST_TTL", time.Second),
+		StreamProxySegmentTTL:     getEnvDuration("STREAM_PROXY_SEGMENT_TTL", 30*time.Second),
+
+		PaymentProvider:      getEnv("PAYMENT_PROVIDER", ""),
+		PaymentWebhookSecret: getEnv("PAYMENT_WEBHOOK_SECRET", ""),
+		PaymentCheckoutURL:   getEnv("PAYMENT_CHECKOUT_URL", ""),
+		PaymentFakeEnabled:   getEnvBool("PAYMENT_FAKE_ENABLED", false),
+
+		SubscriptionCheckInterval: getEnvDuration("SUBSCRIPTION_CHECK_INTERVAL", 5*time.Minute),
+
+		OutboundAllowedNetworks: getEnv("OUTBOUND_ALLOWED_NETWORKS", ""),
+
+		HealthCheckInterval:     getEnvDuration("HEALTH_CHECK_INTERVAL", time.Minute),
+		HealthCheckConcurrency:  getEnvInt("HEALTH_CHECK_CONCURRENCY", 10),
+		HealthCheckTimeout:      getEnvDuration("HEALTH_CHECK_TIMEOUT", 10*time.Second),
+		HealthMaxTargetDuration: getEnvDuration("HEALTH_MAX_TARGET_DURATION", 30*time.Second),
+		HealthStaleSegments:     getEnvInt("HEALTH_STALE_SEGMENTS", 3),
+		HealthMaxFrameBytes:     getEnvInt("HEALTH_MAX_FRAME_BYTES", 5<<20),
+		HealthHistoryRetention:  getEnvDuration("HEALTH_HISTORY_RETENTION", 90*24*time.Hour),
+
+		SnapshotCaptureInterval: getEnvDuration("SNAPSHOT_CAPTURE_INTERVAL", time.Minute),
+		SnapshotConcurrency:     getEnvInt("SNAPSHOT_CONCURRENCY", 4),
+
+		StorageBackend:   getEnv("STORAGE_BACKEND", "local"),
+		StorageDir:       getEnv("STORAGE_DIR", "data"),
+		StorageURLSecret: getEnv("STORAGE_URL_SECRET", getEnv("JWT_SECRET", "default-secret")),
+		StorageBaseURL:   getEnv("STORAGE_BASE_URL", getEnv("APP_BASE_URL", "http://localhost:"+getEnv("APP_PORT", "8080"))),
+		S3Endpoint:       getEnv("S3_ENDPOINT", ""),
+		S3Region:         getEnv("S3_REGION", "us-east-1"),
+		S3Bucket:         getEnv("S3_BUCKET", ""),
+		S3AccessKey:      getEnv("S3_ACCESS_KEY", ""),
+		S3SecretKey:      getEnv("S3_SECRET_KEY", ""),
+		S3PathStyle:      getEnvBool("S3_PATH_STYLE", true),
+
+		MotionDetection:          getEnvBool("MOTION_DETECTION", true),
+		MotionFrameSize:          getEnvInt("MOTION_FRAME_SIZE", 160),
+		MotionBlockSize:          getEnvInt("MOTION_BLOCK_SIZE", 8),
+		MotionPixelThreshold:     getEnvFloat("MOTION_PIXEL_THRESHOLD", 20),
+		MotionScoreThreshold:     getEnvFloat("MOTION_SCORE_THRESHOLD", 2),
+		ActivityHistoryRetention: getEnvDuration("ACTIVITY_HISTORY_RETENTION", 7*24*time.Hour),
+
+		ImageUploadMaxBytes:  getEnvInt("IMAGE_UPLOAD_MAX_BYTES", 10<<20),
+		ImageUploadMaxPixels: getEnvInt("IMAGE_UPLOAD_MAX_PIXELS", 40_000_000),
+
+		SLATargetPercent:     getEnvFloat("SLA_TARGET_PERCENT", 98),
+		UptimeRollupInterval: getEnvPositiveDuration("UPTIME_ROLLUP_INTERVAL", time.Hour),
+
+		AlertCheckInterval: getEnvDuration("ALERT_CHECK_INTERVAL", time.Minute),
+		AlertTimezone:      getEnv("ALERT_TIMEZONE", ""),
+
+		WebhookDispatchInterval:  getEnvPositiveDuration("WEBHOOK_DISPATCH_INTERVAL", 15*time.Second),
+		WebhookMaxAttempts:       getEnvInt("WEBHOOK_MAX_ATTEMPTS", 8),
+		WebhookRetryBase:         getEnvDuration("WEBHOOK_RETRY_BASE", 30*time.Second),
+		WebhookConcurrency:       getEnvInt("WEBHOOK_CONCURRENCY", 4),
+		WebhookDeliveryRetention: getEnvDuration("WEBHOOK_DELIVERY_RETENTION", 30*24*time.Hour),
+
+		RealtimeBufferSize:   getEnvInt("REALTIME_BUFFER_SIZE", 1000),
+		RealtimeQueueSize:    getEnvInt("REALTIME_QUEUE_SIZE", 64),
+		SSEHeartbeatInterval: getEnvPositiveDuration("SSE_HEARTBEAT_INTERVAL", 15*time.Second),
+		WSPingInterval:       getEnvPositiveDuration("WS_PING_INTERVAL", 30*time.Second),
+
+		RateLimits: map[string]ratelimit.Policy{
+			"login":                   getEnvRateLimit("login", "RATE_LIMIT_LOGIN", "10/1m:ip"),
+			"register":                getEnvRateLimit("register", "RATE_LIMIT_REGISTER", "5/1h:ip"),
+			"device-reset-request":    getEnvRateLimit("device-reset-request", "RATE_LIMIT_DEVICE_RESET_REQUEST", "3/1h:email"),
+			"device-reset-request-ip": getEnvRateLimit("device-reset-request-ip", "RATE_LIMIT_DEVICE_RESET_REQUEST_IP", "10/1h:ip"),
+			"device-reset-confirm":    getEnvRateLimit("device-reset-confirm", "RATE_LIMIT_DEVICE_RESET_CONFIRM", "10/1h:ip"),
+			"cctv-list":               getEnvRateLimit("cctv-list", "RATE_LIMIT_CCTV_LIST", "60/1m:user"),
+			"location-list":           getEnvRateLimit("location-list", "RATE_LIMIT_LOCATION_LIST", "60/1m:ip"),
+			"voucher-redeem":          getEnvRateLimit("voucher-redeem", "RATE_LIMIT_VOUCHER_REDEEM", "10/1h:user"),
+		},
+		RateLimitMaxKeys:  getEnvInt("RATE_LIMIT_MAX_KEYS", 10000),
+		TrustProxyHeaders: getEnvBool("TRUST_PROXY_HEADERS", false),
+		TrustedProxies:    getEnv("TRUSTED_PROXIES", "127.0.0.1, ::1"),
+
+		LoginMaxFailures:   getEnvInt("LOGIN_MAX_FAILURES", 5),
+		LoginIPMaxFailures: getEnvInt("LOGIN_IP_MAX_FAILURES", 50),
+		LoginLockDuration:  getEnvDuration("LOGIN_LOCK_DURATION", 15*time.Minute),
+		LoginFailureWindow: getEnvDuration("LOGIN_FAILURE_WINDOW", time.Hour),
+		LoginDelayBase:     getEnvDuration("LOGIN_DELAY_BASE", time.Second),
+		LoginDelayMax:      getEnvDuration("LOGIN_DELAY_MAX", 30*time.Second),
+
+		Argon2MemoryKiB:       getEnvInt("ARGON2_MEMORY_KIB", 64*1024),
+		Argon2Iterations:      getEnvInt("ARGON2_ITERATIONS", 3),
+		Argon2Parallelism:     getEnvInt("ARGON2_PARALLELISM", 2),
+		Argon2CalibrateTarget: getEnvDuration("ARGON2_CALIBRATE_TARGET", 0),
+
+		PasswordMinLength:        getEnvInt("PASSWORD_MIN_LENGTH", 8),
+		PasswordRequireUpper:     getEnvBool("PASSWORD_REQUIRE_UPPER", true),
+		PasswordRequireLower:     getEnvBool("PASSWORD_REQUIRE_LOWER", true),
+		PasswordRequireDigit:     getEnvBool("PASSWORD_REQUIRE_DIGIT", true),
+		PasswordRequireSymbol:    getEnvBool("PASSWORD_REQUIRE_SYMBOL", false),
+		PasswordDisallowIdentity: getEnvBool("PASSWORD_DISALLOW_IDENTITY", true),
+		BreachedPasswordsPath:    getEnv("BREACHED_PASSWORDS_PATH", ""),
 	}
 }
 
@@ -60,3 +324,69 @@ func getEnv(key, defaultValue string) string {
 	}
 	return value
 }
+
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("Invalid %s value %q: must be an integer", key, value)
+	}
+	return parsed
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Fatalf("Invalid %s value %q: must be a number", key, value)
+	}
+	return parsed
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("Invalid %s value %q. Use format like '15m'", key, value)
+	}
+	return parsed
+}
+
+// getEnvPositiveDuration is getEnvDuration for settings that drive a ticker
+// and cannot be switched off.
+func getEnvPositiveDuration(key string, defaultValue time.Duration) time.Duration {
+	parsed := getEnvDuration(key, defaultValue)
+	if parsed <= 0 {
+		log.Fatalf("Invalid %s value %s: must be positive", key, parsed)
+	}
+	return parsed
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Fatalf("Invalid %s value %q: must be true or false", key, value)
+	}
+	return parsed
+}
+
+func getEnvRateLimit(name, key, defaultValue string) ratelimit.Policy {
+	policy, err := ratelimit.ParsePolicy(name, getEnv(key, defaultValue))
+	if err != nil {
+		log.Fatalf("Invalid %s: %v. Use format like '10/1m:ip'", key, err)
+	}
+	return policy
+}
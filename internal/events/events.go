@@ -0,0 +1,108 @@
+// Package events carries domain events (camera and location changes, status
+// changes, upgrades) from the code that causes them to whoever listens,
+// such as outbound webhooks.
+package events
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	CCTVCreated          = "cctv.created"
+	CCTVUpdated          = "cctv.updated"
+	CCTVDeleted          = "cctv.deleted"
+	CCTVStatusChanged    = "cctv.status_changed"
+	CCTVThumbnailUpdated = "cctv.thumbnail_updated"
+	CCTVMotionStarted    = "cctv.motion_started"
+	CCTVMotionEnded      = "cctv.motion_ended"
+	LocationCreated      = "location.created"
+	LocationUpdated      = "location.updated"
+	LocationDeleted      = "location.deleted"
+	UserUpgraded         = "user.upgraded"
+	AlertTriggered       = "alert.triggered"
+	AlertResolved        = "alert.resolved"
+	AlertAcknowledged    = "alert.acknowledged"
+)
+
+// Types lists every event type that is published.
+var Types = []string{
+	CCTVCreated, CCTVUpdated, CCTVDeleted, CCTVStatusChanged, CCTVThumbnailUpdated,
+	CCTVMotionStarted, CCTVMotionEnded,
+	LocationCreated, LocationUpdated, LocationDeleted,
+	UserUpgraded,
+	AlertTriggered, AlertResolved, AlertAcknowledged,
+}
+
+type Event struct {
+	ID         string      `json:"id"`
+	Type       string      `json:"type"`
+	OccurredAt time.Time   `json:"occurredAt"`
+	Data       interface{} `json:"data"`
+}
+
+// Bus delivers every published event to each subscriber in turn, on the
+// publisher's goroutine. Subscribers must not block.
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers []func(Event)
+}
+
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+func (b *Bus) Subscribe(fn func(Event)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers = append(b.subscribers, fn)
+}
+
+// Publish stamps the event with an ID and time and hands it to the
+// subscribers. Call it after the change has been committed.
+func (b *Bus) Publish(eventType string, data interface{}) Event {
+	e := Event{ID: newID(), Type: eventType, OccurredAt: time.Now().UTC(), Data: data}
+
+	b.mu.RLock()
+	subscribers := b.subscribers
+	b.mu.RUnlock()
+
+	for _, fn := range subscribers {
+		fn(e)
+	}
+	return e
+}
+
+// Matches reports whether pattern selects eventType. A pattern is an exact
+// type, "<prefix>.*" for a family such as "location.*", or "*" for all.
+func Matches(pattern, eventType string) bool {
+	if pattern == "*" || pattern == eventType {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(pattern, ".*"); ok {
+		return strings.HasPrefix(eventType, prefix+".")
+	}
+	return false
+}
+
+// ValidPattern reports whether pattern matches at least one known type.
+func ValidPattern(pattern string) bool {
+	for _, t := range Types {
+		if Matches(pattern, t) {
+			return true
+		}
+	}
+	return false
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand does not fail on supported platforms
+		panic(err)
+	}
+	return "evt_" + hex.EncodeToString(b)
+}
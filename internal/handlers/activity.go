@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cctv-api/internal/events"
+	"cctv-api/internal/models"
+	"cctv-api/internal/responses"
+	"cctv-api/internal/services"
+	"cctv-api/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// GetCCTVActivity returns the activity of a camera the user's plan shows:
+// the latest score and, between from and to (the last 24 hours by
+// default), the samples and motion events behind it.
+func GetCCTVActivity(db *sql.DB, plans *services.PlanService, allotments *services.AllotmentService, activity *services.ActivityService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cctv, _, ok := loadVisibleCCTV(w, r, db, plans, allotments)
+		if !ok {
+			return
+		}
+
+		from, to, ok := parseTimeRange(r, 24*time.Hour)
+		if !ok {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid time range; use RFC 3339 from/to with from before to")
+			return
+		}
+
+		limit := 500
+		if raw := r.URL.Query().Get("limit"); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 1 || n > 5000 {
+				responses.SendErrorResponse(w, http.StatusBadRequest, "limit must be between 1 and 5000")
+				return
+			}
+			limit = n
+		}
+
+		report, err := activity.Activity(cctv.ID, from, to, limit)
+		if err != nil {
+			log.Printf("Failed to fetch activity of CCTV %d: %v", cctv.ID, err)
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to fetch activity")
+			return
+		}
+
+		responses.SendSuccessResponse(w, http.StatusOK, report)
+	}
+}
+
+// GetMotionMask returns the parts of a camera's frame that motion
+// detection leaves out.
+func GetMotionMask(activity *services.ActivityService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid CCTV ID")
+			return
+		}
+
+		mask, err := activity.Mask(id)
+		if err == sql.ErrNoRows {
+			responses.SendErrorResponse(w, http.StatusNotFound, "CCTV not found")
+			return
+		}
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to fetch motion mask")
+			return
+		}
+
+		responses.SendSuccessResponse(w, http.StatusOK, mask)
+	}
+}
+
+// SetMotionMask replaces the parts of a camera's frame that motion
+// detection leaves out, such as a clock or trees moving in the wind.
+func SetMotionMask(db *sql.DB, activity *services.ActivityService, bus *events.Bus) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid CCTV ID")
+			return
+		}
+
+		var req models.SetMotionMaskRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		if err := utils.Validate.Struct(req); err != nil {
+			responses.SendValidationError(w, err)
+			return
+		}
+
+		mask, err := activity.SetMask(id, req.IgnoreZones)
+		if err == sql.ErrNoRows {
+			responses.SendErrorResponse(w, http.StatusNotFound, "CCTV not found")
+			return
+		}
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to update motion mask")
+			return
+		}
+
+		publishCCTVEvent(db, bus, events.CCTVUpdated, id, []string{"motionMask"})
+
+		responses.SendSuccessResponse(w, http.StatusOK, mask)
+	}
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"cctv-api/internal/models"
+	"cctv-api/internal/responses"
+	"cctv-api/internal/services"
+	"cctv-api/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+func UnlockUser(db *sql.DB, guard *services.LoginGuard, audit *services.AuditService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(userClaimsKey).(*utils.Claims)
+		if !ok {
+			responses.SendErrorResponse(w, http.StatusUnauthorized, "Invalid user context")
+			return
+		}
+
+		vars := mux.Vars(r)
+		userID, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid user ID")
+			return
+		}
+
+		var exists bool
+		err = db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)", userID).Scan(&exists)
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Database error")
+			return
+		}
+		if !exists {
+			responses.SendErrorResponse(w, http.StatusNotFound, "User not found")
+			return
+		}
+
+		wasLocked, err := guard.Reset(services.AccountKey(userID))
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to unlock account")
+			return
+		}
+
+		ip := utils.ClientIP(r)
+		audit.Record(models.AuditLog{
+			ActorID:   &claims.UserID,
+			UserID:    &userID,
+			Action:    "account.unlocked",
+			IPAddress: &ip,
+			Details:   map[string]interface{}{"wasLocked": wasLocked},
+		})
+
+		responses.SendSuccessResponse(w, http.StatusOK, map[string]string{
+			"message": "Account unlocked successfully",
+		})
+	}
+}
+
+func GetAuditLogs(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := `
+			SELECT id, actor_id, user_id, action, ip_address, details, created_at
+			FROM audit_logs
+			WHERE 1 = 1
+		`
+		args := []interface{}{}
+		argPos := 1
+
+		if userIDStr := r.URL.Query().Get("userId"); userIDStr != "" {
+			userID, err := strconv.Atoi(userIDStr)
+			if err != nil {
+				responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid user ID")
+				return
+			}
+			query += " AND user_id = $" + strconv.Itoa(argPos)
+			args = append(args, userID)
+			argPos++
+		}
+
+		if action := r.URL.Query().Get("action"); action != "" {
+			query += " AND action = $" + strconv.Itoa(argPos)
+			args = append(args, action)
+			argPos++
+		}
+
+		limit := 100
+		if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+			parsed, err := strconv.Atoi(limitStr)
+			if err != nil || parsed <= 0 || parsed > 1000 {
+				responses.SendErrorResponse(w, http.StatusBadRequest, "Limit must be between 1 and 1000")
+				return
+			}
+			limit = parsed
+		}
+
+		query += " ORDER BY created_at DESC LIMIT $" + strconv.Itoa(argPos)
+		args = append(args, limit)
+
+		rows, err := db.Query(query, args...)
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to fetch audit logs")
+			return
+		}
+		defer rows.Close()
+
+		logs := []models.AuditLog{}
+		for rows.Next() {
+			var entry models.AuditLog
+			var actorID, userID sql.NullInt64
+			var ipAddress, details sql.NullString
+			err := rows.Scan(&entry.ID, &actorID, &userID, &entry.Action, &ipAddress, &details, &entry.CreatedAt)
+			if err != nil {
+				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to scan audit log data")
+				return
+			}
+			if actorID.Valid {
+				id := int(actorID.Int64)
+				entry.ActorID = &id
+			}
+			if userID.Valid {
+				id := int(userID.Int64)
+				entry.UserID = &id
+			}
+			if ipAddress.Valid {
+				entry.IPAddress = &ipAddress.String
+			}
+			if details.Valid {
+				_ = json.Unmarshal([]byte(details.String), &entry.Details)
+			}
+			logs = append(logs, entry)
+		}
+
+		responses.SendSuccessResponse(w, http.StatusOK, logs)
+	}
+}
@@ -0,0 +1,341 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"cctv-api/internal/models"
+	"cctv-api/internal/responses"
+	"cctv-api/internal/services"
+	"cctv-api/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// invalidScopeError reports whether err is a foreign key violation on the
+// camera or location a rule or maintenance window points at.
+func invalidScopeError(table string, err error) bool {
+	switch err.Error() {
+	case `pq: insert or update on table "` + table + `" violates foreign key constraint "` + table + `_cctv_id_fkey"`,
+		`pq: insert or update on table "` + table + `" violates foreign key constraint "` + table + `_location_id_fkey"`:
+		return true
+	}
+	return false
+}
+
+func GetAlertRules(alerts *services.AlertService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rules, err := alerts.ListRules()
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to fetch alert rules")
+			return
+		}
+
+		responses.SendSuccessResponse(w, http.StatusOK, rules)
+	}
+}
+
+func CreateAlertRule(alerts *services.AlertService, audit *services.AuditService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(userClaimsKey).(*utils.Claims)
+		if !ok {
+			responses.SendErrorResponse(w, http.StatusUnauthorized, "Invalid user context")
+			return
+		}
+
+		var req models.AlertRuleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		if err := utils.Validate.Struct(req); err != nil {
+			responses.SendValidationError(w, err)
+			return
+		}
+
+		id, err := alerts.CreateRule(req, claims.UserID)
+		if err != nil {
+			if invalidScopeError("alert_rules", err) {
+				responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid CCTV or location ID")
+			} else {
+				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to create alert rule")
+			}
+			return
+		}
+
+		ip := utils.ClientIP(r)
+		audit.Record(models.AuditLog{
+			ActorID:   &claims.UserID,
+			Action:    "alert_rule.created",
+			IPAddress: &ip,
+			Details: map[string]interface{}{
+				"ruleId": id,
+				"name":   req.Name,
+				"scope":  req.Scope,
+			},
+		})
+
+		rule, err := alerts.GetRule(id)
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to fetch alert rule")
+			return
+		}
+
+		responses.SendSuccessResponse(w, http.StatusCreated, rule)
+	}
+}
+
+// UpdateAlertRule replaces a rule. Leave webhookSecret out to keep the
+// current secret.
+func UpdateAlertRule(alerts *services.AlertService, audit *services.AuditService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(userClaimsKey).(*utils.Claims)
+		if !ok {
+			responses.SendErrorResponse(w, http.StatusUnauthorized, "Invalid user context")
+			return
+		}
+
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid alert rule ID")
+			return
+		}
+
+		var req models.AlertRuleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		if err := utils.Validate.Struct(req); err != nil {
+			responses.SendValidationError(w, err)
+			return
+		}
+
+		if err := alerts.UpdateRule(id, req); err != nil {
+			if err == services.ErrAlertRuleNotFound {
+				responses.SendErrorResponse(w, http.StatusNotFound, "Alert rule not found")
+			} else if invalidScopeError("alert_rules", err) {
+				responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid CCTV or location ID")
+			} else {
+				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to update alert rule")
+			}
+			return
+		}
+
+		ip := utils.ClientIP(r)
+		audit.Record(models.AuditLog{
+			ActorID:   &claims.UserID,
+			Action:    "alert_rule.updated",
+			IPAddress: &ip,
+			Details: map[string]interface{}{
+				"ruleId": id,
+				"name":   req.Name,
+				"scope":  req.Scope,
+			},
+		})
+
+		rule, err := alerts.GetRule(id)
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to fetch alert rule")
+			return
+		}
+
+		responses.SendSuccessResponse(w, http.StatusOK, rule)
+	}
+}
+
+func DeleteAlertRule(alerts *services.AlertService, audit *services.AuditService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(userClaimsKey).(*utils.Claims)
+		if !ok {
+			responses.SendErrorResponse(w, http.StatusUnauthorized, "Invalid user context")
+			return
+		}
+
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid alert rule ID")
+			return
+		}
+
+		if err := alerts.DeleteRule(id); err != nil {
+			if err == services.ErrAlertRuleNotFound {
+				responses.SendErrorResponse(w, http.StatusNotFound, "Alert rule not found")
+			} else {
+				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to delete alert rule")
+			}
+			return
+		}
+
+		ip := utils.ClientIP(r)
+		audit.Record(models.AuditLog{
+			ActorID:   &claims.UserID,
+			Action:    "alert_rule.deleted",
+			IPAddress: &ip,
+			Details:   map[string]interface{}{"ruleId": id},
+		})
+
+		responses.SendSuccessResponse(w, http.StatusOK, map[string]string{
+			"message": "Alert rule deleted successfully",
+		})
+	}
+}
+
+// GetMaintenanceWindows lists current and upcoming windows; add ?all=true to
+// include past ones.
+func GetMaintenanceWindows(alerts *services.AlertService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		windows, err := alerts.ListMaintenanceWindows(r.URL.Query().Get("all") == "true")
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to fetch maintenance windows")
+			return
+		}
+
+		responses.SendSuccessResponse(w, http.StatusOK, windows)
+	}
+}
+
+// CreateMaintenanceWindow schedules a window for a camera, a location, or
+// the whole network when neither is given.
+func CreateMaintenanceWindow(alerts *services.AlertService, audit *services.AuditService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(userClaimsKey).(*utils.Claims)
+		if !ok {
+			responses.SendErrorResponse(w, http.StatusUnauthorized, "Invalid user context")
+			return
+		}
+
+		var req models.CreateMaintenanceWindowRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		if err := utils.Validate.Struct(req); err != nil {
+			responses.SendValidationError(w, err)
+			return
+		}
+
+		id, err := alerts.CreateMaintenanceWindow(req, claims.UserID)
+		if err != nil {
+			if invalidScopeError("maintenance_windows", err) {
+				responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid CCTV or location ID")
+			} else {
+				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to create maintenance window")
+			}
+			return
+		}
+
+		ip := utils.ClientIP(r)
+		audit.Record(models.AuditLog{
+			ActorID:   &claims.UserID,
+			Action:    "maintenance_window.created",
+			IPAddress: &ip,
+			Details: map[string]interface{}{
+				"windowId":   id,
+				"cctvId":     req.CCTVID,
+				"locationId": req.LocationID,
+				"startsAt":   req.StartsAt,
+				"endsAt":     req.EndsAt,
+			},
+		})
+
+		responses.SendSuccessResponse(w, http.StatusCreated, map[string]interface{}{
+			"id":      id,
+			"message": "Maintenance window created successfully",
+		})
+	}
+}
+
+func DeleteMaintenanceWindow(alerts *services.AlertService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid maintenance window ID")
+			return
+		}
+
+		if err := alerts.DeleteMaintenanceWindow(id); err != nil {
+			if err == services.ErrMaintenanceWindowNotFound {
+				responses.SendErrorResponse(w, http.StatusNotFound, "Maintenance window not found")
+			} else {
+				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to delete maintenance window")
+			}
+			return
+		}
+
+		responses.SendSuccessResponse(w, http.StatusOK, map[string]string{
+			"message": "Maintenance window deleted successfully",
+		})
+	}
+}
+
+// GetAlertIncidents lists recent incidents; ?open=true limits it to
+// unresolved ones.
+func GetAlertIncidents(alerts *services.AlertService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit := 100
+		if raw := r.URL.Query().Get("limit"); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 1 || n > 1000 {
+				responses.SendErrorResponse(w, http.StatusBadRequest, "limit must be between 1 and 1000")
+				return
+			}
+			limit = n
+		}
+
+		incidents, err := alerts.ListIncidents(r.URL.Query().Get("open") == "true", limit)
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to fetch alert incidents")
+			return
+		}
+
+		responses.SendSuccessResponse(w, http.StatusOK, incidents)
+	}
+}
+
+// AcknowledgeAlertIncident marks an incident as seen; it is announced to
+// live clients as alert.acknowledged.
+func AcknowledgeAlertIncident(alerts *services.AlertService, audit *services.AuditService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(userClaimsKey).(*utils.Claims)
+		if !ok {
+			responses.SendErrorResponse(w, http.StatusUnauthorized, "Invalid user context")
+			return
+		}
+
+		vars := mux.Vars(r)
+		id, err := strconv.ParseInt(vars["id"], 10, 64)
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid incident ID")
+			return
+		}
+
+		if err := alerts.Acknowledge(id, claims.UserID); err != nil {
+			if err == services.ErrAlertIncidentNotFound {
+				responses.SendErrorResponse(w, http.StatusNotFound, "Alert incident not found")
+			} else {
+				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to acknowledge alert incident")
+			}
+			return
+		}
+
+		ip := utils.ClientIP(r)
+		audit.Record(models.AuditLog{
+			ActorID:   &claims.UserID,
+			Action:    "alert_incident.acknowledged",
+			IPAddress: &ip,
+			Details:   map[string]interface{}{"incidentId": id},
+		})
+
+		responses.SendSuccessResponse(w, http.StatusOK, map[string]string{
+			"message": "Alert incident acknowledged",
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"cctv-api/internal/models"
+	"cctv-api/internal/responses"
+	"cctv-api/internal/services"
+	"cctv-api/internal/utils"
+)
+
+// allotmentQuota returns the user's camera quota, writing a response and
+// returning false if the user's plan has no quota to manage.
+func allotmentQuota(w http.ResponseWriter, plans *services.PlanService, userID int) (int, bool) {
+	plan, _, err := plans.UserPlan(userID)
+	if err != nil {
+		responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to get user plan")
+		return 0, false
+	}
+	if !plan.HasCameraQuota() {
+		responses.SendErrorResponse(w, http.StatusForbidden, "Your plan includes every camera")
+		return 0, false
+	}
+	return *plan.CameraQuota, true
+}
+
+func sendAllotmentError(w http.ResponseWriter, userID int, err error) {
+	switch err {
+	case services.ErrAllotmentTooLarge:
+		responses.SendErrorResponse(w, http.StatusBadRequest, "Too many cameras selected for your plan")
+	case services.ErrAllotmentInvalidCCTV:
+		responses.SendErrorResponse(w, http.StatusBadRequest, "Selection contains unknown or inactive cameras")
+	case services.ErrAllotmentNotAllotted:
+		responses.SendErrorResponse(w, http.StatusBadRequest, "Camera to remove is not in your selection")
+	case services.ErrAllotmentAlreadyAdded:
+		responses.SendErrorResponse(w, http.StatusBadRequest, "Camera to add is already in your selection")
+	case services.ErrAllotmentSwapLimit:
+		responses.SendErrorResponse(w, http.StatusTooManyRequests, "Swap limit reached for this period")
+	default:
+		log.Printf("Failed to update camera allotment for user %d: %v", userID, err)
+		responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to update camera selection")
+	}
+}
+
+func GetMyCameras(plans *services.PlanService, allotments *services.AllotmentService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(userClaimsKey).(*utils.Claims)
+		if !ok {
+			responses.SendErrorResponse(w, http.StatusUnauthorized, "Invalid user context")
+			return
+		}
+
+		quota, ok := allotmentQuota(w, plans, claims.UserID)
+		if !ok {
+			return
+		}
+
+		status, err := allotments.Status(claims.UserID, quota)
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to get camera selection")
+			return
+		}
+
+		responses.SendSuccessResponse(w, http.StatusOK, status)
+	}
+}
+
+func SetMyCameras(plans *services.PlanService, allotments *services.AllotmentService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(userClaimsKey).(*utils.Claims)
+		if !ok {
+			responses.SendErrorResponse(w, http.StatusUnauthorized, "Invalid user context")
+			return
+		}
+
+		var req models.SetAllotmentRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		if err := utils.Validate.Struct(req); err != nil {
+			responses.SendValidationError(w, err)
+			return
+		}
+
+		quota, ok := allotmentQuota(w, plans, claims.UserID)
+		if !ok {
+			return
+		}
+
+		if err := allotments.SetSelection(claims.UserID, quota, req.CCTVIDs); err != nil {
+			sendAllotmentError(w, claims.UserID, err)
+			return
+		}
+
+		status, err := allotments.Status(claims.UserID, quota)
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to get camera selection")
+			return
+		}
+
+		responses.SendSuccessResponse(w, http.StatusOK, status)
+	}
+}
+
+func SwapMyCamera(plans *services.PlanService, allotments *services.AllotmentService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(userClaimsKey).(*utils.Claims)
+		if !ok {
+			responses.SendErrorResponse(w, http.StatusUnauthorized, "Invalid user context")
+			return
+		}
+
+		var req models.SwapCCTVRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		if err := utils.Validate.Struct(req); err != nil {
+			responses.SendValidationError(w, err)
+			return
+		}
+
+		quota, ok := allotmentQuota(w, plans, claims.UserID)
+		if !ok {
+			return
+		}
+
+		if err := allotments.Swap(claims.UserID, quota, req.RemoveID, req.AddID); err != nil {
+			sendAllotmentError(w, claims.UserID, err)
+			return
+		}
+
+		status, err := allotments.Status(claims.UserID, quota)
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to get camera selection")
+			return
+		}
+
+		responses.SendSuccessResponse(w, http.StatusOK, status)
+	}
+}
+
+func SetHomeLocation(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(userClaimsKey).(*utils.Claims)
+		if !ok {
+			responses.SendErrorResponse(w, http.StatusUnauthorized, "Invalid user context")
+			return
+		}
+
+		var req models.SetHomeLocationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		_, err := db.Exec("UPDATE users SET home_location_id = $1, updated_at = NOW() WHERE id = $2", req.LocationID, claims.UserID)
+		if err != nil {
+			if err.Error() == `pq: insert or update on table "users" violates foreign key constraint "users_home_location_id_fkey"` {
+				responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid location ID")
+			} else {
+				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to update home location")
+			}
+			return
+		}
+
+		responses.SendSuccessResponse(w, http.StatusOK, map[string]string{
+			"message": "Home location updated successfully",
+		})
+	}
+}
+
+func GetAllotmentSettings(allotments *services.AllotmentService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		settings, err := allotments.Settings()
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to get allotment settings")
+			return
+		}
+
+		responses.SendSuccessResponse(w, http.StatusOK, settings)
+	}
+}
+
+func UpdateAllotmentSettings(allotments *services.AllotmentService, audit *services.AuditService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(userClaimsKey).(*utils.Claims)
+		if !ok {
+			responses.SendErrorResponse(w, http.StatusUnauthorized, "Invalid user context")
+			return
+		}
+
+		var req models.AllotmentSettings
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		if err := utils.Validate.Struct(req); err != nil {
+			responses.SendValidationError(w, err)
+			return
+		}
+
+		if err := allotments.UpdateSettings(req); err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to update allotment settings")
+			return
+		}
+
+		ip := utils.ClientIP(r)
+		audit.Record(models.AuditLog{
+			ActorID:   &claims.UserID,
+			Action:    "settings.allotment_updated",
+			IPAddress: &ip,
+			Details: map[string]interface{}{
+				"strategy":       req.Strategy,
+				"swapsPerPeriod": req.SwapsPerPeriod,
+				"swapPeriodDays": req.SwapPeriodDays,
+			},
+		})
+
+		responses.SendSuccessResponse(w, http.StatusOK, req)
+	}
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"cctv-api/internal/models"
+	"cctv-api/internal/responses"
+	"cctv-api/internal/services"
+	"cctv-api/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+func GetMyAPIKeys(apiKeys *services.APIKeyService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(userClaimsKey).(*utils.Claims)
+		if !ok {
+			responses.SendErrorResponse(w, http.StatusUnauthorized, "Invalid user context")
+			return
+		}
+
+		keys, err := apiKeys.List(claims.UserID)
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to fetch API keys")
+			return
+		}
+
+		responses.SendSuccessResponse(w, http.StatusOK, keys)
+	}
+}
+
+// CreateMyAPIKey issues an API key for integrations such as a media server.
+// The response includes the key; it is not shown again.
+func CreateMyAPIKey(apiKeys *services.APIKeyService, audit *services.AuditService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(userClaimsKey).(*utils.Claims)
+		if !ok {
+			responses.SendErrorResponse(w, http.StatusUnauthorized, "Invalid user context")
+			return
+		}
+
+		var req models.CreateAPIKeyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		if err := utils.Validate.Struct(req); err != nil {
+			responses.SendValidationError(w, err)
+			return
+		}
+
+		key, err := apiKeys.Create(claims.UserID, req)
+		if err != nil {
+			if err == services.ErrTooManyAPIKeys {
+				responses.SendErrorResponse(w, http.StatusConflict, "Too many API keys; revoke one first")
+			} else {
+				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to create API key")
+			}
+			return
+		}
+
+		ip := utils.ClientIP(r)
+		audit.Record(models.AuditLog{
+			ActorID:   &claims.UserID,
+			Action:    "api_key.created",
+			IPAddress: &ip,
+			Details: map[string]interface{}{
+				"apiKeyId": key.ID,
+				"name":     key.Name,
+				"prefix":   key.Prefix,
+			},
+		})
+
+		responses.SendSuccessResponse(w, http.StatusCreated, key)
+	}
+}
+
+func RevokeMyAPIKey(apiKeys *services.APIKeyService, audit *services.AuditService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(userClaimsKey).(*utils.Claims)
+		if !ok {
+			responses.SendErrorResponse(w, http.StatusUnauthorized, "Invalid user context")
+			return
+		}
+
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid API key ID")
+			return
+		}
+
+		if err := apiKeys.Revoke(claims.UserID, id); err != nil {
+			if err == services.ErrAPIKeyNotFound {
+				responses.SendErrorResponse(w, http.StatusNotFound, "API key not found")
+			} else {
+				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to revoke API key")
+			}
+			return
+		}
+
+		ip := utils.ClientIP(r)
+		audit.Record(models.AuditLog{
+			ActorID:   &claims.UserID,
+			Action:    "api_key.revoked",
+			IPAddress: &ip,
+			Details:   map[string]interface{}{"apiKeyId": id},
+		})
+
+		responses.SendSuccessResponse(w, http.StatusOK, map[string]string{
+			"message": "API key revoked",
+		})
+	}
+}
@@ -5,22 +5,40 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"cctv-api/internal/models"
 	"cctv-api/internal/responses"
 	"cctv-api/internal/services"
 	"cctv-api/internal/utils"
+)
 
-	"golang.org/x/crypto/bcrypt"
-	"golang.org/x/time/rate"
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
 )
 
-func Login(db *sql.DB, jwtUtil *utils.JWTUtil) http.HandlerFunc {
+// verifyDummyPassword burns the same hashing time as a real verification so
+// response timing does not reveal whether a username exists.
+func verifyDummyPassword(hasher utils.PasswordHasher, password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = hasher.Hash("dummy-password")
+	})
+	hasher.Verify(dummyHash, password)
+}
+
+func Login(db *sql.DB, jwtUtil *utils.JWTUtil, plans *services.PlanService, sessions *services.SessionService, hasher utils.PasswordHasher,
+	guard *services.LoginGuard, audit *services.AuditService, emailService *services.EmailService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var creds struct {
-			Username string `json:"username"`
-			Password string `json:"password"`
+			Username       string  `json:"username"`
+			Password       string  `json:"password"`
+			DeviceID       string  `json:"deviceId"`
+			DeviceName     *string `json:"deviceName"`
+			DevicePlatform *string `json:"devicePlatform"`
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
@@ -33,41 +51,87 @@ func Login(db *sql.DB, jwtUtil *utils.JWTUtil) http.HandlerFunc {
 			return
 		}
 
+		if creds.DeviceID == "" {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Device ID is required")
+			return
+		}
+
+		ip := utils.ClientIP(r)
+
 		var user models.User
-		var lastLogin sql.NullTime
-		var sessionToken sql.NullString
 		err := db.QueryRow(`
-			SELECT id, username, email, password, name, photo_url, role, account_status, 
-			last_login, session_token
+			SELECT id, username, email, password, name, photo_url, role, account_status
 			FROM users WHERE username = $1 OR email = $1
 		`, creds.Username).Scan(
 			&user.ID, &user.Username, &user.Email, &user.Password,
 			&user.Name, &user.PhotoURL, &user.Role, &user.AccountStatus,
-			&lastLogin, &sessionToken,
 		)
 
-		if err != nil {
-			if err == sql.ErrNoRows {
-				responses.SendErrorResponse(w, http.StatusUnauthorized, "Invalid username or password")
-			} else {
-				responses.SendErrorResponse(w, http.StatusInternalServerError, "Database error")
-			}
+		userFound := err == nil
+		if err != nil && err != sql.ErrNoRows {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Database error")
 			return
 		}
 
-		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(creds.Password)); err != nil {
+		// Unknown logins are tracked and locked exactly like real accounts
+		accountKey := services.LoginNameKey(strings.ToLower(creds.Username))
+		if userFound {
+			accountKey = services.AccountKey(user.ID)
+		}
+		ipKey := services.IPKey(ip)
+
+		if !checkLoginGuard(w, guard, accountKey, ipKey) {
+			return
+		}
+
+		passwordOK, needsRehash := false, false
+		if userFound {
+			passwordOK, needsRehash, err = hasher.Verify(user.Password, creds.Password)
+			if err != nil {
+				log.Printf("Failed to verify password hash for user %d: %v", user.ID, err)
+			}
+		} else {
+			verifyDummyPassword(hasher, creds.Password)
+		}
+
+		if !passwordOK {
+			recordLoginFailure(guard, audit, emailService, accountKey, ipKey, ip, userFound, user)
 			responses.SendErrorResponse(w, http.StatusUnauthorized, "Invalid username or password")
 			return
 		}
 
-		// Check if user is already logged in
-		if lastLogin.Valid && sessionToken.Valid {
-			// Check if token is still valid
-			_, err := jwtUtil.ValidateToken(sessionToken.String)
-			if err == nil {
-				responses.SendErrorResponse(w, http.StatusConflict, "User already logged in on another device")
-				return
+		if _, err := guard.Reset(accountKey); err != nil {
+			log.Printf("Failed to reset login failures for user %d: %v", user.ID, err)
+		}
+
+		// Upgrade hashes made with an old algorithm or old cost parameters
+		if needsRehash {
+			if rehashed, err := hasher.Hash(creds.Password); err != nil {
+				log.Printf("Failed to rehash password for user %d: %v", user.ID, err)
+			} else if _, err := db.Exec("UPDATE users SET password = $1 WHERE id = $2", rehashed, user.ID); err != nil {
+				log.Printf("Failed to store rehashed password for user %d: %v", user.ID, err)
+			}
+		}
+
+		plan, sub, err := plans.UserPlan(user.ID)
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to get subscription")
+			return
+		}
+
+		err = bindDevice(db, user.ID, plan.DeviceLimit, deviceInfo{
+			DeviceID:   creds.DeviceID,
+			DeviceName: creds.DeviceName,
+			Platform:   creds.DevicePlatform,
+		})
+		if err != nil {
+			if err == errDeviceLimitReached {
+				responses.SendErrorResponse(w, http.StatusForbidden, "Account is bound to another device. Request a device reset to use this device.")
+			} else {
+				log.Printf("Failed to bind device for user %d: %v", user.ID, err)
+				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to bind device")
 			}
+			return
 		}
 
 		token, err := jwtUtil.GenerateToken(user.ID, user.Role)
@@ -76,13 +140,19 @@ func Login(db *sql.DB, jwtUtil *utils.JWTUtil) http.HandlerFunc {
 			return
 		}
 
-		// Update last login and session token
 		now := time.Now()
-		_, err = db.Exec(`
-			UPDATE users 
-			SET last_login = $1, session_token = $2 
-			WHERE id = $3
-		`, now, token, user.ID)
+		err = sessions.Start(user.ID, creds.DeviceID, token, now.Add(jwtUtil.Expiration()))
+		if err != nil {
+			if err == services.ErrSessionLimitReached {
+				responses.SendErrorResponse(w, http.StatusConflict, "Your plan's limit of devices signed in at once is reached. Log out on another device first.")
+			} else {
+				log.Printf("Failed to start session for user %d: %v", user.ID, err)
+				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to start session")
+			}
+			return
+		}
+
+		_, err = db.Exec("UPDATE users SET last_login = $1 WHERE id = $2", now, user.ID)
 		if err != nil {
 			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to update login status")
 			return
@@ -95,7 +165,10 @@ func Login(db *sql.DB, jwtUtil *utils.JWTUtil) http.HandlerFunc {
 			Name:          user.Name,
 			PhotoURL:      user.PhotoURL,
 			Role:          user.Role,
-			AccountStatus: user.AccountStatus,
+			AccountStatus: plan.Name,
+		}
+		if sub != nil {
+			userResponse.SubscriptionExpiresAt = sub.ExpiresAt
 		}
 
 		responses.SendSuccessResponse(w, http.StatusOK, map[string]interface{}{
@@ -105,12 +178,63 @@ func Login(db *sql.DB, jwtUtil *utils.JWTUtil) http.HandlerFunc {
 	}
 }
 
-func Register(db *sql.DB) http.HandlerFunc {
+// checkLoginGuard answers 429 and returns false while any of keys is locked
+// out or backing off.
+func checkLoginGuard(w http.ResponseWriter, guard *services.LoginGuard, keys ...string) bool {
+	retryAfter, err := guard.RetryAfter(keys...)
+	if err != nil {
+		responses.SendErrorResponse(w, http.StatusInternalServerError, "Database error")
+		return false
+	}
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(retryAfter.Seconds())))
+		responses.SendErrorResponse(w, http.StatusTooManyRequests, "Too many failed login attempts. Please try again later.")
+		return false
+	}
+	return true
+}
+
+func recordLoginFailure(guard *services.LoginGuard, audit *services.AuditService, emailService *services.EmailService,
+	accountKey, ipKey, ip string, userFound bool, user models.User) {
+	// Without an account key (an unknown reset token) only the IP is charged
+	if accountKey != "" {
+		failure, err := guard.RecordFailure(accountKey, false)
+		if err != nil {
+			log.Printf("Failed to record login failure for %s: %v", accountKey, err)
+		} else if failure.Locked && userFound {
+			audit.Record(models.AuditLog{
+				UserID:    &user.ID,
+				Action:    "account.locked",
+				IPAddress: &ip,
+				Details:   map[string]interface{}{"lockedUntil": failure.LockedUntil},
+			})
+			// Sent in the background so response timing matches unknown accounts
+			go func() {
+				if err := emailService.SendLockoutEmail(user.Email, failure.LockedUntil); err != nil {
+					log.Printf("Failed to send lockout email to user %d: %v", user.ID, err)
+				}
+			}()
+		}
+	}
+
+	ipFailure, err := guard.RecordFailure(ipKey, true)
+	if err != nil {
+		log.Printf("Failed to record login failure for %s: %v", ipKey, err)
+	} else if ipFailure.Locked {
+		audit.Record(models.AuditLog{
+			Action:    "ip.locked",
+			IPAddress: &ip,
+			Details:   map[string]interface{}{"lockedUntil": ipFailure.LockedUntil},
+		})
+	}
+}
+
+func Register(db *sql.DB, hasher utils.PasswordHasher, policy utils.PasswordPolicy) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var user struct {
 			Username string  `json:"username" validate:"required"`
 			Email    string  `json:"email" validate:"required,email"`
-			Password string  `json:"password" validate:"required,min=8"`
+			Password string  `json:"password" validate:"required"`
 			Name     string  `json:"name" validate:"required"`
 			PhotoURL *string `json:"photoUrl"`
 		}
@@ -121,12 +245,23 @@ func Register(db *sql.DB) http.HandlerFunc {
 		}
 
 		// Validasi input
-		if len(user.Password) < 8 {
-			responses.SendErrorResponse(w, http.StatusBadRequest, "Password must be at least 8 characters")
+		if err := utils.Validate.Struct(user); err != nil {
+			responses.SendValidationError(w, err)
 			return
 		}
 
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+		policyErrors, err := policy.Check(user.Password, user.Username, user.Email)
+		if err != nil {
+			log.Printf("Failed to check password policy: %v", err)
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to validate password")
+			return
+		}
+		if len(policyErrors) > 0 {
+			responses.SendValidationErrors(w, policyErrors)
+			return
+		}
+
+		hashedPassword, err := hasher.Hash(user.Password)
 		if err != nil {
 			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to hash password: "+err.Error())
 			return
@@ -142,8 +277,8 @@ func Register(db *sql.DB) http.HandlerFunc {
 
 		_, err = db.Exec(`
 			INSERT INTO users (username, email, password, name, photo_url, role, account_status) 
-			VALUES ($1, $2, $3, $4, $5, 'user', 'free')
-		`, user.Username, user.Email, string(hashedPassword), user.Name, photoUrl)
+			VALUES ($1, $2, $3, $4, $5, 'user', (SELECT name FROM plans WHERE is_default))
+		`, user.Username, user.Email, hashedPassword, user.Name, photoUrl)
 
 		if err != nil {
 			// Log error lengkap untuk debugging
@@ -166,7 +301,9 @@ func Register(db *sql.DB) http.HandlerFunc {
 	}
 }
 
-func UpgradeAccount(db *sql.DB) http.HandlerFunc {
+// UpgradeAccount starts a plan purchase. The account is upgraded later, when
+// the payment provider confirms settlement through the webhook.
+func UpgradeAccount(paymentService *services.PaymentService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		claims, ok := r.Context().Value(userClaimsKey).(*utils.Claims)
 		if !ok {
@@ -175,44 +312,38 @@ func UpgradeAccount(db *sql.DB) http.HandlerFunc {
 		}
 		userID := claims.UserID
 
-		result, err := db.Exec(`
-            UPDATE users 
-            SET account_status = 'paid', 
-                fixed_cctv_ids = NULL, 
-                updated_at = NOW()
-            WHERE id = $1
-        `, userID)
-
-		if err != nil {
-			log.Printf("Error upgrading account for user %d: %v", userID, err)
-			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to upgrade account")
-			return
+		var req struct {
+			Plan string `json:"plan"`
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+				return
+			}
+		}
+		if req.Plan == "" {
+			req.Plan = "paid"
 		}
 
-		rowsAffected, _ := result.RowsAffected()
-		if rowsAffected == 0 {
-			responses.SendErrorResponse(w, http.StatusNotFound, "User not found")
+		order, err := paymentService.CreateOrder(userID, req.Plan)
+		if err != nil {
+			if err == services.ErrPlanNotFound || err == services.ErrPlanNotPurchasable {
+				responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid plan")
+			} else {
+				log.Printf("Error creating upgrade order for user %d: %v", userID, err)
+				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to create order")
+			}
 			return
 		}
 
-		responses.SendSuccessResponse(w, http.StatusOK, map[string]string{
-			"message": "Account upgraded to paid successfully. You now have access to all CCTVs.",
+		responses.SendSuccessResponse(w, http.StatusCreated, map[string]interface{}{
+			"message":     "Order created. Complete the payment to upgrade your account.",
+			"order":       order,
+			"checkoutUrl": order.CheckoutURL,
 		})
 	}
 }
 
-func RateLimitMiddleware(limiter *rate.Limiter) func(http.HandlerFunc) http.HandlerFunc {
-	return func(next http.HandlerFunc) http.HandlerFunc {
-		return func(w http.ResponseWriter, r *http.Request) {
-			if !limiter.Allow() {
-				responses.SendErrorResponse(w, http.StatusTooManyRequests, "Too many requests. Please try again later.")
-				return
-			}
-			next(w, r)
-		}
-	}
-}
-
 func RequestDeviceReset(db *sql.DB, emailService *services.EmailService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req models.ResetRequest
@@ -221,16 +352,21 @@ func RequestDeviceReset(db *sql.DB, emailService *services.EmailService) http.Ha
 			return
 		}
 
-		// Check if email exists
+		// Unknown emails get the same answer, so the endpoint does not reveal
+		// which addresses have accounts
+		submitted := map[string]string{
+			"message": "If the email belongs to an account, a reset link has been sent. Please check your email for instructions.",
+		}
+
 		var userID int
 		var username string
 		err := db.QueryRow("SELECT id, username FROM users WHERE email = $1", req.Email).Scan(&userID, &username)
+		if err == sql.ErrNoRows {
+			responses.SendSuccessResponse(w, http.StatusOK, submitted)
+			return
+		}
 		if err != nil {
-			if err == sql.ErrNoRows {
-				responses.SendErrorResponse(w, http.StatusNotFound, "Email not found")
-			} else {
-				responses.SendErrorResponse(w, http.StatusInternalServerError, "Database error")
-			}
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Database error")
 			return
 		}
 
@@ -249,22 +385,24 @@ func RequestDeviceReset(db *sql.DB, emailService *services.EmailService) http.Ha
 			return
 		}
 
-		// Send email
-		err = emailService.SendResetEmail(req.Email, resetToken)
-		if err != nil {
-			// Rollback the token if email fails
-			db.Exec("UPDATE users SET reset_requested = false, reset_token = NULL, reset_token_expiry = NULL WHERE id = $1", userID)
-			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to send reset email")
-			return
-		}
+		// Sent in the background so response timing matches unknown emails
+		go func() {
+			if err := emailService.SendResetEmail(req.Email, resetToken); err != nil {
+				log.Printf("Failed to send reset email to user %d: %v", userID, err)
+				// Rollback the token if email fails
+				db.Exec("UPDATE users SET reset_requested = false, reset_token = NULL, reset_token_expiry = NULL WHERE id = $1", userID)
+			}
+		}()
 
-		responses.SendSuccessResponse(w, http.StatusOK, map[string]string{
-			"message": "Reset request submitted. Please check your email for instructions.",
-		})
+		responses.SendSuccessResponse(w, http.StatusOK, submitted)
 	}
 }
 
-func ConfirmDeviceReset(db *sql.DB) http.HandlerFunc {
+// ConfirmDeviceReset checks the password like Login does, so it sits behind
+// the same lockout: wrong passwords and unknown tokens count as failed
+// logins.
+func ConfirmDeviceReset(db *sql.DB, hasher utils.PasswordHasher,
+	guard *services.LoginGuard, audit *services.AuditService, emailService *services.EmailService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req models.ResetPassword
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -272,47 +410,61 @@ func ConfirmDeviceReset(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		ip := utils.ClientIP(r)
+		ipKey := services.IPKey(ip)
+		if !checkLoginGuard(w, guard, ipKey) {
+			return
+		}
+
 		// Verify token and get user info
-		var userID int
+		var user models.User
 		var expiry time.Time
-		var email string
 		err := db.QueryRow(`
-			SELECT id, reset_token_expiry, email 
+			SELECT id, reset_token_expiry, email, password
 			FROM users 
 			WHERE reset_token = $1 AND reset_requested = true
-		`, req.Token).Scan(&userID, &expiry, &email)
+		`, req.Token).Scan(&user.ID, &expiry, &user.Email, &user.Password)
 
 		if err != nil {
 			if err == sql.ErrNoRows {
+				recordLoginFailure(guard, audit, emailService, "", ipKey, ip, false, user)
 				responses.SendErrorResponse(w, http.StatusNotFound, "Invalid or expired reset token")
 			} else {
 				responses.SendErrorResponse(w, http.StatusInternalServerError, "Database error")
 			}
 			return
 		}
+		userID := user.ID
 
 		if time.Now().After(expiry) {
 			responses.SendErrorResponse(w, http.StatusBadRequest, "Reset token has expired")
 			return
 		}
 
-		// Verify password
-		var hashedPassword string
-		err = db.QueryRow("SELECT password FROM users WHERE id = $1", userID).Scan(&hashedPassword)
-		if err != nil {
-			responses.SendErrorResponse(w, http.StatusInternalServerError, "Database error")
+		accountKey := services.AccountKey(userID)
+		if !checkLoginGuard(w, guard, accountKey, ipKey) {
 			return
 		}
 
-		if err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(req.Password)); err != nil {
+		if ok, _, _ := hasher.Verify(user.Password, req.Password); !ok {
+			recordLoginFailure(guard, audit, emailService, accountKey, ipKey, ip, true, user)
 			responses.SendErrorResponse(w, http.StatusUnauthorized, "Invalid password")
 			return
 		}
 
-		// Clear device ID and reset flags
+		if _, err := guard.Reset(accountKey); err != nil {
+			log.Printf("Failed to reset login failures for user %d: %v", userID, err)
+		}
+
+		// Clear device bindings so the next device can claim the account
+		if err := clearDeviceBindings(db, userID, ""); err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to reset device")
+			return
+		}
+
 		_, err = db.Exec(`
 			UPDATE users 
-			SET device_id = NULL, reset_requested = false, reset_token = NULL, reset_token_expiry = NULL
+			SET reset_requested = false, reset_token = NULL, reset_token_expiry = NULL
 			WHERE id = $1
 		`, userID)
 
@@ -326,22 +478,16 @@ func ConfirmDeviceReset(db *sql.DB) http.HandlerFunc {
 		})
 	}
 }
-func Logout(db *sql.DB) http.HandlerFunc {
+func Logout(sessions *services.SessionService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		claims, ok := r.Context().Value(userClaimsKey).(*utils.Claims)
+		token, ok := r.Context().Value(sessionTokenKey).(string)
 		if !ok {
 			responses.SendErrorResponse(w, http.StatusUnauthorized, "Invalid user context")
 			return
 		}
-		userID := claims.UserID
 
-		// Clear session token
-		_, err := db.Exec(`
-			UPDATE users 
-			SET session_token = NULL 
-			WHERE id = $1
-		`, userID)
-		if err != nil {
+		// Only this device's session ends
+		if err := sessions.End(token); err != nil {
 			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to logout")
 			return
 		}
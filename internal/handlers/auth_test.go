@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cctv-api/internal/config"
+	"cctv-api/internal/services"
+	"cctv-api/internal/utils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var userColumnNames = []string{"id", "username", "email", "password", "name", "photo_url", "role", "account_status"}
+
+func loginHandler(db *sql.DB) http.HandlerFunc {
+	plans := services.NewPlanService(db)
+	return Login(db, utils.NewJWTUtil("secret", time.Hour, db), plans, services.NewSessionService(db, plans), testHasher{},
+		newTestLoginGuard(db), services.NewAuditService(db), services.NewEmailService(&config.Config{}))
+}
+
+func loginRequest(password, deviceID string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/api/auth/login",
+		strings.NewReader(`{"username":"alice","password":"`+password+`","deviceId":"`+deviceID+`"}`))
+	r.RemoteAddr = "203.0.113.7:50000"
+	return r
+}
+
+// expectCredentials expects alice's lookup and a clean failure history.
+func expectCredentials(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(`FROM users WHERE username = \$1 OR email = \$1`).WithArgs("alice").
+		WillReturnRows(sqlmock.NewRows(userColumnNames).
+			AddRow(7, "alice", "alice@example.com", "hash:s3cret", "Alice", nil, "user", "free"))
+	mock.ExpectQuery(`FROM login_failures`).WithArgs("user:7").WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(`FROM login_failures`).WithArgs("ip:203.0.113.7").WillReturnError(sql.ErrNoRows)
+}
+
+// expectBinding expects tablet to be bound, or refused when the account is
+// at its device limit.
+func expectBinding(mock sqlmock.Sqlmock, bound bool, otherBound, deviceLimit int) {
+	mock.ExpectBegin()
+	mock.ExpectExec(`FOR UPDATE`).WillReturnResult(sqlmock.NewResult(0, 1))
+	if bound {
+		mock.ExpectExec(`UPDATE user_devices`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		return
+	}
+	mock.ExpectExec(`UPDATE user_devices`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM user_devices`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(otherBound))
+	if otherBound < deviceLimit {
+		mock.ExpectExec(`INSERT INTO user_devices`).WithArgs(7, "tablet", nil, nil).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+	} else {
+		mock.ExpectRollback()
+	}
+}
+
+// expectSessionStart expects a session to be started on tablet while
+// otherSessions are live elsewhere.
+func expectSessionStart(mock sqlmock.Sqlmock, otherSessions, deviceLimit, concurrentSessions int) {
+	mock.ExpectBegin()
+	mock.ExpectExec(`SELECT id FROM users WHERE id = \$1 FOR UPDATE`).WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 1))
+	expectDefaultPlan(mock, deviceLimit, concurrentSessions)
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM user_sessions`).WithArgs(7, "tablet").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(otherSessions))
+	if otherSessions >= concurrentSessions {
+		mock.ExpectRollback()
+		return
+	}
+	mock.ExpectExec(`INSERT INTO user_sessions`).WithArgs(7, "tablet", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`DELETE FROM user_sessions WHERE user_id = \$1 AND expires_at <= NOW\(\)`).WithArgs(7).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+}
+
+func TestLoginDeviceAndSessionLimits(t *testing.T) {
+	tests := []struct {
+		name               string
+		deviceLimit        int
+		concurrentSessions int
+		bound              bool // the device logging in is already bound
+		otherBound         int  // devices bound besides it
+		otherSessions      int  // live sessions on other devices
+		wantStatus         int
+	}{
+		{name: "first device", deviceLimit: 1, concurrentSessions: 1, wantStatus: http.StatusOK},
+		{name: "same device signs in again", deviceLimit: 1, concurrentSessions: 1, bound: true, wantStatus: http.StatusOK},
+		{name: "second device within both limits", deviceLimit: 3, concurrentSessions: 2, otherBound: 1, otherSessions: 1, wantStatus: http.StatusOK},
+		{name: "bound device while another is signed in", deviceLimit: 2, concurrentSessions: 2, bound: true, otherBound: 1, otherSessions: 1, wantStatus: http.StatusOK},
+		{name: "bound device over the session limit", deviceLimit: 3, concurrentSessions: 2, bound: true, otherBound: 2, otherSessions: 2, wantStatus: http.StatusConflict},
+		{name: "second device over the device limit", deviceLimit: 1, concurrentSessions: 3, otherBound: 1, wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			expectCredentials(mock)
+			mock.ExpectQuery(`DELETE FROM login_failures`).WithArgs("user:7").WillReturnError(sql.ErrNoRows)
+			expectDefaultPlan(mock, tt.deviceLimit, tt.concurrentSessions)
+			expectBinding(mock, tt.bound, tt.otherBound, tt.deviceLimit)
+			if tt.wantStatus != http.StatusForbidden {
+				expectSessionStart(mock, tt.otherSessions, tt.deviceLimit, tt.concurrentSessions)
+			}
+			if tt.wantStatus == http.StatusOK {
+				mock.ExpectExec(`UPDATE users SET last_login`).WithArgs(sqlmock.AnyArg(), 7).WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+
+			rec := httptest.NewRecorder()
+			loginHandler(db)(rec, loginRequest("s3cret", "tablet"))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus == http.StatusOK {
+				data, _ := decodeResponse(t, rec)["data"].(map[string]interface{})
+				if token, _ := data["token"].(string); token == "" {
+					t.Errorf("response %s carries no token", rec.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestLoginValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"not JSON", "username=alice"},
+		{"missing password", `{"username":"alice","deviceId":"tablet"}`},
+		{"missing device", `{"username":"alice","password":"s3cret"}`},
+	}
+
+	for _, tt := range tests {
+		db, _ := newMockDB(t)
+		rec := httptest.NewRecorder()
+		loginHandler(db)(rec, httptest.NewRequest(http.MethodPost, "/api/auth/login", strings.NewReader(tt.body)))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", tt.name, rec.Code)
+		}
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	failureColumns := []string{"failure_count", "last_failed_at", "locked_until"}
+	now := time.Now()
+
+	t.Run("locked account refused before the password is checked", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		mock.ExpectQuery(`FROM users WHERE username = \$1 OR email = \$1`).WithArgs("alice").
+			WillReturnRows(sqlmock.NewRows(userColumnNames).
+				AddRow(7, "alice", "alice@example.com", "hash:s3cret", "Alice", nil, "user", "free"))
+		mock.ExpectQuery(`FROM login_failures`).WithArgs("user:7").
+			WillReturnRows(sqlmock.NewRows(failureColumns).AddRow(3, now, now.Add(10*time.Minute)))
+		mock.ExpectQuery(`FROM login_failures`).WithArgs("ip:203.0.113.7").WillReturnError(sql.ErrNoRows)
+
+		rec := httptest.NewRecorder()
+		loginHandler(db)(rec, loginRequest("s3cret", "tablet"))
+
+		if rec.Code != http.StatusTooManyRequests {
+			t.Fatalf("status %d, want 429: %s", rec.Code, rec.Body.String())
+		}
+		if got := rec.Header().Get("Retry-After"); got != "600" && got != "599" {
+			t.Errorf("Retry-After = %q, want about 600", got)
+		}
+	})
+
+	t.Run("locked IP refused for unknown logins too", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		mock.ExpectQuery(`FROM users WHERE username = \$1 OR email = \$1`).WithArgs("alice").WillReturnError(sql.ErrNoRows)
+		mock.ExpectQuery(`FROM login_failures`).WithArgs("name:alice").WillReturnError(sql.ErrNoRows)
+		mock.ExpectQuery(`FROM login_failures`).WithArgs("ip:203.0.113.7").
+			WillReturnRows(sqlmock.NewRows(failureColumns).AddRow(10, now, now.Add(time.Minute)))
+
+		rec := httptest.NewRecorder()
+		loginHandler(db)(rec, loginRequest("s3cret", "tablet"))
+
+		if rec.Code != http.StatusTooManyRequests {
+			t.Errorf("status %d, want 429: %s", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("failure at the limit locks the account", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		expectCredentials(mock)
+		mock.ExpectBegin()
+		mock.ExpectExec(`INSERT INTO login_failures`).WithArgs("user:7").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(`FOR UPDATE`).WithArgs("user:7").
+			WillReturnRows(sqlmock.NewRows(failureColumns).AddRow(2, now.Add(-time.Minute), nil))
+		mock.ExpectExec(`UPDATE login_failures`).WithArgs(3, sqlmock.AnyArg(), sqlmock.AnyArg(), "user:7").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectExec(`INSERT INTO audit_logs`).WithArgs(nil, 7, "account.locked", "203.0.113.7", sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectBegin()
+		mock.ExpectExec(`INSERT INTO login_failures`).WithArgs("ip:203.0.113.7").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(`FOR UPDATE`).WithArgs("ip:203.0.113.7").
+			WillReturnRows(sqlmock.NewRows(failureColumns).AddRow(0, nil, nil))
+		mock.ExpectExec(`UPDATE login_failures`).WithArgs(1, sqlmock.AnyArg(), nil, "ip:203.0.113.7").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		rec := httptest.NewRecorder()
+		loginHandler(db)(rec, loginRequest("wrong", "tablet"))
+
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("status %d, want 401: %s", rec.Code, rec.Body.String())
+		}
+	})
+}
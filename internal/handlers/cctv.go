@@ -3,167 +3,359 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"log"
 	"net/http"
 	"strconv"
-	"log"
+	"strings"
+	"time"
+
+	"cctv-api/internal/events"
+	"cctv-api/internal/health"
 	"cctv-api/internal/models"
+	"cctv-api/internal/playback"
 	"cctv-api/internal/responses"
+	"cctv-api/internal/services"
 	"cctv-api/internal/utils"
 
 	"github.com/gorilla/mux"
 	"github.com/lib/pq"
 )
 
-func GetAllCCTVs(db *sql.DB) http.HandlerFunc {
-    return func(w http.ResponseWriter, r *http.Request) {
-        claims, ok := r.Context().Value(userClaimsKey).(*utils.Claims)
-        if !ok {
-            responses.SendErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
-            return
-        }
-        userID := claims.UserID
-
-        // Ambil account_status dan fixed_cctv_ids
-        var accountStatus string
-        var fixedIDs []int
-        var fixedIDsRaw sql.NullString
-
-        err := db.QueryRow(`SELECT account_status, fixed_cctv_ids FROM users WHERE id = $1`, userID).
-            Scan(&accountStatus, &fixedIDsRaw)
-        if err != nil {
-            responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to get user info")
-            return
-        }
-
-        // Decode fixed_cctv_ids jika ada
-        if fixedIDsRaw.Valid {
-            _ = json.Unmarshal([]byte(fixedIDsRaw.String), &fixedIDs)
-        }
-
-        // Jika akun free dan belum punya fixed_cctv_ids → generate dan simpan
-        if accountStatus == "free" && len(fixedIDs) == 0 {
-            rows, err := db.Query(`SELECT id FROM cctvs WHERE is_active = true ORDER BY RANDOM() LIMIT 10`)
-            if err != nil {
-                responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to fetch random CCTVs")
-                return
-            }
-            defer rows.Close()
-
-            for rows.Next() {
-                var id int
-                if err := rows.Scan(&id); err != nil {
-                    responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to scan CCTV ID")
-                    return
-                }
-                fixedIDs = append(fixedIDs, id)
-            }
-
-            if len(fixedIDs) > 0 {
-                fixedJSON, _ := json.Marshal(fixedIDs)
-                _, err = db.Exec(`UPDATE users SET fixed_cctv_ids = $1 WHERE id = $2`, string(fixedJSON), userID)
-                if err != nil {
-                    log.Printf("Failed to save fixed_cctv_ids: %v", err)
-                }
-            }
-        }
-
-        // Base query
-        query := `
-            SELECT 
-                c.id, c.name, c.thumbnail_url, c.source_url, c.is_active, c.created_at, c.updated_at,
-                l.id as location_id, l.name as location_name
-            FROM cctvs c
-            JOIN locations l ON c.location_id = l.id
-            WHERE c.is_active = true
-        `
-        args := []interface{}{}
-        argPos := 1
-
-        // Filter untuk akun free
-        if accountStatus == "free" {
-            if len(fixedIDs) == 0 {
-                responses.SendSuccessResponse(w, http.StatusOK, []models.CCTV{})
-                return
-            }
-
-            query += " AND c.id = ANY($" + strconv.Itoa(argPos) + ")"
-            args = append(args, pq.Array(fixedIDs))
-            argPos++
-        }
-
-        // Filter locationID
-        locationID := r.URL.Query().Get("locationId")
-        if locationID != "" {
-            query += " AND l.id = $" + strconv.Itoa(argPos)
-            args = append(args, locationID)
-            argPos++
-        }
-
-        query += " ORDER BY l.name ASC, c.name ASC"
-
-        // Eksekusi dan scan data
-        rows, err := db.Query(query, args...)
-        if err != nil {
-            responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to fetch CCTVs: "+err.Error())
-            return
-        }
-        defer rows.Close()
-
-        var cctvs []models.CCTV
-        for rows.Next() {
-            var cctv models.CCTV
-            var thumbnail sql.NullString
-            var loc models.Location
-            err := rows.Scan(&cctv.ID, &cctv.Name, &thumbnail, &cctv.SourceURL, &cctv.IsActive, 
-                &cctv.CreatedAt, &cctv.UpdatedAt, &loc.ID, &loc.Name)
-            if err != nil {
-                responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to scan CCTV data")
-                return
-            }
-            if thumbnail.Valid {
-                cctv.ThumbnailURL = &thumbnail.String
-            }
-            cctv.Location = &loc
-            cctvs = append(cctvs, cctv)
-        }
-
-        responses.SendSuccessResponse(w, http.StatusOK, cctvs)
-    }
+const healthColumns = "c.health_status, c.health_latency_ms, c.health_detail, c.health_checked_at, c.health_changed_at"
+
+// healthScan holds the nullable health columns of a CCTV row.
+type healthScan struct {
+	status    sql.NullString
+	latencyMs sql.NullInt64
+	detail    sql.NullString
+	checkedAt sql.NullTime
+	changedAt sql.NullTime
 }
 
+func (h *healthScan) dest() []interface{} {
+	return []interface{}{&h.status, &h.latencyMs, &h.detail, &h.checkedAt, &h.changedAt}
+}
 
-func GetCCTVByID(db *sql.DB) http.HandlerFunc {
+func (h *healthScan) value() models.StreamHealth {
+	health := models.StreamHealth{Status: "unknown"}
+	if h.status.Valid {
+		health.Status = h.status.String
+	}
+	if h.latencyMs.Valid {
+		ms := int(h.latencyMs.Int64)
+		health.LatencyMs = &ms
+	}
+	if h.detail.Valid {
+		health.Detail = &h.detail.String
+	}
+	if h.checkedAt.Valid {
+		health.CheckedAt = &h.checkedAt.Time
+	}
+	if h.changedAt.Valid {
+		health.ChangedAt = &h.changedAt.Time
+	}
+	return health
+}
+
+const activityColumns = "c.activity_score, c.activity_motion, c.activity_measured_at, c.last_motion_at"
+
+// activityScan holds the nullable activity columns of a CCTV row.
+type activityScan struct {
+	score        sql.NullFloat64
+	motion       bool
+	measuredAt   sql.NullTime
+	lastMotionAt sql.NullTime
+}
+
+func (a *activityScan) dest() []interface{} {
+	return []interface{}{&a.score, &a.motion, &a.measuredAt, &a.lastMotionAt}
+}
+
+func (a *activityScan) value() models.CCTVActivity {
+	activity := models.CCTVActivity{Motion: a.motion}
+	if a.score.Valid {
+		activity.Score = &a.score.Float64
+	}
+	if a.measuredAt.Valid {
+		activity.MeasuredAt = &a.measuredAt.Time
+	}
+	if a.lastMotionAt.Valid {
+		activity.LastMotionAt = &a.lastMotionAt.Time
+	}
+	return activity
+}
+
+// cctvListOrders are the orderings of the camera list by ?sort=. Activity
+// comes most active first and cameras never measured last.
+var cctvListOrders = map[string]string{
+	"location":     "l.name ASC, c.name ASC",
+	"name":         "c.name ASC, l.name ASC",
+	"activity":     "c.activity_score DESC NULLS LAST, l.name ASC, c.name ASC",
+	"lastMotionAt": "c.last_motion_at DESC NULLS LAST, l.name ASC, c.name ASC",
+}
+
+// sourceScan holds the nullable, type-specific source columns of a CCTV row.
+type sourceScan struct {
+	rtspTransport  sql.NullString
+	refreshSeconds sql.NullInt64
+}
+
+func (s *sourceScan) apply(cctv *models.CCTV) {
+	if s.rtspTransport.Valid {
+		cctv.RTSPTransport = &s.rtspTransport.String
+	}
+	if s.refreshSeconds.Valid {
+		seconds := int(s.refreshSeconds.Int64)
+		cctv.SnapshotRefreshSeconds = &seconds
+	}
+}
+
+func GetAllCCTVs(db *sql.DB, plans *services.PlanService, allotments *services.AllotmentService, streams *services.StreamService, signer *playback.Signer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		vars := mux.Vars(r)
-		id, err := strconv.Atoi(vars["id"])
+		claims, ok := r.Context().Value(userClaimsKey).(*utils.Claims)
+		if !ok {
+			responses.SendErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		userID := claims.UserID
+
+		plan, _, err := plans.UserPlan(userID)
 		if err != nil {
-			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid CCTV ID")
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to get user info")
 			return
 		}
 
-		var cctv models.CCTV
-		var thumbnailUrl sql.NullString
-		var loc models.Location
+		// Plan dengan kuota kamera hanya melihat kamera yang dialokasikan
+		var fixedIDs []int
+		if plan.HasCameraQuota() {
+			fixedIDs, err = allotments.Ensure(userID, *plan.CameraQuota)
+			if err != nil {
+				log.Printf("Failed to get camera allotment for user %d: %v", userID, err)
+				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to get user info")
+				return
+			}
+		}
 
-		err = db.QueryRow(`
+		// Kualitas stream (main, sub, snapshot) dibatasi oleh plan
+		requested, ok := parseQuality(r)
+		if !ok {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid quality; use main, sub or snapshot")
+			return
+		}
+		quality := capQuality(requested, planQuality(claims, plan))
+
+		// Base query
+		query := `
 			SELECT 
-				c.id, c.name, c.thumbnail_url, c.source_url, c.is_active, c.created_at, c.updated_at,
-				l.id as location_id, l.name as location_name
+				c.id, c.name, c.thumbnail_url, c.source_url, c.source_type, c.rtsp_transport, c.snapshot_refresh_seconds, c.media_path, c.is_active, c.created_at, c.updated_at,
+				l.id as location_id, l.name as location_name, ` + healthColumns + `, ` + activityColumns + `
 			FROM cctvs c
 			JOIN locations l ON c.location_id = l.id
-			WHERE c.id = $1
-		`, id).Scan(
-			&cctv.ID,
-			&cctv.Name,
-			&thumbnailUrl,
-			&cctv.SourceURL,
-			&cctv.IsActive,
-			&cctv.CreatedAt,
-			&cctv.UpdatedAt,
-			&loc.ID,
-			&loc.Name,
-		)
+			WHERE c.is_active = true
+		`
+		args := []interface{}{}
+		argPos := 1
+
+		// Filter untuk plan dengan kuota kamera
+		if plan.HasCameraQuota() {
+			if len(fixedIDs) == 0 {
+				responses.SendSuccessResponse(w, http.StatusOK, []models.CCTV{})
+				return
+			}
+
+			query += " AND c.id = ANY($" + strconv.Itoa(argPos) + ")"
+			args = append(args, pq.Array(fixedIDs))
+			argPos++
+		}
+
+		// Filter locationID
+		locationID := r.URL.Query().Get("locationId")
+		if locationID != "" {
+			query += " AND l.id = $" + strconv.Itoa(argPos)
+			args = append(args, locationID)
+			argPos++
+		}
+
+		// Filter status stream (online, offline, degraded, unknown)
+		if status := r.URL.Query().Get("status"); status != "" {
+			switch status {
+			case "unknown":
+				query += " AND c.health_status IS NULL"
+			case "online", "offline", "degraded":
+				query += " AND c.health_status = $" + strconv.Itoa(argPos)
+				args = append(args, status)
+				argPos++
+			default:
+				responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid status filter")
+				return
+			}
+		}
+
+		// Filter tipe sumber, bisa lebih dari satu: ?sourceType=hls,mjpeg
+		if raw := r.URL.Query().Get("sourceType"); raw != "" {
+			sourceTypes := strings.Split(raw, ",")
+			for _, t := range sourceTypes {
+				if !isSourceType(t) {
+					responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid sourceType filter")
+					return
+				}
+			}
+			query += " AND c.source_type = ANY($" + strconv.Itoa(argPos) + ")"
+			args = append(args, pq.Array(sourceTypes))
+			argPos++
+		}
+
+		// Filter kamera yang sedang ada gerakan: ?motion=true
+		if raw := r.URL.Query().Get("motion"); raw != "" {
+			isMotion, err := strconv.ParseBool(raw)
+			if err != nil {
+				responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid motion filter")
+				return
+			}
+			query += " AND c.activity_motion = $" + strconv.Itoa(argPos)
+			args = append(args, isMotion)
+			argPos++
+		}
+
+		// Urutan: ?sort=location (default), name, activity, lastMotionAt
+		sort := r.URL.Query().Get("sort")
+		if sort == "" {
+			sort = "location"
+		}
+		order, ok := cctvListOrders[sort]
+		if !ok {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid sort; use location, name, activity or lastMotionAt")
+			return
+		}
+		query += " ORDER BY " + order
+
+		// Eksekusi dan scan data
+		rows, err := db.Query(query, args...)
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to fetch CCTVs: "+err.Error())
+			return
+		}
+		defer rows.Close()
+
+		now := time.Now()
+		var cctvs []models.CCTV
+		for rows.Next() {
+			var cctv models.CCTV
+			var thumbnail, mediaPath sql.NullString
+			var loc models.Location
+			var h healthScan
+			var a activityScan
+			var src sourceScan
+			err := rows.Scan(append(append([]interface{}{&cctv.ID, &cctv.Name, &thumbnail, &cctv.SourceURL, &cctv.SourceType,
+				&src.rtspTransport, &src.refreshSeconds, &mediaPath, &cctv.IsActive,
+				&cctv.CreatedAt, &cctv.UpdatedAt, &loc.ID, &loc.Name}, h.dest()...), a.dest()...)...)
+			if err != nil {
+				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to scan CCTV data")
+				return
+			}
+			if thumbnail.Valid {
+				cctv.ThumbnailURL = &thumbnail.String
+			}
+			if mediaPath.Valid {
+				cctv.MediaPath = &mediaPath.String
+			}
+			src.apply(&cctv)
+			cctv.Location = &loc
+			cctv.Health = h.value()
+			cctv.Activity = a.value()
+			cctvs = append(cctvs, cctv)
+		}
+
+		ids := make([]int, len(cctvs))
+		for i := range cctvs {
+			ids[i] = cctvs[i].ID
+		}
+		byCCTV, err := streams.ForCCTVs(ids)
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to fetch CCTV streams")
+			return
+		}
+		for i := range cctvs {
+			cctvs[i].Streams = byCCTV[cctvs[i].ID]
+			presentCCTV(&cctvs[i], claims, signer, quality, now)
+		}
+
+		responses.SendSuccessResponse(w, http.StatusOK, cctvs)
+	}
+}
+
+// loadCCTV reads one camera with its location, health and activity.
+func loadCCTV(q services.Queryer, id int) (*models.CCTV, error) {
+	var cctv models.CCTV
+	var thumbnailUrl, mediaPath sql.NullString
+	var loc models.Location
+	var h healthScan
+	var a activityScan
+	var src sourceScan
+
+	err := q.QueryRow(`
+		SELECT 
+			c.id, c.name, c.thumbnail_url, c.source_url, c.source_type, c.rtsp_transport, c.snapshot_refresh_seconds, c.media_path, c.is_active, c.created_at, c.updated_at,
+			l.id as location_id, l.name as location_name, `+healthColumns+`, `+activityColumns+`
+		FROM cctvs c
+		JOIN locations l ON c.location_id = l.id
+		WHERE c.id = $1
+	`, id).Scan(append(append([]interface{}{
+		&cctv.ID,
+		&cctv.Name,
+		&thumbnailUrl,
+		&cctv.SourceURL,
+		&cctv.SourceType,
+		&src.rtspTransport,
+		&src.refreshSeconds,
+		&mediaPath,
+		&cctv.IsActive,
+		&cctv.CreatedAt,
+		&cctv.UpdatedAt,
+		&loc.ID,
+		&loc.Name,
+	}, h.dest()...), a.dest()...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	if thumbnailUrl.Valid {
+		cctv.ThumbnailURL = &thumbnailUrl.String
+	}
+	if mediaPath.Valid {
+		cctv.MediaPath = &mediaPath.String
+	}
+	src.apply(&cctv)
+	cctv.LocationID = loc.ID
+	cctv.Location = &loc
+	cctv.Health = h.value()
+	cctv.Activity = a.value()
+	return &cctv, nil
+}
+
+// publishCCTVEvent sends a cctv.* event carrying the camera as it now is.
+// Events reach non-operators, so they never carry the source URL.
+func publishCCTVEvent(db *sql.DB, bus *events.Bus, eventType string, id int, changedFields []string) {
+	cctv, err := loadCCTV(db, id)
+	if err != nil {
+		log.Printf("Failed to load CCTV %d for %s event: %v", id, eventType, err)
+		return
+	}
+	hideOrigin(cctv)
+	bus.Publish(eventType, models.CCTVEvent{CCTV: cctv, ChangedFields: changedFields})
+}
 
+// GetCCTVByID is the public view of a camera: no source or playback URL.
+func GetCCTVByID(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid CCTV ID")
+			return
+		}
+
+		cctv, err := loadCCTV(db, id)
 		if err != nil {
 			if err == sql.ErrNoRows {
 				responses.SendErrorResponse(w, http.StatusNotFound, "CCTV not found")
@@ -172,17 +364,13 @@ func GetCCTVByID(db *sql.DB) http.HandlerFunc {
 			}
 			return
 		}
-
-		if thumbnailUrl.Valid {
-			cctv.ThumbnailURL = &thumbnailUrl.String
-		}
-		cctv.Location = &loc
+		hideOrigin(cctv)
 
 		responses.SendSuccessResponse(w, http.StatusOK, cctv)
 	}
 }
 
-func CreateCCTV(db *sql.DB) http.HandlerFunc {
+func CreateCCTV(db *sql.DB, prober *health.Prober, bus *events.Bus) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req models.CreateCCTVRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -195,6 +383,20 @@ func CreateCCTV(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		src := streamSource{
+			url:            req.SourceURL,
+			sourceType:     inferSourceType(req.SourceURL),
+			rtspTransport:  req.RTSPTransport,
+			refreshSeconds: req.SnapshotRefreshSeconds,
+		}
+		if req.SourceType != nil {
+			src.sourceType = *req.SourceType
+		}
+		if err := validateSource(r.Context(), prober, &src, true); err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
 		// Check for duplicate name
 		var existingID int
 		err := db.QueryRow("SELECT id FROM cctvs WHERE name = $1", req.Name).Scan(&existingID)
@@ -208,10 +410,9 @@ func CreateCCTV(db *sql.DB) http.HandlerFunc {
 		}
 
 		// Check for duplicate source URL
-		err = db.QueryRow("SELECT id, name FROM cctvs WHERE source_url = $1", req.SourceURL).Scan(&existingID, &req.Name)
+		err = db.QueryRow("SELECT id FROM cctvs WHERE source_url = $1", req.SourceURL).Scan(&existingID)
 		if err == nil {
-			responses.SendErrorResponse(w, http.StatusConflict,
-				"CCTV with this source URL already exists (ID: "+strconv.Itoa(existingID)+", Name: '"+req.Name+"')")
+			responses.SendErrorResponse(w, http.StatusConflict, "CCTV with this source URL already exists")
 			return
 		} else if err != sql.ErrNoRows {
 			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to check for duplicate source URL")
@@ -225,27 +426,36 @@ func CreateCCTV(db *sql.DB) http.HandlerFunc {
 			thumbnailUrl = nil
 		}
 
+		var mediaPath interface{}
+		if req.MediaPath != nil && *req.MediaPath != "" {
+			mediaPath = *req.MediaPath
+		}
+
 		var id int
 		err = db.QueryRow(`
-			INSERT INTO cctvs (location_id, name, thumbnail_url, source_url)
-			VALUES ($1, $2, $3, $4)
+			INSERT INTO cctvs (location_id, name, thumbnail_url, source_url, source_type, rtsp_transport, snapshot_refresh_seconds, media_path)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 			RETURNING id
-		`, req.LocationID, req.Name, thumbnailUrl, req.SourceURL).Scan(&id)
+		`, req.LocationID, req.Name, thumbnailUrl, src.url, src.sourceType, src.rtspTransport, src.refreshSeconds, mediaPath).Scan(&id)
 
 		if err != nil {
 			if err.Error() == `pq: insert or update on table "cctvs" violates foreign key constraint "cctvs_location_id_fkey"` {
 				responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid location ID")
+			} else if err.Error() == `pq: duplicate key value violates unique constraint "cctvs_media_path_key"` {
+				responses.SendErrorResponse(w, http.StatusConflict, "Media path is already used by another CCTV")
 			} else {
 				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to create CCTV")
 			}
 			return
 		}
 
+		publishCCTVEvent(db, bus, events.CCTVCreated, id, nil)
+
 		responses.SendSuccessResponse(w, http.StatusCreated, map[string]int{"id": id})
 	}
 }
 
-func UpdateCCTV(db *sql.DB) http.HandlerFunc {
+func UpdateCCTV(db *sql.DB, prober *health.Prober, allotments *services.AllotmentService, images *services.ImageService, bus *events.Bus) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 		id, err := strconv.Atoi(vars["id"])
@@ -268,44 +478,124 @@ func UpdateCCTV(db *sql.DB) http.HandlerFunc {
 		query := "UPDATE cctvs SET updated_at = NOW()"
 		args := []interface{}{}
 		argPos := 1
+		changedFields := []string{}
 
 		if req.LocationID != nil {
 			query += ", location_id = $" + strconv.Itoa(argPos)
 			args = append(args, *req.LocationID)
 			argPos++
+			changedFields = append(changedFields, "locationId")
 		}
 
 		if req.Name != nil {
 			query += ", name = $" + strconv.Itoa(argPos)
 			args = append(args, *req.Name)
 			argPos++
+			changedFields = append(changedFields, "name")
 		}
 
+		// A thumbnail URL set by hand replaces an uploaded thumbnail
 		if req.ThumbnailURL != nil {
-			query += ", thumbnail_url = $" + strconv.Itoa(argPos)
+			query += ", thumbnail_url = $" + strconv.Itoa(argPos) + ", thumbnail_key = NULL"
 			args = append(args, *req.ThumbnailURL)
 			argPos++
+			changedFields = append(changedFields, "thumbnailUrl")
 		}
 
-		if req.SourceURL != nil {
-			query += ", source_url = $" + strconv.Itoa(argPos)
-			args = append(args, *req.SourceURL)
-			argPos++
+		// The source is validated as a whole: URL, type and type-specific
+		// options have to fit together
+		if req.SourceURL != nil || req.SourceType != nil || req.RTSPTransport != nil || req.SnapshotRefreshSeconds != nil {
+			current, err := loadCCTV(db, id)
+			if err == sql.ErrNoRows {
+				responses.SendErrorResponse(w, http.StatusNotFound, "CCTV not found")
+				return
+			}
+			if err != nil {
+				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to update CCTV")
+				return
+			}
+
+			src := streamSource{url: current.SourceURL, sourceType: current.SourceType}
+			// Options of the old type are dropped when the type changes
+			if req.SourceType == nil || *req.SourceType == current.SourceType {
+				src.rtspTransport = current.RTSPTransport
+				src.refreshSeconds = current.SnapshotRefreshSeconds
+			}
+			if req.SourceURL != nil {
+				src.url = *req.SourceURL
+				changedFields = append(changedFields, "sourceUrl")
+			}
+			if req.SourceType != nil {
+				src.sourceType = *req.SourceType
+				changedFields = append(changedFields, "sourceType")
+			}
+			// An empty transport lets the media server choose
+			if req.RTSPTransport != nil {
+				src.rtspTransport = nil
+				if *req.RTSPTransport != "" {
+					src.rtspTransport = req.RTSPTransport
+				}
+				changedFields = append(changedFields, "rtspTransport")
+			}
+			if req.SnapshotRefreshSeconds != nil {
+				src.refreshSeconds = req.SnapshotRefreshSeconds
+				changedFields = append(changedFields, "snapshotRefreshSeconds")
+			}
+
+			probe := src.url != current.SourceURL || src.sourceType != current.SourceType
+			if err := validateSource(r.Context(), prober, &src, probe); err != nil {
+				responses.SendErrorResponse(w, http.StatusBadRequest, err.Error())
+				return
+			}
+
+			query += ", source_url = $" + strconv.Itoa(argPos) +
+				", source_type = $" + strconv.Itoa(argPos+1) +
+				", rtsp_transport = $" + strconv.Itoa(argPos+2) +
+				", snapshot_refresh_seconds = $" + strconv.Itoa(argPos+3)
+			args = append(args, src.url, src.sourceType, src.rtspTransport, src.refreshSeconds)
+			argPos += 4
 		}
 
 		if req.IsActive != nil {
 			query += ", is_active = $" + strconv.Itoa(argPos)
 			args = append(args, *req.IsActive)
 			argPos++
+			changedFields = append(changedFields, "isActive")
+		}
+
+		// An empty media path removes it
+		if req.MediaPath != nil {
+			query += ", media_path = NULLIF($" + strconv.Itoa(argPos) + ", '')"
+			args = append(args, *req.MediaPath)
+			argPos++
+			changedFields = append(changedFields, "mediaPath")
 		}
 
 		query += " WHERE id = $" + strconv.Itoa(argPos)
 		args = append(args, id)
 
-		result, err := db.Exec(query, args...)
+		tx, err := db.Begin()
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Database error")
+			return
+		}
+		defer tx.Rollback()
+
+		var oldThumbnailKey sql.NullString
+		if req.ThumbnailURL != nil {
+			err := tx.QueryRow("SELECT thumbnail_key FROM cctvs WHERE id = $1 FOR UPDATE", id).Scan(&oldThumbnailKey)
+			if err != nil && err != sql.ErrNoRows {
+				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to update CCTV")
+				return
+			}
+		}
+
+		result, err := tx.Exec(query, args...)
 		if err != nil {
 			if err.Error() == `pq: insert or update on table "cctvs" violates foreign key constraint "cctvs_location_id_fkey"` {
 				responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid location ID")
+			} else if err.Error() == `pq: duplicate key value violates unique constraint "cctvs_media_path_key"` {
+				responses.SendErrorResponse(w, http.StatusConflict, "Media path is already used by another CCTV")
 			} else {
 				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to update CCTV")
 			}
@@ -318,13 +608,36 @@ func UpdateCCTV(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		// Kamera dinonaktifkan → ganti di alokasi semua user
+		if req.IsActive != nil && !*req.IsActive {
+			if err := allotments.ReleaseCCTV(tx, id); err != nil {
+				log.Printf("Failed to release CCTV %d from allotments: %v", id, err)
+				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to update CCTV")
+				return
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to update CCTV")
+			return
+		}
+
+		if oldThumbnailKey.Valid {
+			images.DiscardThumbnail(r.Context(), oldThumbnailKey.String)
+		}
+
+		publishCCTVEvent(db, bus, events.CCTVUpdated, id, changedFields)
+		if req.ThumbnailURL != nil {
+			publishCCTVEvent(db, bus, events.CCTVThumbnailUpdated, id, nil)
+		}
+
 		responses.SendSuccessResponse(w, http.StatusOK, map[string]string{
 			"message": "CCTV updated successfully",
 		})
 	}
 }
 
-func DeleteCCTV(db *sql.DB) http.HandlerFunc {
+func DeleteCCTV(db *sql.DB, allotments *services.AllotmentService, snapshots *services.SnapshotService, images *services.ImageService, bus *events.Bus) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 		id, err := strconv.Atoi(vars["id"])
@@ -333,17 +646,55 @@ func DeleteCCTV(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		result, err := db.Exec("DELETE FROM cctvs WHERE id = $1", id)
+		tx, err := db.Begin()
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Database error")
+			return
+		}
+		defer tx.Rollback()
+
+		cctv, err := loadCCTV(tx, id)
+		if err == sql.ErrNoRows {
+			responses.SendErrorResponse(w, http.StatusNotFound, "CCTV not found")
+			return
+		}
 		if err != nil {
 			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to delete CCTV")
 			return
 		}
 
-		rowsAffected, _ := result.RowsAffected()
-		if rowsAffected == 0 {
+		// Ganti kamera ini di alokasi user sebelum dihapus
+		if err := allotments.ReleaseCCTV(tx, id); err != nil {
+			log.Printf("Failed to release CCTV %d from allotments: %v", id, err)
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to delete CCTV")
+			return
+		}
+
+		var thumbnailKey sql.NullString
+		err = tx.QueryRow("DELETE FROM cctvs WHERE id = $1 RETURNING thumbnail_key", id).Scan(&thumbnailKey)
+		if err == sql.ErrNoRows {
 			responses.SendErrorResponse(w, http.StatusNotFound, "CCTV not found")
 			return
 		}
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to delete CCTV")
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to delete CCTV")
+			return
+		}
+
+		if err := snapshots.Remove(r.Context(), id); err != nil {
+			log.Printf("Failed to remove snapshots of CCTV %d: %v", id, err)
+		}
+		if thumbnailKey.Valid {
+			images.DiscardThumbnail(r.Context(), thumbnailKey.String)
+		}
+
+		hideOrigin(cctv)
+		bus.Publish(events.CCTVDeleted, models.CCTVEvent{CCTV: cctv})
 
 		responses.SendSuccessResponse(w, http.StatusOK, map[string]string{
 			"message": "CCTV deleted successfully",
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"cctv-api/internal/models"
+	"cctv-api/internal/responses"
+
+	"github.com/gorilla/mux"
+)
+
+var errDeviceLimitReached = errors.New("device limit reached")
+
+type deviceInfo struct {
+	DeviceID   string
+	DeviceName *string
+	Platform   *string
+}
+
+// bindDevice records the device on the user's account. A device that is
+// already bound just has its details refreshed; a new device is only bound
+// while the account is below its device limit.
+func bindDevice(db *sql.DB, userID int, limit int, device deviceInfo) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Serialize concurrent logins for the same user
+	if _, err := tx.Exec("SELECT id FROM users WHERE id = $1 FOR UPDATE", userID); err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`
+		UPDATE user_devices
+		SET device_name = COALESCE($1, device_name),
+			platform = COALESCE($2, platform),
+			last_seen_at = NOW()
+		WHERE user_id = $3 AND device_id = $4
+	`, device.DeviceName, device.Platform, userID, device.DeviceID)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected > 0 {
+		return tx.Commit()
+	}
+
+	var count int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM user_devices WHERE user_id = $1", userID).Scan(&count); err != nil {
+		return err
+	}
+	if count >= limit {
+		return errDeviceLimitReached
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO user_devices (user_id, device_id, device_name, platform)
+		VALUES ($1, $2, $3, $4)
+	`, userID, device.DeviceID, device.DeviceName, device.Platform)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func GetUserDevices(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		userID, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid user ID")
+			return
+		}
+
+		var exists bool
+		err = db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)", userID).Scan(&exists)
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Database error")
+			return
+		}
+		if !exists {
+			responses.SendErrorResponse(w, http.StatusNotFound, "User not found")
+			return
+		}
+
+		rows, err := db.Query(`
+			SELECT id, user_id, device_id, device_name, platform, created_at, last_seen_at
+			FROM user_devices
+			WHERE user_id = $1
+			ORDER BY created_at ASC
+		`, userID)
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to fetch devices")
+			return
+		}
+		defer rows.Close()
+
+		devices := []models.UserDevice{}
+		for rows.Next() {
+			var device models.UserDevice
+			var deviceName, platform sql.NullString
+			err := rows.Scan(&device.ID, &device.UserID, &device.DeviceID, &deviceName, &platform,
+				&device.CreatedAt, &device.LastSeenAt)
+			if err != nil {
+				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to scan device data")
+				return
+			}
+			if deviceName.Valid {
+				device.DeviceName = &deviceName.String
+			}
+			if platform.Valid {
+				device.Platform = &platform.String
+			}
+			devices = append(devices, device)
+		}
+
+		responses.SendSuccessResponse(w, http.StatusOK, devices)
+	}
+}
+
+func ResetUserDevices(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		userID, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid user ID")
+			return
+		}
+
+		// Optional: only unbind a single device
+		deviceID := r.URL.Query().Get("deviceId")
+
+		if err := clearDeviceBindings(db, userID, deviceID); err != nil {
+			if err == sql.ErrNoRows {
+				responses.SendErrorResponse(w, http.StatusNotFound, "User not found")
+			} else {
+				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to reset devices")
+			}
+			return
+		}
+
+		responses.SendSuccessResponse(w, http.StatusOK, map[string]string{
+			"message": "Device bindings reset successfully",
+		})
+	}
+}
+
+// clearDeviceBindings removes the user's bound devices (or only deviceID when
+// given) and signs them out so the next device can claim the account.
+func clearDeviceBindings(db *sql.DB, userID int, deviceID string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE users
+		SET device_id = NULL, updated_at = NOW()
+		WHERE id = $1
+	`, userID)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	for _, table := range []string{"user_devices", "user_sessions"} {
+		if deviceID != "" {
+			_, err = tx.Exec("DELETE FROM "+table+" WHERE user_id = $1 AND device_id = $2", userID, deviceID)
+		} else {
+			_, err = tx.Exec("DELETE FROM "+table+" WHERE user_id = $1", userID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestBindDevice(t *testing.T) {
+	tests := []struct {
+		name    string
+		limit   int
+		bound   bool // the device is already bound
+		count   int  // other devices bound
+		wantErr error
+	}{
+		{name: "first device", limit: 1, count: 0},
+		{name: "bound device refreshed", limit: 1, bound: true},
+		{name: "bound device at the limit", limit: 2, bound: true, count: 2},
+		{name: "another device below the limit", limit: 3, count: 2},
+		{name: "another device at the limit", limit: 1, count: 1, wantErr: errDeviceLimitReached},
+		{name: "limit lowered below bound devices", limit: 1, count: 3, wantErr: errDeviceLimitReached},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			mock.ExpectBegin()
+			mock.ExpectExec(`SELECT id FROM users WHERE id = \$1 FOR UPDATE`).WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 1))
+			if tt.bound {
+				mock.ExpectExec(`UPDATE user_devices`).WithArgs(nil, nil, 7, "phone").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			} else {
+				mock.ExpectExec(`UPDATE user_devices`).WithArgs(nil, nil, 7, "phone").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(`SELECT COUNT\(\*\) FROM user_devices`).WithArgs(7).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(tt.count))
+				if tt.wantErr == nil {
+					mock.ExpectExec(`INSERT INTO user_devices`).WithArgs(7, "phone", nil, nil).WillReturnResult(sqlmock.NewResult(1, 1))
+					mock.ExpectCommit()
+				} else {
+					mock.ExpectRollback()
+				}
+			}
+
+			err := bindDevice(db, 7, tt.limit, deviceInfo{DeviceID: "phone"})
+			if err != tt.wantErr {
+				t.Errorf("bindDevice() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClearDeviceBindings(t *testing.T) {
+	tests := []struct {
+		name     string
+		deviceID string
+		found    bool
+		wantErr  error
+	}{
+		{name: "every device", found: true},
+		{name: "one device", deviceID: "phone", found: true},
+		{name: "unknown user", found: false, wantErr: sql.ErrNoRows},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			mock.ExpectBegin()
+			if !tt.found {
+				mock.ExpectExec(`UPDATE users`).WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+			} else {
+				mock.ExpectExec(`UPDATE users`).WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 1))
+				for _, table := range []string{"user_devices", "user_sessions"} {
+					if tt.deviceID != "" {
+						mock.ExpectExec(`DELETE FROM `+table+` WHERE user_id = \$1 AND device_id = \$2`).
+							WithArgs(7, tt.deviceID).WillReturnResult(sqlmock.NewResult(0, 1))
+					} else {
+						mock.ExpectExec(`DELETE FROM ` + table + ` WHERE user_id = \$1$`).
+							WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 2))
+					}
+				}
+				mock.ExpectCommit()
+			}
+
+			if err := clearDeviceBindings(db, 7, tt.deviceID); err != tt.wantErr {
+				t.Errorf("clearDeviceBindings() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,294 @@
+package handlers
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"cctv-api/internal/events"
+	"cctv-api/internal/models"
+	"cctv-api/internal/realtime"
+	"cctv-api/internal/responses"
+	"cctv-api/internal/services"
+	"cctv-api/internal/utils"
+)
+
+// viewerScopeTTL is how long a user's visible cameras are cached on a
+// connection before they are looked up again.
+const viewerScopeTTL = time.Minute
+
+// viewerScope decides which events a user may receive. Admins get
+// everything. Other users get events for the cameras their plan shows them,
+// location events, and their own upgrades. It is not safe for concurrent
+// use; each connection has its own.
+type viewerScope struct {
+	userID     int
+	admin      bool
+	plans      *services.PlanService
+	allotments *services.AllotmentService
+	allCameras bool
+	cameraIDs  map[int]bool
+	loadedAt   time.Time
+}
+
+func newViewerScope(claims *utils.Claims, plans *services.PlanService, allotments *services.AllotmentService) (*viewerScope, error) {
+	s := &viewerScope{userID: claims.UserID, admin: claims.Role == "admin", plans: plans, allotments: allotments}
+	if s.admin {
+		return s, nil
+	}
+	return s, s.load()
+}
+
+func (s *viewerScope) load() error {
+	plan, _, err := s.plans.UserPlan(s.userID)
+	if err != nil {
+		return err
+	}
+
+	s.allCameras = !plan.HasCameraQuota()
+	s.cameraIDs = nil
+	if !s.allCameras {
+		ids, err := s.allotments.Ensure(s.userID, *plan.CameraQuota)
+		if err != nil {
+			return err
+		}
+		s.cameraIDs = make(map[int]bool, len(ids))
+		for _, id := range ids {
+			s.cameraIDs[id] = true
+		}
+	}
+	s.loadedAt = time.Now()
+	return nil
+}
+
+// refresh reloads the scope once it is older than viewerScopeTTL. On error
+// the previous scope is kept.
+func (s *viewerScope) refresh() {
+	if time.Since(s.loadedAt) < viewerScopeTTL {
+		return
+	}
+	if err := s.load(); err != nil {
+		log.Printf("Failed to refresh event scope for user %d: %v", s.userID, err)
+	}
+}
+
+// sessionRecheck re-authenticates the token of a long-lived connection at
+// most once per viewerScopeTTL, so that logging out, a device reset or the
+// plan's session limit also ends streams opened before.
+type sessionRecheck struct {
+	jwtUtil   *utils.JWTUtil
+	sessions  *services.SessionService
+	token     string
+	checkedAt time.Time
+}
+
+func newSessionRecheck(r *http.Request, jwtUtil *utils.JWTUtil, sessions *services.SessionService) *sessionRecheck {
+	token, _ := r.Context().Value(sessionTokenKey).(string)
+	return &sessionRecheck{jwtUtil: jwtUtil, sessions: sessions, token: token, checkedAt: time.Now()}
+}
+
+// valid reports whether the session still stands.
+func (c *sessionRecheck) valid() bool {
+	if time.Since(c.checkedAt) < viewerScopeTTL {
+		return true
+	}
+	if _, err := authenticateSession(c.jwtUtil, c.sessions, c.token); err != nil {
+		return false
+	}
+	c.checkedAt = time.Now()
+	return true
+}
+
+func (s *viewerScope) allows(e events.Event) bool {
+	if s.admin {
+		return true
+	}
+
+	switch data := e.Data.(type) {
+	case models.CCTVEvent:
+		s.refresh()
+		if s.allCameras {
+			// Hidden cameras stay hidden, but clients still hear that one
+			// was switched off or removed
+			return data.CCTV.IsActive || e.Type == events.CCTVUpdated || e.Type == events.CCTVDeleted
+		}
+		return s.cameraIDs[data.CCTV.ID]
+	case models.CCTVStatusChange:
+		s.refresh()
+		return s.allCameras || s.cameraIDs[data.CCTVID]
+	case models.CCTVMotionChange:
+		s.refresh()
+		return s.allCameras || s.cameraIDs[data.CCTVID]
+	case models.LocationEvent:
+		return true
+	case models.UserUpgradedEvent:
+		if data.UserID != s.userID {
+			return false
+		}
+		// The new plan may show different cameras
+		s.loadedAt = time.Time{}
+		s.refresh()
+		return true
+	}
+	return false
+}
+
+// parseEventTypes reads a comma-separated ?types= filter such as
+// "cctv.status_changed,location.*". Empty means every type.
+func parseEventTypes(raw string) ([]string, bool) {
+	if raw == "" {
+		return nil, true
+	}
+	var patterns []string
+	for _, p := range strings.Split(raw, ",") {
+		p = strings.TrimSpace(p)
+		if !events.ValidPattern(p) {
+			return nil, false
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns, true
+}
+
+func matchesAny(patterns []string, eventType string) bool {
+	if patterns == nil {
+		return true
+	}
+	for _, p := range patterns {
+		if events.Matches(p, eventType) {
+			return true
+		}
+	}
+	return false
+}
+
+// StreamEvents serves live events as Server-Sent Events. Clients resume
+// after a reconnect with the Last-Event-ID header (or ?lastEventId=); if
+// events were missed in between, a "reset" event tells them to reload.
+// A client that cannot keep up is disconnected and resumes the same way.
+// The session is checked again at heartbeats; the stream ends once it no
+// longer stands.
+func StreamEvents(jwtUtil *utils.JWTUtil, sessions *services.SessionService, broker *realtime.Broker, plans *services.PlanService, allotments *services.AllotmentService, heartbeat time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(userClaimsKey).(*utils.Claims)
+		if !ok {
+			responses.SendErrorResponse(w, http.StatusUnauthorized, "Invalid user context")
+			return
+		}
+
+		patterns, ok := parseEventTypes(r.URL.Query().Get("types"))
+		if !ok {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid types filter")
+			return
+		}
+
+		scope, err := newViewerScope(claims, plans, allotments)
+		if err != nil {
+			log.Printf("Failed to load event scope for user %d: %v", claims.UserID, err)
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to get user info")
+			return
+		}
+
+		session := newSessionRecheck(r, jwtUtil, sessions)
+
+		lastID := r.Header.Get("Last-Event-ID")
+		if lastID == "" {
+			lastID = r.URL.Query().Get("lastEventId")
+		}
+
+		client, replay, complete := broker.Subscribe(lastID)
+		defer broker.Unsubscribe(client)
+
+		rc := http.NewResponseController(w)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no") // nginx: don't buffer the stream
+		w.WriteHeader(http.StatusOK)
+
+		// Writes to a client whose connection has stalled give up after
+		// this long instead of holding the handler forever
+		send := func(write func(io.Writer) error) bool {
+			rc.SetWriteDeadline(time.Now().Add(heartbeat + 10*time.Second))
+			if err := write(w); err != nil {
+				return false
+			}
+			return rc.Flush() == nil
+		}
+
+		// sentID is the last ID the client has seen, including events it was
+		// not shown, so that a resume does not look like a gap
+		sentID := lastID
+		seenID := lastID
+		writeMessage := func(out io.Writer, msg realtime.Message) error {
+			id := broker.ID(msg.Seq)
+			seenID = id
+			if !matchesAny(patterns, msg.Event.Type) || !scope.allows(msg.Event) {
+				return nil
+			}
+			sentID = id
+			_, err := io.WriteString(out, "id: "+id+"\nevent: "+msg.Event.Type+"\ndata: "+string(msg.JSON)+"\n\n")
+			return err
+		}
+
+		ok = send(func(out io.Writer) error {
+			if _, err := io.WriteString(out, "retry: 3000\n\n"); err != nil {
+				return err
+			}
+			if lastID != "" && !complete {
+				id := broker.LastID()
+				sentID, seenID = id, id
+				_, err := io.WriteString(out, "id: "+id+"\nevent: reset\ndata: {\"reason\":\"missed events; reload state\"}\n\n")
+				return err
+			}
+			for _, msg := range replay {
+				if err := writeMessage(out, msg); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if !ok {
+			return
+		}
+
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-client.Done():
+				if client.Overflowed() {
+					log.Printf("Dropped slow event stream client (user %d)", claims.UserID)
+				}
+				return
+			case msg := <-client.C:
+				if !send(func(out io.Writer) error { return writeMessage(out, msg) }) {
+					return
+				}
+			case <-ticker.C:
+				if !session.valid() {
+					return
+				}
+				ok := send(func(out io.Writer) error {
+					// An id-only message moves the client's Last-Event-ID past
+					// events it was not shown without dispatching anything
+					if seenID != sentID {
+						sentID = seenID
+						if _, err := io.WriteString(out, "id: "+seenID+"\n\n"); err != nil {
+							return err
+						}
+					}
+					_, err := io.WriteString(out, ": heartbeat\n\n")
+					return err
+				})
+				if !ok {
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cctv-api/internal/services"
+	"cctv-api/internal/utils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestSessionRecheck(t *testing.T) {
+	db, mock := newMockDB(t)
+	jwtUtil := utils.NewJWTUtil("secret", time.Hour, db)
+	token, err := jwtUtil.GenerateToken(7, "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/api/events", nil)
+	r = r.WithContext(context.WithValue(r.Context(), sessionTokenKey, token))
+	session := newSessionRecheck(r, jwtUtil, services.NewSessionService(db, services.NewPlanService(db)))
+
+	// Within viewerScopeTTL of the last check nothing is looked up
+	if !session.valid() {
+		t.Fatal("valid() = false right after connecting")
+	}
+
+	session.checkedAt = time.Now().Add(-viewerScopeTTL)
+	mock.ExpectQuery(`FROM user_sessions`).WithArgs(7, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"rank"}).AddRow(1))
+	expectDefaultPlan(mock, 1, 1)
+	if !session.valid() {
+		t.Fatal("valid() = false for a live session")
+	}
+
+	session.checkedAt = time.Now().Add(-viewerScopeTTL)
+	mock.ExpectQuery(`FROM user_sessions`).WithArgs(7, sqlmock.AnyArg()).WillReturnError(sql.ErrNoRows)
+	if session.valid() {
+		t.Error("valid() = true after the session was signed out")
+	}
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"cctv-api/internal/responses"
+	"cctv-api/internal/storage"
+
+	"github.com/gorilla/mux"
+)
+
+// fileLinkTTL is how long download links handed out by the API stay valid.
+const fileLinkTTL = 15 * time.Minute
+
+// ServeFile serves a stored file to anyone holding a signed link to it
+// (?expires= and &sig=), as handed out by the local storage backend.
+func ServeFile(store storage.Store, links *storage.URLSigner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := mux.Vars(r)["key"]
+		query := r.URL.Query()
+		if err := links.Verify(key, query.Get("expires"), query.Get("sig"), time.Now()); err != nil {
+			if err == storage.ErrLinkExpired {
+				responses.SendErrorResponse(w, http.StatusForbidden, "Download link expired")
+			} else {
+				responses.SendErrorResponse(w, http.StatusForbidden, "Invalid download link")
+			}
+			return
+		}
+
+		body, obj, err := store.Get(r.Context(), key)
+		if err == storage.ErrNotFound || err == storage.ErrInvalidKey {
+			responses.SendErrorResponse(w, http.StatusNotFound, "File not found")
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to read stored file %s: %v", key, err)
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to read file")
+			return
+		}
+		defer body.Close()
+
+		data, err := io.ReadAll(body)
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to read file")
+			return
+		}
+
+		if obj.ContentType != "" {
+			w.Header().Set("Content-Type", obj.ContentType)
+		}
+		if obj.ETag != "" {
+			w.Header().Set("ETag", obj.ETag)
+		}
+		w.Header().Set("Cache-Control", "private, max-age=300")
+		http.ServeContent(w, r, "", obj.ModTime, bytes.NewReader(data))
+	}
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cctv-api/internal/config"
+	"cctv-api/internal/services"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// newMockDB returns a database whose every statement must be expected in
+// order, checked when the test ends.
+func newMockDB(t *testing.T) (*sql.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	})
+	return db, mock
+}
+
+// testHasher stands in for argon2id: the hash of p is "hash:p".
+type testHasher struct{}
+
+func (testHasher) Hash(password string) (string, error) {
+	return "hash:" + password, nil
+}
+
+func (testHasher) Verify(encoded, password string) (bool, bool, error) {
+	return encoded == "hash:"+password, false, nil
+}
+
+func newTestLoginGuard(db *sql.DB) *services.LoginGuard {
+	return services.NewLoginGuard(db, &config.Config{
+		LoginMaxFailures:   3,
+		LoginIPMaxFailures: 10,
+		LoginLockDuration:  15 * time.Minute,
+		LoginFailureWindow: time.Hour,
+		LoginDelayBase:     time.Second,
+		LoginDelayMax:      30 * time.Second,
+	})
+}
+
+var planColumnNames = []string{"id", "name", "camera_quota", "device_limit", "concurrent_sessions", "can_export", "max_stream_quality",
+	"price", "currency", "duration_days", "is_default", "is_active", "created_at", "updated_at"}
+
+// planRow is the default plan with the given device and session limits.
+func planRow(deviceLimit, concurrentSessions int) *sqlmock.Rows {
+	now := time.Now()
+	return sqlmock.NewRows(planColumnNames).
+		AddRow(1, "free", 10, deviceLimit, concurrentSessions, false, "sub", 0, "IDR", nil, true, true, now, now)
+}
+
+// expectDefaultPlan expects the lookup of a user without a subscription.
+func expectDefaultPlan(mock sqlmock.Sqlmock, deviceLimit, concurrentSessions int) {
+	mock.ExpectQuery(`FROM subscriptions`).WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(`FROM plans p WHERE p.is_default`).WillReturnRows(planRow(deviceLimit, concurrentSessions))
+}
+
+// decodeResponse decodes the JSON envelope of a handler response.
+func decodeResponse(t *testing.T, rec *httptest.ResponseRecorder) map[string]interface{} {
+	t.Helper()
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("response %q is not JSON: %v", rec.Body.String(), err)
+	}
+	return body
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cctv-api/internal/responses"
+	"cctv-api/internal/services"
+
+	"github.com/gorilla/mux"
+)
+
+// parseTimeRange reads RFC 3339 ?from= and ?to= parameters, defaulting to
+// the given window ending now.
+func parseTimeRange(r *http.Request, window time.Duration) (time.Time, time.Time, bool) {
+	to := time.Now()
+	if raw := r.URL.Query().Get("to"); raw != "" {
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return time.Time{}, time.Time{}, false
+		}
+		to = t
+	}
+	from := to.Add(-window)
+	if raw := r.URL.Query().Get("from"); raw != "" {
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return time.Time{}, time.Time{}, false
+		}
+		from = t
+	}
+	return from, to, from.Before(to)
+}
+
+func GetCCTVStatusHistory(monitor *services.HealthMonitor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid CCTV ID")
+			return
+		}
+
+		from, to, ok := parseTimeRange(r, 24*time.Hour)
+		if !ok {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid time range; use RFC 3339 from/to with from before to")
+			return
+		}
+
+		limit := 500
+		if raw := r.URL.Query().Get("limit"); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 1 || n > 5000 {
+				responses.SendErrorResponse(w, http.StatusBadRequest, "limit must be between 1 and 5000")
+				return
+			}
+			limit = n
+		}
+
+		entries, err := monitor.History(id, from, to, limit)
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to fetch status history")
+			return
+		}
+
+		responses.SendSuccessResponse(w, http.StatusOK, entries)
+	}
+}
+
+// CheckCCTVHealth probes a camera immediately instead of waiting for the
+// next monitor run.
+func CheckCCTVHealth(db *sql.DB, monitor *services.HealthMonitor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid CCTV ID")
+			return
+		}
+
+		var sourceURL, sourceType string
+		err = db.QueryRow("SELECT source_url, source_type FROM cctvs WHERE id = $1", id).Scan(&sourceURL, &sourceType)
+		if err == sql.ErrNoRows {
+			responses.SendErrorResponse(w, http.StatusNotFound, "CCTV not found")
+			return
+		}
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to fetch CCTV")
+			return
+		}
+
+		result, err := monitor.Check(r.Context(), id, sourceURL, sourceType)
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to record health check")
+			return
+		}
+
+		responses.SendSuccessResponse(w, http.StatusOK, map[string]interface{}{
+			"status":    result.Status,
+			"latencyMs": result.Latency.Milliseconds(),
+			"detail":    result.Detail,
+			"checkedAt": result.CheckedAt,
+		})
+	}
+}
@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"cctv-api/internal/events"
+	"cctv-api/internal/models"
+	"cctv-api/internal/responses"
+	"cctv-api/internal/services"
+	"cctv-api/internal/storage"
+	"cctv-api/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// readImageUpload reads the "file" part of a multipart upload, answering
+// 413 when the request is larger than an image may be.
+func readImageUpload(w http.ResponseWriter, r *http.Request, maxBytes int64) ([]byte, bool) {
+	// Leave room for the multipart headers around the file
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes+64<<10)
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			sendImageError(w, storage.ErrTooLarge, maxBytes)
+		} else {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Send the image as multipart/form-data in a field named file")
+		}
+		return nil, false
+	}
+	defer file.Close()
+	if r.MultipartForm != nil {
+		defer r.MultipartForm.RemoveAll()
+	}
+
+	data, err := io.ReadAll(io.LimitReader(file, maxBytes+1))
+	if err != nil {
+		responses.SendErrorResponse(w, http.StatusBadRequest, "Failed to read upload")
+		return nil, false
+	}
+	return data, true
+}
+
+// sendImageError answers for an upload the image service turned down.
+func sendImageError(w http.ResponseWriter, err error, maxBytes int64) {
+	switch err {
+	case storage.ErrTooLarge:
+		limit := strconv.FormatInt(maxBytes>>10, 10) + " KB"
+		if maxBytes >= 1<<20 {
+			limit = strconv.FormatInt(maxBytes>>20, 10) + " MB"
+		}
+		responses.SendErrorResponse(w, http.StatusRequestEntityTooLarge, "Image must be at most "+limit)
+	case storage.ErrUnsupportedType:
+		responses.SendErrorResponse(w, http.StatusUnsupportedMediaType, "Only JPEG, PNG and GIF images are supported")
+	case services.ErrInvalidImage:
+		responses.SendErrorResponse(w, http.StatusBadRequest, "File is not a valid image")
+	case services.ErrImageTooLarge:
+		responses.SendErrorResponse(w, http.StatusRequestEntityTooLarge, "Image dimensions are too large")
+	default:
+		log.Printf("Failed to store uploaded image: %v", err)
+		responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to store image")
+	}
+}
+
+// imageVariant reads ?size= (small, medium or large; medium by default).
+func imageVariant(w http.ResponseWriter, r *http.Request, variants map[string]services.ImageSize) (string, bool) {
+	variant := r.URL.Query().Get("size")
+	if variant == "" {
+		variant = services.DefaultImageVariant
+	}
+	if _, ok := variants[variant]; !ok {
+		responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid size; use small, medium or large")
+		return "", false
+	}
+	return variant, true
+}
+
+// serveStoredImage serves an image read from storage. Clients revalidate
+// with If-None-Match or If-Modified-Since.
+func serveStoredImage(w http.ResponseWriter, r *http.Request, body io.ReadCloser, obj *storage.Object) {
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to read image")
+		return
+	}
+
+	w.Header().Set("Content-Type", obj.ContentType)
+	if obj.ETag != "" {
+		w.Header().Set("ETag", obj.ETag)
+	}
+	w.Header().Set("Cache-Control", "private, no-cache")
+	http.ServeContent(w, r, "", obj.ModTime, bytes.NewReader(data))
+}
+
+// UploadMyPhoto replaces the user's profile photo with a multipart upload
+// (field "file"). It is stored square in several sizes and served from
+// the returned photoUrl.
+func UploadMyPhoto(images *services.ImageService, audit *services.AuditService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(userClaimsKey).(*utils.Claims)
+		if !ok {
+			responses.SendErrorResponse(w, http.StatusUnauthorized, "Invalid user context")
+			return
+		}
+
+		data, ok := readImageUpload(w, r, images.MaxBytes())
+		if !ok {
+			return
+		}
+
+		photoURL, err := images.SetPhoto(r.Context(), claims.UserID, data)
+		if err == services.ErrImageOwner {
+			responses.SendErrorResponse(w, http.StatusNotFound, "User not found")
+			return
+		}
+		if err != nil {
+			sendImageError(w, err, images.MaxBytes())
+			return
+		}
+
+		ip := utils.ClientIP(r)
+		audit.Record(models.AuditLog{
+			ActorID:   &claims.UserID,
+			Action:    "account.photo_updated",
+			IPAddress: &ip,
+		})
+
+		responses.SendSuccessResponse(w, http.StatusOK, map[string]string{
+			"message":  "Photo updated successfully",
+			"photoUrl": photoURL,
+		})
+	}
+}
+
+func DeleteMyPhoto(images *services.ImageService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(userClaimsKey).(*utils.Claims)
+		if !ok {
+			responses.SendErrorResponse(w, http.StatusUnauthorized, "Invalid user context")
+			return
+		}
+
+		if err := images.RemovePhoto(r.Context(), claims.UserID); err != nil {
+			if err == storage.ErrNotFound {
+				responses.SendErrorResponse(w, http.StatusNotFound, "No photo uploaded")
+			} else {
+				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to remove photo")
+			}
+			return
+		}
+
+		responses.SendSuccessResponse(w, http.StatusOK, map[string]string{
+			"message": "Photo removed successfully",
+		})
+	}
+}
+
+// GetUserPhoto serves a user's uploaded profile photo in ?size= small,
+// medium (the default) or large.
+func GetUserPhoto(images *services.ImageService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid user ID")
+			return
+		}
+
+		variant, ok := imageVariant(w, r, services.PhotoVariants)
+		if !ok {
+			return
+		}
+
+		body, obj, err := images.OpenPhoto(r.Context(), id, variant)
+		if err == storage.ErrNotFound {
+			responses.SendErrorResponse(w, http.StatusNotFound, "No photo uploaded")
+			return
+		}
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to read photo")
+			return
+		}
+		serveStoredImage(w, r, body, obj)
+	}
+}
+
+// UploadCCTVThumbnail replaces a camera's thumbnail with a multipart upload
+// (field "file"), cropped to 16:9 in several sizes. An uploaded thumbnail
+// takes the place of captured snapshots until it is removed.
+func UploadCCTVThumbnail(db *sql.DB, images *services.ImageService, bus *events.Bus) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid CCTV ID")
+			return
+		}
+
+		data, ok := readImageUpload(w, r, images.MaxBytes())
+		if !ok {
+			return
+		}
+
+		thumbnailURL, err := images.SetThumbnail(r.Context(), id, data)
+		if err == services.ErrImageOwner {
+			responses.SendErrorResponse(w, http.StatusNotFound, "CCTV not found")
+			return
+		}
+		if err != nil {
+			sendImageError(w, err, images.MaxBytes())
+			return
+		}
+
+		publishCCTVEvent(db, bus, events.CCTVUpdated, id, []string{"thumbnailUrl"})
+		publishCCTVEvent(db, bus, events.CCTVThumbnailUpdated, id, nil)
+
+		responses.SendSuccessResponse(w, http.StatusOK, map[string]string{
+			"message":      "Thumbnail updated successfully",
+			"thumbnailUrl": thumbnailURL,
+		})
+	}
+}
+
+// DeleteCCTVThumbnail removes a camera's uploaded thumbnail; captured
+// snapshots become its thumbnail again.
+func DeleteCCTVThumbnail(db *sql.DB, images *services.ImageService, bus *events.Bus) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid CCTV ID")
+			return
+		}
+
+		if err := images.RemoveThumbnail(r.Context(), id); err != nil {
+			if err == storage.ErrNotFound {
+				responses.SendErrorResponse(w, http.StatusNotFound, "No thumbnail uploaded")
+			} else {
+				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to remove thumbnail")
+			}
+			return
+		}
+
+		publishCCTVEvent(db, bus, events.CCTVUpdated, id, []string{"thumbnailUrl"})
+		publishCCTVEvent(db, bus, events.CCTVThumbnailUpdated, id, nil)
+
+		responses.SendSuccessResponse(w, http.StatusOK, map[string]string{
+			"message": "Thumbnail removed successfully",
+		})
+	}
+}
+
+// GetCCTVThumbnail serves the uploaded thumbnail of a camera the user's
+// plan shows, in ?size= small, medium (the default) or large.
+func GetCCTVThumbnail(db *sql.DB, plans *services.PlanService, allotments *services.AllotmentService, images *services.ImageService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cctv, _, ok := loadVisibleCCTV(w, r, db, plans, allotments)
+		if !ok {
+			return
+		}
+
+		variant, ok := imageVariant(w, r, services.ThumbnailVariants)
+		if !ok {
+			return
+		}
+
+		body, obj, err := images.OpenThumbnail(r.Context(), cctv.ID, variant)
+		if err == storage.ErrNotFound {
+			responses.SendErrorResponse(w, http.StatusNotFound, "No thumbnail uploaded")
+			return
+		}
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to read thumbnail")
+			return
+		}
+		serveStoredImage(w, r, body, obj)
+	}
+}
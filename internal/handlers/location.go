@@ -6,8 +6,10 @@ import (
 	"net/http"
 	"strconv"
 
+	"cctv-api/internal/events"
 	"cctv-api/internal/models"
 	"cctv-api/internal/responses"
+	"cctv-api/internal/utils"
 
 	"github.com/gorilla/mux"
 )
@@ -15,7 +17,7 @@ import (
 func GetAllLocations(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		rows, err := db.Query(`
-			SELECT id, name, created_at, updated_at 
+			SELECT id, name, latitude, longitude, created_at, updated_at 
 			FROM locations 
 			ORDER BY name ASC
 		`)
@@ -28,11 +30,16 @@ func GetAllLocations(db *sql.DB) http.HandlerFunc {
 		var locations []models.Location
 		for rows.Next() {
 			var loc models.Location
-			err := rows.Scan(&loc.ID, &loc.Name, &loc.CreatedAt, &loc.UpdatedAt)
+			var lat, lng sql.NullFloat64
+			err := rows.Scan(&loc.ID, &loc.Name, &lat, &lng, &loc.CreatedAt, &loc.UpdatedAt)
 			if err != nil {
 				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to scan location data")
 				return
 			}
+			if lat.Valid && lng.Valid {
+				loc.Latitude = &lat.Float64
+				loc.Longitude = &lng.Float64
+			}
 			locations = append(locations, loc)
 		}
 
@@ -40,10 +47,12 @@ func GetAllLocations(db *sql.DB) http.HandlerFunc {
 	}
 }
 
-func CreateLocation(db *sql.DB) http.HandlerFunc {
+func CreateLocation(db *sql.DB, bus *events.Bus) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var loc struct {
-			Name string `json:"name" validate:"required"`
+			Name      string   `json:"name" validate:"required"`
+			Latitude  *float64 `json:"latitude" validate:"required_with=Longitude,omitempty,latitude"`
+			Longitude *float64 `json:"longitude" validate:"required_with=Latitude,omitempty,longitude"`
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&loc); err != nil {
@@ -51,6 +60,11 @@ func CreateLocation(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		if err := utils.Validate.Struct(loc); err != nil {
+			responses.SendValidationError(w, err)
+			return
+		}
+
 		// Check for existing location with same name
 		var existingID int
 		err := db.QueryRow("SELECT id FROM locations WHERE name = $1", loc.Name).Scan(&existingID)
@@ -63,23 +77,98 @@ func CreateLocation(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		var id int
+		created := models.Location{Name: loc.Name, Latitude: loc.Latitude, Longitude: loc.Longitude}
 		err = db.QueryRow(`
-			INSERT INTO locations (name) 
-			VALUES ($1) 
-			RETURNING id
-		`, loc.Name).Scan(&id)
+			INSERT INTO locations (name, latitude, longitude) 
+			VALUES ($1, $2, $3) 
+			RETURNING id, created_at, updated_at
+		`, loc.Name, loc.Latitude, loc.Longitude).Scan(&created.ID, &created.CreatedAt, &created.UpdatedAt)
 
 		if err != nil {
 			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to create location")
 			return
 		}
 
-		responses.SendSuccessResponse(w, http.StatusCreated, map[string]int{"id": id})
+		bus.Publish(events.LocationCreated, models.LocationEvent{Location: created})
+
+		responses.SendSuccessResponse(w, http.StatusCreated, map[string]int{"id": created.ID})
+	}
+}
+
+// UpdateLocation renames a location or moves it. Latitude and longitude are
+// given together; they place the location for the nearest allotment
+// strategy.
+func UpdateLocation(db *sql.DB, bus *events.Bus) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid location ID")
+			return
+		}
+
+		var loc struct {
+			Name      *string  `json:"name" validate:"omitempty,min=1"`
+			Latitude  *float64 `json:"latitude" validate:"required_with=Longitude,omitempty,latitude"`
+			Longitude *float64 `json:"longitude" validate:"required_with=Latitude,omitempty,longitude"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&loc); err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		if err := utils.Validate.Struct(loc); err != nil {
+			responses.SendValidationError(w, err)
+			return
+		}
+		if loc.Name == nil && loc.Latitude == nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Provide a name or latitude and longitude")
+			return
+		}
+
+		if loc.Name != nil {
+			var existingID int
+			err := db.QueryRow("SELECT id FROM locations WHERE name = $1 AND id <> $2", *loc.Name, id).Scan(&existingID)
+			if err == nil {
+				responses.SendErrorResponse(w, http.StatusConflict,
+					"Location with name '"+*loc.Name+"' already exists (ID: "+strconv.Itoa(existingID)+")")
+				return
+			} else if err != sql.ErrNoRows {
+				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to check for duplicate location")
+				return
+			}
+		}
+
+		updated := models.Location{ID: id}
+		var lat, lng sql.NullFloat64
+		err = db.QueryRow(`
+			UPDATE locations
+			SET name = COALESCE($1, name), latitude = COALESCE($2, latitude),
+				longitude = COALESCE($3, longitude), updated_at = NOW()
+			WHERE id = $4
+			RETURNING name, latitude, longitude, created_at, updated_at
+		`, loc.Name, loc.Latitude, loc.Longitude, id).Scan(&updated.Name, &lat, &lng, &updated.CreatedAt, &updated.UpdatedAt)
+		if err == sql.ErrNoRows {
+			responses.SendErrorResponse(w, http.StatusNotFound, "Location not found")
+			return
+		}
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to update location")
+			return
+		}
+		if lat.Valid && lng.Valid {
+			updated.Latitude = &lat.Float64
+			updated.Longitude = &lng.Float64
+		}
+
+		bus.Publish(events.LocationUpdated, models.LocationEvent{Location: updated})
+
+		responses.SendSuccessResponse(w, http.StatusOK, updated)
 	}
 }
 
-func DeleteLocation(db *sql.DB) http.HandlerFunc {
+func DeleteLocation(db *sql.DB, bus *events.Bus) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 		id, err := strconv.Atoi(vars["id"])
@@ -101,18 +190,27 @@ func DeleteLocation(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		result, err := db.Exec("DELETE FROM locations WHERE id = $1", id)
+		deleted := models.Location{ID: id}
+		var lat, lng sql.NullFloat64
+		err = db.QueryRow(`
+			DELETE FROM locations WHERE id = $1
+			RETURNING name, latitude, longitude, created_at, updated_at
+		`, id).Scan(&deleted.Name, &lat, &lng, &deleted.CreatedAt, &deleted.UpdatedAt)
+		if err == sql.ErrNoRows {
+			responses.SendErrorResponse(w, http.StatusNotFound, "Location not found")
+			return
+		}
 		if err != nil {
 			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to delete location")
 			return
 		}
-
-		rowsAffected, _ := result.RowsAffected()
-		if rowsAffected == 0 {
-			responses.SendErrorResponse(w, http.StatusNotFound, "Location not found")
-			return
+		if lat.Valid && lng.Valid {
+			deleted.Latitude = &lat.Float64
+			deleted.Longitude = &lng.Float64
 		}
 
+		bus.Publish(events.LocationDeleted, models.LocationEvent{Location: deleted})
+
 		responses.SendSuccessResponse(w, http.StatusOK, map[string]string{
 			"message": "Location deleted successfully",
 		})
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cctv-api/internal/events"
+	"cctv-api/internal/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+)
+
+func TestUpdateLocation(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		expect     func(mock sqlmock.Sqlmock)
+		wantStatus int
+		wantEvent  bool
+	}{
+		{
+			name: "coordinates",
+			body: `{"latitude":-6.2,"longitude":106.8}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`UPDATE locations`).WithArgs(nil, -6.2, 106.8, 3).
+					WillReturnRows(sqlmock.NewRows([]string{"name", "latitude", "longitude", "created_at", "updated_at"}).
+						AddRow("Jakarta", -6.2, 106.8, time.Now(), time.Now()))
+			},
+			wantStatus: http.StatusOK,
+			wantEvent:  true,
+		},
+		{
+			name: "name taken",
+			body: `{"name":"Bandung"}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT id FROM locations WHERE name = \$1 AND id <> \$2`).WithArgs("Bandung", 3).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+			},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name: "unknown location",
+			body: `{"latitude":1,"longitude":2}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`UPDATE locations`).WillReturnError(sql.ErrNoRows)
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{name: "latitude without longitude", body: `{"latitude":1}`, expect: func(sqlmock.Sqlmock) {}, wantStatus: http.StatusBadRequest},
+		{name: "latitude out of range", body: `{"latitude":91,"longitude":0}`, expect: func(sqlmock.Sqlmock) {}, wantStatus: http.StatusBadRequest},
+		{name: "nothing to change", body: `{}`, expect: func(sqlmock.Sqlmock) {}, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			tt.expect(mock)
+
+			bus := events.NewBus()
+			var published *models.LocationEvent
+			bus.Subscribe(func(e events.Event) {
+				if e.Type == events.LocationUpdated {
+					data := e.Data.(models.LocationEvent)
+					published = &data
+				}
+			})
+
+			req := httptest.NewRequest(http.MethodPut, "/api/locations/3", strings.NewReader(tt.body))
+			req = mux.SetURLVars(req, map[string]string{"id": "3"})
+			rec := httptest.NewRecorder()
+			UpdateLocation(db, bus)(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if (published != nil) != tt.wantEvent {
+				t.Fatalf("location.updated published = %v, want %v", published != nil, tt.wantEvent)
+			}
+			if published != nil && (published.Location.ID != 3 || published.Location.Latitude == nil || *published.Location.Latitude != -6.2) {
+				t.Errorf("location.updated carries %+v", published.Location)
+			}
+		})
+	}
+}
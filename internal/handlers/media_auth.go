@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"cctv-api/internal/playback"
+	"cctv-api/internal/responses"
+	"cctv-api/internal/services"
+	"cctv-api/internal/utils"
+
+	"github.com/lib/pq"
+)
+
+// mediaAuthRequest is the body MediaMTX posts to its external
+// authentication URL (authHTTPAddress).
+type mediaAuthRequest struct {
+	User     string  `json:"user"`
+	Password string  `json:"password"`
+	Token    string  `json:"token"`
+	IP       string  `json:"ip"`
+	Action   string  `json:"action"`
+	Path     string  `json:"path"`
+	Protocol string  `json:"protocol"`
+	ID       *string `json:"id"`
+	Query    string  `json:"query"`
+}
+
+// mediaPathPattern matches conventional path names that carry the camera
+// ID, such as "cctv/12", "cctv-12", "stream/12" or just "12". Cameras with
+// a media_path set are only matched on that, never by their ID.
+var mediaPathPattern = regexp.MustCompile(`^(?i:(?:cctvs?|cams?|stream)[/_-]?)?([0-9]+)$`)
+
+// resolveMediaPath finds the camera a media server path refers to. Longer
+// leading parts of the path win, so "/live/lobby/index.m3u8" matches a
+// camera whose media path is "live/lobby".
+func resolveMediaPath(db *sql.DB, mediaPath string) (int, error) {
+	segments := strings.Split(strings.Trim(mediaPath, "/"), "/")
+	var candidates []string
+	for n := len(segments); n >= 1; n-- {
+		if candidate := strings.Join(segments[:n], "/"); candidate != "" {
+			candidates = append(candidates, candidate)
+		}
+	}
+	if len(candidates) == 0 {
+		return 0, sql.ErrNoRows
+	}
+
+	rows, err := db.Query("SELECT id, media_path FROM cctvs WHERE media_path = ANY($1)", pq.Array(candidates))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	bestID, bestLen := 0, 0
+	for rows.Next() {
+		var id int
+		var path string
+		if err := rows.Scan(&id, &path); err != nil {
+			return 0, err
+		}
+		if len(path) > bestLen {
+			bestID, bestLen = id, len(path)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if bestID != 0 {
+		return bestID, nil
+	}
+
+	for _, candidate := range candidates {
+		m := mediaPathPattern.FindStringSubmatch(candidate)
+		if m == nil {
+			continue
+		}
+		id, err := strconv.Atoi(m[1])
+		if err != nil {
+			continue
+		}
+		var hasMediaPath bool
+		err = db.QueryRow("SELECT COALESCE(media_path, '') <> '' FROM cctvs WHERE id = $1", id).Scan(&hasMediaPath)
+		if err == sql.ErrNoRows || (err == nil && hasMediaPath) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		return id, nil
+	}
+	return 0, sql.ErrNoRows
+}
+
+// MediaAuth is an authentication hook for media servers. It speaks both
+// MediaMTX's external authentication (a JSON POST per read or publish) and
+// nginx auth_request (a GET subrequest; pass the original URI in
+// X-Original-URI). The caller may present a JWT, an API key or a playback
+// token: as the MediaMTX token or password, as a Bearer, X-API-Key or
+// X-Playback-Token header, or as a token, access_token or api_key query
+// parameter. Reads are allowed when the camera is visible under the user's
+// plan; publishing and the media server's own API need an admin.
+//
+// Answers 204 to allow, 401 without valid credentials and 403 otherwise.
+func MediaAuth(db *sql.DB, jwtUtil *utils.JWTUtil, sessions *services.SessionService, apiKeys *services.APIKeyService, plans *services.PlanService, allotments *services.AllotmentService, signer *playback.Signer) http.HandlerFunc {
+	// identify returns who a credential belongs to and, for playback
+	// tokens, the only camera it is good for
+	identify := func(credential string) (*utils.Claims, int, bool) {
+		switch {
+		case strings.HasPrefix(credential, services.APIKeyPrefix):
+			userID, role, err := apiKeys.Authenticate(credential)
+			if err != nil {
+				if err != services.ErrInvalidAPIKey {
+					log.Printf("Failed to check API key: %v", err)
+				}
+				return nil, 0, false
+			}
+			return &utils.Claims{UserID: userID, Role: role}, 0, true
+		case strings.Count(credential, ".") == 3:
+			grant, err := signer.Verify(credential, time.Now())
+			if err != nil {
+				return nil, 0, false
+			}
+			claims := &utils.Claims{UserID: grant.UserID}
+			if err := db.QueryRow("SELECT role FROM users WHERE id = $1", grant.UserID).Scan(&claims.Role); err != nil {
+				return nil, 0, false
+			}
+			return claims, grant.CCTVID, true
+		default:
+			claims, err := authenticateSession(jwtUtil, sessions, credential)
+			if err != nil {
+				return nil, 0, false
+			}
+			return claims, 0, true
+		}
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req mediaAuthRequest
+		var credentials []string
+
+		if r.Method == http.MethodPost {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+				return
+			}
+			credentials = append(credentials, req.Token, req.Password)
+		} else {
+			original := r.Header.Get("X-Original-URI")
+			if original == "" {
+				original = r.Header.Get("X-Forwarded-Uri")
+			}
+			u, err := url.Parse(original)
+			if original == "" || err != nil {
+				responses.SendErrorResponse(w, http.StatusForbidden, "X-Original-URI header is required")
+				return
+			}
+			req.Action = "read"
+			req.Path = u.Path
+			req.Query = u.RawQuery
+
+			credentials = append(credentials,
+				strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "),
+				r.Header.Get("X-API-Key"),
+				r.Header.Get("X-Playback-Token"),
+			)
+		}
+		if query, err := url.ParseQuery(req.Query); err == nil {
+			credentials = append(credentials, query.Get("token"), query.Get("access_token"), query.Get("api_key"))
+		}
+
+		read := req.Action == "read" || req.Action == "playback"
+
+		// Reads are of a camera; the other actions (publish, api, metrics,
+		// pprof) are for admins whatever the path
+		var cctvID int
+		if read {
+			var err error
+			cctvID, err = resolveMediaPath(db, req.Path)
+			if err != nil {
+				if err != sql.ErrNoRows {
+					log.Printf("Failed to resolve media path %q: %v", req.Path, err)
+				}
+				responses.SendErrorResponse(w, http.StatusForbidden, "Unknown stream path")
+				return
+			}
+		}
+
+		var claims *utils.Claims
+		for _, credential := range credentials {
+			if credential == "" {
+				continue
+			}
+			c, tokenCCTV, ok := identify(credential)
+			// Playback tokens only allow reading their own camera
+			if !ok || (tokenCCTV != 0 && (!read || tokenCCTV != cctvID)) {
+				continue
+			}
+			claims = c
+			break
+		}
+		if claims == nil {
+			responses.SendErrorResponse(w, http.StatusUnauthorized, "Valid credentials are required")
+			return
+		}
+
+		if !read {
+			if claims.Role != "admin" {
+				responses.SendErrorResponse(w, http.StatusForbidden, "Access denied: admin role required")
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		cctv, err := loadCCTV(db, cctvID)
+		if err == sql.ErrNoRows {
+			responses.SendErrorResponse(w, http.StatusForbidden, "Unknown stream path")
+			return
+		}
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to fetch CCTV")
+			return
+		}
+
+		visible, err := canViewCCTV(claims, plans, allotments, cctv)
+		if err != nil {
+			log.Printf("Failed to check camera access for user %d: %v", claims.UserID, err)
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to get user info")
+			return
+		}
+		if !visible {
+			responses.SendErrorResponse(w, http.StatusForbidden, "Camera is not available on your plan")
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
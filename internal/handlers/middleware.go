@@ -1,21 +1,34 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
 
+	"cctv-api/internal/ratelimit"
 	"cctv-api/internal/responses"
+	"cctv-api/internal/services"
 	"cctv-api/internal/utils"
 )
 
 type contextKey string
 
 const (
-	userClaimsKey contextKey = "userClaims"
+	userClaimsKey   contextKey = "userClaims"
+	sessionTokenKey contextKey = "sessionToken"
+	// apiKeyIDKey holds the ID of the API key a request was authenticated
+	// with, once the key has been validated
+	apiKeyIDKey contextKey = "apiKeyID"
 )
 
-func JWTMiddleware(jwtUtil *utils.JWTUtil) func(http.Handler) http.Handler {
+func JWTMiddleware(jwtUtil *utils.JWTUtil, sessions *services.SessionService) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Skip middleware untuk endpoint tertentu
@@ -27,6 +40,13 @@ func JWTMiddleware(jwtUtil *utils.JWTUtil) func(http.Handler) http.Handler {
 			}
 
 			authHeader := r.Header.Get("Authorization")
+			// Browsers cannot set headers on a WebSocket handshake, so it
+			// may carry the token as ?access_token= instead
+			if authHeader == "" && isWebSocketUpgrade(r) {
+				if token := r.URL.Query().Get("access_token"); token != "" {
+					authHeader = "Bearer " + token
+				}
+			}
 			if authHeader == "" {
 				responses.SendErrorResponse(w, http.StatusUnauthorized, "Authorization header is required")
 				return
@@ -38,21 +58,14 @@ func JWTMiddleware(jwtUtil *utils.JWTUtil) func(http.Handler) http.Handler {
 				return
 			}
 
-			claims, err := jwtUtil.ValidateToken(tokenString)
+			claims, err := authenticateSession(jwtUtil, sessions, tokenString)
 			if err != nil {
-				responses.SendErrorResponse(w, http.StatusUnauthorized, "Invalid token: "+err.Error())
-				return
-			}
-
-			// Verify token matches the one in database
-			var dbToken string
-			err = jwtUtil.DB.QueryRow("SELECT session_token FROM users WHERE id = $1", claims.UserID).Scan(&dbToken)
-			if err != nil || dbToken != tokenString {
-				responses.SendErrorResponse(w, http.StatusUnauthorized, "Token mismatch - possibly logged in from another device")
+				responses.SendErrorResponse(w, http.StatusUnauthorized, err.Error())
 				return
 			}
 
 			ctx := context.WithValue(r.Context(), userClaimsKey, claims)
+			ctx = context.WithValue(ctx, sessionTokenKey, tokenString)
 			ctx = context.WithValue(ctx, "userID", claims.UserID)
 			ctx = context.WithValue(ctx, "userRole", claims.Role)
 			r = r.WithContext(ctx)
@@ -62,6 +75,27 @@ func JWTMiddleware(jwtUtil *utils.JWTUtil) func(http.Handler) http.Handler {
 	}
 }
 
+// authenticateSession validates a JWT and checks that it is still a live
+// session within the user's plan. The error is meant for the client.
+func authenticateSession(jwtUtil *utils.JWTUtil, sessions *services.SessionService, tokenString string) (*utils.Claims, error) {
+	claims, err := jwtUtil.ValidateToken(tokenString)
+	if err != nil {
+		return nil, errors.New("Invalid token: " + err.Error())
+	}
+
+	switch err := sessions.Check(claims.UserID, tokenString); err {
+	case nil:
+		return claims, nil
+	case services.ErrSessionNotFound:
+		return nil, errors.New("Session ended - please log in again")
+	case services.ErrSessionLimitReached:
+		return nil, errors.New("Session limit of your plan reached - please log in again")
+	default:
+		log.Printf("Failed to check session of user %d: %v", claims.UserID, err)
+		return nil, errors.New("Failed to check session")
+	}
+}
+
 func AdminMiddleware() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -75,3 +109,78 @@ func AdminMiddleware() func(http.Handler) http.Handler {
 		})
 	}
 }
+
+func RateLimitMiddleware(store *ratelimit.Store, policy ratelimit.Policy) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			result := store.Allow(policy, rateLimitKey(r, policy.KeyBy))
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset.Seconds())))
+			w.Header().Set("RateLimit-Policy", strconv.Itoa(policy.Limit)+";w="+strconv.Itoa(ceilSeconds(policy.Period.Seconds())))
+
+			if !result.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter.Seconds())))
+				responses.SendErrorResponse(w, http.StatusTooManyRequests, "Too many requests. Please try again later.")
+				return
+			}
+			next(w, r)
+		}
+	}
+}
+
+// rateLimitKey identifies the client a request is counted against. Requests
+// that lack the configured identifier fall back to the client IP.
+func rateLimitKey(r *http.Request, keyBy string) string {
+	switch keyBy {
+	case ratelimit.KeyByUser:
+		if claims, ok := r.Context().Value(userClaimsKey).(*utils.Claims); ok {
+			return "user:" + strconv.Itoa(claims.UserID)
+		}
+	case ratelimit.KeyByAPIKey:
+		// Only a validated key counts; made-up X-API-Key values would each
+		// get a fresh bucket
+		if keyID, ok := r.Context().Value(apiKeyIDKey).(int); ok {
+			return "apikey:" + strconv.Itoa(keyID)
+		}
+	case ratelimit.KeyByEmail:
+		if email := peekEmail(r); email != "" {
+			return "email:" + email
+		}
+	}
+	return "ip:" + utils.ClientIP(r)
+}
+
+// peekEmail reads the email (or username) from a JSON body and restores the
+// body so the handler can decode it again. Only the first megabyte is
+// looked at; the rest stays unread behind it.
+func peekEmail(r *http.Request) string {
+	if r.Body == nil {
+		return ""
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	if err != nil {
+		return ""
+	}
+
+	var payload struct {
+		Email    string `json:"email"`
+		Username string `json:"username"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return ""
+	}
+	if payload.Email != "" {
+		return strings.ToLower(strings.TrimSpace(payload.Email))
+	}
+	return strings.ToLower(strings.TrimSpace(payload.Username))
+}
+
+func ceilSeconds(seconds float64) int {
+	return int(math.Ceil(seconds))
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cctv-api/internal/ratelimit"
+	"cctv-api/internal/services"
+	"cctv-api/internal/utils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestJWTMiddlewareSession(t *testing.T) {
+	tests := []struct {
+		name               string
+		rank               int // 0 when the token has no live session
+		concurrentSessions int
+		wantStatus         int
+	}{
+		{name: "live session", rank: 1, concurrentSessions: 1, wantStatus: http.StatusOK},
+		{name: "signed out", wantStatus: http.StatusUnauthorized},
+		{name: "beyond the plan's sessions", rank: 2, concurrentSessions: 1, wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			jwtUtil := utils.NewJWTUtil("secret", time.Hour, db)
+			token, err := jwtUtil.GenerateToken(7, "user")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			query := mock.ExpectQuery(`FROM user_sessions`).WithArgs(7, sqlmock.AnyArg())
+			if tt.rank == 0 {
+				query.WillReturnError(sql.ErrNoRows)
+			} else {
+				query.WillReturnRows(sqlmock.NewRows([]string{"rank"}).AddRow(tt.rank))
+				expectDefaultPlan(mock, 3, tt.concurrentSessions)
+			}
+
+			sessions := services.NewSessionService(db, services.NewPlanService(db))
+			handler := JWTMiddleware(jwtUtil, sessions)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Context().Value(sessionTokenKey) != token {
+					t.Error("session token missing from the request context")
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/api/cctv", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestRateLimitKey(t *testing.T) {
+	withValue := func(key contextKey, value interface{}) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/api/cctv", nil)
+		r.RemoteAddr = "203.0.113.7:50000"
+		r.Header.Set("X-API-Key", "cctv_made-up")
+		if value != nil {
+			r = r.WithContext(context.WithValue(r.Context(), key, value))
+		}
+		return r
+	}
+
+	tests := []struct {
+		name  string
+		r     *http.Request
+		keyBy string
+		want  string
+	}{
+		{"ip", withValue("", nil), ratelimit.KeyByIP, "ip:203.0.113.7"},
+		{"user", withValue(userClaimsKey, &utils.Claims{UserID: 7}), ratelimit.KeyByUser, "user:7"},
+		{"anonymous user", withValue("", nil), ratelimit.KeyByUser, "ip:203.0.113.7"},
+		{"validated API key", withValue(apiKeyIDKey, 12), ratelimit.KeyByAPIKey, "apikey:12"},
+		{"unvalidated API key header", withValue("", nil), ratelimit.KeyByAPIKey, "ip:203.0.113.7"},
+	}
+
+	for _, tt := range tests {
+		if got := rateLimitKey(tt.r, tt.keyBy); got != tt.want {
+			t.Errorf("%s: rateLimitKey() = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
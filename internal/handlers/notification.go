@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"cctv-api/internal/responses"
+	"cctv-api/internal/services"
+	"cctv-api/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+func GetMyNotifications(notifications *services.NotificationService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(userClaimsKey).(*utils.Claims)
+		if !ok {
+			responses.SendErrorResponse(w, http.StatusUnauthorized, "Invalid user context")
+			return
+		}
+
+		limit := 50
+		if raw := r.URL.Query().Get("limit"); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 1 || n > 200 {
+				responses.SendErrorResponse(w, http.StatusBadRequest, "limit must be between 1 and 200")
+				return
+			}
+			limit = n
+		}
+		unreadOnly := r.URL.Query().Get("unread") == "true"
+
+		list, err := notifications.List(claims.UserID, unreadOnly, limit)
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to fetch notifications")
+			return
+		}
+
+		unread, err := notifications.UnreadCount(claims.UserID)
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to fetch notifications")
+			return
+		}
+
+		responses.SendSuccessResponse(w, http.StatusOK, map[string]interface{}{
+			"notifications": list,
+			"unreadCount":   unread,
+		})
+	}
+}
+
+func MarkNotificationRead(notifications *services.NotificationService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(userClaimsKey).(*utils.Claims)
+		if !ok {
+			responses.SendErrorResponse(w, http.StatusUnauthorized, "Invalid user context")
+			return
+		}
+
+		vars := mux.Vars(r)
+		id, err := strconv.ParseInt(vars["id"], 10, 64)
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid notification ID")
+			return
+		}
+
+		if err := notifications.MarkRead(claims.UserID, id); err != nil {
+			if err == services.ErrNotificationNotFound {
+				responses.SendErrorResponse(w, http.StatusNotFound, "Notification not found")
+			} else {
+				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to update notification")
+			}
+			return
+		}
+
+		responses.SendSuccessResponse(w, http.StatusOK, map[string]string{
+			"message": "Notification marked as read",
+		})
+	}
+}
+
+func MarkAllNotificationsRead(notifications *services.NotificationService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(userClaimsKey).(*utils.Claims)
+		if !ok {
+			responses.SendErrorResponse(w, http.StatusUnauthorized, "Invalid user context")
+			return
+		}
+
+		if err := notifications.MarkAllRead(claims.UserID); err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to update notifications")
+			return
+		}
+
+		responses.SendSuccessResponse(w, http.StatusOK, map[string]string{
+			"message": "All notifications marked as read",
+		})
+	}
+}
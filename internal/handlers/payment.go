@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"cctv-api/internal/payments"
+	"cctv-api/internal/responses"
+	"cctv-api/internal/services"
+	"cctv-api/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+func GetMyOrders(paymentService *services.PaymentService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(userClaimsKey).(*utils.Claims)
+		if !ok {
+			responses.SendErrorResponse(w, http.StatusUnauthorized, "Invalid user context")
+			return
+		}
+
+		orders, err := paymentService.ListOrders(claims.UserID)
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to fetch orders")
+			return
+		}
+
+		responses.SendSuccessResponse(w, http.StatusOK, orders)
+	}
+}
+
+func CancelMyOrder(paymentService *services.PaymentService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(userClaimsKey).(*utils.Claims)
+		if !ok {
+			responses.SendErrorResponse(w, http.StatusUnauthorized, "Invalid user context")
+			return
+		}
+
+		reference := mux.Vars(r)["reference"]
+		err := paymentService.CancelOrder(claims.UserID, reference)
+		if err != nil {
+			switch err {
+			case services.ErrOrderNotFound:
+				responses.SendErrorResponse(w, http.StatusNotFound, "Order not found")
+			case services.ErrOrderNotPending:
+				responses.SendErrorResponse(w, http.StatusConflict, "Only pending orders can be cancelled")
+			default:
+				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to cancel order")
+			}
+			return
+		}
+
+		responses.SendSuccessResponse(w, http.StatusOK, map[string]string{
+			"message": "Order cancelled successfully",
+		})
+	}
+}
+
+func PaymentWebhook(paymentService *services.PaymentService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		notification, err := paymentService.Provider().ParseWebhook(r)
+		if err != nil {
+			if err == payments.ErrInvalidSignature {
+				responses.SendErrorResponse(w, http.StatusUnauthorized, "Invalid signature")
+			} else {
+				responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid notification")
+			}
+			return
+		}
+
+		if err := paymentService.HandleNotification(notification); err != nil {
+			switch err {
+			case services.ErrOrderNotFound:
+				responses.SendErrorResponse(w, http.StatusNotFound, "Order not found")
+			default:
+				log.Printf("Failed to process payment notification %s: %v", notification.EventID, err)
+				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to process notification")
+			}
+			return
+		}
+
+		responses.SendSuccessResponse(w, http.StatusOK, map[string]string{
+			"message": "Notification processed",
+		})
+	}
+}
+
+// SimulateFakePayment plays the fake provider's part: it signs a callback for
+// the order and feeds it through the regular webhook handler.
+func SimulateFakePayment(paymentService *services.PaymentService, provider *payments.FakeProvider) http.HandlerFunc {
+	webhook := PaymentWebhook(paymentService)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		reference := vars["reference"]
+
+		status := r.URL.Query().Get("status")
+		if status == "" {
+			status = payments.StatusSettlement
+		}
+
+		order, err := paymentService.GetOrder(reference)
+		if err != nil {
+			if err == services.ErrOrderNotFound {
+				responses.SendErrorResponse(w, http.StatusNotFound, "Order not found")
+			} else {
+				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to fetch order")
+			}
+			return
+		}
+
+		req, err := provider.Simulate(reference, status, order.Amount, order.Currency)
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to build notification")
+			return
+		}
+
+		webhook(w, req.WithContext(r.Context()))
+	}
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cctv-api/internal/events"
+	"cctv-api/internal/payments"
+	"cctv-api/internal/services"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestPaymentWebhook(t *testing.T) {
+	orderColumns := []string{"id", "reference", "user_id", "plan_id", "name", "amount", "currency", "status", "provider",
+		"checkout_url", "subscription_id", "paid_at", "created_at", "updated_at"}
+	provider := payments.NewFakeProvider("secret", "")
+
+	tests := []struct {
+		name       string
+		signedBy   *payments.FakeProvider
+		amount     int64
+		expect     func(mock sqlmock.Sqlmock)
+		wantStatus int
+	}{
+		{
+			name:     "amount mismatch acknowledged",
+			signedBy: provider,
+			amount:   1500,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(`INSERT INTO payment_events`).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectQuery(`FOR UPDATE OF o`).WithArgs("ORD-1").WillReturnRows(sqlmock.NewRows(orderColumns).
+					AddRow(5, "ORD-1", 7, 2, "pro", 150000, "IDR", "pending", "fake", nil, nil, nil, time.Now(), time.Now()))
+				mock.ExpectExec(`UPDATE orders SET status = 'refund_required'`).WithArgs(5).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				mock.ExpectExec(`INSERT INTO audit_logs`).WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:     "unknown order",
+			signedBy: provider,
+			amount:   150000,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(`INSERT INTO payment_events`).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectQuery(`FOR UPDATE OF o`).WillReturnError(sql.ErrNoRows)
+				mock.ExpectRollback()
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "forged callback",
+			signedBy:   payments.NewFakeProvider("other", ""),
+			amount:     150000,
+			expect:     func(mock sqlmock.Sqlmock) {},
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			tt.expect(mock)
+			paymentService := services.NewPaymentService(db, provider, services.NewPlanService(db), services.NewAuditService(db), events.NewBus())
+
+			req, err := tt.signedBy.Simulate("ORD-1", payments.StatusSettlement, tt.amount, "IDR")
+			if err != nil {
+				t.Fatal(err)
+			}
+			rec := httptest.NewRecorder()
+			PaymentWebhook(paymentService)(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+}
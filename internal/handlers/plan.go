@@ -0,0 +1,285 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"cctv-api/internal/events"
+	"cctv-api/internal/models"
+	"cctv-api/internal/responses"
+	"cctv-api/internal/services"
+	"cctv-api/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+func GetPlans(plans *services.PlanService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		list, err := plans.ListPlans(false)
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to fetch plans")
+			return
+		}
+
+		responses.SendSuccessResponse(w, http.StatusOK, list)
+	}
+}
+
+func GetAllPlans(plans *services.PlanService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		list, err := plans.ListPlans(true)
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to fetch plans")
+			return
+		}
+
+		responses.SendSuccessResponse(w, http.StatusOK, list)
+	}
+}
+
+func CreatePlan(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req models.CreatePlanRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		if err := utils.Validate.Struct(req); err != nil {
+			responses.SendValidationError(w, err)
+			return
+		}
+
+		currency := "IDR"
+		if req.Currency != nil {
+			currency = strings.ToUpper(*req.Currency)
+		}
+
+		maxStreamQuality := models.StreamMain
+		if req.MaxStreamQuality != nil {
+			maxStreamQuality = *req.MaxStreamQuality
+		}
+
+		concurrentSessions := 1
+		if req.ConcurrentSessions != nil {
+			concurrentSessions = *req.ConcurrentSessions
+		}
+
+		var id int
+		err := db.QueryRow(`
+			INSERT INTO plans (name, camera_quota, device_limit, concurrent_sessions, can_export, max_stream_quality, price, currency, duration_days)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			RETURNING id
+		`, req.Name, req.CameraQuota, req.DeviceLimit, concurrentSessions, req.CanExport, maxStreamQuality, req.Price, currency, req.DurationDays).Scan(&id)
+		if err != nil {
+			if err.Error() == `pq: duplicate key value violates unique constraint "plans_name_key"` {
+				responses.SendErrorResponse(w, http.StatusConflict, "Plan with name '"+req.Name+"' already exists")
+			} else {
+				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to create plan")
+			}
+			return
+		}
+
+		responses.SendSuccessResponse(w, http.StatusCreated, map[string]int{"id": id})
+	}
+}
+
+func UpdatePlan(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid plan ID")
+			return
+		}
+
+		var req models.UpdatePlanRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		if err := utils.Validate.Struct(req); err != nil {
+			responses.SendValidationError(w, err)
+			return
+		}
+
+		query := "UPDATE plans SET updated_at = NOW()"
+		args := []interface{}{}
+		argPos := 1
+
+		if req.UnlimitedCameras != nil && *req.UnlimitedCameras {
+			query += ", camera_quota = NULL"
+		} else if req.CameraQuota != nil {
+			query += ", camera_quota = $" + strconv.Itoa(argPos)
+			args = append(args, *req.CameraQuota)
+			argPos++
+		}
+
+		if req.DeviceLimit != nil {
+			query += ", device_limit = $" + strconv.Itoa(argPos)
+			args = append(args, *req.DeviceLimit)
+			argPos++
+		}
+
+		if req.ConcurrentSessions != nil {
+			query += ", concurrent_sessions = $" + strconv.Itoa(argPos)
+			args = append(args, *req.ConcurrentSessions)
+			argPos++
+		}
+
+		if req.CanExport != nil {
+			query += ", can_export = $" + strconv.Itoa(argPos)
+			args = append(args, *req.CanExport)
+			argPos++
+		}
+
+		if req.MaxStreamQuality != nil {
+			query += ", max_stream_quality = $" + strconv.Itoa(argPos)
+			args = append(args, *req.MaxStreamQuality)
+			argPos++
+		}
+
+		if req.Price != nil {
+			query += ", price = $" + strconv.Itoa(argPos)
+			args = append(args, *req.Price)
+			argPos++
+		}
+
+		if req.DurationDays != nil {
+			query += ", duration_days = $" + strconv.Itoa(argPos)
+			args = append(args, *req.DurationDays)
+			argPos++
+		}
+
+		if req.IsActive != nil {
+			query += ", is_active = $" + strconv.Itoa(argPos)
+			args = append(args, *req.IsActive)
+			argPos++
+		}
+
+		query += " WHERE id = $" + strconv.Itoa(argPos)
+		args = append(args, id)
+
+		result, err := db.Exec(query, args...)
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to update plan")
+			return
+		}
+
+		rowsAffected, _ := result.RowsAffected()
+		if rowsAffected == 0 {
+			responses.SendErrorResponse(w, http.StatusNotFound, "Plan not found")
+			return
+		}
+
+		responses.SendSuccessResponse(w, http.StatusOK, map[string]string{
+			"message": "Plan updated successfully",
+		})
+	}
+}
+
+func GetMySubscription(plans *services.PlanService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(userClaimsKey).(*utils.Claims)
+		if !ok {
+			responses.SendErrorResponse(w, http.StatusUnauthorized, "Invalid user context")
+			return
+		}
+
+		plan, sub, err := plans.UserPlan(claims.UserID)
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to get subscription")
+			return
+		}
+
+		responses.SendSuccessResponse(w, http.StatusOK, map[string]interface{}{
+			"plan":         plan,
+			"subscription": sub,
+		})
+	}
+}
+
+func GrantSubscription(db *sql.DB, plans *services.PlanService, audit *services.AuditService, bus *events.Bus) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(userClaimsKey).(*utils.Claims)
+		if !ok {
+			responses.SendErrorResponse(w, http.StatusUnauthorized, "Invalid user context")
+			return
+		}
+
+		vars := mux.Vars(r)
+		userID, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid user ID")
+			return
+		}
+
+		var req models.GrantSubscriptionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		if err := utils.Validate.Struct(req); err != nil {
+			responses.SendValidationError(w, err)
+			return
+		}
+
+		var duration *time.Duration
+		if req.DurationDays != nil {
+			d := time.Duration(*req.DurationDays) * 24 * time.Hour
+			duration = &d
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Database error")
+			return
+		}
+		defer tx.Rollback()
+
+		var exists bool
+		if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)", userID).Scan(&exists); err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Database error")
+			return
+		}
+		if !exists {
+			responses.SendErrorResponse(w, http.StatusNotFound, "User not found")
+			return
+		}
+
+		sub, err := plans.Subscribe(tx, userID, req.PlanID, duration, "manual")
+		if err != nil {
+			if err == services.ErrPlanNotFound {
+				responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid plan ID")
+			} else {
+				log.Printf("Failed to grant subscription to user %d: %v", userID, err)
+				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to grant subscription")
+			}
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to grant subscription")
+			return
+		}
+
+		ip := utils.ClientIP(r)
+		audit.Record(models.AuditLog{
+			ActorID:   &claims.UserID,
+			UserID:    &userID,
+			Action:    "subscription.granted",
+			IPAddress: &ip,
+			Details:   map[string]interface{}{"planId": req.PlanID, "subscriptionId": sub.ID, "expiresAt": sub.ExpiresAt},
+		})
+		services.PublishUpgrade(bus, sub)
+
+		responses.SendSuccessResponse(w, http.StatusOK, sub)
+	}
+}
@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cctv-api/internal/models"
+	"cctv-api/internal/playback"
+	"cctv-api/internal/responses"
+	"cctv-api/internal/services"
+	"cctv-api/internal/streamproxy"
+	"cctv-api/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// presentCCTV replaces a camera's source URL with a playback URL signed for
+// the user, playing the camera's stream for quality. Operators keep the
+// source URL as well.
+func presentCCTV(cctv *models.CCTV, claims *utils.Claims, signer *playback.Signer, quality string, now time.Time) {
+	setPlayback(cctv, claims.UserID, signer, quality, now)
+	if claims.Role != "admin" {
+		hideOrigin(cctv)
+	}
+}
+
+// setPlayback sets where the user plays the camera from, by the source
+// type of the chosen stream: HLS, MJPEG and snapshots through the stream
+// proxy, RTSP through the media server, and embeds straight from the embed
+// URL, which never expires. RTSP cameras get no playback URL without a
+// media server.
+func setPlayback(cctv *models.CCTV, userID int, signer *playback.Signer, quality string, now time.Time) {
+	role, streamURL, sourceType := chooseStream(cctv, quality)
+	cctv.Quality = role
+	cctv.PlaybackURL, cctv.PlaybackExpiresAt = "", nil
+
+	var playURL string
+	var expiresAt time.Time
+	switch sourceType {
+	case models.SourceEmbed:
+		cctv.PlaybackURL = streamURL
+		return
+	case models.SourceRTSP:
+		// The media server path is the camera's media path or, by
+		// convention, stream/{id}; other streams than the main one are
+		// below it, e.g. stream/{id}/sub
+		mediaPath := "stream/" + strconv.Itoa(cctv.ID)
+		if cctv.MediaPath != nil {
+			mediaPath = *cctv.MediaPath
+		}
+		if role != models.StreamMain {
+			mediaPath += "/" + role
+		}
+		var ok bool
+		playURL, expiresAt, ok = signer.MediaServerURL(cctv.ID, userID, mediaPath, now)
+		if !ok {
+			return
+		}
+	default:
+		file := streamproxy.RootPlaylist
+		switch sourceType {
+		case models.SourceMJPEG:
+			file = streamproxy.RootMJPEG
+		case models.SourceSnapshot:
+			file = streamproxy.RootSnapshot
+		}
+		playURL, expiresAt = signer.URL(cctv.ID, userID, file, now)
+		if role != models.StreamMain {
+			playURL += "&quality=" + role
+		}
+	}
+	cctv.PlaybackURL, cctv.PlaybackExpiresAt = playURL, &expiresAt
+}
+
+// hideOrigin strips what only operators may see: where the stream really
+// comes from.
+func hideOrigin(cctv *models.CCTV) {
+	cctv.SourceURL = ""
+	cctv.MediaPath = nil
+	for i := range cctv.Streams {
+		cctv.Streams[i].URL = ""
+	}
+}
+
+// canViewCCTV reports whether the user's plan shows the camera. Operators
+// see every camera, including inactive ones.
+func canViewCCTV(claims *utils.Claims, plans *services.PlanService, allotments *services.AllotmentService, cctv *models.CCTV) (bool, error) {
+	if claims.Role == "admin" {
+		return true, nil
+	}
+	if !cctv.IsActive {
+		return false, nil
+	}
+
+	plan, _, err := plans.UserPlan(claims.UserID)
+	if err != nil {
+		return false, err
+	}
+	if !plan.HasCameraQuota() {
+		return true, nil
+	}
+
+	ids, err := allotments.Ensure(claims.UserID, *plan.CameraQuota)
+	if err != nil {
+		return false, err
+	}
+	for _, id := range ids {
+		if id == cctv.ID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// loadVisibleCCTV loads a camera for the signed-in user, answering 404 for
+// cameras their plan does not show.
+func loadVisibleCCTV(w http.ResponseWriter, r *http.Request, db *sql.DB, plans *services.PlanService, allotments *services.AllotmentService) (*models.CCTV, *utils.Claims, bool) {
+	claims, ok := r.Context().Value(userClaimsKey).(*utils.Claims)
+	if !ok {
+		responses.SendErrorResponse(w, http.StatusUnauthorized, "Invalid user context")
+		return nil, nil, false
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid CCTV ID")
+		return nil, nil, false
+	}
+
+	cctv, err := loadCCTV(db, id)
+	if err == sql.ErrNoRows {
+		responses.SendErrorResponse(w, http.StatusNotFound, "CCTV not found")
+		return nil, nil, false
+	}
+	if err != nil {
+		responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to fetch CCTV")
+		return nil, nil, false
+	}
+
+	visible, err := canViewCCTV(claims, plans, allotments, cctv)
+	if err != nil {
+		log.Printf("Failed to check camera access for user %d: %v", claims.UserID, err)
+		responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to get user info")
+		return nil, nil, false
+	}
+	if !visible {
+		responses.SendErrorResponse(w, http.StatusNotFound, "CCTV not found")
+		return nil, nil, false
+	}
+	return cctv, claims, true
+}
+
+// loadPlayableCCTV is loadVisibleCCTV for handing out a playback URL: it
+// also loads the camera's streams and works out the quality to play.
+func loadPlayableCCTV(w http.ResponseWriter, r *http.Request, db *sql.DB, plans *services.PlanService, allotments *services.AllotmentService, streams *services.StreamService) (*models.CCTV, *utils.Claims, string, bool) {
+	cctv, claims, ok := loadVisibleCCTV(w, r, db, plans, allotments)
+	if !ok {
+		return nil, nil, "", false
+	}
+
+	quality, ok := viewerQuality(w, r, claims, plans)
+	if !ok {
+		return nil, nil, "", false
+	}
+
+	list, err := streams.List(cctv.ID)
+	if err != nil {
+		responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to fetch CCTV")
+		return nil, nil, "", false
+	}
+	cctv.Streams = list
+	return cctv, claims, quality, true
+}
+
+// GetCCTV returns a camera the user's plan shows, with a playback URL for
+// ?quality= (main, sub or snapshot; the best the plan allows by default).
+func GetCCTV(db *sql.DB, plans *services.PlanService, allotments *services.AllotmentService, streams *services.StreamService, signer *playback.Signer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cctv, claims, quality, ok := loadPlayableCCTV(w, r, db, plans, allotments, streams)
+		if !ok {
+			return
+		}
+
+		presentCCTV(cctv, claims, signer, quality, time.Now())
+		responses.SendSuccessResponse(w, http.StatusOK, cctv)
+	}
+}
+
+// GetPlaybackURL issues a fresh playback URL, e.g. when the previous one is
+// about to expire or to switch to another ?quality=.
+func GetPlaybackURL(db *sql.DB, plans *services.PlanService, allotments *services.AllotmentService, streams *services.StreamService, signer *playback.Signer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cctv, claims, quality, ok := loadPlayableCCTV(w, r, db, plans, allotments, streams)
+		if !ok {
+			return
+		}
+
+		setPlayback(cctv, claims.UserID, signer, quality, time.Now())
+		if cctv.PlaybackURL == "" {
+			responses.SendErrorResponse(w, http.StatusNotFound, "Camera has no playback URL")
+			return
+		}
+		responses.SendSuccessResponse(w, http.StatusOK, map[string]interface{}{
+			"cctvId":      cctv.ID,
+			"sourceType":  cctv.SourceType,
+			"quality":     cctv.Quality,
+			"playbackUrl": cctv.PlaybackURL,
+			"expiresAt":   cctv.PlaybackExpiresAt,
+		})
+	}
+}
+
+// VerifyPlaybackToken lets media servers check a playback token, passed as
+// ?token= or in the X-Playback-Token header. With ?cctvId= the token must
+// also be for that camera. Answers 200 with the grant, 401 for a bad or
+// expired token and 403 for the wrong or a deactivated camera.
+func VerifyPlaybackToken(db *sql.DB, signer *playback.Signer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("token")
+		if token == "" {
+			token = r.Header.Get("X-Playback-Token")
+		}
+		if token == "" {
+			responses.SendErrorResponse(w, http.StatusUnauthorized, "Playback token is required")
+			return
+		}
+
+		grant, err := signer.Verify(token, time.Now())
+		if err != nil {
+			if err == playback.ErrTokenExpired {
+				responses.SendErrorResponse(w, http.StatusUnauthorized, "Playback token expired")
+			} else {
+				responses.SendErrorResponse(w, http.StatusUnauthorized, "Invalid playback token")
+			}
+			return
+		}
+
+		if raw := r.URL.Query().Get("cctvId"); raw != "" {
+			if raw != strconv.Itoa(grant.CCTVID) {
+				responses.SendErrorResponse(w, http.StatusForbidden, "Playback token is for another camera")
+				return
+			}
+		}
+
+		var active bool
+		err = db.QueryRow("SELECT is_active FROM cctvs WHERE id = $1", grant.CCTVID).Scan(&active)
+		if err != nil && err != sql.ErrNoRows {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to verify playback token")
+			return
+		}
+		if !active {
+			responses.SendErrorResponse(w, http.StatusForbidden, "Camera is not available")
+			return
+		}
+
+		responses.SendSuccessResponse(w, http.StatusOK, grant)
+	}
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"cctv-api/internal/events"
+	"cctv-api/internal/responses"
+	"cctv-api/internal/services"
+	"cctv-api/internal/storage"
+)
+
+// ThumbnailPublisher announces a camera's newly captured snapshot as a
+// cctv.thumbnail_updated event.
+func ThumbnailPublisher(db *sql.DB, bus *events.Bus) func(cctvID int) {
+	return func(cctvID int) {
+		publishCCTVEvent(db, bus, events.CCTVThumbnailUpdated, cctvID, nil)
+	}
+}
+
+// GetCCTVSnapshot serves the latest captured frame of a camera the user's
+// plan shows, in ?size= small, medium (the default) or large. Clients
+// revalidate with If-None-Match or If-Modified-Since. With ?link=true it
+// answers with a short-lived download link instead, e.g. for <img> tags.
+func GetCCTVSnapshot(db *sql.DB, plans *services.PlanService, allotments *services.AllotmentService, snapshots *services.SnapshotService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cctv, _, ok := loadVisibleCCTV(w, r, db, plans, allotments)
+		if !ok {
+			return
+		}
+
+		variant := r.URL.Query().Get("size")
+		if variant == "" {
+			variant = services.DefaultSnapshotVariant
+		}
+		if _, ok := services.SnapshotVariants[variant]; !ok {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid size; use small, medium or large")
+			return
+		}
+
+		if r.URL.Query().Get("link") == "true" {
+			expiresAt := time.Now().Add(fileLinkTTL)
+			link, err := snapshots.SignedURL(cctv.ID, variant, expiresAt)
+			if err != nil {
+				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to sign snapshot link")
+				return
+			}
+			responses.SendSuccessResponse(w, http.StatusOK, map[string]interface{}{
+				"url":       link,
+				"expiresAt": expiresAt,
+			})
+			return
+		}
+
+		body, obj, err := snapshots.Open(r.Context(), cctv.ID, variant)
+		if err == storage.ErrNotFound {
+			responses.SendErrorResponse(w, http.StatusNotFound, "No snapshot captured for this CCTV yet")
+			return
+		}
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to read snapshot")
+			return
+		}
+		serveStoredImage(w, r, body, obj)
+	}
+}
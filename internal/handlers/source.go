@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+
+	"cctv-api/internal/health"
+	"cctv-api/internal/models"
+)
+
+// defaultSnapshotRefreshSeconds is how often clients reload a snapshot
+// camera that was created without a refresh interval.
+const defaultSnapshotRefreshSeconds = 10
+
+// streamSource is a camera's source as it is about to be stored.
+type streamSource struct {
+	url            string
+	sourceType     string
+	rtspTransport  *string
+	refreshSeconds *int
+}
+
+func isSourceType(t string) bool {
+	for _, known := range models.SourceTypes {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+// inferSourceType guesses the type of a camera created without one.
+func inferSourceType(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil && (u.Scheme == "rtsp" || u.Scheme == "rtsps") {
+		return models.SourceRTSP
+	}
+	return models.SourceHLS
+}
+
+// validateSource checks that the source URL and options suit the source
+// type, filling in the default snapshot refresh interval. With probe set,
+// HLS URLs that don't end in .m3u8 are fetched to make sure they serve a
+// playlist. The error message is meant for the client.
+func validateSource(ctx context.Context, prober *health.Prober, src *streamSource, probe bool) error {
+	u, err := url.Parse(src.url)
+	if err != nil || u.Host == "" {
+		return errors.New("Invalid source URL")
+	}
+	scheme := strings.ToLower(u.Scheme)
+	web := scheme == "http" || scheme == "https"
+
+	if src.rtspTransport != nil && src.sourceType != models.SourceRTSP {
+		return errors.New("rtspTransport only applies to rtsp sources")
+	}
+	if src.refreshSeconds != nil && src.sourceType != models.SourceSnapshot {
+		return errors.New("snapshotRefreshSeconds only applies to snapshot sources")
+	}
+
+	switch src.sourceType {
+	case models.SourceHLS:
+		if !web {
+			return errors.New("HLS sources must be http or https URLs")
+		}
+		if !probe || strings.HasSuffix(strings.ToLower(u.Path), ".m3u8") {
+			return nil
+		}
+		ok, err := prober.IsPlaylist(ctx, src.url)
+		if err != nil {
+			return errors.New("Could not verify HLS source: " + err.Error())
+		}
+		if !ok {
+			return errors.New("HLS source must be an .m3u8 playlist")
+		}
+	case models.SourceRTSP:
+		if scheme != "rtsp" && scheme != "rtsps" {
+			return errors.New("RTSP sources must be rtsp or rtsps URLs")
+		}
+	case models.SourceMJPEG:
+		if !web {
+			return errors.New("MJPEG sources must be http or https URLs")
+		}
+	case models.SourceSnapshot:
+		if !web {
+			return errors.New("Snapshot sources must be http or https URLs")
+		}
+		if src.refreshSeconds == nil {
+			seconds := defaultSnapshotRefreshSeconds
+			src.refreshSeconds = &seconds
+		}
+	case models.SourceEmbed:
+		if scheme != "https" {
+			return errors.New("Embed sources must be https URLs")
+		}
+	default:
+		return errors.New("Invalid source type")
+	}
+	return nil
+}
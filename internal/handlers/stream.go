@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"cctv-api/internal/models"
+	"cctv-api/internal/playback"
+	"cctv-api/internal/responses"
+	"cctv-api/internal/services"
+	"cctv-api/internal/streamproxy"
+	"cctv-api/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// streamAccessTTL is how long a viewer's access to a camera is trusted
+// before their plan is checked again. Players fetch a segment every few
+// seconds, so checking every request would cost a query each time.
+const streamAccessTTL = 30 * time.Second
+
+type streamAccess struct {
+	cctv *models.CCTV
+	// Best stream quality the user's plan allows
+	maxQuality string
+	allowed    bool
+	expires    time.Time
+}
+
+type streamAccessKey struct {
+	userID, cctvID int
+}
+
+// ProxyStream serves /stream/{id}/... to players holding a playback token
+// (?token=) for that camera, as long as the user's plan still shows it.
+// ?quality= picks one of the camera's streams, no better than the plan
+// allows.
+func ProxyStream(db *sql.DB, plans *services.PlanService, allotments *services.AllotmentService, streams *services.StreamService, signer *playback.Signer, proxy *streamproxy.Proxy) http.HandlerFunc {
+	var mu sync.Mutex
+	accessCache := make(map[streamAccessKey]streamAccess)
+
+	lookup := func(userID, cctvID int) (streamAccess, error) {
+		key := streamAccessKey{userID, cctvID}
+		now := time.Now()
+
+		mu.Lock()
+		access, ok := accessCache[key]
+		mu.Unlock()
+		if ok && now.Before(access.expires) {
+			return access, nil
+		}
+
+		access = streamAccess{expires: now.Add(streamAccessTTL)}
+		claims := &utils.Claims{UserID: userID}
+		err := db.QueryRow("SELECT role FROM users WHERE id = $1", userID).Scan(&claims.Role)
+		if err != nil && err != sql.ErrNoRows {
+			return access, err
+		}
+		if err == nil {
+			cctv, err := loadCCTV(db, cctvID)
+			if err != nil && err != sql.ErrNoRows {
+				return access, err
+			}
+			if err == nil {
+				access.allowed, err = canViewCCTV(claims, plans, allotments, cctv)
+				if err != nil {
+					return access, err
+				}
+				if access.allowed {
+					if cctv.Streams, err = streams.List(cctvID); err != nil {
+						return access, err
+					}
+					access.maxQuality = models.StreamMain
+					if claims.Role != "admin" {
+						plan, _, err := plans.UserPlan(userID)
+						if err != nil {
+							return access, err
+						}
+						access.maxQuality = planQuality(claims, plan)
+					}
+				}
+				access.cctv = cctv
+			}
+		}
+
+		mu.Lock()
+		// Drop expired decisions now and then so the map stays small
+		if len(accessCache) > 10000 {
+			for k, v := range accessCache {
+				if now.After(v.expires) {
+					delete(accessCache, k)
+				}
+			}
+		}
+		accessCache[key] = access
+		mu.Unlock()
+		return access, nil
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid CCTV ID")
+			return
+		}
+
+		now := time.Now()
+		grant, err := signer.Verify(r.URL.Query().Get("token"), now)
+		if err != nil {
+			if err == playback.ErrTokenExpired {
+				responses.SendErrorResponse(w, http.StatusUnauthorized, "Playback token expired")
+			} else {
+				responses.SendErrorResponse(w, http.StatusUnauthorized, "Invalid playback token")
+			}
+			return
+		}
+		if grant.CCTVID != id {
+			responses.SendErrorResponse(w, http.StatusForbidden, "Playback token is for another camera")
+			return
+		}
+
+		access, err := lookup(grant.UserID, id)
+		if err != nil {
+			log.Printf("Failed to check stream access for user %d, CCTV %d: %v", grant.UserID, id, err)
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to check stream access")
+			return
+		}
+		if !access.allowed {
+			responses.SendErrorResponse(w, http.StatusForbidden, "Camera is not available on your plan")
+			return
+		}
+
+		requested, ok := parseQuality(r)
+		if !ok {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid quality; use main, sub or snapshot")
+			return
+		}
+		role, streamURL, sourceType := chooseStream(access.cctv, capQuality(requested, access.maxQuality))
+
+		// Rewritten playlists carry a session token, so that players keep
+		// going after the playback URL expires, and the stream. Its expiry
+		// is fixed when the playback URL is first used, not pushed back on
+		// every reload.
+		session, _ := signer.SessionToken(grant)
+		query := url.Values{"token": {session}}
+		if role != models.StreamMain {
+			query.Set("quality", role)
+		}
+		proxy.Serve(w, r, id, streamURL, sourceType, vars["path"], query)
+	}
+}
@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"cctv-api/internal/events"
+	"cctv-api/internal/health"
+	"cctv-api/internal/models"
+	"cctv-api/internal/responses"
+	"cctv-api/internal/services"
+	"cctv-api/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// streamQualities orders stream roles from the best quality to the lightest.
+var streamQualities = []string{models.StreamMain, models.StreamSub, models.StreamSnapshot}
+
+func qualityRank(quality string) int {
+	for i, q := range streamQualities {
+		if q == quality {
+			return i
+		}
+	}
+	return 0
+}
+
+// parseQuality reads ?quality=; empty (or "auto") means the best quality
+// the user's plan allows.
+func parseQuality(r *http.Request) (string, bool) {
+	quality := r.URL.Query().Get("quality")
+	if quality == "" || quality == "auto" {
+		return "", true
+	}
+	for _, q := range streamQualities {
+		if q == quality {
+			return quality, true
+		}
+	}
+	return "", false
+}
+
+// planQuality is the best stream quality the user may watch. Operators
+// are not limited.
+func planQuality(claims *utils.Claims, plan *models.Plan) string {
+	if claims.Role == "admin" || plan.MaxStreamQuality == "" {
+		return models.StreamMain
+	}
+	return plan.MaxStreamQuality
+}
+
+// capQuality returns the quality played when requested is asked for and
+// best is the plan's limit.
+func capQuality(requested, best string) string {
+	if requested == "" || qualityRank(requested) < qualityRank(best) {
+		return best
+	}
+	return requested
+}
+
+// viewerQuality combines ?quality= with the user's plan. It answers the
+// request itself when it returns false.
+func viewerQuality(w http.ResponseWriter, r *http.Request, claims *utils.Claims, plans *services.PlanService) (string, bool) {
+	requested, ok := parseQuality(r)
+	if !ok {
+		responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid quality; use main, sub or snapshot")
+		return "", false
+	}
+	if claims.Role == "admin" {
+		return capQuality(requested, models.StreamMain), true
+	}
+	plan, _, err := plans.UserPlan(claims.UserID)
+	if err != nil {
+		responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to get user info")
+		return "", false
+	}
+	return capQuality(requested, planQuality(claims, plan)), true
+}
+
+// chooseStream picks the stream played at quality: the camera's stream of
+// that role or else the next lighter one it has. The camera's own source is
+// its main stream unless it has a main stream of its own, and is also the
+// last resort for cameras without lighter streams. Returns the role, URL
+// and source type of the stream.
+func chooseStream(cctv *models.CCTV, quality string) (string, string, string) {
+	for _, role := range streamQualities[qualityRank(quality):] {
+		for _, stream := range cctv.Streams {
+			if stream.Role != role {
+				continue
+			}
+			if role == models.StreamSnapshot {
+				return role, stream.URL, models.SourceSnapshot
+			}
+			return role, stream.URL, cctv.SourceType
+		}
+		if role == models.StreamMain {
+			break
+		}
+	}
+	return models.StreamMain, cctv.SourceURL, cctv.SourceType
+}
+
+// loadStreamCCTV loads the camera of a /cctvs/{id}/streams request.
+func loadStreamCCTV(w http.ResponseWriter, r *http.Request, db *sql.DB) (*models.CCTV, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid CCTV ID")
+		return nil, false
+	}
+	cctv, err := loadCCTV(db, id)
+	if err == sql.ErrNoRows {
+		responses.SendErrorResponse(w, http.StatusNotFound, "CCTV not found")
+		return nil, false
+	}
+	if err != nil {
+		responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to fetch CCTV")
+		return nil, false
+	}
+	return cctv, true
+}
+
+// validateStreamURL checks a stream URL like a camera source: main and sub
+// streams are of the camera's source type, snapshot streams still images.
+func validateStreamURL(w http.ResponseWriter, r *http.Request, prober *health.Prober, cctv *models.CCTV, role, streamURL string) bool {
+	if cctv.SourceType == models.SourceEmbed {
+		responses.SendErrorResponse(w, http.StatusBadRequest, "Embed cameras have no alternative streams")
+		return false
+	}
+	src := streamSource{url: streamURL, sourceType: cctv.SourceType}
+	if role == models.StreamSnapshot {
+		src.sourceType = models.SourceSnapshot
+	}
+	if err := validateSource(r.Context(), prober, &src, true); err != nil {
+		responses.SendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return false
+	}
+	return true
+}
+
+func GetCCTVStreams(db *sql.DB, streams *services.StreamService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cctv, ok := loadStreamCCTV(w, r, db)
+		if !ok {
+			return
+		}
+
+		list, err := streams.List(cctv.ID)
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to fetch streams")
+			return
+		}
+
+		responses.SendSuccessResponse(w, http.StatusOK, list)
+	}
+}
+
+func CreateCCTVStream(db *sql.DB, prober *health.Prober, streams *services.StreamService, bus *events.Bus) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cctv, ok := loadStreamCCTV(w, r, db)
+		if !ok {
+			return
+		}
+
+		var req models.CreateCCTVStreamRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		if err := utils.Validate.Struct(req); err != nil {
+			responses.SendValidationError(w, err)
+			return
+		}
+
+		if !validateStreamURL(w, r, prober, cctv, req.Role, req.URL) {
+			return
+		}
+
+		stream, err := streams.Create(cctv.ID, req)
+		if err != nil {
+			if err == services.ErrStreamRoleTaken {
+				responses.SendErrorResponse(w, http.StatusConflict, "CCTV already has a "+req.Role+" stream")
+			} else {
+				log.Printf("Failed to create stream for CCTV %d: %v", cctv.ID, err)
+				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to create stream")
+			}
+			return
+		}
+
+		publishCCTVEvent(db, bus, events.CCTVUpdated, cctv.ID, []string{"streams"})
+
+		responses.SendSuccessResponse(w, http.StatusCreated, stream)
+	}
+}
+
+func UpdateCCTVStream(db *sql.DB, prober *health.Prober, streams *services.StreamService, bus *events.Bus) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cctv, ok := loadStreamCCTV(w, r, db)
+		if !ok {
+			return
+		}
+
+		streamID, err := strconv.Atoi(mux.Vars(r)["streamId"])
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid stream ID")
+			return
+		}
+
+		var req models.UpdateCCTVStreamRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		if err := utils.Validate.Struct(req); err != nil {
+			responses.SendValidationError(w, err)
+			return
+		}
+
+		if req.URL != nil {
+			current, err := streams.Get(cctv.ID, streamID)
+			if err == services.ErrStreamNotFound {
+				responses.SendErrorResponse(w, http.StatusNotFound, "Stream not found")
+				return
+			}
+			if err != nil {
+				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to update stream")
+				return
+			}
+			if !validateStreamURL(w, r, prober, cctv, current.Role, *req.URL) {
+				return
+			}
+		}
+
+		stream, err := streams.Update(cctv.ID, streamID, req)
+		if err != nil {
+			if err == services.ErrStreamNotFound {
+				responses.SendErrorResponse(w, http.StatusNotFound, "Stream not found")
+			} else {
+				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to update stream")
+			}
+			return
+		}
+
+		publishCCTVEvent(db, bus, events.CCTVUpdated, cctv.ID, []string{"streams"})
+
+		responses.SendSuccessResponse(w, http.StatusOK, stream)
+	}
+}
+
+func DeleteCCTVStream(db *sql.DB, streams *services.StreamService, bus *events.Bus) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cctv, ok := loadStreamCCTV(w, r, db)
+		if !ok {
+			return
+		}
+
+		streamID, err := strconv.Atoi(mux.Vars(r)["streamId"])
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid stream ID")
+			return
+		}
+
+		if err := streams.Delete(cctv.ID, streamID); err != nil {
+			if err == services.ErrStreamNotFound {
+				responses.SendErrorResponse(w, http.StatusNotFound, "Stream not found")
+			} else {
+				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to delete stream")
+			}
+			return
+		}
+
+		publishCCTVEvent(db, bus, events.CCTVUpdated, cctv.ID, []string{"streams"})
+
+		responses.SendSuccessResponse(w, http.StatusOK, map[string]string{
+			"message": "Stream deleted successfully",
+		})
+	}
+}
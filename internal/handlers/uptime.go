@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cctv-api/internal/models"
+	"cctv-api/internal/responses"
+	"cctv-api/internal/services"
+	"cctv-api/internal/storage"
+
+	"github.com/gorilla/mux"
+)
+
+// GetUptimeReport serves the network-wide report, or a single camera or
+// location when the route has an {id}. Add ?format=csv for a CSV download,
+// and &delivery=link to store the CSV and get a download link to it instead.
+func GetUptimeReport(uptime *services.UptimeService, store storage.Store, scope string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		from, to, ok := parseTimeRange(r, 30*24*time.Hour)
+		if !ok {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid time range; use RFC 3339 from/to with from before to")
+			return
+		}
+
+		var report *models.UptimeReport
+		var err error
+		switch scope {
+		case "network":
+			report, err = uptime.NetworkReport(from, to)
+		default:
+			id, convErr := strconv.Atoi(mux.Vars(r)["id"])
+			if convErr != nil {
+				responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid ID")
+				return
+			}
+			if scope == "location" {
+				report, err = uptime.LocationReport(id, from, to)
+			} else {
+				report, err = uptime.CCTVReport(id, from, to)
+			}
+		}
+		if err != nil {
+			if err == services.ErrUptimeScopeNotFound {
+				responses.SendErrorResponse(w, http.StatusNotFound, "Not found")
+			} else {
+				log.Printf("Failed to compute %s uptime report: %v", scope, err)
+				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to compute uptime report")
+			}
+			return
+		}
+
+		if r.URL.Query().Get("format") == "csv" {
+			filename := "uptime-" + report.Scope + "-" + report.From.Format("20060102") + "-" + report.To.Format("20060102") + ".csv"
+			if r.URL.Query().Get("delivery") == "link" {
+				sendUptimeLink(w, r, store, report, filename)
+				return
+			}
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+			w.WriteHeader(http.StatusOK)
+			writeUptimeCSV(w, report)
+			return
+		}
+
+		responses.SendSuccessResponse(w, http.StatusOK, report)
+	}
+}
+
+// sendUptimeLink stores the report as CSV and answers with a link to it.
+// Exports are content-addressed, so asking for the same report twice
+// stores it once.
+func sendUptimeLink(w http.ResponseWriter, r *http.Request, store storage.Store, report *models.UptimeReport, filename string) {
+	var buf bytes.Buffer
+	writeUptimeCSV(&buf, report)
+	data := buf.Bytes()
+
+	key := storage.ContentKey("exports", data, ".csv")
+	if _, err := store.Put(r.Context(), key, bytes.NewReader(data), "text/csv; charset=utf-8"); err != nil {
+		log.Printf("Failed to store uptime export: %v", err)
+		responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to store export")
+		return
+	}
+
+	expiresAt := time.Now().Add(fileLinkTTL)
+	link, err := store.SignedURL(key, expiresAt)
+	if err != nil {
+		log.Printf("Failed to sign uptime export link: %v", err)
+		responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to store export")
+		return
+	}
+
+	responses.SendSuccessResponse(w, http.StatusOK, map[string]interface{}{
+		"url":       link,
+		"filename":  filename,
+		"size":      len(data),
+		"expiresAt": expiresAt,
+	})
+}
+
+func writeUptimeCSV(w io.Writer, report *models.UptimeReport) {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{
+		"scope", "id", "name", "from", "to", "uptime_percent", "sla_target_percent", "meets_sla",
+		"observed_seconds", "up_seconds", "degraded_seconds", "down_seconds",
+		"outage_count", "ongoing_outages", "mttr_seconds", "longest_outage_seconds",
+	})
+
+	row := func(scope string, id *int, name string, s models.UptimeStats) {
+		idText := ""
+		if id != nil {
+			idText = strconv.Itoa(*id)
+		}
+		uptimeText, meetsText, mttrText := "", "", ""
+		if s.UptimePercent != nil {
+			uptimeText = strconv.FormatFloat(*s.UptimePercent, 'f', 3, 64)
+		}
+		if s.MeetsSLA != nil {
+			meetsText = strconv.FormatBool(*s.MeetsSLA)
+		}
+		if s.MTTRSeconds != nil {
+			mttrText = strconv.FormatFloat(*s.MTTRSeconds, 'f', 0, 64)
+		}
+		cw.Write([]string{
+			scope, idText, name, report.From.Format(time.RFC3339), report.To.Format(time.RFC3339),
+			uptimeText, strconv.FormatFloat(report.SLATargetPercent, 'f', -1, 64), meetsText,
+			strconv.FormatInt(s.ObservedSeconds, 10), strconv.FormatInt(s.UpSeconds, 10),
+			strconv.FormatInt(s.DegradedSeconds, 10), strconv.FormatInt(s.DownSeconds, 10),
+			strconv.Itoa(s.OutageCount), strconv.Itoa(s.OngoingOutages), mttrText,
+			strconv.FormatInt(s.LongestOutageSeconds, 10),
+		})
+	}
+
+	row(report.Scope, report.ID, report.Name, report.Summary)
+	for _, g := range report.Breakdown {
+		id := g.ID
+		row(g.Scope, &id, g.Name, g.UptimeStats)
+	}
+	cw.Flush()
+}
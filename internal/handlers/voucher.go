@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"cctv-api/internal/models"
+	"cctv-api/internal/responses"
+	"cctv-api/internal/services"
+	"cctv-api/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+func GetVouchers(vouchers *services.VoucherService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		list, err := vouchers.ListVouchers()
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to fetch vouchers")
+			return
+		}
+
+		responses.SendSuccessResponse(w, http.StatusOK, list)
+	}
+}
+
+func CreateVoucher(db *sql.DB, audit *services.AuditService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(userClaimsKey).(*utils.Claims)
+		if !ok {
+			responses.SendErrorResponse(w, http.StatusUnauthorized, "Invalid user context")
+			return
+		}
+
+		var req models.CreateVoucherRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		if err := utils.Validate.Struct(req); err != nil {
+			responses.SendValidationError(w, err)
+			return
+		}
+
+		if req.ValidFrom != nil && req.ValidUntil != nil && !req.ValidUntil.After(*req.ValidFrom) {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "validUntil must be after validFrom")
+			return
+		}
+
+		code := services.NormalizeVoucherCode(req.Code)
+		if code == "" {
+			generated, err := services.GenerateVoucherCode()
+			if err != nil {
+				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to generate voucher code")
+				return
+			}
+			code = generated
+		}
+
+		perUserLimit := 1
+		if req.PerUserLimit != nil {
+			perUserLimit = *req.PerUserLimit
+		}
+
+		var id int
+		err := db.QueryRow(`
+			INSERT INTO vouchers (code, description, plan_id, duration_days, max_redemptions, per_user_limit,
+				valid_from, valid_until, created_by)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			RETURNING id
+		`, code, req.Description, req.PlanID, req.DurationDays, req.MaxRedemptions, perUserLimit,
+			req.ValidFrom, req.ValidUntil, claims.UserID).Scan(&id)
+		if err != nil {
+			if err.Error() == `pq: duplicate key value violates unique constraint "vouchers_code_key"` {
+				responses.SendErrorResponse(w, http.StatusConflict, "Voucher with code '"+code+"' already exists")
+			} else if err.Error() == `pq: insert or update on table "vouchers" violates foreign key constraint "vouchers_plan_id_fkey"` {
+				responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid plan ID")
+			} else {
+				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to create voucher")
+			}
+			return
+		}
+
+		ip := utils.ClientIP(r)
+		audit.Record(models.AuditLog{
+			ActorID:   &claims.UserID,
+			Action:    "voucher.created",
+			IPAddress: &ip,
+			Details:   map[string]interface{}{"voucherId": id, "code": code, "planId": req.PlanID},
+		})
+
+		responses.SendSuccessResponse(w, http.StatusCreated, map[string]interface{}{"id": id, "code": code})
+	}
+}
+
+func UpdateVoucher(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid voucher ID")
+			return
+		}
+
+		var req models.UpdateVoucherRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		if err := utils.Validate.Struct(req); err != nil {
+			responses.SendValidationError(w, err)
+			return
+		}
+
+		query := "UPDATE vouchers SET updated_at = NOW()"
+		args := []interface{}{}
+		argPos := 1
+
+		if req.Description != nil {
+			query += ", description = $" + strconv.Itoa(argPos)
+			args = append(args, *req.Description)
+			argPos++
+		}
+
+		if req.MaxRedemptions != nil {
+			query += ", max_redemptions = $" + strconv.Itoa(argPos)
+			args = append(args, *req.MaxRedemptions)
+			argPos++
+		}
+
+		if req.PerUserLimit != nil {
+			query += ", per_user_limit = $" + strconv.Itoa(argPos)
+			args = append(args, *req.PerUserLimit)
+			argPos++
+		}
+
+		if req.ValidFrom != nil {
+			query += ", valid_from = $" + strconv.Itoa(argPos)
+			args = append(args, *req.ValidFrom)
+			argPos++
+		}
+
+		if req.ValidUntil != nil {
+			query += ", valid_until = $" + strconv.Itoa(argPos)
+			args = append(args, *req.ValidUntil)
+			argPos++
+		}
+
+		if req.IsActive != nil {
+			query += ", is_active = $" + strconv.Itoa(argPos)
+			args = append(args, *req.IsActive)
+			argPos++
+		}
+
+		query += " WHERE id = $" + strconv.Itoa(argPos)
+		args = append(args, id)
+
+		result, err := db.Exec(query, args...)
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to update voucher")
+			return
+		}
+
+		rowsAffected, _ := result.RowsAffected()
+		if rowsAffected == 0 {
+			responses.SendErrorResponse(w, http.StatusNotFound, "Voucher not found")
+			return
+		}
+
+		responses.SendSuccessResponse(w, http.StatusOK, map[string]string{
+			"message": "Voucher updated successfully",
+		})
+	}
+}
+
+func GetVoucherRedemptions(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid voucher ID")
+			return
+		}
+
+		rows, err := db.Query(`
+			SELECT r.id, r.voucher_id, r.user_id, u.username, r.subscription_id, r.redeemed_at
+			FROM voucher_redemptions r
+			JOIN users u ON u.id = r.user_id
+			WHERE r.voucher_id = $1
+			ORDER BY r.redeemed_at DESC
+		`, id)
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to fetch redemptions")
+			return
+		}
+		defer rows.Close()
+
+		redemptions := []models.VoucherRedemption{}
+		for rows.Next() {
+			var redemption models.VoucherRedemption
+			var subscriptionID sql.NullInt64
+			err := rows.Scan(&redemption.ID, &redemption.VoucherID, &redemption.UserID, &redemption.Username,
+				&subscriptionID, &redemption.RedeemedAt)
+			if err != nil {
+				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to scan redemption data")
+				return
+			}
+			if subscriptionID.Valid {
+				subID := int(subscriptionID.Int64)
+				redemption.SubscriptionID = &subID
+			}
+			redemptions = append(redemptions, redemption)
+		}
+
+		responses.SendSuccessResponse(w, http.StatusOK, redemptions)
+	}
+}
+
+func RedeemVoucher(vouchers *services.VoucherService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(userClaimsKey).(*utils.Claims)
+		if !ok {
+			responses.SendErrorResponse(w, http.StatusUnauthorized, "Invalid user context")
+			return
+		}
+
+		var req models.RedeemVoucherRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		if err := utils.Validate.Struct(req); err != nil {
+			responses.SendValidationError(w, err)
+			return
+		}
+
+		sub, err := vouchers.Redeem(claims.UserID, req.Code, utils.ClientIP(r))
+		if err != nil {
+			switch err {
+			case services.ErrVoucherNotFound:
+				responses.SendErrorResponse(w, http.StatusNotFound, "Voucher not found")
+			case services.ErrVoucherNotValid:
+				responses.SendErrorResponse(w, http.StatusBadRequest, "Voucher is not valid at this time")
+			case services.ErrVoucherExhausted:
+				responses.SendErrorResponse(w, http.StatusConflict, "Voucher has been fully redeemed")
+			case services.ErrVoucherUserLimit:
+				responses.SendErrorResponse(w, http.StatusConflict, "You have already redeemed this voucher")
+			case services.ErrVoucherPlanConflict:
+				responses.SendErrorResponse(w, http.StatusConflict, "Voucher cannot be applied to your current plan")
+			default:
+				log.Printf("Failed to redeem voucher for user %d: %v", claims.UserID, err)
+				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to redeem voucher")
+			}
+			return
+		}
+
+		responses.SendSuccessResponse(w, http.StatusOK, map[string]interface{}{
+			"message":      "Voucher redeemed successfully",
+			"subscription": sub,
+		})
+	}
+}
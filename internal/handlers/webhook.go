@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"cctv-api/internal/events"
+	"cctv-api/internal/models"
+	"cctv-api/internal/responses"
+	"cctv-api/internal/services"
+	"cctv-api/internal/utils"
+
+	"github.com/gorilla/mux"
+)
+
+func GetWebhookEventTypes() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		responses.SendSuccessResponse(w, http.StatusOK, events.Types)
+	}
+}
+
+func GetWebhooks(webhooks *services.WebhookService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		subs, err := webhooks.List()
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to fetch webhooks")
+			return
+		}
+
+		responses.SendSuccessResponse(w, http.StatusOK, subs)
+	}
+}
+
+func GetWebhook(webhooks *services.WebhookService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid webhook ID")
+			return
+		}
+
+		sub, err := webhooks.Get(id)
+		if err != nil {
+			if err == services.ErrWebhookNotFound {
+				responses.SendErrorResponse(w, http.StatusNotFound, "Webhook not found")
+			} else {
+				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to fetch webhook")
+			}
+			return
+		}
+
+		responses.SendSuccessResponse(w, http.StatusOK, sub)
+	}
+}
+
+// CreateWebhook registers a subscription. The response includes the signing
+// secret; it is not shown again.
+func CreateWebhook(webhooks *services.WebhookService, audit *services.AuditService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(userClaimsKey).(*utils.Claims)
+		if !ok {
+			responses.SendErrorResponse(w, http.StatusUnauthorized, "Invalid user context")
+			return
+		}
+
+		var req models.CreateWebhookSubscriptionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		if err := utils.Validate.Struct(req); err != nil {
+			responses.SendValidationError(w, err)
+			return
+		}
+
+		sub, err := webhooks.Create(req, claims.UserID)
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidEventType) {
+				responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid eventTypes: "+err.Error())
+			} else {
+				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to create webhook")
+			}
+			return
+		}
+
+		ip := utils.ClientIP(r)
+		audit.Record(models.AuditLog{
+			ActorID:   &claims.UserID,
+			Action:    "webhook.created",
+			IPAddress: &ip,
+			Details: map[string]interface{}{
+				"webhookId":  sub.ID,
+				"url":        sub.URL,
+				"eventTypes": sub.EventTypes,
+			},
+		})
+
+		responses.SendSuccessResponse(w, http.StatusCreated, sub)
+	}
+}
+
+// UpdateWebhook changes a subscription. Set rotateSecret to get a new
+// signing secret in the response.
+func UpdateWebhook(webhooks *services.WebhookService, audit *services.AuditService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(userClaimsKey).(*utils.Claims)
+		if !ok {
+			responses.SendErrorResponse(w, http.StatusUnauthorized, "Invalid user context")
+			return
+		}
+
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid webhook ID")
+			return
+		}
+
+		var req models.UpdateWebhookSubscriptionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		if err := utils.Validate.Struct(req); err != nil {
+			responses.SendValidationError(w, err)
+			return
+		}
+
+		sub, err := webhooks.Update(id, req)
+		if err != nil {
+			if err == services.ErrWebhookNotFound {
+				responses.SendErrorResponse(w, http.StatusNotFound, "Webhook not found")
+			} else if errors.Is(err, services.ErrInvalidEventType) {
+				responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid eventTypes: "+err.Error())
+			} else {
+				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to update webhook")
+			}
+			return
+		}
+
+		ip := utils.ClientIP(r)
+		audit.Record(models.AuditLog{
+			ActorID:   &claims.UserID,
+			Action:    "webhook.updated",
+			IPAddress: &ip,
+			Details: map[string]interface{}{
+				"webhookId":     id,
+				"eventTypes":    sub.EventTypes,
+				"isActive":      sub.IsActive,
+				"secretRotated": req.RotateSecret,
+			},
+		})
+
+		responses.SendSuccessResponse(w, http.StatusOK, sub)
+	}
+}
+
+func DeleteWebhook(webhooks *services.WebhookService, audit *services.AuditService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(userClaimsKey).(*utils.Claims)
+		if !ok {
+			responses.SendErrorResponse(w, http.StatusUnauthorized, "Invalid user context")
+			return
+		}
+
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid webhook ID")
+			return
+		}
+
+		if err := webhooks.Delete(id); err != nil {
+			if err == services.ErrWebhookNotFound {
+				responses.SendErrorResponse(w, http.StatusNotFound, "Webhook not found")
+			} else {
+				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to delete webhook")
+			}
+			return
+		}
+
+		ip := utils.ClientIP(r)
+		audit.Record(models.AuditLog{
+			ActorID:   &claims.UserID,
+			Action:    "webhook.deleted",
+			IPAddress: &ip,
+			Details:   map[string]interface{}{"webhookId": id},
+		})
+
+		responses.SendSuccessResponse(w, http.StatusOK, map[string]string{
+			"message": "Webhook deleted successfully",
+		})
+	}
+}
+
+// GetWebhookDeliveries returns the delivery log of a subscription, newest
+// first. Filter with ?status=pending|succeeded|failed.
+func GetWebhookDeliveries(webhooks *services.WebhookService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid webhook ID")
+			return
+		}
+
+		status := r.URL.Query().Get("status")
+		switch status {
+		case "", "pending", "succeeded", "failed":
+		default:
+			responses.SendErrorResponse(w, http.StatusBadRequest, "status must be pending, succeeded or failed")
+			return
+		}
+
+		limit := 100
+		if raw := r.URL.Query().Get("limit"); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 1 || n > 1000 {
+				responses.SendErrorResponse(w, http.StatusBadRequest, "limit must be between 1 and 1000")
+				return
+			}
+			limit = n
+		}
+
+		deliveries, err := webhooks.Deliveries(id, status, limit)
+		if err != nil {
+			if err == services.ErrWebhookNotFound {
+				responses.SendErrorResponse(w, http.StatusNotFound, "Webhook not found")
+			} else {
+				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to fetch webhook deliveries")
+			}
+			return
+		}
+
+		responses.SendSuccessResponse(w, http.StatusOK, deliveries)
+	}
+}
+
+// RedeliverWebhook queues a delivery again with the original event ID and
+// payload.
+func RedeliverWebhook(webhooks *services.WebhookService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		id, err := strconv.ParseInt(vars["id"], 10, 64)
+		if err != nil {
+			responses.SendErrorResponse(w, http.StatusBadRequest, "Invalid delivery ID")
+			return
+		}
+
+		delivery, err := webhooks.Redeliver(id)
+		if err != nil {
+			if err == services.ErrWebhookDeliveryNotFound {
+				responses.SendErrorResponse(w, http.StatusNotFound, "Delivery not found")
+			} else {
+				responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to queue redelivery")
+			}
+			return
+		}
+
+		responses.SendSuccessResponse(w, http.StatusAccepted, delivery)
+	}
+}
@@ -0,0 +1,397 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"cctv-api/internal/events"
+	"cctv-api/internal/models"
+	"cctv-api/internal/realtime"
+	"cctv-api/internal/responses"
+	"cctv-api/internal/services"
+	"cctv-api/internal/utils"
+
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// wsMaxMessageBytes caps a single client message
+	wsMaxMessageBytes = 64 << 10
+	// wsCommandQueue is how many client messages may wait for the writer
+	// before the connection is considered abusive and closed
+	wsCommandQueue = 32
+	wsWriteTimeout = 10 * time.Second
+)
+
+// wsClientMessage is anything a client sends. Type is subscribe,
+// unsubscribe, ack or ping; the other fields depend on it.
+type wsClientMessage struct {
+	Type      string `json:"type"`
+	RequestID string `json:"requestId"`
+	// subscribe / unsubscribe
+	All         bool     `json:"all"`
+	CCTVIDs     []int    `json:"cctvIds"`
+	LocationIDs []int    `json:"locationIds"`
+	Events      []string `json:"events"`
+	// ack
+	IncidentID int64 `json:"incidentId"`
+	// ping: the cameras the client is currently playing
+	Viewing []int `json:"viewing"`
+}
+
+// wsReply answers a client message. The first reply on a connection has no
+// requestId; Reset tells a resuming client that events were missed.
+type wsReply struct {
+	Type      string `json:"type"`
+	RequestID string `json:"requestId,omitempty"`
+	OK        bool   `json:"ok"`
+	Error     string `json:"error,omitempty"`
+	EventID   string `json:"eventId,omitempty"`
+	Reset     bool   `json:"reset,omitempty"`
+}
+
+// wsSubscription is what a connection asked to hear about. Camera events
+// match by camera or by its location; patterns filter by event type.
+type wsSubscription struct {
+	all       bool
+	cctvs     map[int]bool
+	locations map[int]bool
+	patterns  []string
+}
+
+func (s *wsSubscription) empty() bool {
+	return !s.all && len(s.cctvs) == 0 && len(s.locations) == 0
+}
+
+func (s *wsSubscription) matches(e events.Event) bool {
+	if s.empty() || !matchesAny(s.patterns, e.Type) {
+		return false
+	}
+
+	switch data := e.Data.(type) {
+	case models.CCTVEvent:
+		return s.all || s.cctvs[data.CCTV.ID] || s.locations[data.CCTV.LocationID]
+	case models.CCTVStatusChange:
+		return s.all || s.cctvs[data.CCTVID] || s.locations[data.LocationID]
+	case models.CCTVMotionChange:
+		return s.all || s.cctvs[data.CCTVID] || s.locations[data.LocationID]
+	case models.AlertEvent:
+		return s.all || s.cctvs[data.CCTVID] || s.locations[data.LocationID]
+	case models.LocationEvent:
+		return s.all || s.locations[data.Location.ID]
+	case models.UserUpgradedEvent:
+		// Only the user's own upgrades pass the viewer scope
+		return true
+	}
+	return s.all
+}
+
+func (s *wsSubscription) apply(msg wsClientMessage) error {
+	if msg.Type == "subscribe" {
+		if msg.Events != nil {
+			for _, p := range msg.Events {
+				if !events.ValidPattern(p) {
+					return errInvalidPattern(p)
+				}
+			}
+			s.patterns = msg.Events
+		}
+		if msg.All {
+			s.all = true
+		}
+		for _, id := range msg.CCTVIDs {
+			s.cctvs[id] = true
+		}
+		for _, id := range msg.LocationIDs {
+			s.locations[id] = true
+		}
+		return nil
+	}
+
+	if msg.All {
+		s.all = false
+	}
+	for _, id := range msg.CCTVIDs {
+		delete(s.cctvs, id)
+	}
+	for _, id := range msg.LocationIDs {
+		delete(s.locations, id)
+	}
+	return nil
+}
+
+type errInvalidPattern string
+
+func (e errInvalidPattern) Error() string {
+	return "unknown event type " + strconv.Quote(string(e))
+}
+
+// ServeWebSocket is the bidirectional counterpart of StreamEvents. Clients
+// authenticate like any API request (or with ?access_token= on the
+// handshake) and talk JSON:
+//
+//	{"type":"subscribe","requestId":"1","cctvIds":[3],"locationIds":[1],"events":["cctv.*"]}
+//	{"type":"unsubscribe","requestId":"2","cctvIds":[3]}
+//	{"type":"ack","requestId":"3","incidentId":42}   (admins: acknowledge an alert)
+//	{"type":"ping","viewing":[3]}                      (heartbeat, cameras on screen)
+//
+// Every client message is answered with {"type":"ack","requestId":...,"ok":...}.
+// Matching events arrive as {"type":"event","eventId":...,"event":{...}}, and
+// the server sends {"type":"ping"} every pingInterval; a client that stays
+// silent for two intervals is disconnected, as is one whose session no
+// longer stands when it is checked again at a ping. Pass ?lastEventId= to
+// resume: missed events are replayed after the first subscribe.
+func ServeWebSocket(jwtUtil *utils.JWTUtil, sessions *services.SessionService, broker *realtime.Broker, viewers *realtime.Viewers, plans *services.PlanService, allotments *services.AllotmentService, alerts *services.AlertService, pingInterval time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(userClaimsKey).(*utils.Claims)
+		if !ok {
+			responses.SendErrorResponse(w, http.StatusUnauthorized, "Invalid user context")
+			return
+		}
+
+		scope, err := newViewerScope(claims, plans, allotments)
+		if err != nil {
+			log.Printf("Failed to load event scope for user %d: %v", claims.UserID, err)
+			responses.SendErrorResponse(w, http.StatusInternalServerError, "Failed to get user info")
+			return
+		}
+
+		session := newSessionRecheck(r, jwtUtil, sessions)
+		lastID := r.URL.Query().Get("lastEventId")
+
+		server := websocket.Server{
+			// Origins are checked by CORS and the token, not the handshake
+			Handshake: func(*websocket.Config, *http.Request) error { return nil },
+			Handler: func(ws *websocket.Conn) {
+				ws.MaxPayloadBytes = wsMaxMessageBytes
+				conn := &wsConn{
+					ws:           ws,
+					claims:       claims,
+					session:      session,
+					scope:        scope,
+					broker:       broker,
+					viewers:      viewers,
+					alerts:       alerts,
+					pingInterval: pingInterval,
+					sub:          wsSubscription{cctvs: map[int]bool{}, locations: map[int]bool{}},
+				}
+				conn.serve(lastID)
+			},
+		}
+		server.ServeHTTP(w, r)
+	}
+}
+
+// wsConn is one WebSocket connection. A reader goroutine parses client
+// messages and hands them to serve, which owns all other state and is the
+// only writer.
+type wsConn struct {
+	ws           *websocket.Conn
+	claims       *utils.Claims
+	session      *sessionRecheck
+	scope        *viewerScope
+	broker       *realtime.Broker
+	viewers      *realtime.Viewers
+	alerts       *services.AlertService
+	pingInterval time.Duration
+	sub          wsSubscription
+	client       *realtime.Client
+}
+
+func (c *wsConn) serve(lastID string) {
+	defer c.ws.Close()
+
+	client, replay, complete := c.broker.Subscribe(lastID)
+	c.client = client
+	defer c.broker.Unsubscribe(client)
+	defer c.viewers.Remove(client)
+
+	commands := make(chan wsClientMessage, wsCommandQueue)
+	readerDone := make(chan struct{})
+	go c.read(commands, readerDone)
+
+	reset := lastID != "" && !complete
+	if !c.send(wsReply{Type: "ack", OK: true, EventID: c.broker.LastID(), Reset: reset}) {
+		return
+	}
+
+	// A resuming client has not subscribed yet, so its replay and anything
+	// published meanwhile wait in the client queue until it does
+	holding := lastID != "" && complete
+	if !holding {
+		replay = nil
+	}
+
+	ticker := time.NewTicker(c.pingInterval)
+	defer ticker.Stop()
+
+	for {
+		live := client.C
+		if holding {
+			live = nil
+		}
+
+		select {
+		case <-readerDone:
+			return
+		case <-client.Done():
+			if client.Overflowed() {
+				log.Printf("Dropped slow WebSocket client (user %d)", c.claims.UserID)
+			}
+			return
+		case msg := <-live:
+			if !c.sendEvent(msg) {
+				return
+			}
+		case cmd := <-commands:
+			if !c.handle(cmd) {
+				return
+			}
+			if holding && cmd.Type == "subscribe" && !c.sub.empty() {
+				holding = false
+				for _, msg := range replay {
+					if !c.sendEvent(msg) {
+						return
+					}
+				}
+				replay = nil
+			}
+		case <-ticker.C:
+			if !c.session.valid() || !c.write(`{"type":"ping"}`) {
+				return
+			}
+		}
+	}
+}
+
+// read parses client messages until the connection fails or goes quiet for
+// two ping intervals.
+func (c *wsConn) read(commands chan<- wsClientMessage, done chan<- struct{}) {
+	defer close(done)
+	for {
+		c.ws.SetReadDeadline(time.Now().Add(2 * c.pingInterval))
+		var msg wsClientMessage
+		if err := websocket.JSON.Receive(c.ws, &msg); err != nil {
+			var syntaxErr *json.SyntaxError
+			var typeErr *json.UnmarshalTypeError
+			if !errors.As(err, &syntaxErr) && !errors.As(err, &typeErr) {
+				return
+			}
+			// The frame was consumed; answer it and keep reading
+			msg = wsClientMessage{Type: "invalid"}
+		}
+		select {
+		case commands <- msg:
+		default:
+			log.Printf("Closing flooding WebSocket client (user %d)", c.claims.UserID)
+			return
+		}
+	}
+}
+
+func (c *wsConn) handle(msg wsClientMessage) bool {
+	reply := wsReply{Type: "ack", RequestID: msg.RequestID, OK: true}
+
+	switch msg.Type {
+	case "subscribe", "unsubscribe":
+		if err := c.sub.apply(msg); err != nil {
+			reply.OK, reply.Error = false, err.Error()
+		}
+	case "ack":
+		if c.claims.Role != "admin" {
+			reply.OK, reply.Error = false, "only admins can acknowledge alerts"
+			break
+		}
+		if err := c.alerts.Acknowledge(msg.IncidentID, c.claims.UserID); err != nil {
+			reply.OK = false
+			if err == services.ErrAlertIncidentNotFound {
+				reply.Error = "alert incident not found"
+			} else {
+				log.Printf("Failed to acknowledge alert incident %d: %v", msg.IncidentID, err)
+				reply.Error = "failed to acknowledge alert"
+			}
+		}
+	case "ping":
+		c.viewers.Set(c.client, c.visible(msg.Viewing))
+	case "invalid":
+		reply.OK, reply.Error = false, "invalid JSON"
+	default:
+		reply.OK, reply.Error = false, "unknown message type "+strconv.Quote(msg.Type)
+	}
+
+	return c.send(reply)
+}
+
+// visible drops cameras the user's plan does not show, so viewer counts
+// cannot be inflated with arbitrary IDs.
+func (c *wsConn) visible(ids []int) []int {
+	if c.scope.admin {
+		return ids
+	}
+	c.scope.refresh()
+	if c.scope.allCameras {
+		return ids
+	}
+	var visible []int
+	for _, id := range ids {
+		if c.scope.cameraIDs[id] {
+			visible = append(visible, id)
+		}
+	}
+	return visible
+}
+
+func (c *wsConn) sendEvent(msg realtime.Message) bool {
+	if !c.sub.matches(msg.Event) || !c.scope.allows(msg.Event) {
+		return true
+	}
+	var b strings.Builder
+	b.WriteString(`{"type":"event","eventId":"`)
+	b.WriteString(c.broker.ID(msg.Seq))
+	b.WriteString(`","event":`)
+	b.Write(msg.JSON)
+	b.WriteString("}")
+	return c.write(b.String())
+}
+
+func (c *wsConn) send(reply wsReply) bool {
+	data, err := json.Marshal(reply)
+	if err != nil {
+		return false
+	}
+	return c.write(string(data))
+}
+
+func (c *wsConn) write(frame string) bool {
+	c.ws.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	return websocket.Message.Send(c.ws, frame) == nil
+}
+
+func isWebSocketUpgrade(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+// GetRealtimeStats reports connected live clients (SSE and WebSocket) and
+// how many WebSocket clients are watching each camera.
+func GetRealtimeStats(broker *realtime.Broker, viewers *realtime.Viewers) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		counts := viewers.Counts()
+		byCamera := make(map[string]int, len(counts))
+		total := 0
+		for id, n := range counts {
+			byCamera[strconv.Itoa(id)] = n
+			total += n
+		}
+
+		responses.SendSuccessResponse(w, http.StatusOK, map[string]interface{}{
+			"connections":   broker.Clients(),
+			"viewers":       total,
+			"viewersByCctv": byCamera,
+		})
+	}
+}
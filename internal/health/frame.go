@@ -0,0 +1,121 @@
+package health
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+
+	// Decoders for snapshot sources
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	"cctv-api/internal/models"
+)
+
+var errFrameTooLarge = errors.New("frame exceeds size limit")
+
+// GrabFrame fetches one still image from a snapshot source or the next
+// frame of an MJPEG stream.
+func (p *Prober) GrabFrame(ctx context.Context, sourceURL, sourceType string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.opts.Timeout)
+	defer cancel()
+
+	resp, err := p.get(ctx, sourceURL, "")
+	if err != nil {
+		return nil, errors.New(describeError(err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+
+	if sourceType == models.SourceMJPEG {
+		return readJPEGFrame(bufio.NewReader(resp.Body), p.opts.MaxFrameBytes)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, p.opts.MaxFrameBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > p.opts.MaxFrameBytes {
+		return nil, errFrameTooLarge
+	}
+	return data, nil
+}
+
+// checkMJPEG reads a multipart MJPEG stream until one complete JPEG frame
+// has arrived.
+func (p *Prober) checkMJPEG(body *bufio.Reader) (string, string) {
+	frame, err := readJPEGFrame(body, p.opts.MaxFrameBytes)
+	if err != nil {
+		return StatusOffline, "no frame received: " + describeError(err)
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(frame))
+	if err != nil {
+		return StatusDegraded, "corrupt frame"
+	}
+	return StatusOnline, fmt.Sprintf("frame %dx%d, %d bytes", cfg.Width, cfg.Height, len(frame))
+}
+
+// checkSnapshot expects a single still image as the response body.
+func (p *Prober) checkSnapshot(body io.Reader) (string, string) {
+	data, err := io.ReadAll(io.LimitReader(body, p.opts.MaxFrameBytes+1))
+	if err != nil {
+		return StatusOffline, "no frame received: " + describeError(err)
+	}
+	if len(data) == 0 {
+		return StatusOffline, "empty response"
+	}
+	if int64(len(data)) > p.opts.MaxFrameBytes {
+		return StatusDegraded, "frame exceeds size limit"
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return StatusDegraded, "response is not an image"
+	}
+	return StatusOnline, fmt.Sprintf("%s frame %dx%d, %d bytes", format, cfg.Width, cfg.Height, len(data))
+}
+
+// readJPEGFrame scans for a JPEG start-of-image marker and returns
+// everything up to the matching end-of-image marker. Multipart boundaries
+// and part headers are skipped, which also copes with cameras that send
+// malformed multipart framing.
+func readJPEGFrame(r *bufio.Reader, maxBytes int64) ([]byte, error) {
+	var read int64
+	var prev byte
+	started := false
+	var frame bytes.Buffer
+
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		read++
+		if read > maxBytes {
+			return nil, fmt.Errorf("no complete frame within %d bytes", maxBytes)
+		}
+
+		if !started {
+			if prev == 0xFF && b == 0xD8 {
+				started = true
+				frame.Write([]byte{0xFF, 0xD8})
+			}
+			prev = b
+			continue
+		}
+
+		frame.WriteByte(b)
+		if prev == 0xFF && b == 0xD9 {
+			return frame.Bytes(), nil
+		}
+		prev = b
+	}
+}
@@ -0,0 +1,231 @@
+package health
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxPlaylistBytes = 1 << 20
+
+type segment struct {
+	URI             string
+	Duration        float64
+	ProgramDateTime time.Time
+}
+
+type playlist struct {
+	Variants       []string
+	TargetDuration float64
+	MediaSequence  int64
+	Segments       []segment
+	EndList        bool
+}
+
+func (pl *playlist) isMaster() bool {
+	return len(pl.Variants) > 0
+}
+
+// hlsState remembers the newest segment seen per playlist, so playlists
+// without timestamps can still be detected as stuck.
+type hlsState struct {
+	lastSequence int64
+	changedAt    time.Time
+	seenAt       time.Time
+}
+
+var errNotPlaylist = errors.New("not an m3u8 playlist")
+
+func parsePlaylist(r io.Reader) (*playlist, error) {
+	scanner := bufio.NewScanner(io.LimitReader(r, maxPlaylistBytes))
+	scanner.Buffer(make([]byte, 64*1024), 64*1024)
+
+	pl := &playlist{}
+	first := true
+	var pendingVariant bool
+	var pendingDuration float64
+	var pendingPDT time.Time
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if first {
+			if line != "#EXTM3U" {
+				return nil, errNotPlaylist
+			}
+			first = false
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "#EXT-X-STREAM-INF"):
+			pendingVariant = true
+		case strings.HasPrefix(line, "#EXT-X-TARGETDURATION:"):
+			pl.TargetDuration, _ = strconv.ParseFloat(strings.TrimPrefix(line, "#EXT-X-TARGETDURATION:"), 64)
+		case strings.HasPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"):
+			pl.MediaSequence, _ = strconv.ParseInt(strings.TrimPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"), 10, 64)
+		case strings.HasPrefix(line, "#EXTINF:"):
+			value := strings.TrimPrefix(line, "#EXTINF:")
+			if i := strings.IndexByte(value, ','); i >= 0 {
+				value = value[:i]
+			}
+			pendingDuration, _ = strconv.ParseFloat(value, 64)
+		case strings.HasPrefix(line, "#EXT-X-PROGRAM-DATE-TIME:"):
+			pendingPDT, _ = time.Parse(time.RFC3339Nano, strings.TrimPrefix(line, "#EXT-X-PROGRAM-DATE-TIME:"))
+		case line == "#EXT-X-ENDLIST":
+			pl.EndList = true
+		case strings.HasPrefix(line, "#"):
+			// Other tags don't matter for health
+		case pendingVariant:
+			pl.Variants = append(pl.Variants, line)
+			pendingVariant = false
+		default:
+			seg := segment{URI: line, Duration: pendingDuration, ProgramDateTime: pendingPDT}
+			// A program date-time carries over to the following segments
+			if n := len(pl.Segments); n > 0 && seg.ProgramDateTime.IsZero() {
+				prev := pl.Segments[n-1]
+				if !prev.ProgramDateTime.IsZero() {
+					seg.ProgramDateTime = prev.ProgramDateTime.Add(seconds(prev.Duration))
+				}
+			}
+			pl.Segments = append(pl.Segments, seg)
+			pendingDuration = 0
+			pendingPDT = time.Time{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if first {
+		return nil, errNotPlaylist
+	}
+	return pl, nil
+}
+
+// checkHLS follows a master playlist to its first variant and checks the
+// media playlist: a sane target duration, fresh segments and a newest
+// segment that can actually be downloaded.
+func (p *Prober) checkHLS(ctx context.Context, base *url.URL, resp *http.Response, body io.Reader) (string, string) {
+	pl, err := parsePlaylist(body)
+	if err != nil {
+		return StatusOffline, "invalid playlist: " + err.Error()
+	}
+
+	mediaURL := base
+	lastModified := resp.Header.Get("Last-Modified")
+	if pl.isMaster() {
+		mediaURL, err = base.Parse(pl.Variants[0])
+		if err != nil {
+			return StatusOffline, "invalid variant URI"
+		}
+		variantResp, err := p.get(ctx, mediaURL.String(), "")
+		if err != nil {
+			return StatusOffline, "variant playlist: " + describeError(err)
+		}
+		defer variantResp.Body.Close()
+		if variantResp.StatusCode < 200 || variantResp.StatusCode > 299 {
+			return StatusOffline, fmt.Sprintf("variant playlist: HTTP %d", variantResp.StatusCode)
+		}
+		pl, err = parsePlaylist(variantResp.Body)
+		if err != nil {
+			return StatusOffline, "invalid variant playlist: " + err.Error()
+		}
+		if pl.isMaster() {
+			return StatusOffline, "variant playlist is another master playlist"
+		}
+		lastModified = variantResp.Header.Get("Last-Modified")
+	}
+
+	if len(pl.Segments) == 0 {
+		return StatusOffline, "playlist has no segments"
+	}
+
+	target := pl.TargetDuration
+	if target <= 0 || seconds(target) > p.opts.MaxTargetDuration {
+		return StatusDegraded, fmt.Sprintf("unreasonable target duration %gs", target)
+	}
+	for _, seg := range pl.Segments {
+		// Segments may not exceed the target duration once rounded
+		if math.Round(seg.Duration) > target {
+			return StatusDegraded, fmt.Sprintf("segment duration %gs exceeds target duration %gs", seg.Duration, target)
+		}
+	}
+
+	if pl.EndList {
+		return StatusDegraded, "playlist has ended"
+	}
+
+	now := time.Now()
+	staleAfter := seconds(target) * time.Duration(p.opts.StaleSegments)
+	last := pl.Segments[len(pl.Segments)-1]
+	lastSequence := pl.MediaSequence + int64(len(pl.Segments)) - 1
+
+	if !last.ProgramDateTime.IsZero() {
+		age := now.Sub(last.ProgramDateTime.Add(seconds(last.Duration)))
+		if age > staleAfter {
+			return StatusDegraded, fmt.Sprintf("newest segment is %s old", age.Round(time.Second))
+		}
+	} else if modified, err := http.ParseTime(lastModified); err == nil && now.Sub(modified) > staleAfter {
+		return StatusDegraded, fmt.Sprintf("playlist not modified for %s", now.Sub(modified).Round(time.Second))
+	} else if stuck := p.trackSequence(mediaURL.String(), lastSequence, now); stuck > staleAfter {
+		return StatusDegraded, fmt.Sprintf("playlist not updated for %s", stuck.Round(time.Second))
+	}
+
+	segURL, err := mediaURL.Parse(last.URI)
+	if err != nil {
+		return StatusDegraded, "invalid segment URI"
+	}
+	segResp, err := p.get(ctx, segURL.String(), "bytes=0-1023")
+	if err != nil {
+		return StatusDegraded, "segment: " + describeError(err)
+	}
+	segResp.Body.Close()
+	if segResp.StatusCode < 200 || segResp.StatusCode > 299 {
+		return StatusDegraded, fmt.Sprintf("segment: HTTP %d", segResp.StatusCode)
+	}
+
+	return StatusOnline, fmt.Sprintf("%d segments, target duration %gs", len(pl.Segments), target)
+}
+
+// trackSequence records the newest segment of a playlist and returns how
+// long it has gone unchanged.
+func (p *Prober) trackSequence(key string, sequence int64, now time.Time) time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	state, ok := p.hls[key]
+	if !ok || state.lastSequence != sequence {
+		p.hls[key] = hlsState{lastSequence: sequence, changedAt: now, seenAt: now}
+		return 0
+	}
+	state.seenAt = now
+	p.hls[key] = state
+	return now.Sub(state.changedAt)
+}
+
+// ForgetUnseen drops what is remembered about playlists that have not been
+// probed since before, such as those of deleted cameras or old source URLs.
+func (p *Prober) ForgetUnseen(before time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for key, state := range p.hls {
+		if state.seenAt.Before(before) {
+			delete(p.hls, key)
+		}
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
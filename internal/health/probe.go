@@ -0,0 +1,207 @@
+// Package health probes camera streams to find out whether they are
+// actually delivering video.
+package health
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"cctv-api/internal/models"
+	"cctv-api/internal/netguard"
+)
+
+const (
+	StatusOnline   = "online"
+	StatusOffline  = "offline"
+	StatusDegraded = "degraded"
+)
+
+// Result is the outcome of one probe. Latency is the time until the source
+// answered with response headers.
+type Result struct {
+	Status    string
+	Latency   time.Duration
+	Detail    string
+	CheckedAt time.Time
+}
+
+type Options struct {
+	Timeout time.Duration
+	// HLS playlists with a target duration above this are reported as degraded
+	MaxTargetDuration time.Duration
+	// A live playlist is stale once its newest segment is older than this
+	// many target durations
+	StaleSegments int
+	// Upper bound on a single snapshot or MJPEG frame
+	MaxFrameBytes int64
+	// Addresses sources may resolve to; nil refuses internal addresses
+	Guard *netguard.Guard
+}
+
+// Prober checks stream URLs. It is safe for concurrent use.
+type Prober struct {
+	client *http.Client
+	opts   Options
+
+	mu  sync.Mutex
+	hls map[string]hlsState
+}
+
+func NewProber(opts Options) *Prober {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	if opts.MaxTargetDuration <= 0 {
+		opts.MaxTargetDuration = 30 * time.Second
+	}
+	if opts.StaleSegments <= 0 {
+		opts.StaleSegments = 3
+	}
+	if opts.MaxFrameBytes <= 0 {
+		opts.MaxFrameBytes = 5 << 20
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = opts.Guard.Dialer(opts.Timeout).DialContext
+	transport.MaxIdleConnsPerHost = 4
+	transport.ResponseHeaderTimeout = opts.Timeout
+
+	return &Prober{
+		client: &http.Client{Transport: transport},
+		opts:   opts,
+		hls:    make(map[string]hlsState),
+	}
+}
+
+// Probe checks sourceURL the way its source type is played: HLS playlists
+// and their segments, an RTSP DESCRIBE, a frame of an MJPEG stream, a
+// snapshot image or, for embeds, that the page loads. An empty sourceType
+// checks HTTP sources by what they serve.
+func (p *Prober) Probe(ctx context.Context, sourceURL, sourceType string) Result {
+	ctx, cancel := context.WithTimeout(ctx, p.opts.Timeout)
+	defer cancel()
+
+	u, err := url.Parse(sourceURL)
+	if err != nil {
+		return p.result(StatusOffline, 0, "unsupported source URL")
+	}
+	if sourceType == models.SourceRTSP {
+		if u.Scheme != "rtsp" && u.Scheme != "rtsps" {
+			return p.result(StatusOffline, 0, "unsupported source URL")
+		}
+		return p.checkRTSP(ctx, u)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return p.result(StatusOffline, 0, "unsupported source URL")
+	}
+
+	start := time.Now()
+	resp, err := p.get(ctx, sourceURL, "")
+	if err != nil {
+		return p.result(StatusOffline, 0, describeError(err))
+	}
+	defer resp.Body.Close()
+	latency := time.Since(start)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return p.result(StatusOffline, latency, fmt.Sprintf("HTTP %d", resp.StatusCode))
+	}
+
+	body := bufio.NewReader(resp.Body)
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+
+	var status, detail string
+	switch sourceType {
+	case models.SourceHLS:
+		if !isPlaylist(mediaType, u.Path, body) {
+			return p.result(StatusOffline, latency, "source is not an HLS playlist")
+		}
+		status, detail = p.checkHLS(ctx, u, resp, body)
+	case models.SourceMJPEG:
+		status, detail = p.checkMJPEG(body)
+	case models.SourceSnapshot:
+		status, detail = p.checkSnapshot(body)
+	case models.SourceEmbed:
+		status, detail = StatusOnline, "page loaded"
+	default:
+		switch {
+		case isPlaylist(mediaType, u.Path, body):
+			status, detail = p.checkHLS(ctx, u, resp, body)
+		case strings.HasPrefix(mediaType, "multipart/"):
+			status, detail = p.checkMJPEG(body)
+		default:
+			status, detail = p.checkSnapshot(body)
+		}
+	}
+	return p.result(status, latency, detail)
+}
+
+// IsPlaylist fetches sourceURL and reports whether it serves an HLS
+// playlist.
+func (p *Prober) IsPlaylist(ctx context.Context, sourceURL string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.opts.Timeout)
+	defer cancel()
+
+	u, err := url.Parse(sourceURL)
+	if err != nil {
+		return false, err
+	}
+	resp, err := p.get(ctx, sourceURL, "")
+	if err != nil {
+		return false, errors.New(describeError(err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return false, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return isPlaylist(mediaType, u.Path, bufio.NewReader(resp.Body)), nil
+}
+
+func (p *Prober) get(ctx context.Context, rawURL, byteRange string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "cctv-api-health/1.0")
+	if byteRange != "" {
+		req.Header.Set("Range", byteRange)
+	}
+	return p.client.Do(req)
+}
+
+func (p *Prober) result(status string, latency time.Duration, detail string) Result {
+	return Result{Status: status, Latency: latency, Detail: detail, CheckedAt: time.Now()}
+}
+
+func isPlaylist(mediaType, path string, body *bufio.Reader) bool {
+	switch mediaType {
+	case "application/vnd.apple.mpegurl", "application/x-mpegurl", "audio/mpegurl", "audio/x-mpegurl":
+		return true
+	}
+	if strings.HasSuffix(strings.ToLower(path), ".m3u8") {
+		return true
+	}
+	head, _ := body.Peek(7)
+	return string(head) == "#EXTM3U"
+}
+
+func describeError(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "timed out"
+	}
+	if errors.Is(err, netguard.ErrBlocked) {
+		return "source address not allowed"
+	}
+	return err.Error()
+}
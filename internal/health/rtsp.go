@@ -0,0 +1,178 @@
+package health
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSDPBytes bounds the session description read from a DESCRIBE answer.
+const maxSDPBytes = 64 << 10
+
+// rtspResponse is the part of an RTSP answer the probe needs.
+type rtspResponse struct {
+	status int
+	header textproto.MIMEHeader
+	body   []byte
+}
+
+// checkRTSP sends a DESCRIBE and expects a session description with a video
+// track. Credentials in the URL are sent with Basic or Digest auth, as the
+// camera asks for.
+func (p *Prober) checkRTSP(ctx context.Context, u *url.URL) Result {
+	host := u.Host
+	if u.Port() == "" {
+		if u.Scheme == "rtsps" {
+			host = net.JoinHostPort(u.Hostname(), "322")
+		} else {
+			host = net.JoinHostPort(u.Hostname(), "554")
+		}
+	}
+
+	start := time.Now()
+	conn, err := p.opts.Guard.Dialer(p.opts.Timeout).DialContext(ctx, "tcp", host)
+	if err != nil {
+		return p.result(StatusOffline, 0, describeError(err))
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if u.Scheme == "rtsps" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: u.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return p.result(StatusOffline, 0, describeError(err))
+		}
+		conn = tlsConn
+	}
+
+	// Credentials go in the Authorization header, not the request URI
+	target := *u
+	target.User = nil
+	uri := target.String()
+	reader := bufio.NewReader(conn)
+
+	resp, err := rtspDescribe(conn, reader, uri, 1, "")
+	if err != nil {
+		return p.result(StatusOffline, 0, "DESCRIBE: "+describeError(err))
+	}
+	latency := time.Since(start)
+
+	if resp.status == 401 && u.User != nil {
+		auth := rtspAuthorization(u.User, resp.header.Get("WWW-Authenticate"), uri)
+		if auth != "" {
+			resp, err = rtspDescribe(conn, reader, uri, 2, auth)
+			if err != nil {
+				return p.result(StatusOffline, latency, "DESCRIBE: "+describeError(err))
+			}
+		}
+	}
+
+	switch {
+	case resp.status == 401:
+		return p.result(StatusDegraded, latency, "camera rejected the credentials")
+	case resp.status < 200 || resp.status > 299:
+		return p.result(StatusOffline, latency, fmt.Sprintf("RTSP %d", resp.status))
+	}
+
+	var tracks []string
+	for _, line := range strings.Split(string(resp.body), "\n") {
+		media, ok := strings.CutPrefix(strings.TrimSpace(line), "m=")
+		if fields := strings.Fields(media); ok && len(fields) > 0 {
+			tracks = append(tracks, fields[0])
+		}
+	}
+	for _, track := range tracks {
+		if track == "video" {
+			return p.result(StatusOnline, latency, fmt.Sprintf("%d track(s): %s", len(tracks), strings.Join(tracks, ", ")))
+		}
+	}
+	return p.result(StatusDegraded, latency, "session has no video track")
+}
+
+func rtspDescribe(w io.Writer, r *bufio.Reader, uri string, cseq int, authorization string) (*rtspResponse, error) {
+	req := "DESCRIBE " + uri + " RTSP/1.0\r\n" +
+		"CSeq: " + strconv.Itoa(cseq) + "\r\n" +
+		"Accept: application/sdp\r\n" +
+		"User-Agent: cctv-api-health/1.0\r\n"
+	if authorization != "" {
+		req += "Authorization: " + authorization + "\r\n"
+	}
+	if _, err := io.WriteString(w, req+"\r\n"); err != nil {
+		return nil, err
+	}
+
+	tp := textproto.NewReader(r)
+	line, err := tp.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+	proto, rest, _ := strings.Cut(line, " ")
+	code, _, _ := strings.Cut(rest, " ")
+	status, err := strconv.Atoi(code)
+	if !strings.HasPrefix(proto, "RTSP/") || err != nil {
+		return nil, fmt.Errorf("not an RTSP server")
+	}
+
+	header, err := tp.ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	resp := &rtspResponse{status: status, header: header}
+
+	// The body has to be drained before the connection can be reused
+	if length, err := strconv.Atoi(header.Get("Content-Length")); err == nil && length > 0 {
+		if length > maxSDPBytes {
+			return nil, fmt.Errorf("session description too large")
+		}
+		resp.body = make([]byte, length)
+		if _, err := io.ReadFull(r, resp.body); err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+// rtspAuthorization answers a Basic or Digest challenge for a DESCRIBE of
+// uri, or returns "" for challenges it does not understand.
+func rtspAuthorization(user *url.Userinfo, challenge, uri string) string {
+	username := user.Username()
+	password, _ := user.Password()
+
+	scheme, params, _ := strings.Cut(challenge, " ")
+	switch strings.ToLower(scheme) {
+	case "basic":
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+	case "digest":
+		values := map[string]string{}
+		for _, part := range strings.Split(params, ",") {
+			key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+			if ok {
+				values[strings.ToLower(key)] = strings.Trim(value, `"`)
+			}
+		}
+		realm, nonce := values["realm"], values["nonce"]
+		ha1 := md5Hex(username + ":" + realm + ":" + password)
+		ha2 := md5Hex("DESCRIBE:" + uri)
+		response := md5Hex(ha1 + ":" + nonce + ":" + ha2)
+		return fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", response="%s"`,
+			username, realm, nonce, uri, response)
+	}
+	return ""
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,143 @@
+// Package imaging resizes and encodes images in pure Go, for thumbnails
+// and frame analysis.
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"image/jpeg"
+
+	// Decoders for camera frames and uploads
+	_ "image/gif"
+	_ "image/png"
+)
+
+// Decode decodes a JPEG, PNG or GIF image.
+func Decode(data []byte) (image.Image, string, error) {
+	return image.Decode(bytes.NewReader(data))
+}
+
+// DecodeConfig reads an image's format and dimensions without decoding it,
+// to turn away huge images before they take up memory.
+func DecodeConfig(data []byte) (image.Config, string, error) {
+	return image.DecodeConfig(bytes.NewReader(data))
+}
+
+// toRGBA returns img as an *image.RGBA with its origin at (0, 0).
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) {
+		return rgba
+	}
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Rect, img, b.Min, draw.Src)
+	return rgba
+}
+
+// Resize scales img to width x height. Each output pixel is the average of
+// the source pixels it covers, which keeps downscaled frames smooth;
+// enlarging repeats pixels.
+func Resize(img image.Image, width, height int) *image.RGBA {
+	src := toRGBA(img)
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	if sw == 0 || sh == 0 || width <= 0 || height <= 0 {
+		return dst
+	}
+
+	for y := 0; y < height; y++ {
+		y0 := y * sh / height
+		y1 := (y + 1) * sh / height
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < width; x++ {
+			x0 := x * sw / width
+			x1 := (x + 1) * sw / width
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, b, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride+x0*4 : sy*src.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					r += uint32(row[i])
+					g += uint32(row[i+1])
+					b += uint32(row[i+2])
+					a += uint32(row[i+3])
+					n++
+				}
+			}
+			i := y*dst.Stride + x*4
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// Grayscale returns the luma of img, weighted as in ITU-R BT.601.
+func Grayscale(img image.Image) *image.Gray {
+	src := toRGBA(img)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	gray := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		row := src.Pix[y*src.Stride : y*src.Stride+w*4]
+		for x := 0; x < w; x++ {
+			r, g, b := uint32(row[x*4]), uint32(row[x*4+1]), uint32(row[x*4+2])
+			gray.Pix[y*gray.Stride+x] = uint8((299*r + 587*g + 114*b) / 1000)
+		}
+	}
+	return gray
+}
+
+// Fit scales img down to fit within maxWidth x maxHeight, keeping its
+// aspect ratio. Images that already fit are returned as they are.
+func Fit(img image.Image, maxWidth, maxHeight int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= maxWidth && h <= maxHeight {
+		return img
+	}
+	if w*maxHeight > h*maxWidth {
+		h = max(1, h*maxWidth/w)
+		w = maxWidth
+	} else {
+		w = max(1, w*maxHeight/h)
+		h = maxHeight
+	}
+	return Resize(img, w, h)
+}
+
+// Fill scales and crops img to exactly width x height: the largest centred
+// part of img with that aspect ratio is kept and resized.
+func Fill(img image.Image, width, height int) *image.RGBA {
+	src := toRGBA(img)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	if w == 0 || h == 0 || width <= 0 || height <= 0 {
+		return image.NewRGBA(image.Rect(0, 0, max(width, 0), max(height, 0)))
+	}
+
+	cropW, cropH := w, h
+	if w*height > h*width {
+		cropW = max(1, h*width/height)
+	} else {
+		cropH = max(1, w*height/width)
+	}
+	x0, y0 := (w-cropW)/2, (h-cropH)/2
+	return Resize(src.SubImage(image.Rect(x0, y0, x0+cropW, y0+cropH)), width, height)
+}
+
+// EncodeJPEG encodes img as a JPEG of the given quality (1-100). The result
+// carries no metadata: EXIF, including any location, is never written.
+func EncodeJPEG(img image.Image, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
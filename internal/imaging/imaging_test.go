@@ -0,0 +1,181 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func uniform(w, h int, c color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestResize(t *testing.T) {
+	// Left half black, right half white
+	src := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 4; x++ {
+			v := uint8(0)
+			if x >= 2 {
+				v = 255
+			}
+			src.SetRGBA(x, y, color.RGBA{v, v, v, 255})
+		}
+	}
+
+	tests := []struct {
+		name          string
+		width, height int
+		want          []uint8 // red channel, row by row
+	}{
+		{"same size", 4, 2, []uint8{0, 0, 255, 255, 0, 0, 255, 255}},
+		{"halved", 2, 1, []uint8{0, 255}},
+		{"averaged", 1, 1, []uint8{127}},
+		{"enlarged", 8, 1, []uint8{0, 0, 0, 0, 255, 255, 255, 255}},
+		{"empty", 0, 0, nil},
+	}
+
+	for _, tt := range tests {
+		dst := Resize(src, tt.width, tt.height)
+		if dst.Rect.Dx() != tt.width || dst.Rect.Dy() != tt.height {
+			t.Errorf("%s: Resize() is %v, want %dx%d", tt.name, dst.Rect, tt.width, tt.height)
+			continue
+		}
+		var got []uint8
+		for i := 0; i < len(dst.Pix); i += 4 {
+			got = append(got, dst.Pix[i])
+		}
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("%s: Resize() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFit(t *testing.T) {
+	tests := []struct {
+		w, h                  int
+		maxWidth, maxHeight   int
+		wantWidth, wantHeight int
+	}{
+		{1920, 1080, 320, 320, 320, 180},
+		{1080, 1920, 320, 320, 180, 320},
+		{640, 480, 640, 480, 640, 480},
+		{100, 50, 320, 320, 100, 50},
+		{4000, 1, 100, 100, 100, 1},
+	}
+
+	for _, tt := range tests {
+		b := Fit(image.NewRGBA(image.Rect(0, 0, tt.w, tt.h)), tt.maxWidth, tt.maxHeight).Bounds()
+		if b.Dx() != tt.wantWidth || b.Dy() != tt.wantHeight {
+			t.Errorf("Fit(%dx%d, %dx%d) = %dx%d, want %dx%d", tt.w, tt.h, tt.maxWidth, tt.maxHeight, b.Dx(), b.Dy(), tt.wantWidth, tt.wantHeight)
+		}
+	}
+}
+
+func TestFill(t *testing.T) {
+	// A wide frame whose outer thirds are red and centre is blue
+	src := uniform(300, 100, color.RGBA{255, 0, 0, 255})
+	for y := 0; y < 100; y++ {
+		for x := 100; x < 200; x++ {
+			src.SetRGBA(x, y, color.RGBA{0, 0, 255, 255})
+		}
+	}
+
+	tests := []struct {
+		name          string
+		width, height int
+		wantCentre    color.RGBA
+		wantCorner    color.RGBA
+	}{
+		{"square keeps the centre", 50, 50, color.RGBA{0, 0, 255, 255}, color.RGBA{0, 0, 255, 255}},
+		{"same ratio keeps everything", 30, 10, color.RGBA{0, 0, 255, 255}, color.RGBA{255, 0, 0, 255}},
+		{"tall keeps the centre", 10, 40, color.RGBA{0, 0, 255, 255}, color.RGBA{0, 0, 255, 255}},
+	}
+
+	for _, tt := range tests {
+		dst := Fill(src, tt.width, tt.height)
+		if dst.Rect.Dx() != tt.width || dst.Rect.Dy() != tt.height {
+			t.Errorf("%s: Fill() is %v, want %dx%d", tt.name, dst.Rect, tt.width, tt.height)
+			continue
+		}
+		if got := dst.RGBAAt(tt.width/2, tt.height/2); got != tt.wantCentre {
+			t.Errorf("%s: centre %v, want %v", tt.name, got, tt.wantCentre)
+		}
+		if got := dst.RGBAAt(0, 0); got != tt.wantCorner {
+			t.Errorf("%s: corner %v, want %v", tt.name, got, tt.wantCorner)
+		}
+	}
+
+	if b := Fill(image.NewRGBA(image.Rect(0, 0, 0, 0)), 16, 9).Rect; b.Dx() != 16 || b.Dy() != 9 {
+		t.Errorf("Fill(empty) is %v, want 16x9", b)
+	}
+}
+
+func TestGrayscale(t *testing.T) {
+	tests := []struct {
+		in   color.RGBA
+		want uint8
+	}{
+		{color.RGBA{0, 0, 0, 255}, 0},
+		{color.RGBA{255, 255, 255, 255}, 255},
+		{color.RGBA{255, 0, 0, 255}, 76},
+		{color.RGBA{0, 255, 0, 255}, 149},
+		{color.RGBA{0, 0, 255, 255}, 29},
+	}
+
+	for _, tt := range tests {
+		gray := Grayscale(uniform(2, 2, tt.in))
+		if gray.Rect.Dx() != 2 || gray.Rect.Dy() != 2 {
+			t.Fatalf("Grayscale() is %v, want 2x2", gray.Rect)
+		}
+		if got := gray.GrayAt(1, 1).Y; got != tt.want {
+			t.Errorf("Grayscale(%v) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeConfigAndEncodeJPEG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, uniform(64, 48, color.RGBA{10, 20, 30, 255})); err != nil {
+		t.Fatal(err)
+	}
+	jpg, err := EncodeJPEG(uniform(64, 48, color.RGBA{10, 20, 30, 255}), 80)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		data       []byte
+		wantFormat string
+		wantErr    bool
+	}{
+		{"png", buf.Bytes(), "png", false},
+		{"jpeg", jpg, "jpeg", false},
+		{"not an image", []byte("GIF87a? no"), "", true},
+		{"empty", nil, "", true},
+	}
+
+	for _, tt := range tests {
+		cfg, format, err := DecodeConfig(tt.data)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: DecodeConfig() error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && (format != tt.wantFormat || cfg.Width != 64 || cfg.Height != 48) {
+			t.Errorf("%s: DecodeConfig() = %s %dx%d, want %s 64x48", tt.name, format, cfg.Width, cfg.Height, tt.wantFormat)
+		}
+	}
+
+	if bytes.Contains(jpg, []byte("Exif")) {
+		t.Error("EncodeJPEG wrote EXIF data")
+	}
+}
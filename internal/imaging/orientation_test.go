@@ -0,0 +1,99 @@
+package imaging
+
+import (
+	"encoding/binary"
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+// exifJPEG builds the start of a JPEG whose EXIF segment holds a single
+// orientation entry, in big- or little-endian TIFF byte order.
+func exifJPEG(order binary.ByteOrder, orientation uint16) []byte {
+	tiff := make([]byte, 8+2+12+4)
+	if order == binary.BigEndian {
+		copy(tiff, "MM")
+	} else {
+		copy(tiff, "II")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8) // first IFD
+	order.PutUint16(tiff[8:], 1) // one entry
+	order.PutUint16(tiff[10:], exifOrientationTag)
+	order.PutUint16(tiff[12:], 3) // SHORT
+	order.PutUint32(tiff[14:], 1) // count
+	order.PutUint16(tiff[18:], orientation)
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	length := len(segment) + 2
+	data := []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x04, 0x00, 0x00} // an empty APP0 first
+	data = append(data, 0xFF, 0xE1, byte(length>>8), byte(length))
+	data = append(data, segment...)
+	return append(data, 0xFF, 0xDA, 0x00, 0x02)
+}
+
+func TestOrientation(t *testing.T) {
+	truncated := exifJPEG(binary.BigEndian, 6)
+
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{"big endian", exifJPEG(binary.BigEndian, 6), 6},
+		{"little endian", exifJPEG(binary.LittleEndian, 8), 8},
+		{"upright", exifJPEG(binary.BigEndian, 1), 1},
+		{"out of range", exifJPEG(binary.BigEndian, 9), 1},
+		{"no EXIF", []byte{0xFF, 0xD8, 0xFF, 0xDA, 0x00, 0x02}, 1},
+		{"truncated segment", truncated[:20], 1},
+		{"not a JPEG", []byte("\x89PNG\r\n\x1a\n"), 1},
+		{"empty", nil, 1},
+	}
+
+	for _, tt := range tests {
+		if got := Orientation(tt.data); got != tt.want {
+			t.Errorf("%s: Orientation() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// A 3x2 image whose pixels are numbered 0-5 in the red channel:
+	//   0 1 2
+	//   3 4 5
+	src := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	for i := 0; i < 6; i++ {
+		src.SetRGBA(i%3, i/3, color.RGBA{uint8(i), 0, 0, 255})
+	}
+
+	tests := []struct {
+		orientation int
+		want        [][]uint8
+	}{
+		{1, [][]uint8{{0, 1, 2}, {3, 4, 5}}},
+		{2, [][]uint8{{2, 1, 0}, {5, 4, 3}}},
+		{3, [][]uint8{{5, 4, 3}, {2, 1, 0}}},
+		{4, [][]uint8{{3, 4, 5}, {0, 1, 2}}},
+		{5, [][]uint8{{0, 3}, {1, 4}, {2, 5}}},
+		{6, [][]uint8{{3, 0}, {4, 1}, {5, 2}}},
+		{7, [][]uint8{{5, 2}, {4, 1}, {3, 0}}},
+		{8, [][]uint8{{2, 5}, {1, 4}, {0, 3}}},
+		{9, [][]uint8{{0, 1, 2}, {3, 4, 5}}},
+	}
+
+	for _, tt := range tests {
+		img := Orient(src, tt.orientation)
+		b := img.Bounds()
+		got := make([][]uint8, b.Dy())
+		for y := range got {
+			for x := 0; x < b.Dx(); x++ {
+				r, _, _, _ := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+				got[y] = append(got[y], uint8(r>>8))
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Orient(%d) = %v, want %v", tt.orientation, got, tt.want)
+		}
+	}
+}
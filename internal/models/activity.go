@@ -0,0 +1,66 @@
+package models
+
+import "time"
+
+// CCTVActivity is the latest result of motion detection on a camera's
+// snapshots. Score, the share of the frame that changed (0-100), is nil
+// until two frames have been compared.
+type CCTVActivity struct {
+	Score        *float64   `json:"score"`
+	Motion       bool       `json:"motion"`
+	MeasuredAt   *time.Time `json:"measuredAt"`
+	LastMotionAt *time.Time `json:"lastMotionAt"`
+}
+
+type ActivitySample struct {
+	Score      float64   `json:"score"`
+	Motion     bool      `json:"motion"`
+	MeasuredAt time.Time `json:"measuredAt"`
+}
+
+// MotionEvent is a run of consecutive snapshots with motion. EndedAt is
+// nil while it lasts.
+type MotionEvent struct {
+	ID        int64      `json:"id"`
+	CCTVID    int        `json:"cctvId"`
+	StartedAt time.Time  `json:"startedAt"`
+	EndedAt   *time.Time `json:"endedAt"`
+	PeakScore float64    `json:"peakScore"`
+}
+
+type CCTVActivityReport struct {
+	CCTVID       int              `json:"cctvId"`
+	Current      CCTVActivity     `json:"current"`
+	Samples      []ActivitySample `json:"samples"`
+	MotionEvents []MotionEvent    `json:"motionEvents"`
+}
+
+// CCTVMotionChange is published when motion starts (cctv.motion_started)
+// or stops (cctv.motion_ended) on a camera.
+type CCTVMotionChange struct {
+	CCTVID        int        `json:"cctvId"`
+	Name          string     `json:"name"`
+	LocationID    int        `json:"locationId"`
+	MotionEventID int64      `json:"motionEventId"`
+	Score         float64    `json:"score"`
+	PeakScore     float64    `json:"peakScore"`
+	StartedAt     time.Time  `json:"startedAt"`
+	EndedAt       *time.Time `json:"endedAt"`
+}
+
+// MotionZone is a part of the frame left out of motion detection, in
+// fractions of the frame's width and height.
+type MotionZone struct {
+	X      float64 `json:"x" validate:"min=0,max=1"`
+	Y      float64 `json:"y" validate:"min=0,max=1"`
+	Width  float64 `json:"width" validate:"gt=0,max=1"`
+	Height float64 `json:"height" validate:"gt=0,max=1"`
+}
+
+type MotionMask struct {
+	IgnoreZones []MotionZone `json:"ignoreZones"`
+}
+
+type SetMotionMaskRequest struct {
+	IgnoreZones []MotionZone `json:"ignoreZones" validate:"max=32,dive"`
+}
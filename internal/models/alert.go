@@ -0,0 +1,97 @@
+package models
+
+import "time"
+
+type AlertRule struct {
+	ID                int       `json:"id"`
+	Name              string    `json:"name"`
+	Scope             string    `json:"scope"`
+	CCTVID            *int      `json:"cctvId"`
+	LocationID        *int      `json:"locationId"`
+	OfflineMinutes    *int      `json:"offlineMinutes"`
+	FlapChanges       *int      `json:"flapChanges"`
+	FlapWindowMinutes *int      `json:"flapWindowMinutes"`
+	NotifyEmails      []string  `json:"notifyEmails"`
+	WebhookURL        *string   `json:"webhookUrl"`
+	HasWebhookSecret  bool      `json:"hasWebhookSecret"`
+	NotifyRecovery    bool      `json:"notifyRecovery"`
+	QuietHoursStart   *string   `json:"quietHoursStart"`
+	QuietHoursEnd     *string   `json:"quietHoursEnd"`
+	IsActive          bool      `json:"isActive"`
+	CreatedAt         time.Time `json:"createdAt"`
+	UpdatedAt         time.Time `json:"updatedAt"`
+}
+
+// AlertRuleRequest is used to create a rule and, with PUT, to replace one.
+// At least one trigger is required: offline longer than OfflineMinutes, or
+// FlapChanges status changes within FlapWindowMinutes.
+type AlertRuleRequest struct {
+	Name              string   `json:"name" validate:"required,max=255"`
+	Scope             string   `json:"scope" validate:"required,oneof=all location cctv"`
+	CCTVID            *int     `json:"cctvId" validate:"required_if=Scope cctv,excluded_unless=Scope cctv"`
+	LocationID        *int     `json:"locationId" validate:"required_if=Scope location,excluded_unless=Scope location"`
+	OfflineMinutes    *int     `json:"offlineMinutes" validate:"required_without=FlapChanges,omitempty,min=1"`
+	FlapChanges       *int     `json:"flapChanges" validate:"required_with=FlapWindowMinutes,omitempty,min=2"`
+	FlapWindowMinutes *int     `json:"flapWindowMinutes" validate:"required_with=FlapChanges,omitempty,min=1"`
+	NotifyEmails      []string `json:"notifyEmails" validate:"dive,email"`
+	WebhookURL        *string  `json:"webhookUrl" validate:"omitempty,url,startswith=http"`
+	WebhookSecret     *string  `json:"webhookSecret"`
+	NotifyRecovery    *bool    `json:"notifyRecovery"`
+	QuietHoursStart   *string  `json:"quietHoursStart" validate:"required_with=QuietHoursEnd,omitempty,datetime=15:04"`
+	QuietHoursEnd     *string  `json:"quietHoursEnd" validate:"required_with=QuietHoursStart,omitempty,datetime=15:04"`
+	IsActive          *bool    `json:"isActive"`
+}
+
+type MaintenanceWindow struct {
+	ID         int       `json:"id"`
+	CCTVID     *int      `json:"cctvId"`
+	LocationID *int      `json:"locationId"`
+	StartsAt   time.Time `json:"startsAt"`
+	EndsAt     time.Time `json:"endsAt"`
+	Reason     *string   `json:"reason"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+type CreateMaintenanceWindowRequest struct {
+	CCTVID     *int      `json:"cctvId" validate:"excluded_with=LocationID"`
+	LocationID *int      `json:"locationId"`
+	StartsAt   time.Time `json:"startsAt" validate:"required"`
+	EndsAt     time.Time `json:"endsAt" validate:"required,gtfield=StartsAt"`
+	Reason     *string   `json:"reason"`
+}
+
+// AlertEvent is the payload of alert.* events and of alert rule webhooks.
+type AlertEvent struct {
+	Event           string     `json:"event"`
+	IncidentID      int64      `json:"incidentId"`
+	Kind            string     `json:"kind"`
+	RuleID          int        `json:"ruleId"`
+	RuleName        string     `json:"ruleName"`
+	CCTVID          int        `json:"cctvId"`
+	CCTVName        string     `json:"cctvName"`
+	LocationID      int        `json:"locationId"`
+	LocationName    string     `json:"locationName"`
+	Status          string     `json:"status"`
+	Detail          string     `json:"detail,omitempty"`
+	Suppressed      bool       `json:"suppressed,omitempty"`
+	OpenedAt        time.Time  `json:"openedAt"`
+	ResolvedAt      *time.Time `json:"resolvedAt,omitempty"`
+	DurationSeconds int64      `json:"durationSeconds"`
+	AcknowledgedBy  *int       `json:"acknowledgedBy,omitempty"`
+}
+
+type AlertIncident struct {
+	ID                 int64      `json:"id"`
+	RuleID             int        `json:"ruleId"`
+	RuleName           string     `json:"ruleName"`
+	CCTVID             int        `json:"cctvId"`
+	CCTVName           string     `json:"cctvName"`
+	Kind               string     `json:"kind"`
+	OpenedAt           time.Time  `json:"openedAt"`
+	ResolvedAt         *time.Time `json:"resolvedAt"`
+	Suppressed         bool       `json:"suppressed"`
+	NotifiedAt         *time.Time `json:"notifiedAt"`
+	RecoveryNotifiedAt *time.Time `json:"recoveryNotifiedAt"`
+	AcknowledgedAt     *time.Time `json:"acknowledgedAt"`
+	AcknowledgedBy     *int       `json:"acknowledgedBy"`
+}
@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// Strategies for picking a user's cameras when they have not chosen any
+const (
+	AllotmentStrategyRandom  = "random"
+	AllotmentStrategyPopular = "popular"
+	AllotmentStrategyNearest = "nearest"
+)
+
+type AllotmentSettings struct {
+	Strategy       string `json:"strategy" validate:"required,oneof=random popular nearest"`
+	SwapsPerPeriod int    `json:"swapsPerPeriod" validate:"min=0"`
+	SwapPeriodDays int    `json:"swapPeriodDays" validate:"required,min=1"`
+}
+
+type AllotmentStatus struct {
+	CCTVIDs        []int      `json:"cctvIds"`
+	Quota          int        `json:"quota"`
+	RemainingSlots int        `json:"remainingSlots"`
+	Chosen         bool       `json:"chosen"`
+	SwapsPerPeriod int        `json:"swapsPerPeriod"`
+	SwapsUsed      int        `json:"swapsUsed"`
+	SwapsRemaining int        `json:"swapsRemaining"`
+	PeriodResetsAt *time.Time `json:"periodResetsAt"`
+}
+
+type SetAllotmentRequest struct {
+	CCTVIDs []int `json:"cctvIds" validate:"required,unique"`
+}
+
+type SwapCCTVRequest struct {
+	RemoveID int `json:"removeId" validate:"required"`
+	AddID    int `json:"addId" validate:"required"`
+}
+
+type SetHomeLocationRequest struct {
+	LocationID *int `json:"locationId"`
+}
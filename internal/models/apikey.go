@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+type APIKey struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	// Only returned when the key is created
+	Key string `json:"key,omitempty"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name          string `json:"name" validate:"required,max=100"`
+	ExpiresInDays *int   `json:"expiresInDays" validate:"omitempty,min=1,max=3650"`
+}
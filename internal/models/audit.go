@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+type AuditLog struct {
+	ID        int64                  `json:"id"`
+	ActorID   *int                   `json:"actorId"`
+	UserID    *int                   `json:"userId"`
+	Action    string                 `json:"action"`
+	IPAddress *string                `json:"ipAddress"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+	CreatedAt time.Time              `json:"createdAt"`
+}
@@ -2,16 +2,84 @@ package models
 
 import "time"
 
+// Stream source types
+const (
+	SourceHLS      = "hls"
+	SourceRTSP     = "rtsp"
+	SourceMJPEG    = "mjpeg"
+	SourceSnapshot = "snapshot"
+	SourceEmbed    = "embed"
+)
+
+// SourceTypes lists every source type.
+var SourceTypes = []string{SourceHLS, SourceRTSP, SourceMJPEG, SourceSnapshot, SourceEmbed}
+
+// CCTV is a camera. Only operators see SourceURL, the origin stream, and
+// MediaPath, its path name on the media server; everyone else plays from
+// PlaybackURL, a signed URL that expires at PlaybackExpiresAt.
 type CCTV struct {
 	ID           int       `json:"id"`
 	LocationID   int       `json:"-"`
 	Location     *Location `json:"location,omitempty"`
 	Name         string    `json:"name"`
 	ThumbnailURL *string   `json:"thumbnailUrl"`
-	SourceURL    string    `json:"sourceUrl"`
-	IsActive     bool      `json:"isActive"`
-	CreatedAt    time.Time `json:"createdAt"`
-	UpdatedAt    time.Time `json:"updatedAt"`
+	SourceURL    string    `json:"sourceUrl,omitempty"`
+	SourceType   string    `json:"sourceType"`
+	// RTSP only; nil lets the media server choose
+	RTSPTransport *string `json:"rtspTransport,omitempty"`
+	// Snapshot only: how often clients should reload the image
+	SnapshotRefreshSeconds *int `json:"snapshotRefreshSeconds,omitempty"`
+	// Streams the camera offers besides its source, and which one
+	// PlaybackURL plays
+	Streams           []CCTVStream `json:"streams,omitempty"`
+	Quality           string       `json:"quality,omitempty"`
+	PlaybackURL       string       `json:"playbackUrl,omitempty"`
+	PlaybackExpiresAt *time.Time   `json:"playbackExpiresAt,omitempty"`
+	MediaPath         *string      `json:"mediaPath,omitempty"`
+	IsActive          bool         `json:"isActive"`
+	Health            StreamHealth `json:"health"`
+	Activity          CCTVActivity `json:"activity"`
+	CreatedAt         time.Time    `json:"createdAt"`
+	UpdatedAt         time.Time    `json:"updatedAt"`
+}
+
+// StreamHealth is the latest result of the stream health monitor.
+// Status is "unknown" until the camera has been probed.
+type StreamHealth struct {
+	Status    string     `json:"status"`
+	LatencyMs *int       `json:"latencyMs"`
+	Detail    *string    `json:"detail"`
+	CheckedAt *time.Time `json:"checkedAt"`
+	ChangedAt *time.Time `json:"changedAt"`
+}
+
+type StatusHistoryEntry struct {
+	ID        int64     `json:"id"`
+	CCTVID    int       `json:"cctvId"`
+	Status    string    `json:"status"`
+	LatencyMs *int      `json:"latencyMs"`
+	Detail    *string   `json:"detail"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// CCTVEvent is the payload of cctv.created, cctv.updated, cctv.deleted and
+// cctv.thumbnail_updated events.
+type CCTVEvent struct {
+	CCTV          *CCTV    `json:"cctv"`
+	ChangedFields []string `json:"changedFields,omitempty"`
+}
+
+// CCTVStatusChange is published when the health monitor sees a camera's
+// status change. PreviousStatus is "unknown" for a first check.
+type CCTVStatusChange struct {
+	CCTVID         int       `json:"cctvId"`
+	Name           string    `json:"name"`
+	LocationID     int       `json:"locationId"`
+	PreviousStatus string    `json:"previousStatus"`
+	Status         string    `json:"status"`
+	LatencyMs      *int      `json:"latencyMs"`
+	Detail         *string   `json:"detail"`
+	ChangedAt      time.Time `json:"changedAt"`
 }
 
 type CreateCCTVRequest struct {
@@ -19,6 +87,11 @@ type CreateCCTVRequest struct {
 	Name         string  `json:"name" validate:"required"`
 	ThumbnailURL *string `json:"thumbnailUrl"`
 	SourceURL    string  `json:"sourceUrl" validate:"required,url"`
+	// Guessed from the URL when empty: rtsp for rtsp:// URLs, otherwise hls
+	SourceType             *string `json:"sourceType" validate:"omitempty,oneof=hls rtsp mjpeg snapshot embed"`
+	RTSPTransport          *string `json:"rtspTransport" validate:"omitempty,oneof=tcp udp multicast"`
+	SnapshotRefreshSeconds *int    `json:"snapshotRefreshSeconds" validate:"omitempty,min=1,max=3600"`
+	MediaPath              *string `json:"mediaPath" validate:"omitempty,max=255"`
 }
 
 type UpdateCCTVRequest struct {
@@ -27,4 +100,9 @@ type UpdateCCTVRequest struct {
 	ThumbnailURL *string `json:"thumbnailUrl"`
 	SourceURL    *string `json:"sourceUrl" validate:"omitempty,url"`
 	IsActive     *bool   `json:"isActive"`
+	MediaPath    *string `json:"mediaPath" validate:"omitempty,max=255"`
+	SourceType   *string `json:"sourceType" validate:"omitempty,oneof=hls rtsp mjpeg snapshot embed"`
+	// An empty transport lets the media server choose
+	RTSPTransport          *string `json:"rtspTransport" validate:"omitempty,oneof='' tcp udp multicast"`
+	SnapshotRefreshSeconds *int    `json:"snapshotRefreshSeconds" validate:"omitempty,min=1,max=3600"`
 }
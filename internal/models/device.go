@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+type UserDevice struct {
+	ID         int       `json:"id"`
+	UserID     int       `json:"userId"`
+	DeviceID   string    `json:"deviceId"`
+	DeviceName *string   `json:"deviceName"`
+	Platform   *string   `json:"platform"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+}
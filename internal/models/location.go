@@ -5,6 +5,13 @@ import "time"
 type Location struct {
 	ID        int       `json:"id"`
 	Name      string    `json:"name"`
+	Latitude  *float64  `json:"latitude,omitempty"`
+	Longitude *float64  `json:"longitude,omitempty"`
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
 }
+
+// LocationEvent is the payload of location.* events.
+type LocationEvent struct {
+	Location Location `json:"location"`
+}
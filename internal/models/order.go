@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+type Order struct {
+	ID             int        `json:"id"`
+	Reference      string     `json:"reference"`
+	UserID         int        `json:"userId"`
+	PlanID         int        `json:"planId"`
+	PlanName       string     `json:"planName"`
+	Amount         int64      `json:"amount"`
+	Currency       string     `json:"currency"`
+	Status         string     `json:"status"`
+	Provider       string     `json:"provider"`
+	CheckoutURL    *string    `json:"checkoutUrl"`
+	SubscriptionID *int       `json:"subscriptionId"`
+	PaidAt         *time.Time `json:"paidAt"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	UpdatedAt      time.Time  `json:"updatedAt"`
+}
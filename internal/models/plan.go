@@ -0,0 +1,72 @@
+package models
+
+import "time"
+
+type Plan struct {
+	ID                 int       `json:"id"`
+	Name               string    `json:"name"`
+	CameraQuota        *int      `json:"cameraQuota"`        // nil means unlimited
+	DeviceLimit        int       `json:"deviceLimit"`        // devices the account may be bound to
+	ConcurrentSessions int       `json:"concurrentSessions"` // devices signed in at once
+	CanExport          bool      `json:"canExport"`
+	MaxStreamQuality   string    `json:"maxStreamQuality"` // main, sub or snapshot
+	Price              int64     `json:"price"`
+	Currency           string    `json:"currency"`
+	DurationDays       *int      `json:"durationDays"` // nil means no expiry
+	IsDefault          bool      `json:"isDefault"`
+	IsActive           bool      `json:"isActive"`
+	CreatedAt          time.Time `json:"createdAt"`
+	UpdatedAt          time.Time `json:"updatedAt"`
+}
+
+// HasCameraQuota reports whether the plan only grants a fixed allotment of cameras.
+func (p *Plan) HasCameraQuota() bool {
+	return p.CameraQuota != nil
+}
+
+type Subscription struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"userId"`
+	PlanID    int        `json:"planId"`
+	Plan      *Plan      `json:"plan,omitempty"`
+	Status    string     `json:"status"`
+	Source    string     `json:"source"`
+	StartsAt  time.Time  `json:"startsAt"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// UserUpgradedEvent is the payload of user.upgraded events.
+type UserUpgradedEvent struct {
+	UserID       int           `json:"userId"`
+	Subscription *Subscription `json:"subscription"`
+}
+
+type CreatePlanRequest struct {
+	Name               string  `json:"name" validate:"required,max=50"`
+	CameraQuota        *int    `json:"cameraQuota" validate:"omitempty,min=1"`
+	DeviceLimit        int     `json:"deviceLimit" validate:"required,min=1"`
+	ConcurrentSessions *int    `json:"concurrentSessions" validate:"omitempty,min=1"`
+	CanExport          bool    `json:"canExport"`
+	MaxStreamQuality   *string `json:"maxStreamQuality" validate:"omitempty,oneof=main sub snapshot"`
+	Price              int64   `json:"price" validate:"min=0"`
+	Currency           *string `json:"currency" validate:"omitempty,len=3"`
+	DurationDays       *int    `json:"durationDays" validate:"omitempty,min=1"`
+}
+
+type UpdatePlanRequest struct {
+	CameraQuota        *int    `json:"cameraQuota" validate:"omitempty,min=1"`
+	UnlimitedCameras   *bool   `json:"unlimitedCameras"`
+	DeviceLimit        *int    `json:"deviceLimit" validate:"omitempty,min=1"`
+	ConcurrentSessions *int    `json:"concurrentSessions" validate:"omitempty,min=1"`
+	CanExport          *bool   `json:"canExport"`
+	MaxStreamQuality   *string `json:"maxStreamQuality" validate:"omitempty,oneof=main sub snapshot"`
+	Price              *int64  `json:"price" validate:"omitempty,min=0"`
+	DurationDays       *int    `json:"durationDays" validate:"omitempty,min=1"`
+	IsActive           *bool   `json:"isActive"`
+}
+
+type GrantSubscriptionRequest struct {
+	PlanID       int  `json:"planId" validate:"required"`
+	DurationDays *int `json:"durationDays" validate:"omitempty,min=1"`
+}
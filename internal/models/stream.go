@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// Stream roles, from the best quality to the lightest
+const (
+	StreamMain     = "main"
+	StreamSub      = "sub"
+	StreamSnapshot = "snapshot"
+)
+
+// CCTVStream is one of a camera's streams. Main and sub streams are of the
+// camera's source type; snapshot streams are still images. URL is only
+// shown to operators.
+type CCTVStream struct {
+	ID          int       `json:"id"`
+	CCTVID      int       `json:"cctvId"`
+	Role        string    `json:"role"`
+	URL         string    `json:"url,omitempty"`
+	Codec       *string   `json:"codec"`
+	Width       *int      `json:"width"`
+	Height      *int      `json:"height"`
+	BitrateKbps *int      `json:"bitrateKbps"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+type CreateCCTVStreamRequest struct {
+	Role        string  `json:"role" validate:"required,oneof=main sub snapshot"`
+	URL         string  `json:"url" validate:"required,url"`
+	Codec       *string `json:"codec" validate:"omitempty,max=20"`
+	Width       *int    `json:"width" validate:"required_with=Height,omitempty,min=1"`
+	Height      *int    `json:"height" validate:"required_with=Width,omitempty,min=1"`
+	BitrateKbps *int    `json:"bitrateKbps" validate:"omitempty,min=1"`
+}
+
+type UpdateCCTVStreamRequest struct {
+	URL         *string `json:"url" validate:"omitempty,url"`
+	Codec       *string `json:"codec" validate:"omitempty,max=20"`
+	Width       *int    `json:"width" validate:"omitempty,min=1"`
+	Height      *int    `json:"height" validate:"omitempty,min=1"`
+	BitrateKbps *int    `json:"bitrateKbps" validate:"omitempty,min=1"`
+}
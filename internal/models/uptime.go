@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// UptimeStats summarises availability over a period. Degraded time counts as
+// up; an outage is a run of offline checks. Times when the monitor was not
+// checking are left out of ObservedSeconds.
+type UptimeStats struct {
+	ObservedSeconds      int64    `json:"observedSeconds"`
+	UpSeconds            int64    `json:"upSeconds"`
+	DegradedSeconds      int64    `json:"degradedSeconds"`
+	DownSeconds          int64    `json:"downSeconds"`
+	UptimePercent        *float64 `json:"uptimePercent"`
+	OutageCount          int      `json:"outageCount"`
+	OngoingOutages       int      `json:"ongoingOutages"`
+	MTTRSeconds          *float64 `json:"mttrSeconds"`
+	LongestOutageSeconds int64    `json:"longestOutageSeconds"`
+	MeetsSLA             *bool    `json:"meetsSla"`
+}
+
+type UptimeGroup struct {
+	Scope string `json:"scope"`
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	UptimeStats
+}
+
+type UptimeReport struct {
+	Scope            string        `json:"scope"`
+	ID               *int          `json:"id,omitempty"`
+	Name             string        `json:"name"`
+	From             time.Time     `json:"from"`
+	To               time.Time     `json:"to"`
+	SLATargetPercent float64       `json:"slaTargetPercent"`
+	Summary          UptimeStats   `json:"summary"`
+	Breakdown        []UptimeGroup `json:"breakdown,omitempty"`
+}
@@ -13,7 +13,6 @@ type User struct {
 	Role             string     `json:"role"`
 	AccountStatus    string     `json:"accountStatus"`
 	LastLogin        *time.Time `json:"-"`
-	SessionToken     *string    `json:"-"`
 	DeviceID         *string    `json:"-"`
 	ResetRequested   bool       `json:"-"`
 	ResetToken       *string    `json:"-"`
@@ -23,13 +22,14 @@ type User struct {
 }
 
 type UserResponse struct {
-	ID            int     `json:"id"`
-	Username      string  `json:"username"`
-	Email         string  `json:"email"`
-	Name          string  `json:"name"`
-	PhotoURL      *string `json:"photoUrl"`
-	Role          string  `json:"role"`
-	AccountStatus string  `json:"accountStatus"`
+	ID                    int        `json:"id"`
+	Username              string     `json:"username"`
+	Email                 string     `json:"email"`
+	Name                  string     `json:"name"`
+	PhotoURL              *string    `json:"photoUrl"`
+	Role                  string     `json:"role"`
+	AccountStatus         string     `json:"accountStatus"`
+	SubscriptionExpiresAt *time.Time `json:"subscriptionExpiresAt,omitempty"`
 }
 
 type ResetRequest struct {
@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+type Voucher struct {
+	ID             int        `json:"id"`
+	Code           string     `json:"code"`
+	Description    *string    `json:"description"`
+	PlanID         int        `json:"planId"`
+	PlanName       string     `json:"planName"`
+	DurationDays   int        `json:"durationDays"`
+	MaxRedemptions *int       `json:"maxRedemptions"`
+	PerUserLimit   int        `json:"perUserLimit"`
+	Redemptions    int        `json:"redemptions"`
+	ValidFrom      *time.Time `json:"validFrom"`
+	ValidUntil     *time.Time `json:"validUntil"`
+	IsActive       bool       `json:"isActive"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	UpdatedAt      time.Time  `json:"updatedAt"`
+}
+
+type VoucherRedemption struct {
+	ID             int       `json:"id"`
+	VoucherID      int       `json:"voucherId"`
+	UserID         int       `json:"userId"`
+	Username       string    `json:"username"`
+	SubscriptionID *int      `json:"subscriptionId"`
+	RedeemedAt     time.Time `json:"redeemedAt"`
+}
+
+type CreateVoucherRequest struct {
+	Code           string     `json:"code" validate:"omitempty,alphanum,max=50"`
+	Description    *string    `json:"description"`
+	PlanID         int        `json:"planId" validate:"required"`
+	DurationDays   int        `json:"durationDays" validate:"required,min=1"`
+	MaxRedemptions *int       `json:"maxRedemptions" validate:"omitempty,min=1"`
+	PerUserLimit   *int       `json:"perUserLimit" validate:"omitempty,min=1"`
+	ValidFrom      *time.Time `json:"validFrom"`
+	ValidUntil     *time.Time `json:"validUntil"`
+}
+
+type UpdateVoucherRequest struct {
+	Description    *string    `json:"description"`
+	MaxRedemptions *int       `json:"maxRedemptions" validate:"omitempty,min=1"`
+	PerUserLimit   *int       `json:"perUserLimit" validate:"omitempty,min=1"`
+	ValidFrom      *time.Time `json:"validFrom"`
+	ValidUntil     *time.Time `json:"validUntil"`
+	IsActive       *bool      `json:"isActive"`
+}
+
+type RedeemVoucherRequest struct {
+	Code string `json:"code" validate:"required"`
+}
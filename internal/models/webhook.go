@@ -0,0 +1,52 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type WebhookSubscription struct {
+	ID          int       `json:"id"`
+	URL         string    `json:"url"`
+	EventTypes  []string  `json:"eventTypes"`
+	Description *string   `json:"description"`
+	IsActive    bool      `json:"isActive"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+	// Only returned when the subscription is created or the secret rotated
+	Secret string `json:"secret,omitempty"`
+}
+
+type CreateWebhookSubscriptionRequest struct {
+	URL         string   `json:"url" validate:"required,url,startswith=http"`
+	EventTypes  []string `json:"eventTypes" validate:"required,min=1,dive,required"`
+	Description *string  `json:"description"`
+	// Generated when empty
+	Secret *string `json:"secret" validate:"omitempty,min=16"`
+}
+
+type UpdateWebhookSubscriptionRequest struct {
+	URL          *string  `json:"url" validate:"omitempty,url,startswith=http"`
+	EventTypes   []string `json:"eventTypes" validate:"omitempty,min=1,dive,required"`
+	Description  *string  `json:"description"`
+	IsActive     *bool    `json:"isActive"`
+	RotateSecret bool     `json:"rotateSecret"`
+}
+
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	SubscriptionID int             `json:"subscriptionId"`
+	EventID        string          `json:"eventId"`
+	EventType      string          `json:"eventType"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"nextAttemptAt"`
+	LastAttemptAt  *time.Time      `json:"lastAttemptAt"`
+	ResponseStatus *int            `json:"responseStatus"`
+	ResponseBody   *string         `json:"responseBody"`
+	Error          *string         `json:"error"`
+	RedeliveryOf   *int64          `json:"redeliveryOf"`
+	CreatedAt      time.Time       `json:"createdAt"`
+	DeliveredAt    *time.Time      `json:"deliveredAt"`
+}
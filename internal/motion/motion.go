@@ -0,0 +1,138 @@
+// Package motion detects activity by comparing consecutive still frames of
+// a camera: both are scaled down and turned to grayscale, split into
+// blocks, and the share of blocks whose brightness changed is the score.
+package motion
+
+import (
+	"image"
+
+	"cctv-api/internal/imaging"
+)
+
+// Zone is a part of the frame whose changes are ignored, such as a road
+// sign with a clock or trees in the wind. It is given in fractions of the
+// frame's width and height, so it holds whatever the camera's resolution.
+type Zone struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+func (z Zone) contains(x, y float64) bool {
+	return x >= z.X && x < z.X+z.Width && y >= z.Y && y < z.Y+z.Height
+}
+
+type Options struct {
+	// Frames are scaled down to fit Size x Size pixels before comparing
+	Size int
+	// Side of the square blocks compared, in scaled-down pixels
+	BlockSize int
+	// Mean brightness difference (0-255) over which a block has changed
+	Threshold float64
+}
+
+type Detector struct {
+	opts Options
+}
+
+func NewDetector(opts Options) *Detector {
+	if opts.Size <= 0 {
+		opts.Size = 160
+	}
+	if opts.BlockSize <= 0 {
+		opts.BlockSize = 8
+	}
+	if opts.Threshold <= 0 {
+		opts.Threshold = 20
+	}
+	return &Detector{opts: opts}
+}
+
+// Frame is a frame prepared for comparison.
+type Frame struct {
+	gray *image.Gray
+}
+
+// Frame scales img down and turns it to grayscale.
+func (d *Detector) Frame(img image.Image) *Frame {
+	return &Frame{gray: imaging.Grayscale(imaging.Fit(img, d.opts.Size, d.opts.Size))}
+}
+
+// Result is what changed between two frames.
+type Result struct {
+	// Share of the compared blocks that changed, 0-100
+	Score   float64
+	Changed int
+	Blocks  int
+}
+
+// Compare scores how much changed from prev to cur, leaving out blocks
+// whose centre lies in an ignored zone. It returns false when the frames
+// cannot be compared, e.g. because the camera's resolution changed.
+func (d *Detector) Compare(prev, cur *Frame, ignore []Zone) (Result, bool) {
+	a, b := prev.gray, cur.gray
+	if a.Rect != b.Rect || a.Rect.Empty() {
+		return Result{}, false
+	}
+	w, h := a.Rect.Dx(), a.Rect.Dy()
+	size := d.opts.BlockSize
+
+	// Blocks that take part; a partial block at the edge counts too
+	type block struct{ x0, y0, x1, y1 int }
+	var blocks []block
+	for y0 := 0; y0 < h; y0 += size {
+		for x0 := 0; x0 < w; x0 += size {
+			blk := block{x0, y0, min(x0+size, w), min(y0+size, h)}
+			cx := float64(blk.x0+blk.x1) / 2 / float64(w)
+			cy := float64(blk.y0+blk.y1) / 2 / float64(h)
+			ignored := false
+			for _, z := range ignore {
+				if z.contains(cx, cy) {
+					ignored = true
+					break
+				}
+			}
+			if !ignored {
+				blocks = append(blocks, blk)
+			}
+		}
+	}
+	if len(blocks) == 0 {
+		return Result{}, true
+	}
+
+	// Compare brightness relative to each frame's mean, so that the sun
+	// going behind a cloud or the camera adjusting its exposure does not
+	// light up every block
+	var sumA, sumB, n int64
+	for _, blk := range blocks {
+		for y := blk.y0; y < blk.y1; y++ {
+			for x := blk.x0; x < blk.x1; x++ {
+				sumA += int64(a.Pix[y*a.Stride+x])
+				sumB += int64(b.Pix[y*b.Stride+x])
+				n++
+			}
+		}
+	}
+	shift := float64(sumB-sumA) / float64(n)
+
+	result := Result{Blocks: len(blocks)}
+	for _, blk := range blocks {
+		var diff float64
+		for y := blk.y0; y < blk.y1; y++ {
+			for x := blk.x0; x < blk.x1; x++ {
+				delta := float64(b.Pix[y*b.Stride+x]) - float64(a.Pix[y*a.Stride+x]) - shift
+				if delta < 0 {
+					delta = -delta
+				}
+				diff += delta
+			}
+		}
+		if diff/float64((blk.x1-blk.x0)*(blk.y1-blk.y0)) > d.opts.Threshold {
+			result.Changed++
+		}
+	}
+	result.Score = 100 * float64(result.Changed) / float64(result.Blocks)
+	return result, true
+}
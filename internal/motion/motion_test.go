@@ -0,0 +1,101 @@
+package motion
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// frame returns a w x h image of the given brightness with a white square
+// of side n at (x, y).
+func frame(w, h int, background uint8, x, y, n int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for py := 0; py < h; py++ {
+		for px := 0; px < w; px++ {
+			v := background
+			if px >= x && px < x+n && py >= y && py < y+n {
+				v = 255
+			}
+			img.SetRGBA(px, py, color.RGBA{v, v, v, 255})
+		}
+	}
+	return img
+}
+
+func TestDetectorCompare(t *testing.T) {
+	d := NewDetector(Options{Size: 64, BlockSize: 8, Threshold: 20})
+	still := d.Frame(frame(64, 64, 0, 0, 0, 0))
+
+	tests := []struct {
+		name   string
+		prev   *Frame
+		cur    *Frame
+		ignore []Zone
+		want   Result
+	}{
+		{"identical frames", still, still, nil, Result{Score: 0, Changed: 0, Blocks: 64}},
+		{"object appears", still, d.Frame(frame(64, 64, 0, 0, 0, 16)), nil, Result{Score: 6.25, Changed: 4, Blocks: 64}},
+		{"object moves", d.Frame(frame(64, 64, 0, 0, 0, 16)), d.Frame(frame(64, 64, 0, 48, 48, 16)), nil, Result{Score: 12.5, Changed: 8, Blocks: 64}},
+		{
+			name:   "object in an ignored zone",
+			prev:   still,
+			cur:    d.Frame(frame(64, 64, 0, 0, 0, 16)),
+			ignore: []Zone{{X: 0, Y: 0, Width: 0.25, Height: 0.25}},
+			want:   Result{Score: 0, Changed: 0, Blocks: 60},
+		},
+		{
+			name:   "zone elsewhere",
+			prev:   still,
+			cur:    d.Frame(frame(64, 64, 0, 0, 0, 8)),
+			ignore: []Zone{{X: 0.5, Y: 0.5, Width: 0.5, Height: 0.5}},
+			want:   Result{Score: 100.0 / 48, Changed: 1, Blocks: 48},
+		},
+		{"exposure change", d.Frame(frame(64, 64, 100, 0, 0, 0)), d.Frame(frame(64, 64, 150, 0, 0, 0)), nil, Result{Score: 0, Changed: 0, Blocks: 64}},
+		{"everything ignored", still, d.Frame(frame(64, 64, 0, 0, 0, 16)), []Zone{{X: 0, Y: 0, Width: 1, Height: 1}}, Result{}},
+		{"scaled down first", d.Frame(frame(128, 128, 0, 0, 0, 0)), d.Frame(frame(128, 128, 0, 0, 0, 32)), nil, Result{Score: 6.25, Changed: 4, Blocks: 64}},
+	}
+
+	for _, tt := range tests {
+		got, ok := d.Compare(tt.prev, tt.cur, tt.ignore)
+		if !ok {
+			t.Errorf("%s: Compare() could not compare the frames", tt.name)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: Compare() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDetectorCompareResolutionChange(t *testing.T) {
+	d := NewDetector(Options{Size: 64})
+	if _, ok := d.Compare(d.Frame(frame(64, 64, 0, 0, 0, 0)), d.Frame(frame(64, 32, 0, 0, 0, 0)), nil); ok {
+		t.Error("Compare() compared frames of different sizes")
+	}
+	empty := d.Frame(image.NewRGBA(image.Rect(0, 0, 0, 0)))
+	if _, ok := d.Compare(empty, empty, nil); ok {
+		t.Error("Compare() compared empty frames")
+	}
+}
+
+func TestZoneContains(t *testing.T) {
+	z := Zone{X: 0.25, Y: 0.5, Width: 0.5, Height: 0.25}
+
+	tests := []struct {
+		x, y float64
+		want bool
+	}{
+		{0.25, 0.5, true},
+		{0.5, 0.6, true},
+		{0.75, 0.6, false}, // right edge is outside
+		{0.5, 0.75, false},
+		{0.2, 0.6, false},
+		{0.5, 0.4, false},
+	}
+
+	for _, tt := range tests {
+		if got := z.contains(tt.x, tt.y); got != tt.want {
+			t.Errorf("%+v.contains(%v, %v) = %v, want %v", z, tt.x, tt.y, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// Package netguard keeps server-side fetches of camera URLs away from the
+// server's own network. Loopback, link-local and private addresses are
+// refused when a connection is dialled, unless an allowlist covers them.
+package netguard
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var ErrBlocked = errors.New("destination address not allowed")
+
+// Guard decides which addresses outbound connections may reach. The zero
+// value, and a nil *Guard, refuse every internal address.
+type Guard struct {
+	allow []*net.IPNet
+}
+
+// Parse builds a Guard from a comma-separated list of CIDR ranges or single
+// addresses that may be reached even though they are internal, such as a
+// camera VLAN.
+func Parse(allowlist string) (*Guard, error) {
+	allow, err := ParseNetworks(allowlist)
+	if err != nil {
+		return nil, err
+	}
+	return &Guard{allow: allow}, nil
+}
+
+// ParseNetworks parses a comma-separated list of CIDR ranges or single
+// addresses. Blank entries are skipped.
+func ParseNetworks(list string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q", entry)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// Allowed reports whether connections to ip are permitted.
+func (g *Guard) Allowed(ip net.IP) bool {
+	if g != nil {
+		for _, network := range g.allow {
+			if network.Contains(ip) {
+				return true
+			}
+		}
+	}
+	return !isInternal(ip)
+}
+
+func isInternal(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil && ip4[0] == 0 {
+		return true // 0.0.0.0/8 reaches the local host on most systems
+	}
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast()
+}
+
+// Control is a net.Dialer hook. It runs on the resolved address just before
+// connecting, so a hostname that resolves to an internal address is caught
+// however many times its DNS answer changes.
+func (g *Guard) Control(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !g.Allowed(ip) {
+		return ErrBlocked
+	}
+	return nil
+}
+
+// Dialer returns a dialer that refuses addresses the guard does not allow.
+func (g *Guard) Dialer(timeout time.Duration) *net.Dialer {
+	return &net.Dialer{
+		Timeout:   timeout,
+		KeepAlive: 30 * time.Second,
+		Control:   g.Control,
+	}
+}
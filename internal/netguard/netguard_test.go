@@ -0,0 +1,91 @@
+package netguard
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestGuardAllowed(t *testing.T) {
+	cameras, err := Parse("10.20.0.0/16, 192.168.1.50, fd00::/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		guard *Guard
+		ip    string
+		want  bool
+	}{
+		{nil, "8.8.8.8", true},
+		{nil, "2001:4860:4860::8888", true},
+		{nil, "127.0.0.1", false},
+		{nil, "::1", false},
+		{nil, "10.1.2.3", false},
+		{nil, "172.16.0.1", false},
+		{nil, "192.168.1.50", false},
+		{nil, "169.254.169.254", false},
+		{nil, "0.0.0.0", false},
+		{nil, "0.1.2.3", false},
+		{nil, "::", false},
+		{nil, "fe80::1", false},
+		{nil, "::ffff:127.0.0.1", false},
+		{&Guard{}, "10.1.2.3", false},
+		{cameras, "10.20.5.6", true},
+		{cameras, "10.21.5.6", false},
+		{cameras, "192.168.1.50", true},
+		{cameras, "192.168.1.51", false},
+		{cameras, "fd12::1", true},
+		{cameras, "127.0.0.1", false},
+		{cameras, "8.8.8.8", true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.guard.Allowed(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("Allowed(%s) with %v = %v, want %v", tt.ip, tt.guard, got, tt.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		allowlist string
+		wantErr   bool
+	}{
+		{"", false},
+		{" , ", false},
+		{"10.0.0.0/8,::1", false},
+		{"camera.local", true},
+		{"10.0.0.0/33", true},
+		{"10.0.0.1,", false},
+	}
+
+	for _, tt := range tests {
+		if _, err := Parse(tt.allowlist); (err != nil) != tt.wantErr {
+			t.Errorf("Parse(%q) error = %v, want error %v", tt.allowlist, err, tt.wantErr)
+		}
+	}
+}
+
+func TestGuardControl(t *testing.T) {
+	var guard *Guard
+
+	tests := []struct {
+		address string
+		wantErr error
+	}{
+		{"93.184.216.34:443", nil},
+		{"127.0.0.1:8080", ErrBlocked},
+		{"[::1]:80", ErrBlocked},
+		{"localhost:80", ErrBlocked}, // only resolved addresses reach Control
+	}
+
+	for _, tt := range tests {
+		if err := guard.Control("tcp", tt.address, nil); !errors.Is(err, tt.wantErr) {
+			t.Errorf("Control(%s) = %v, want %v", tt.address, err, tt.wantErr)
+		}
+	}
+	if err := guard.Control("tcp", "no-port", nil); err == nil {
+		t.Error("Control accepted an address without a port")
+	}
+}
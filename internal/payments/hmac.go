@@ -0,0 +1,144 @@
+package payments
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// SignatureHeader carries the hex HMAC-SHA256 of the raw callback body.
+const SignatureHeader = "X-Callback-Signature"
+
+// HMACProvider handles gateways in the Midtrans/Xendit mould: the customer
+// pays on a hosted page and the gateway calls back with a JSON body signed
+// with a shared secret.
+type HMACProvider struct {
+	name        string
+	secret      []byte
+	checkoutURL string // "{reference}" is replaced with the order reference
+}
+
+func NewHMACProvider(name, secret, checkoutURL string) *HMACProvider {
+	return &HMACProvider{name: name, secret: []byte(secret), checkoutURL: checkoutURL}
+}
+
+func (p *HMACProvider) Name() string {
+	return p.name
+}
+
+func (p *HMACProvider) CreateCheckout(req CheckoutRequest) (*Checkout, error) {
+	return &Checkout{
+		ProviderRef: req.Reference,
+		URL:         strings.ReplaceAll(p.checkoutURL, "{reference}", req.Reference),
+	}, nil
+}
+
+// webhookPayload is the callback body, using Midtrans field names.
+type webhookPayload struct {
+	EventID           string      `json:"event_id"`
+	OrderID           string      `json:"order_id"`
+	TransactionID     string      `json:"transaction_id"`
+	TransactionStatus string      `json:"transaction_status"`
+	GrossAmount       json.Number `json:"gross_amount"`
+	Currency          string      `json:"currency,omitempty"`
+}
+
+func (p *HMACProvider) ParseWebhook(r *http.Request) (*Notification, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		return nil, ErrInvalidPayload
+	}
+
+	signature, err := hex.DecodeString(r.Header.Get(SignatureHeader))
+	if err != nil || !hmac.Equal(signature, p.sign(body)) {
+		return nil, ErrInvalidSignature
+	}
+
+	var payload webhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil || payload.OrderID == "" {
+		return nil, ErrInvalidPayload
+	}
+
+	amount, err := parseAmount(payload.GrossAmount)
+	if err != nil {
+		return nil, ErrInvalidPayload
+	}
+
+	status, ok := normalizeStatus(payload.TransactionStatus)
+	if !ok {
+		return nil, ErrInvalidPayload
+	}
+
+	eventID := payload.EventID
+	if eventID == "" {
+		eventID = payload.OrderID + ":" + payload.TransactionID + ":" + status
+	}
+
+	return &Notification{
+		EventID:     eventID,
+		Reference:   payload.OrderID,
+		Status:      status,
+		Amount:      amount,
+		Currency:    strings.ToUpper(payload.Currency),
+		ProviderRef: payload.TransactionID,
+		Payload:     body,
+	}, nil
+}
+
+func (p *HMACProvider) sign(body []byte) []byte {
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// parseAmount accepts whole amounts written as "50000" or "50000.00". Orders
+// are priced in whole units, so a non-zero fraction, a sign, an exponent or
+// anything that overflows int64 is rejected rather than rounded.
+func parseAmount(n json.Number) (int64, error) {
+	whole, fraction, _ := strings.Cut(n.String(), ".")
+	if !allDigits(whole) || strings.Trim(fraction, "0") != "" {
+		return 0, ErrInvalidPayload
+	}
+	amount, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidPayload
+	}
+	return amount, nil
+}
+
+func allDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func normalizeStatus(status string) (string, bool) {
+	switch strings.ToLower(status) {
+	case "settlement", "capture", "paid", "succeeded":
+		return StatusSettlement, true
+	case "pending":
+		return StatusPending, true
+	case "refund", "refunded":
+		return StatusRefund, true
+	case "partial_refund", "partially_refunded":
+		return StatusPartialRefund, true
+	case "cancel", "cancelled":
+		return StatusCancel, true
+	case "expire", "expired":
+		return StatusExpire, true
+	case "deny", "failure", "failed":
+		return StatusDeny, true
+	}
+	return "", false
+}
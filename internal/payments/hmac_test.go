@@ -0,0 +1,184 @@
+package payments
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{in: "50000", want: 50000},
+		{in: "50000.00", want: 50000},
+		{in: "50000.", want: 50000},
+		{in: "0", want: 0},
+		{in: "9223372036854775807", want: 9223372036854775807},
+		{in: "50000.50", wantErr: true},
+		{in: "50000.01", wantErr: true},
+		{in: "-1", wantErr: true},
+		{in: "+1", wantErr: true},
+		{in: "1e5", wantErr: true},
+		{in: "9223372036854775808", wantErr: true},
+		{in: ".5", wantErr: true},
+		{in: "", wantErr: true},
+		{in: "abc", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseAmount(json.Number(tt.in))
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseAmount(%q) = %d, want error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseAmount(%q) = %d, %v; want %d", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestNormalizeStatus(t *testing.T) {
+	tests := []struct {
+		in     string
+		want   string
+		wantOK bool
+	}{
+		{"settlement", StatusSettlement, true},
+		{"CAPTURE", StatusSettlement, true},
+		{"succeeded", StatusSettlement, true},
+		{"pending", StatusPending, true},
+		{"refunded", StatusRefund, true},
+		{"partial_refund", StatusPartialRefund, true},
+		{"partially_refunded", StatusPartialRefund, true},
+		{"cancelled", StatusCancel, true},
+		{"expire", StatusExpire, true},
+		{"failure", StatusDeny, true},
+		{"authorize", "", false},
+		{"", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := normalizeStatus(tt.in)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("normalizeStatus(%q) = %q, %v; want %q, %v", tt.in, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestHMACProviderParseWebhook(t *testing.T) {
+	provider := NewHMACProvider("midtrans", "secret", "https://pay.example.com/{reference}")
+
+	sign := func(secret, body string) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(body))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	const settled = `{"event_id":"evt-1","order_id":"ORD-1","transaction_id":"tx-9","transaction_status":"settlement","gross_amount":"150000.00","currency":"idr"}`
+	const noEventID = `{"order_id":"ORD-1","transaction_id":"tx-9","transaction_status":"partial_refund","gross_amount":50000}`
+
+	tests := []struct {
+		name      string
+		body      string
+		signature string
+		want      *Notification
+		wantErr   error
+	}{
+		{
+			name:      "valid",
+			body:      settled,
+			signature: sign("secret", settled),
+			want:      &Notification{EventID: "evt-1", Reference: "ORD-1", Status: StatusSettlement, Amount: 150000, Currency: "IDR", ProviderRef: "tx-9"},
+		},
+		{
+			name:      "event ID derived when absent",
+			body:      noEventID,
+			signature: sign("secret", noEventID),
+			want:      &Notification{EventID: "ORD-1:tx-9:partial_refund", Reference: "ORD-1", Status: StatusPartialRefund, Amount: 50000, ProviderRef: "tx-9"},
+		},
+		{name: "wrong secret", body: settled, signature: sign("other", settled), wantErr: ErrInvalidSignature},
+		{name: "missing signature", body: settled, signature: "", wantErr: ErrInvalidSignature},
+		{name: "signature not hex", body: settled, signature: "zz", wantErr: ErrInvalidSignature},
+		{name: "body changed after signing", body: strings.Replace(settled, "150000", "1", 1), signature: sign("secret", settled), wantErr: ErrInvalidSignature},
+		{
+			name:      "fractional amount",
+			body:      `{"order_id":"ORD-1","transaction_status":"settlement","gross_amount":"150000.50"}`,
+			signature: sign("secret", `{"order_id":"ORD-1","transaction_status":"settlement","gross_amount":"150000.50"}`),
+			wantErr:   ErrInvalidPayload,
+		},
+		{
+			name:      "unknown status",
+			body:      `{"order_id":"ORD-1","transaction_status":"authorize","gross_amount":"1"}`,
+			signature: sign("secret", `{"order_id":"ORD-1","transaction_status":"authorize","gross_amount":"1"}`),
+			wantErr:   ErrInvalidPayload,
+		},
+		{
+			name:      "missing order",
+			body:      `{"transaction_status":"settlement","gross_amount":"1"}`,
+			signature: sign("secret", `{"transaction_status":"settlement","gross_amount":"1"}`),
+			wantErr:   ErrInvalidPayload,
+		},
+		{name: "not JSON", body: "order=ORD-1", signature: sign("secret", "order=ORD-1"), wantErr: ErrInvalidPayload},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/api/payments/webhook", strings.NewReader(tt.body))
+		req.Header.Set(SignatureHeader, tt.signature)
+
+		got, err := provider.ParseWebhook(req)
+		if err != tt.wantErr {
+			t.Errorf("%s: ParseWebhook() error = %v, want %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if tt.want == nil {
+			continue
+		}
+		if string(got.Payload) != tt.body {
+			t.Errorf("%s: Payload = %q, want the raw body", tt.name, got.Payload)
+		}
+		got.Payload = nil
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: ParseWebhook() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFakeProviderSimulate(t *testing.T) {
+	fake := NewFakeProvider("secret", "http://localhost:8080")
+
+	checkout, err := fake.CreateCheckout(CheckoutRequest{Reference: "ORD-7"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "http://localhost:8080/api/admin/payments/fake/ORD-7"; checkout.URL != want {
+		t.Errorf("CreateCheckout() URL = %q, want %q", checkout.URL, want)
+	}
+
+	req, err := fake.Simulate("ORD-7", "settlement", 99000, "IDR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := fake.ParseWebhook(req)
+	if err != nil {
+		t.Fatalf("ParseWebhook(Simulate()) error: %v", err)
+	}
+	if n.Reference != "ORD-7" || n.Status != StatusSettlement || n.Amount != 99000 || n.Currency != "IDR" || n.ProviderRef != "fake-ORD-7" {
+		t.Errorf("ParseWebhook(Simulate()) = %+v", n)
+	}
+
+	// A callback signed by another deployment's fake gateway is refused
+	other, _ := NewFakeProvider("other", "").Simulate("ORD-7", "settlement", 99000, "IDR")
+	if _, err := fake.ParseWebhook(other); err != ErrInvalidSignature {
+		t.Errorf("ParseWebhook(foreign callback) error = %v, want ErrInvalidSignature", err)
+	}
+}
@@ -0,0 +1,57 @@
+package payments
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Notification statuses, normalised from the provider's own vocabulary.
+const (
+	StatusPending       = "pending"
+	StatusSettlement    = "settlement"
+	StatusRefund        = "refund"
+	StatusPartialRefund = "partial_refund"
+	StatusCancel        = "cancel"
+	StatusExpire        = "expire"
+	StatusDeny          = "deny"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrInvalidPayload   = errors.New("invalid webhook payload")
+)
+
+// CheckoutRequest is what a provider needs to start a payment.
+type CheckoutRequest struct {
+	Reference   string
+	Amount      int64
+	Currency    string
+	Description string
+	Email       string
+}
+
+type Checkout struct {
+	ProviderRef string
+	URL         string
+	ExpiresAt   *time.Time
+}
+
+// Notification is a verified payment status callback.
+type Notification struct {
+	EventID     string
+	Reference   string
+	Status      string
+	Amount      int64
+	Currency    string // empty when the provider does not say
+	ProviderRef string
+	Payload     []byte
+}
+
+// Provider is a payment gateway. ParseWebhook must reject callbacks whose
+// signature does not verify.
+type Provider interface {
+	Name() string
+	CreateCheckout(req CheckoutRequest) (*Checkout, error)
+	ParseWebhook(r *http.Request) (*Notification, error)
+}
@@ -0,0 +1,145 @@
+// Package playback issues signed, short-lived playback URLs so that clients
+// never see a camera's origin stream URL. A token binds a camera, a user and
+// an expiry time; media servers (or the stream proxy) verify it before
+// serving the stream.
+//
+// A playback URL only has to last until the player starts. Live players
+// then reload playlists and fetch segments for as long as they are watched,
+// so the stream proxy hands them session tokens, which are valid for the
+// longer session TTL, in every playlist it rewrites. The session TTL runs
+// from when the playback URL was issued and session tokens are never
+// renewed, so viewers who watch for longer than that fetch a new playback
+// URL.
+package playback
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid playback token")
+	ErrTokenExpired = errors.New("playback token expired")
+)
+
+// Grant is what a valid token allows: user UserID may play camera CCTVID
+// until ExpiresAt. Session is set for session tokens.
+type Grant struct {
+	CCTVID    int       `json:"cctvId"`
+	UserID    int       `json:"userId"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Session   bool      `json:"session"`
+}
+
+type Signer struct {
+	secret         []byte
+	ttl            time.Duration
+	sessionTTL     time.Duration
+	baseURL        string
+	mediaServerURL string
+}
+
+// NewSigner signs tokens with secret that are valid for ttl, and session
+// tokens that are valid for sessionTTL. Playback URLs point at baseURL, the
+// public address of the API or of a media server in front of it, or for
+// RTSP cameras at mediaServerURL, the media server that restreams them as
+// HLS (empty when there is none).
+func NewSigner(secret string, ttl, sessionTTL time.Duration, baseURL, mediaServerURL string) *Signer {
+	if sessionTTL < ttl {
+		sessionTTL = ttl
+	}
+	return &Signer{
+		secret:         []byte(secret),
+		ttl:            ttl,
+		sessionTTL:     sessionTTL,
+		baseURL:        strings.TrimSuffix(baseURL, "/"),
+		mediaServerURL: strings.TrimSuffix(mediaServerURL, "/"),
+	}
+}
+
+// Token returns a token of the form "<cctvId>.<userId>.<unix expiry>.<sig>".
+func (s *Signer) Token(cctvID, userID int, now time.Time) (string, time.Time) {
+	return s.token(cctvID, userID, now.Add(s.ttl), false)
+}
+
+// SessionToken returns a token for the URIs inside a playlist rewritten for
+// grant, which players keep using while they watch. A session token is
+// returned as is; one for a playback token lasts the session TTL from when
+// the playback URL was issued.
+func (s *Signer) SessionToken(grant *Grant) (string, time.Time) {
+	expiresAt := grant.ExpiresAt
+	if !grant.Session {
+		expiresAt = expiresAt.Add(s.sessionTTL - s.ttl)
+	}
+	return s.token(grant.CCTVID, grant.UserID, expiresAt, true)
+}
+
+func (s *Signer) token(cctvID, userID int, expiresAt time.Time, session bool) (string, time.Time) {
+	expiresAt = expiresAt.Truncate(time.Second)
+	payload := strconv.Itoa(cctvID) + "." + strconv.Itoa(userID) + "." + strconv.FormatInt(expiresAt.Unix(), 10)
+	return payload + "." + s.sign(payload, session), expiresAt
+}
+
+// URL returns a playback URL for file, e.g. "index.m3u8", below the
+// camera's /stream/{id}/ path and when it expires.
+func (s *Signer) URL(cctvID, userID int, file string, now time.Time) (string, time.Time) {
+	token, expiresAt := s.Token(cctvID, userID, now)
+	return s.baseURL + "/stream/" + strconv.Itoa(cctvID) + "/" + file + "?token=" + url.QueryEscape(token), expiresAt
+}
+
+// MediaServerURL returns a playback URL for the HLS muxer of the media
+// server path mediaPath. ok is false when no media server is configured.
+func (s *Signer) MediaServerURL(cctvID, userID int, mediaPath string, now time.Time) (string, time.Time, bool) {
+	if s.mediaServerURL == "" {
+		return "", time.Time{}, false
+	}
+	token, expiresAt := s.Token(cctvID, userID, now)
+	return s.mediaServerURL + "/" + strings.Trim(mediaPath, "/") + "/index.m3u8?token=" + url.QueryEscape(token), expiresAt, true
+}
+
+// Verify checks a token's signature and expiry.
+func (s *Signer) Verify(token string, now time.Time) (*Grant, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 4 {
+		return nil, ErrInvalidToken
+	}
+	payload := strings.Join(parts[:3], ".")
+	var session bool
+	switch {
+	case hmac.Equal([]byte(parts[3]), []byte(s.sign(payload, false))):
+	case hmac.Equal([]byte(parts[3]), []byte(s.sign(payload, true))):
+		session = true
+	default:
+		return nil, ErrInvalidToken
+	}
+
+	cctvID, err1 := strconv.Atoi(parts[0])
+	userID, err2 := strconv.Atoi(parts[1])
+	expiry, err3 := strconv.ParseInt(parts[2], 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return nil, ErrInvalidToken
+	}
+
+	grant := &Grant{CCTVID: cctvID, UserID: userID, ExpiresAt: time.Unix(expiry, 0).UTC(), Session: session}
+	if !now.Before(grant.ExpiresAt) {
+		return grant, ErrTokenExpired
+	}
+	return grant, nil
+}
+
+// sign MACs session tokens under their own label, so that a token says
+// which kind it is.
+func (s *Signer) sign(payload string, session bool) string {
+	h := hmac.New(sha256.New, s.secret)
+	if session {
+		h.Write([]byte("session:"))
+	}
+	h.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
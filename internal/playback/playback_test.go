@@ -0,0 +1,155 @@
+package playback
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignerVerify(t *testing.T) {
+	signer := NewSigner("secret", 10*time.Minute, 12*time.Hour, "https://api.example.com/", "")
+	now := time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)
+
+	token, expiresAt := signer.Token(7, 42, now)
+	if want := now.Add(10 * time.Minute); !expiresAt.Equal(want) {
+		t.Fatalf("Token() expires at %s, want %s", expiresAt, want)
+	}
+	// The player starts five minutes after the playback URL was issued
+	grant, err := signer.Verify(token, now.Add(5*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, sessionExpiresAt := signer.SessionToken(grant)
+	if want := now.Add(12 * time.Hour); !sessionExpiresAt.Equal(want) {
+		t.Fatalf("SessionToken() expires at %s, want %s", sessionExpiresAt, want)
+	}
+
+	parts := strings.Split(token, ".")
+	tampered := strings.Join([]string{"8", parts[1], parts[2], parts[3]}, ".")
+	extended := strings.Join([]string{parts[0], parts[1], "9999999999", parts[3]}, ".")
+	otherKey, _ := NewSigner("other", 10*time.Minute, 0, "", "").Token(7, 42, now)
+
+	tests := []struct {
+		name      string
+		token     string
+		at        time.Time
+		wantErr   error
+		wantGrant *Grant
+	}{
+		{"valid", token, now, nil, &Grant{CCTVID: 7, UserID: 42, ExpiresAt: now.Add(10 * time.Minute)}},
+		{"valid just before expiry", token, now.Add(10*time.Minute - time.Second), nil, &Grant{CCTVID: 7, UserID: 42, ExpiresAt: now.Add(10 * time.Minute)}},
+		{"expired at expiry", token, now.Add(10 * time.Minute), ErrTokenExpired, nil},
+		{"session outlives playback URL", session, now.Add(11 * time.Hour), nil, &Grant{CCTVID: 7, UserID: 42, ExpiresAt: now.Add(12 * time.Hour), Session: true}},
+		{"session expired", session, now.Add(12 * time.Hour), ErrTokenExpired, nil},
+		{"other camera", tampered, now, ErrInvalidToken, nil},
+		{"extended expiry", extended, now, ErrInvalidToken, nil},
+		{"other secret", otherKey, now, ErrInvalidToken, nil},
+		{"empty", "", now, ErrInvalidToken, nil},
+		{"too few parts", "7.42.1", now, ErrInvalidToken, nil},
+		{"non-numeric", "a.b.c." + parts[3], now, ErrInvalidToken, nil},
+	}
+
+	for _, tt := range tests {
+		grant, err := signer.Verify(tt.token, tt.at)
+		if err != tt.wantErr {
+			t.Errorf("%s: Verify() error = %v, want %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if tt.wantGrant != nil && (grant == nil || *grant != *tt.wantGrant) {
+			t.Errorf("%s: Verify() = %+v, want %+v", tt.name, grant, tt.wantGrant)
+		}
+	}
+}
+
+func TestSignerSessionTTLNeverShorter(t *testing.T) {
+	signer := NewSigner("secret", time.Hour, time.Minute, "", "")
+	now := time.Unix(1_700_000_000, 0)
+	token, _ := signer.Token(1, 1, now)
+	grant, _ := signer.Verify(token, now)
+	_, expiresAt := signer.SessionToken(grant)
+	if want := now.Add(time.Hour); !expiresAt.Equal(want) {
+		t.Errorf("SessionToken() expires at %s, want the playback TTL %s", expiresAt, want)
+	}
+}
+
+func TestSignerSessionTokenNotRenewed(t *testing.T) {
+	signer := NewSigner("secret", 10*time.Minute, 12*time.Hour, "", "")
+	now := time.Unix(1_700_000_000, 0)
+	token, _ := signer.Token(7, 42, now)
+
+	// A player reloading its playlist presents the session token again
+	for _, at := range []time.Duration{0, 5 * time.Minute, 6 * time.Hour, 11 * time.Hour} {
+		grant, err := signer.Verify(token, now.Add(at))
+		if err != nil {
+			t.Fatalf("Verify() after %s: %v", at, err)
+		}
+		var expiresAt time.Time
+		token, expiresAt = signer.SessionToken(grant)
+		if want := now.Add(12 * time.Hour); !expiresAt.Equal(want) {
+			t.Fatalf("SessionToken() after %s expires at %s, want %s", at, expiresAt, want)
+		}
+	}
+	if _, err := signer.Verify(token, now.Add(12*time.Hour)); err != ErrTokenExpired {
+		t.Errorf("Verify() at the end of the session = %v, want ErrTokenExpired", err)
+	}
+}
+
+func TestSignerURLs(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+
+	tests := []struct {
+		name           string
+		mediaServerURL string
+		mediaPath      string
+		wantURL        string
+		wantMedia      string
+		wantMediaOK    bool
+	}{
+		{
+			name:        "without media server",
+			wantURL:     "https://api.example.com/stream/3/index.m3u8",
+			wantMediaOK: false,
+		},
+		{
+			name:           "with media server",
+			mediaServerURL: "https://media.example.com/",
+			mediaPath:      "/cctv/3/",
+			wantURL:        "https://api.example.com/stream/3/index.m3u8",
+			wantMedia:      "https://media.example.com/cctv/3/index.m3u8",
+			wantMediaOK:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		signer := NewSigner("secret", time.Minute, time.Hour, "https://api.example.com/", tt.mediaServerURL)
+
+		raw, _ := signer.URL(3, 9, "index.m3u8", now)
+		checkTokenURL(t, tt.name, signer, raw, tt.wantURL, now)
+
+		media, _, ok := signer.MediaServerURL(3, 9, tt.mediaPath, now)
+		if ok != tt.wantMediaOK {
+			t.Errorf("%s: MediaServerURL() ok = %v, want %v", tt.name, ok, tt.wantMediaOK)
+			continue
+		}
+		if ok {
+			checkTokenURL(t, tt.name, signer, media, tt.wantMedia, now)
+		}
+	}
+}
+
+func checkTokenURL(t *testing.T, name string, signer *Signer, raw, want string, now time.Time) {
+	t.Helper()
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Errorf("%s: invalid URL %q: %v", name, raw, err)
+		return
+	}
+	if got := u.Scheme + "://" + u.Host + u.Path; got != want {
+		t.Errorf("%s: URL %q, want %q with a token", name, got, want)
+	}
+	grant, err := signer.Verify(u.Query().Get("token"), now)
+	if err != nil || grant.CCTVID != 3 || grant.UserID != 9 {
+		t.Errorf("%s: token in %q verifies as %+v, %v", name, raw, grant, err)
+	}
+}
@@ -0,0 +1,137 @@
+package ratelimit
+
+import (
+	"container/list"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Key sources a policy can be keyed by
+const (
+	KeyByIP     = "ip"
+	KeyByUser   = "user"
+	KeyByEmail  = "email"
+	KeyByAPIKey = "apikey"
+)
+
+// Policy allows Limit requests per Period for each key.
+type Policy struct {
+	Name   string
+	Limit  int
+	Period time.Duration
+	KeyBy  string
+}
+
+// ParsePolicy parses a spec of the form "<limit>/<period>:<key>", e.g.
+// "10/1m:ip" or "3/1h:email".
+func ParsePolicy(name, spec string) (Policy, error) {
+	policy := Policy{Name: name, KeyBy: KeyByIP}
+
+	rateSpec, keyBy, hasKey := strings.Cut(spec, ":")
+	if hasKey {
+		switch keyBy {
+		case KeyByIP, KeyByUser, KeyByEmail, KeyByAPIKey:
+			policy.KeyBy = keyBy
+		default:
+			return policy, fmt.Errorf("unknown rate limit key %q", keyBy)
+		}
+	}
+
+	limitStr, periodStr, ok := strings.Cut(rateSpec, "/")
+	if !ok {
+		return policy, fmt.Errorf("invalid rate limit %q: expected <limit>/<period>", rateSpec)
+	}
+
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil || limit <= 0 {
+		return policy, fmt.Errorf("invalid rate limit count %q", limitStr)
+	}
+	period, err := time.ParseDuration(periodStr)
+	if err != nil || period <= 0 {
+		return policy, fmt.Errorf("invalid rate limit period %q", periodStr)
+	}
+
+	policy.Limit = limit
+	policy.Period = period
+	return policy, nil
+}
+
+// Result describes the state of a key's bucket after a request.
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration // until the bucket is full again
+	RetryAfter time.Duration // until the next request is allowed
+}
+
+type entry struct {
+	key     string
+	limiter *rate.Limiter
+}
+
+// Store keeps one token bucket per key and evicts the least recently used
+// keys once maxKeys is reached, so memory stays bounded under key floods.
+type Store struct {
+	mu      sync.Mutex
+	maxKeys int
+	items   map[string]*list.Element
+	order   *list.List
+}
+
+func NewStore(maxKeys int) *Store {
+	return &Store{
+		maxKeys: maxKeys,
+		items:   make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+func (s *Store) limiter(key string, policy Policy) *rate.Limiter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, ok := s.items[key]; ok {
+		s.order.MoveToFront(elem)
+		return elem.Value.(*entry).limiter
+	}
+
+	interval := policy.Period / time.Duration(policy.Limit)
+	limiter := rate.NewLimiter(rate.Every(interval), policy.Limit)
+	s.items[key] = s.order.PushFront(&entry{key: key, limiter: limiter})
+
+	for s.maxKeys > 0 && s.order.Len() > s.maxKeys {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.items, oldest.Value.(*entry).key)
+	}
+
+	return limiter
+}
+
+// Allow consumes a token from the bucket for key under policy.
+func (s *Store) Allow(policy Policy, key string) Result {
+	limiter := s.limiter(policy.Name+":"+key, policy)
+	interval := policy.Period / time.Duration(policy.Limit)
+
+	now := time.Now()
+	allowed := limiter.AllowN(now, 1)
+	tokens := limiter.TokensAt(now)
+
+	result := Result{
+		Allowed:   allowed,
+		Limit:     policy.Limit,
+		Remaining: int(math.Max(0, math.Floor(tokens))),
+		Reset:     time.Duration((float64(policy.Limit) - tokens) * float64(interval)),
+	}
+	if !allowed {
+		result.RetryAfter = time.Duration((1 - tokens) * float64(interval))
+	}
+	return result
+}
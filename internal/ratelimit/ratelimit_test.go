@@ -0,0 +1,123 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    Policy
+		wantErr bool
+	}{
+		{spec: "10/1m:ip", want: Policy{Name: "p", Limit: 10, Period: time.Minute, KeyBy: KeyByIP}},
+		{spec: "3/1h:email", want: Policy{Name: "p", Limit: 3, Period: time.Hour, KeyBy: KeyByEmail}},
+		{spec: "100/1s:apikey", want: Policy{Name: "p", Limit: 100, Period: time.Second, KeyBy: KeyByAPIKey}},
+		{spec: "60/1m:user", want: Policy{Name: "p", Limit: 60, Period: time.Minute, KeyBy: KeyByUser}},
+		{spec: "5/30s", want: Policy{Name: "p", Limit: 5, Period: 30 * time.Second, KeyBy: KeyByIP}},
+		{spec: "10/1m:host", wantErr: true},
+		{spec: "10", wantErr: true},
+		{spec: "0/1m", wantErr: true},
+		{spec: "-1/1m", wantErr: true},
+		{spec: "x/1m", wantErr: true},
+		{spec: "10/0s", wantErr: true},
+		{spec: "10/soon", wantErr: true},
+		{spec: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParsePolicy("p", tt.spec)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParsePolicy(%q) = %+v, want error", tt.spec, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParsePolicy(%q) error: %v", tt.spec, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParsePolicy(%q) = %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestStoreAllow(t *testing.T) {
+	policy := Policy{Name: "login", Limit: 3, Period: time.Minute, KeyBy: KeyByIP}
+	store := NewStore(100)
+
+	tests := []struct {
+		key           string
+		wantAllowed   bool
+		wantRemaining int
+	}{
+		{"1.2.3.4", true, 2},
+		{"1.2.3.4", true, 1},
+		{"1.2.3.4", true, 0},
+		{"1.2.3.4", false, 0},
+		// Keys have their own buckets
+		{"5.6.7.8", true, 2},
+	}
+
+	for i, tt := range tests {
+		got := store.Allow(policy, tt.key)
+		if got.Allowed != tt.wantAllowed || got.Remaining != tt.wantRemaining || got.Limit != policy.Limit {
+			t.Errorf("request %d for %s: got allowed=%v remaining=%d limit=%d, want allowed=%v remaining=%d limit=%d",
+				i, tt.key, got.Allowed, got.Remaining, got.Limit, tt.wantAllowed, tt.wantRemaining, policy.Limit)
+		}
+		if got.Allowed && got.RetryAfter != 0 {
+			t.Errorf("request %d: allowed request has RetryAfter %s", i, got.RetryAfter)
+		}
+		// One token comes back every 20s
+		if !got.Allowed && (got.RetryAfter <= 0 || got.RetryAfter > 20*time.Second) {
+			t.Errorf("request %d: RetryAfter = %s, want within (0, 20s]", i, got.RetryAfter)
+		}
+		if got.Reset < 0 || got.Reset > time.Minute {
+			t.Errorf("request %d: Reset = %s, want within [0, 1m]", i, got.Reset)
+		}
+	}
+}
+
+func TestStorePoliciesDoNotShareBuckets(t *testing.T) {
+	store := NewStore(100)
+	strict := Policy{Name: "register", Limit: 1, Period: time.Hour}
+	loose := Policy{Name: "cctv-list", Limit: 1, Period: time.Hour}
+
+	if !store.Allow(strict, "ip").Allowed {
+		t.Fatal("first request under strict policy was denied")
+	}
+	if !store.Allow(loose, "ip").Allowed {
+		t.Error("same key under another policy was denied")
+	}
+	if store.Allow(strict, "ip").Allowed {
+		t.Error("second request under strict policy was allowed")
+	}
+}
+
+func TestStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	policy := Policy{Name: "p", Limit: 1, Period: time.Hour}
+	store := NewStore(2)
+
+	steps := []struct {
+		key         string
+		wantAllowed bool
+	}{
+		{"a", true},
+		{"b", true},
+		{"a", false}, // a is now the most recently used
+		{"c", true},  // evicts b
+		{"a", false},
+		{"b", true}, // b starts over with a full bucket
+	}
+
+	for i, step := range steps {
+		if got := store.Allow(policy, step.key).Allowed; got != step.wantAllowed {
+			t.Errorf("step %d (%s): allowed = %v, want %v", i, step.key, got, step.wantAllowed)
+		}
+	}
+	if n := store.order.Len(); n != 2 {
+		t.Errorf("store holds %d keys, want 2", n)
+	}
+}
@@ -0,0 +1,179 @@
+// Package realtime pushes published events to connected clients (SSE and
+// WebSocket). The broker numbers every event, keeps the most recent ones in
+// a ring buffer so that reconnecting clients can resume, and gives each
+// client a bounded queue: a client that falls behind is disconnected rather
+// than slowing everyone else down, and resumes from the buffer when it
+// reconnects.
+package realtime
+
+import (
+	"encoding/json"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cctv-api/internal/events"
+)
+
+// Message is an event with its position in the stream. JSON is the event
+// encoded once for all clients.
+type Message struct {
+	Seq   uint64
+	Event events.Event
+	JSON  []byte
+}
+
+// Broker fans events out to clients. It is safe for concurrent use.
+type Broker struct {
+	mu        sync.Mutex
+	epoch     string
+	ring      []Message
+	start     int // index of the oldest message in ring
+	count     int
+	nextSeq   uint64
+	clients   map[*Client]struct{}
+	queueSize int
+}
+
+// NewBroker keeps the last bufferSize events for resuming and queues up to
+// queueSize events per client.
+func NewBroker(bufferSize, queueSize int) *Broker {
+	if bufferSize < 1 {
+		bufferSize = 1
+	}
+	if queueSize < 1 {
+		queueSize = 1
+	}
+	return &Broker{
+		// Sequence numbers restart with the process, so IDs carry the start
+		// time to tell a stale Last-Event-ID from a current one
+		epoch:     strconv.FormatInt(time.Now().UnixMilli(), 36),
+		ring:      make([]Message, bufferSize),
+		nextSeq:   1,
+		clients:   make(map[*Client]struct{}),
+		queueSize: queueSize,
+	}
+}
+
+// Client receives messages on C until Done is closed, either because it
+// unsubscribed or because its queue overflowed.
+type Client struct {
+	C    chan Message
+	done chan struct{}
+	// Set when the client was dropped for falling behind
+	overflowed bool
+}
+
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Overflowed reports whether the client was dropped for falling behind.
+// Only meaningful once Done is closed.
+func (c *Client) Overflowed() bool {
+	return c.overflowed
+}
+
+// ID formats a sequence number as an event ID for clients.
+func (b *Broker) ID(seq uint64) string {
+	return b.epoch + "-" + strconv.FormatUint(seq, 10)
+}
+
+// Publish numbers an event and queues it for every client. It is meant to be
+// subscribed to the event bus.
+func (b *Broker) Publish(e events.Event) {
+	encoded, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("Failed to encode %s event: %v", e.Type, err)
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	msg := Message{Seq: b.nextSeq, Event: e, JSON: encoded}
+	b.nextSeq++
+
+	if b.count < len(b.ring) {
+		b.ring[(b.start+b.count)%len(b.ring)] = msg
+		b.count++
+	} else {
+		b.ring[b.start] = msg
+		b.start = (b.start + 1) % len(b.ring)
+	}
+
+	for c := range b.clients {
+		select {
+		case c.C <- msg:
+		default:
+			c.overflowed = true
+			b.drop(c)
+		}
+	}
+}
+
+// Subscribe registers a client. With a lastID from a previous connection it
+// also returns the buffered messages after it; complete is false when some
+// were no longer buffered (or lastID is from an earlier process), in which
+// case the client should reload its state.
+func (b *Broker) Subscribe(lastID string) (client *Client, replay []Message, complete bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	complete = true
+	if lastID != "" {
+		epoch, seqText, _ := strings.Cut(lastID, "-")
+		lastSeq, err := strconv.ParseUint(seqText, 10, 64)
+		if err != nil || epoch != b.epoch || lastSeq >= b.nextSeq {
+			complete = false
+		} else {
+			oldest := b.nextSeq - uint64(b.count)
+			if lastSeq+1 < oldest {
+				complete = false
+			}
+			for i := 0; i < b.count; i++ {
+				msg := b.ring[(b.start+i)%len(b.ring)]
+				if msg.Seq > lastSeq {
+					replay = append(replay, msg)
+				}
+			}
+		}
+	}
+
+	client = &Client{C: make(chan Message, b.queueSize), done: make(chan struct{})}
+	b.clients[client] = struct{}{}
+	return client, replay, complete
+}
+
+func (b *Broker) Unsubscribe(c *Client) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.drop(c)
+}
+
+func (b *Broker) drop(c *Client) {
+	if _, ok := b.clients[c]; !ok {
+		return
+	}
+	delete(b.clients, c)
+	close(c.done)
+}
+
+// Clients returns the number of connected clients.
+func (b *Broker) Clients() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.clients)
+}
+
+// LastID returns the ID of the newest event, or "" if there is none yet.
+func (b *Broker) LastID() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.nextSeq == 1 {
+		return ""
+	}
+	return b.ID(b.nextSeq - 1)
+}
@@ -0,0 +1,63 @@
+package realtime
+
+import "sync"
+
+// Viewers counts how many connections are watching each camera, as reported
+// by WebSocket heartbeats. It is safe for concurrent use.
+type Viewers struct {
+	mu     sync.Mutex
+	byConn map[*Client][]int
+	counts map[int]int
+}
+
+func NewViewers() *Viewers {
+	return &Viewers{byConn: make(map[*Client][]int), counts: make(map[int]int)}
+}
+
+// Set replaces the cameras a connection is watching.
+func (v *Viewers) Set(c *Client, cctvIDs []int) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.remove(c)
+
+	seen := make(map[int]bool, len(cctvIDs))
+	ids := make([]int, 0, len(cctvIDs))
+	for _, id := range cctvIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, id)
+		v.counts[id]++
+	}
+	if len(ids) > 0 {
+		v.byConn[c] = ids
+	}
+}
+
+// Remove forgets a connection, e.g. when it closes.
+func (v *Viewers) Remove(c *Client) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.remove(c)
+}
+
+func (v *Viewers) remove(c *Client) {
+	for _, id := range v.byConn[c] {
+		if v.counts[id]--; v.counts[id] <= 0 {
+			delete(v.counts, id)
+		}
+	}
+	delete(v.byConn, c)
+}
+
+// Counts returns the number of viewers per camera ID.
+func (v *Viewers) Counts() map[int]int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	counts := make(map[int]int, len(v.counts))
+	for id, n := range v.counts {
+		counts[id] = n
+	}
+	return counts
+}
@@ -49,6 +49,10 @@ func SendValidationError(w http.ResponseWriter, err error) {
 		})
 	}
 
+	SendValidationErrors(w, errors)
+}
+
+func SendValidationErrors(w http.ResponseWriter, errors []ValidationError) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusBadRequest)
 	json.NewEncoder(w).Encode(ValidationErrorResponse{
@@ -0,0 +1,333 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"image"
+	"log"
+	"sync"
+	"time"
+
+	"cctv-api/internal/events"
+	"cctv-api/internal/models"
+	"cctv-api/internal/motion"
+)
+
+// ActivityService scores how much changes between consecutive snapshots of
+// a camera. Scores of at least motionThreshold count as motion; a run of
+// them is a motion event, announced when it starts and ends.
+type ActivityService struct {
+	db              *sql.DB
+	bus             *events.Bus
+	detector        *motion.Detector
+	motionThreshold float64
+	retention       time.Duration
+
+	mu sync.Mutex
+	// Last frame of each camera, to compare the next one with
+	frames map[int]*motion.Frame
+}
+
+func NewActivityService(db *sql.DB, bus *events.Bus, detector *motion.Detector, motionThreshold float64, retention time.Duration) *ActivityService {
+	return &ActivityService{
+		db:              db,
+		bus:             bus,
+		detector:        detector,
+		motionThreshold: motionThreshold,
+		retention:       retention,
+		frames:          make(map[int]*motion.Frame),
+	}
+}
+
+// Observe compares a new frame of a camera with the previous one and
+// records the result. The first frame after a start only sets the
+// baseline.
+func (as *ActivityService) Observe(ctx context.Context, cctvID int, img image.Image) error {
+	frame := as.detector.Frame(img)
+
+	as.mu.Lock()
+	prev := as.frames[cctvID]
+	as.frames[cctvID] = frame
+	as.mu.Unlock()
+	if prev == nil {
+		return nil
+	}
+
+	zones, err := as.ignoreZones(ctx, cctvID)
+	if err == sql.ErrNoRows {
+		as.Forget(cctvID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	result, ok := as.detector.Compare(prev, frame, zones)
+	if !ok {
+		return nil
+	}
+	return as.record(ctx, cctvID, result.Score, time.Now())
+}
+
+// ObserveStill records that a camera sent the very same frame again:
+// nothing moved.
+func (as *ActivityService) ObserveStill(ctx context.Context, cctvID int) error {
+	as.mu.Lock()
+	_, ok := as.frames[cctvID]
+	as.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return as.record(ctx, cctvID, 0, time.Now())
+}
+
+// Forget drops the frame kept for a camera that no longer exists.
+func (as *ActivityService) Forget(cctvID int) {
+	as.mu.Lock()
+	delete(as.frames, cctvID)
+	as.mu.Unlock()
+}
+
+func (as *ActivityService) ignoreZones(ctx context.Context, cctvID int) ([]motion.Zone, error) {
+	var raw []byte
+	err := as.db.QueryRowContext(ctx, "SELECT motion_ignore_zones FROM cctvs WHERE id = $1", cctvID).Scan(&raw)
+	if err != nil {
+		return nil, err
+	}
+	var zones []motion.Zone
+	if err := json.Unmarshal(raw, &zones); err != nil {
+		return nil, err
+	}
+	return zones, nil
+}
+
+func (as *ActivityService) record(ctx context.Context, cctvID int, score float64, now time.Time) error {
+	isMotion := score >= as.motionThreshold
+	change := models.CCTVMotionChange{CCTVID: cctvID, Score: score}
+
+	tx, err := as.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var wasMotion bool
+	err = tx.QueryRow(`
+		SELECT name, location_id, activity_motion FROM cctvs WHERE id = $1 FOR UPDATE
+	`, cctvID).Scan(&change.Name, &change.LocationID, &wasMotion)
+	if err == sql.ErrNoRows {
+		as.Forget(cctvID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE cctvs SET activity_score = $1, activity_motion = $2, activity_measured_at = $3,
+			last_motion_at = CASE WHEN $2 THEN $3 ELSE last_motion_at END
+		WHERE id = $4
+	`, score, isMotion, now, cctvID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO cctv_activity_samples (cctv_id, score, motion, measured_at)
+		VALUES ($1, $2, $3, $4)
+	`, cctvID, score, isMotion, now)
+	if err != nil {
+		return err
+	}
+
+	var eventType string
+	switch {
+	case isMotion && !wasMotion:
+		eventType = events.CCTVMotionStarted
+		change.StartedAt, change.PeakScore = now, score
+		err = tx.QueryRow(`
+			INSERT INTO cctv_motion_events (cctv_id, started_at, peak_score)
+			VALUES ($1, $2, $3)
+			RETURNING id
+		`, cctvID, now, score).Scan(&change.MotionEventID)
+	case isMotion:
+		_, err = tx.Exec(`
+			UPDATE cctv_motion_events SET peak_score = GREATEST(peak_score, $1)
+			WHERE cctv_id = $2 AND ended_at IS NULL
+		`, score, cctvID)
+	case wasMotion:
+		eventType = events.CCTVMotionEnded
+		change.EndedAt = &now
+		err = tx.QueryRow(`
+			UPDATE cctv_motion_events SET ended_at = $1
+			WHERE cctv_id = $2 AND ended_at IS NULL
+			RETURNING id, started_at, peak_score
+		`, now, cctvID).Scan(&change.MotionEventID, &change.StartedAt, &change.PeakScore)
+		if err == sql.ErrNoRows {
+			// The open event is gone, e.g. pruned; just stop the motion
+			eventType, err = "", nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if eventType != "" {
+		as.bus.Publish(eventType, change)
+	}
+	return nil
+}
+
+// Activity returns a camera's current activity with the samples and motion
+// events between from and to, newest first.
+func (as *ActivityService) Activity(cctvID int, from, to time.Time, limit int) (*models.CCTVActivityReport, error) {
+	report := &models.CCTVActivityReport{
+		CCTVID:       cctvID,
+		Samples:      []models.ActivitySample{},
+		MotionEvents: []models.MotionEvent{},
+	}
+
+	var score sql.NullFloat64
+	var measuredAt, lastMotionAt sql.NullTime
+	err := as.db.QueryRow(`
+		SELECT activity_score, activity_motion, activity_measured_at, last_motion_at FROM cctvs WHERE id = $1
+	`, cctvID).Scan(&score, &report.Current.Motion, &measuredAt, &lastMotionAt)
+	if err != nil {
+		return nil, err
+	}
+	if score.Valid {
+		report.Current.Score = &score.Float64
+	}
+	if measuredAt.Valid {
+		report.Current.MeasuredAt = &measuredAt.Time
+	}
+	if lastMotionAt.Valid {
+		report.Current.LastMotionAt = &lastMotionAt.Time
+	}
+
+	rows, err := as.db.Query(`
+		SELECT score, motion, measured_at
+		FROM cctv_activity_samples
+		WHERE cctv_id = $1 AND measured_at >= $2 AND measured_at < $3
+		ORDER BY measured_at DESC
+		LIMIT $4
+	`, cctvID, from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var s models.ActivitySample
+		if err := rows.Scan(&s.Score, &s.Motion, &s.MeasuredAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		report.Samples = append(report.Samples, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Events that overlap the range, including one still going on
+	rows, err = as.db.Query(`
+		SELECT id, cctv_id, started_at, ended_at, peak_score
+		FROM cctv_motion_events
+		WHERE cctv_id = $1 AND started_at < $3 AND (ended_at IS NULL OR ended_at >= $2)
+		ORDER BY started_at DESC
+		LIMIT $4
+	`, cctvID, from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e models.MotionEvent
+		var endedAt sql.NullTime
+		if err := rows.Scan(&e.ID, &e.CCTVID, &e.StartedAt, &endedAt, &e.PeakScore); err != nil {
+			return nil, err
+		}
+		if endedAt.Valid {
+			e.EndedAt = &endedAt.Time
+		}
+		report.MotionEvents = append(report.MotionEvents, e)
+	}
+	return report, rows.Err()
+}
+
+// Mask returns the parts of a camera's frame left out of motion detection.
+func (as *ActivityService) Mask(cctvID int) (*models.MotionMask, error) {
+	var raw []byte
+	if err := as.db.QueryRow("SELECT motion_ignore_zones FROM cctvs WHERE id = $1", cctvID).Scan(&raw); err != nil {
+		return nil, err
+	}
+	mask := &models.MotionMask{IgnoreZones: []models.MotionZone{}}
+	if err := json.Unmarshal(raw, &mask.IgnoreZones); err != nil {
+		return nil, err
+	}
+	return mask, nil
+}
+
+// SetMask replaces the parts of a camera's frame left out of motion
+// detection. It returns sql.ErrNoRows for an unknown camera.
+func (as *ActivityService) SetMask(cctvID int, zones []models.MotionZone) (*models.MotionMask, error) {
+	if zones == nil {
+		zones = []models.MotionZone{}
+	}
+	raw, err := json.Marshal(zones)
+	if err != nil {
+		return nil, err
+	}
+	result, err := as.db.Exec("UPDATE cctvs SET motion_ignore_zones = $1, updated_at = NOW() WHERE id = $2", raw, cctvID)
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &models.MotionMask{IgnoreZones: zones}, nil
+}
+
+// PruneHistory deletes samples and finished motion events older than the
+// retention period.
+func (as *ActivityService) PruneHistory() (int64, error) {
+	if as.retention <= 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().Add(-as.retention)
+	result, err := as.db.Exec("DELETE FROM cctv_activity_samples WHERE measured_at < $1", cutoff)
+	if err != nil {
+		return 0, err
+	}
+	pruned, _ := result.RowsAffected()
+
+	result, err = as.db.Exec("DELETE FROM cctv_motion_events WHERE ended_at < $1", cutoff)
+	if err != nil {
+		return pruned, err
+	}
+	ended, _ := result.RowsAffected()
+	return pruned + ended, nil
+}
+
+// RunPruneJob prunes old activity every interval until ctx is cancelled.
+func (as *ActivityService) RunPruneJob(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if pruned, err := as.PruneHistory(); err != nil {
+			log.Printf("Failed to prune activity history: %v", err)
+		} else if pruned > 0 {
+			log.Printf("Pruned %d activity history row(s)", pruned)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,895 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"cctv-api/internal/events"
+	"cctv-api/internal/models"
+	"cctv-api/internal/netguard"
+	"cctv-api/internal/webhooks"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrAlertRuleNotFound         = errors.New("alert rule not found")
+	ErrMaintenanceWindowNotFound = errors.New("maintenance window not found")
+	ErrAlertIncidentNotFound     = errors.New("alert incident not found")
+)
+
+// AlertService evaluates alert rules against the stream health monitor's
+// results and notifies admins by email and webhook. Each rule, camera and
+// kind has at most one open incident, so an outage is only announced once;
+// notifications held back by quiet hours are sent when they end, and
+// incidents opened during a maintenance window are never announced.
+type AlertService struct {
+	db       *sql.DB
+	email    *EmailService
+	bus      *events.Bus
+	client   *http.Client
+	location *time.Location
+}
+
+// NewAlertService posts rule webhooks through guard, without following
+// redirects, so a rule cannot point the server at its own network.
+func NewAlertService(db *sql.DB, guard *netguard.Guard, email *EmailService, bus *events.Bus, location *time.Location) *AlertService {
+	if location == nil {
+		location = time.Local
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = guard.Dialer(10 * time.Second).DialContext
+
+	return &AlertService{
+		db:    db,
+		email: email,
+		bus:   bus,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   10 * time.Second,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		location: location,
+	}
+}
+
+// alertRule keeps the webhook secret next to the public rule.
+type alertRule struct {
+	models.AlertRule
+	webhookSecret string
+}
+
+const alertRuleColumns = `
+	id, name, scope, cctv_id, location_id, offline_minutes, flap_changes, flap_window_minutes,
+	notify_emails, webhook_url, webhook_secret, notify_recovery, quiet_hours_start, quiet_hours_end,
+	is_active, created_at, updated_at
+`
+
+func scanAlertRule(row interface{ Scan(...interface{}) error }, rule *alertRule) error {
+	var cctvID, locationID, offlineMinutes, flapChanges, flapWindow sql.NullInt64
+	var webhookURL, webhookSecret, quietStart, quietEnd sql.NullString
+	err := row.Scan(&rule.ID, &rule.Name, &rule.Scope, &cctvID, &locationID, &offlineMinutes, &flapChanges,
+		&flapWindow, pq.Array(&rule.NotifyEmails), &webhookURL, &webhookSecret, &rule.NotifyRecovery,
+		&quietStart, &quietEnd, &rule.IsActive, &rule.CreatedAt, &rule.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	rule.CCTVID = nullIntPtr(cctvID)
+	rule.LocationID = nullIntPtr(locationID)
+	rule.OfflineMinutes = nullIntPtr(offlineMinutes)
+	rule.FlapChanges = nullIntPtr(flapChanges)
+	rule.FlapWindowMinutes = nullIntPtr(flapWindow)
+	if webhookURL.Valid {
+		rule.WebhookURL = &webhookURL.String
+	}
+	if webhookSecret.Valid {
+		rule.webhookSecret = webhookSecret.String
+	}
+	rule.HasWebhookSecret = rule.webhookSecret != ""
+	if quietStart.Valid && quietEnd.Valid {
+		rule.QuietHoursStart = &quietStart.String
+		rule.QuietHoursEnd = &quietEnd.String
+	}
+	if rule.NotifyEmails == nil {
+		rule.NotifyEmails = []string{}
+	}
+	return nil
+}
+
+func nullIntPtr(v sql.NullInt64) *int {
+	if !v.Valid {
+		return nil
+	}
+	n := int(v.Int64)
+	return &n
+}
+
+func (as *AlertService) rules(activeOnly bool) ([]alertRule, error) {
+	query := "SELECT " + alertRuleColumns + " FROM alert_rules"
+	if activeOnly {
+		query += " WHERE is_active = true"
+	}
+	query += " ORDER BY id"
+
+	rows, err := as.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []alertRule
+	for rows.Next() {
+		var rule alertRule
+		if err := scanAlertRule(rows, &rule); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+func (as *AlertService) ListRules() ([]models.AlertRule, error) {
+	rules, err := as.rules(false)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]models.AlertRule, len(rules))
+	for i, rule := range rules {
+		list[i] = rule.AlertRule
+	}
+	return list, nil
+}
+
+func (as *AlertService) GetRule(id int) (*models.AlertRule, error) {
+	var rule alertRule
+	err := scanAlertRule(as.db.QueryRow("SELECT "+alertRuleColumns+" FROM alert_rules WHERE id = $1", id), &rule)
+	if err == sql.ErrNoRows {
+		return nil, ErrAlertRuleNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rule.AlertRule, nil
+}
+
+func alertRuleArgs(req models.AlertRuleRequest) []interface{} {
+	notifyRecovery := true
+	if req.NotifyRecovery != nil {
+		notifyRecovery = *req.NotifyRecovery
+	}
+	isActive := true
+	if req.IsActive != nil {
+		isActive = *req.IsActive
+	}
+	emails := req.NotifyEmails
+	if emails == nil {
+		emails = []string{}
+	}
+	return []interface{}{
+		req.Name, req.Scope, req.CCTVID, req.LocationID, req.OfflineMinutes, req.FlapChanges,
+		req.FlapWindowMinutes, pq.Array(emails), req.WebhookURL, req.WebhookSecret, notifyRecovery,
+		req.QuietHoursStart, req.QuietHoursEnd, isActive,
+	}
+}
+
+func (as *AlertService) CreateRule(req models.AlertRuleRequest, createdBy int) (int, error) {
+	var id int
+	err := as.db.QueryRow(`
+		INSERT INTO alert_rules (name, scope, cctv_id, location_id, offline_minutes, flap_changes, flap_window_minutes,
+			notify_emails, webhook_url, webhook_secret, notify_recovery, quiet_hours_start, quiet_hours_end, is_active, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		RETURNING id
+	`, append(alertRuleArgs(req), createdBy)...).Scan(&id)
+	return id, err
+}
+
+// UpdateRule replaces a rule. A nil webhook secret keeps the current one.
+func (as *AlertService) UpdateRule(id int, req models.AlertRuleRequest) error {
+	result, err := as.db.Exec(`
+		UPDATE alert_rules SET
+			name = $1, scope = $2, cctv_id = $3, location_id = $4, offline_minutes = $5, flap_changes = $6,
+			flap_window_minutes = $7, notify_emails = $8, webhook_url = $9,
+			webhook_secret = COALESCE($10, webhook_secret), notify_recovery = $11,
+			quiet_hours_start = $12, quiet_hours_end = $13, is_active = $14, updated_at = NOW()
+		WHERE id = $15
+	`, append(alertRuleArgs(req), id)...)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return ErrAlertRuleNotFound
+	}
+	return nil
+}
+
+func (as *AlertService) DeleteRule(id int) error {
+	result, err := as.db.Exec("DELETE FROM alert_rules WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return ErrAlertRuleNotFound
+	}
+	return nil
+}
+
+// ListMaintenanceWindows returns windows that have not ended yet, or all
+// of them when includePast is set.
+func (as *AlertService) ListMaintenanceWindows(includePast bool) ([]models.MaintenanceWindow, error) {
+	query := "SELECT id, cctv_id, location_id, starts_at, ends_at, reason, created_at FROM maintenance_windows"
+	if !includePast {
+		query += " WHERE ends_at > NOW()"
+	}
+	query += " ORDER BY starts_at DESC"
+
+	rows, err := as.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	windows := []models.MaintenanceWindow{}
+	for rows.Next() {
+		var w models.MaintenanceWindow
+		var cctvID, locationID sql.NullInt64
+		var reason sql.NullString
+		if err := rows.Scan(&w.ID, &cctvID, &locationID, &w.StartsAt, &w.EndsAt, &reason, &w.CreatedAt); err != nil {
+			return nil, err
+		}
+		w.CCTVID = nullIntPtr(cctvID)
+		w.LocationID = nullIntPtr(locationID)
+		if reason.Valid {
+			w.Reason = &reason.String
+		}
+		windows = append(windows, w)
+	}
+	return windows, rows.Err()
+}
+
+func (as *AlertService) CreateMaintenanceWindow(req models.CreateMaintenanceWindowRequest, createdBy int) (int, error) {
+	var id int
+	err := as.db.QueryRow(`
+		INSERT INTO maintenance_windows (cctv_id, location_id, starts_at, ends_at, reason, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`, req.CCTVID, req.LocationID, req.StartsAt, req.EndsAt, req.Reason, createdBy).Scan(&id)
+	return id, err
+}
+
+func (as *AlertService) DeleteMaintenanceWindow(id int) error {
+	result, err := as.db.Exec("DELETE FROM maintenance_windows WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return ErrMaintenanceWindowNotFound
+	}
+	return nil
+}
+
+func (as *AlertService) ListIncidents(openOnly bool, limit int) ([]models.AlertIncident, error) {
+	query := `
+		SELECT i.id, i.rule_id, r.name, i.cctv_id, c.name, i.kind, i.opened_at, i.resolved_at,
+			i.suppressed, i.notified_at, i.recovery_notified_at, i.acknowledged_at, i.acknowledged_by
+		FROM alert_incidents i
+		JOIN alert_rules r ON r.id = i.rule_id
+		JOIN cctvs c ON c.id = i.cctv_id
+	`
+	if openOnly {
+		query += " WHERE i.resolved_at IS NULL"
+	}
+	query += " ORDER BY i.opened_at DESC LIMIT $1"
+
+	rows, err := as.db.Query(query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	incidents := []models.AlertIncident{}
+	for rows.Next() {
+		var inc models.AlertIncident
+		var resolvedAt, notifiedAt, recoveryAt, acknowledgedAt sql.NullTime
+		var acknowledgedBy sql.NullInt64
+		err := rows.Scan(&inc.ID, &inc.RuleID, &inc.RuleName, &inc.CCTVID, &inc.CCTVName, &inc.Kind,
+			&inc.OpenedAt, &resolvedAt, &inc.Suppressed, &notifiedAt, &recoveryAt, &acknowledgedAt, &acknowledgedBy)
+		if err != nil {
+			return nil, err
+		}
+		if resolvedAt.Valid {
+			inc.ResolvedAt = &resolvedAt.Time
+		}
+		if notifiedAt.Valid {
+			inc.NotifiedAt = &notifiedAt.Time
+		}
+		if recoveryAt.Valid {
+			inc.RecoveryNotifiedAt = &recoveryAt.Time
+		}
+		if acknowledgedAt.Valid {
+			inc.AcknowledgedAt = &acknowledgedAt.Time
+		}
+		inc.AcknowledgedBy = nullIntPtr(acknowledgedBy)
+		incidents = append(incidents, inc)
+	}
+	return incidents, rows.Err()
+}
+
+// Acknowledge records that an admin has seen an incident and announces it
+// as an alert.acknowledged event. Acknowledging twice keeps the first.
+func (as *AlertService) Acknowledge(incidentID int64, userID int) error {
+	result, err := as.db.Exec(`
+		UPDATE alert_incidents SET acknowledged_at = NOW(), acknowledged_by = $2
+		WHERE id = $1 AND acknowledged_at IS NULL
+	`, incidentID, userID)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		var exists bool
+		if err := as.db.QueryRow("SELECT EXISTS(SELECT 1 FROM alert_incidents WHERE id = $1)", incidentID).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return ErrAlertIncidentNotFound
+		}
+		return nil
+	}
+
+	var rule alertRule
+	var cam alertCamera
+	var kind string
+	var openedAt time.Time
+	var resolvedAt sql.NullTime
+	err = as.db.QueryRow(`
+		SELECT i.kind, i.opened_at, i.resolved_at, r.id, r.name, c.id, c.name, l.id, l.name, c.health_status, c.health_detail
+		FROM alert_incidents i
+		JOIN alert_rules r ON r.id = i.rule_id
+		JOIN cctvs c ON c.id = i.cctv_id
+		JOIN locations l ON l.id = c.location_id
+		WHERE i.id = $1
+	`, incidentID).Scan(&kind, &openedAt, &resolvedAt, &rule.ID, &rule.Name, &cam.id, &cam.name,
+		&cam.locationID, &cam.locationName, &cam.status, &cam.detail)
+	if err != nil {
+		return err
+	}
+
+	var resolved *time.Time
+	if resolvedAt.Valid {
+		resolved = &resolvedAt.Time
+	}
+	payload := alertEvent(rule, cam, kind, events.AlertAcknowledged, incidentID, openedAt, resolved)
+	payload.AcknowledgedBy = &userID
+	as.bus.Publish(events.AlertAcknowledged, payload)
+	return nil
+}
+
+type alertCamera struct {
+	id           int
+	name         string
+	locationID   int
+	locationName string
+	status       sql.NullString
+	changedAt    sql.NullTime
+	detail       sql.NullString
+}
+
+type incidentKey struct {
+	ruleID int
+	cctvID int
+	kind   string
+}
+
+type openIncident struct {
+	id         int64
+	openedAt   time.Time
+	suppressed bool
+	notified   bool
+}
+
+// Evaluate checks every active rule once. It is called by RunAlertJob after
+// each monitor interval.
+func (as *AlertService) Evaluate(now time.Time) error {
+	rules, err := as.rules(true)
+	if err != nil {
+		return err
+	}
+
+	cameras, err := as.alertCameras()
+	if err != nil {
+		return err
+	}
+
+	windows, err := as.activeMaintenance(now)
+	if err != nil {
+		return err
+	}
+
+	open, err := as.openIncidents()
+	if err != nil {
+		return err
+	}
+
+	flapCounts := make(map[int]map[int]int) // window minutes → cctv → changes
+	seen := make(map[incidentKey]bool)
+
+	for _, rule := range rules {
+		if rule.FlapWindowMinutes != nil {
+			if _, ok := flapCounts[*rule.FlapWindowMinutes]; !ok {
+				counts, err := as.statusChanges(now.Add(-time.Duration(*rule.FlapWindowMinutes) * time.Minute))
+				if err != nil {
+					return err
+				}
+				flapCounts[*rule.FlapWindowMinutes] = counts
+			}
+		}
+
+		for _, cam := range cameras {
+			if !ruleCovers(rule, cam) {
+				continue
+			}
+
+			if rule.OfflineMinutes != nil {
+				key := incidentKey{rule.ID, cam.id, "offline"}
+				seen[key] = true
+				firing := cam.status.String == "offline" && cam.changedAt.Valid &&
+					now.Sub(cam.changedAt.Time) >= time.Duration(*rule.OfflineMinutes)*time.Minute
+				as.reconcile(rule, cam, key, firing, open, windows, now)
+			}
+
+			if rule.FlapChanges != nil && rule.FlapWindowMinutes != nil {
+				key := incidentKey{rule.ID, cam.id, "flapping"}
+				seen[key] = true
+				firing := flapCounts[*rule.FlapWindowMinutes][cam.id] >= *rule.FlapChanges
+				as.reconcile(rule, cam, key, firing, open, windows, now)
+			}
+		}
+	}
+
+	// Incidents whose rule was disabled or camera deactivated are closed
+	// quietly, without a recovery notice
+	for key, inc := range open {
+		if seen[key] {
+			continue
+		}
+		_, err := as.db.Exec(`
+			UPDATE alert_incidents SET resolved_at = $1, recovery_notified_at = $1
+			WHERE id = $2 AND resolved_at IS NULL
+		`, now, inc.id)
+		if err != nil {
+			log.Printf("Failed to close alert incident %d: %v", inc.id, err)
+		}
+	}
+
+	return as.sendPendingRecoveries(rules, cameras, now)
+}
+
+func ruleCovers(rule alertRule, cam alertCamera) bool {
+	switch rule.Scope {
+	case "cctv":
+		return rule.CCTVID != nil && *rule.CCTVID == cam.id
+	case "location":
+		return rule.LocationID != nil && *rule.LocationID == cam.locationID
+	default:
+		return true
+	}
+}
+
+// reconcile opens, notifies or resolves the incident for one rule, camera
+// and kind according to whether its condition currently holds.
+func (as *AlertService) reconcile(rule alertRule, cam alertCamera, key incidentKey, firing bool, open map[incidentKey]*openIncident, windows []models.MaintenanceWindow, now time.Time) {
+	inc, isOpen := open[key]
+
+	if firing && !isOpen {
+		suppressed := inMaintenance(windows, cam, now)
+		var id int64
+		err := as.db.QueryRow(`
+			INSERT INTO alert_incidents (rule_id, cctv_id, kind, opened_at, suppressed)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (rule_id, cctv_id, kind) WHERE resolved_at IS NULL DO NOTHING
+			RETURNING id
+		`, key.ruleID, key.cctvID, key.kind, now, suppressed).Scan(&id)
+		if err == sql.ErrNoRows {
+			return // opened concurrently
+		}
+		if err != nil {
+			log.Printf("Failed to open alert incident for rule %d, CCTV %d: %v", rule.ID, cam.id, err)
+			return
+		}
+		inc = &openIncident{id: id, openedAt: now, suppressed: suppressed}
+		open[key] = inc
+		isOpen = true
+
+		opened := alertEvent(rule, cam, key.kind, events.AlertTriggered, id, now, nil)
+		opened.Suppressed = suppressed
+		as.bus.Publish(events.AlertTriggered, opened)
+	}
+
+	if !isOpen {
+		return
+	}
+
+	if firing {
+		if !inc.notified && !inc.suppressed && !as.inQuietHours(rule, now) {
+			if as.deliver(rule, alertEvent(rule, cam, key.kind, events.AlertTriggered, inc.id, inc.openedAt, nil)) {
+				if _, err := as.db.Exec("UPDATE alert_incidents SET notified_at = $1 WHERE id = $2", now, inc.id); err != nil {
+					log.Printf("Failed to mark alert incident %d notified: %v", inc.id, err)
+				}
+			}
+		}
+		return
+	}
+
+	// Condition cleared: resolve. Recovery is only announced for incidents
+	// that were announced, and goes out with the pending recoveries.
+	skipRecovery := !inc.notified || !rule.NotifyRecovery
+	var recoveryNotifiedAt interface{}
+	if skipRecovery {
+		recoveryNotifiedAt = now
+	}
+	_, err := as.db.Exec(`
+		UPDATE alert_incidents SET resolved_at = $1, recovery_notified_at = $2
+		WHERE id = $3 AND resolved_at IS NULL
+	`, now, recoveryNotifiedAt, inc.id)
+	if err != nil {
+		log.Printf("Failed to resolve alert incident %d: %v", inc.id, err)
+		return
+	}
+	delete(open, key)
+
+	resolved := alertEvent(rule, cam, key.kind, events.AlertResolved, inc.id, inc.openedAt, &now)
+	resolved.Suppressed = inc.suppressed
+	as.bus.Publish(events.AlertResolved, resolved)
+}
+
+// sendPendingRecoveries announces resolved incidents whose recovery notice
+// has not gone out yet, unless the rule is in quiet hours.
+func (as *AlertService) sendPendingRecoveries(rules []alertRule, cameras []alertCamera, now time.Time) error {
+	rows, err := as.db.Query(`
+		SELECT id, rule_id, cctv_id, kind, opened_at, resolved_at FROM alert_incidents
+		WHERE resolved_at IS NOT NULL AND recovery_notified_at IS NULL
+	`)
+	if err != nil {
+		return err
+	}
+	type pending struct {
+		id                 int64
+		ruleID, cctvID     int
+		kind               string
+		openedAt, resolved time.Time
+	}
+	var list []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.ruleID, &p.cctvID, &p.kind, &p.openedAt, &p.resolved); err != nil {
+			rows.Close()
+			return err
+		}
+		list = append(list, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	ruleByID := make(map[int]alertRule, len(rules))
+	for _, r := range rules {
+		ruleByID[r.ID] = r
+	}
+	camByID := make(map[int]alertCamera, len(cameras))
+	for _, c := range cameras {
+		camByID[c.id] = c
+	}
+
+	for _, p := range list {
+		rule, ruleOK := ruleByID[p.ruleID]
+		cam, camOK := camByID[p.cctvID]
+		if !ruleOK || !camOK {
+			// Rule disabled or camera deactivated since; drop the notice
+			as.db.Exec("UPDATE alert_incidents SET recovery_notified_at = $1 WHERE id = $2", now, p.id)
+			continue
+		}
+		if as.inQuietHours(rule, now) {
+			continue
+		}
+		resolved := p.resolved
+		if as.deliver(rule, alertEvent(rule, cam, p.kind, events.AlertResolved, p.id, p.openedAt, &resolved)) {
+			if _, err := as.db.Exec("UPDATE alert_incidents SET recovery_notified_at = $1 WHERE id = $2", now, p.id); err != nil {
+				log.Printf("Failed to mark alert incident %d recovery notified: %v", p.id, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (as *AlertService) alertCameras() ([]alertCamera, error) {
+	rows, err := as.db.Query(`
+		SELECT c.id, c.name, l.id, l.name, c.health_status, c.health_changed_at, c.health_detail
+		FROM cctvs c JOIN locations l ON l.id = c.location_id
+		WHERE c.is_active = true
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cameras []alertCamera
+	for rows.Next() {
+		var c alertCamera
+		if err := rows.Scan(&c.id, &c.name, &c.locationID, &c.locationName, &c.status, &c.changedAt, &c.detail); err != nil {
+			return nil, err
+		}
+		cameras = append(cameras, c)
+	}
+	return cameras, rows.Err()
+}
+
+func (as *AlertService) activeMaintenance(now time.Time) ([]models.MaintenanceWindow, error) {
+	windows, err := as.ListMaintenanceWindows(false)
+	if err != nil {
+		return nil, err
+	}
+	active := windows[:0]
+	for _, w := range windows {
+		if !now.Before(w.StartsAt) && now.Before(w.EndsAt) {
+			active = append(active, w)
+		}
+	}
+	return active, nil
+}
+
+func inMaintenance(windows []models.MaintenanceWindow, cam alertCamera, now time.Time) bool {
+	for _, w := range windows {
+		switch {
+		case w.CCTVID != nil:
+			if *w.CCTVID == cam.id {
+				return true
+			}
+		case w.LocationID != nil:
+			if *w.LocationID == cam.locationID {
+				return true
+			}
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+func (as *AlertService) openIncidents() (map[incidentKey]*openIncident, error) {
+	rows, err := as.db.Query(`
+		SELECT id, rule_id, cctv_id, kind, opened_at, suppressed, notified_at IS NOT NULL
+		FROM alert_incidents WHERE resolved_at IS NULL
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	open := make(map[incidentKey]*openIncident)
+	for rows.Next() {
+		var key incidentKey
+		inc := &openIncident{}
+		if err := rows.Scan(&inc.id, &key.ruleID, &key.cctvID, &key.kind, &inc.openedAt, &inc.suppressed, &inc.notified); err != nil {
+			return nil, err
+		}
+		open[key] = inc
+	}
+	return open, rows.Err()
+}
+
+// statusChanges counts status transitions per camera since the given time.
+func (as *AlertService) statusChanges(since time.Time) (map[int]int, error) {
+	rows, err := as.db.Query(`
+		SELECT cctv_id, COUNT(*) FROM (
+			SELECT cctv_id, status, LAG(status) OVER (PARTITION BY cctv_id ORDER BY checked_at) AS previous
+			FROM cctv_status_history
+			WHERE checked_at >= $1
+		) h
+		WHERE previous IS NOT NULL AND previous <> status
+		GROUP BY cctv_id
+	`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[int]int)
+	for rows.Next() {
+		var id, count int
+		if err := rows.Scan(&id, &count); err != nil {
+			return nil, err
+		}
+		counts[id] = count
+	}
+	return counts, rows.Err()
+}
+
+// inQuietHours reports whether now falls in the rule's quiet hours, which
+// may wrap past midnight (e.g. 22:00–06:00).
+func (as *AlertService) inQuietHours(rule alertRule, now time.Time) bool {
+	if rule.QuietHoursStart == nil || rule.QuietHoursEnd == nil {
+		return false
+	}
+	start, err1 := time.Parse("15:04", *rule.QuietHoursStart)
+	end, err2 := time.Parse("15:04", *rule.QuietHoursEnd)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+
+	local := now.In(as.location)
+	minute := local.Hour()*60 + local.Minute()
+	from := start.Hour()*60 + start.Minute()
+	to := end.Hour()*60 + end.Minute()
+
+	if from <= to {
+		return minute >= from && minute < to
+	}
+	return minute >= from || minute < to
+}
+
+func alertEvent(rule alertRule, cam alertCamera, kind, event string, incidentID int64, openedAt time.Time, resolvedAt *time.Time) models.AlertEvent {
+	end := time.Now()
+	if resolvedAt != nil {
+		end = *resolvedAt
+	}
+	payload := models.AlertEvent{
+		Event:           event,
+		IncidentID:      incidentID,
+		Kind:            kind,
+		RuleID:          rule.ID,
+		RuleName:        rule.Name,
+		CCTVID:          cam.id,
+		CCTVName:        cam.name,
+		LocationID:      cam.locationID,
+		LocationName:    cam.locationName,
+		Status:          cam.status.String,
+		Detail:          cam.detail.String,
+		OpenedAt:        openedAt,
+		ResolvedAt:      resolvedAt,
+		DurationSeconds: int64(end.Sub(openedAt) / time.Second),
+	}
+	if payload.Status == "" {
+		payload.Status = "unknown"
+	}
+	return payload
+}
+
+// deliver sends the notification through every channel configured on the
+// rule and reports whether at least one succeeded. If none did, the
+// incident stays pending and delivery is retried on the next evaluation.
+func (as *AlertService) deliver(rule alertRule, payload models.AlertEvent) bool {
+	incidentID := payload.IncidentID
+	subject, body := alertMessage(payload, as.location)
+	delivered := false
+
+	recipients := rule.NotifyEmails
+	if len(recipients) == 0 {
+		admins, err := as.adminEmails()
+		if err != nil {
+			log.Printf("Failed to look up admin emails for alert %d: %v", incidentID, err)
+		}
+		recipients = admins
+	}
+	for _, to := range recipients {
+		if err := as.email.SendAlertEmail(to, subject, body); err != nil {
+			log.Printf("Failed to email alert %d to %s: %v", incidentID, to, err)
+			continue
+		}
+		delivered = true
+	}
+
+	if rule.WebhookURL != nil {
+		if err := as.postWebhook(*rule.WebhookURL, rule.webhookSecret, payload); err != nil {
+			log.Printf("Failed to post alert %d to webhook: %v", incidentID, err)
+		} else {
+			delivered = true
+		}
+	}
+
+	return delivered
+}
+
+func alertMessage(p models.AlertEvent, location *time.Location) (string, string) {
+	duration := time.Duration(p.DurationSeconds) * time.Second
+	var subject, summary string
+	switch {
+	case p.Event == "alert.resolved" && p.Kind == "flapping":
+		subject = fmt.Sprintf("[CCTV Recovered] %s is stable again", p.CCTVName)
+		summary = fmt.Sprintf("%s at %s has stopped flapping after %s.", p.CCTVName, p.LocationName, duration)
+	case p.Event == "alert.resolved":
+		subject = fmt.Sprintf("[CCTV Recovered] %s is back %s", p.CCTVName, p.Status)
+		summary = fmt.Sprintf("%s at %s is back %s after %s offline.", p.CCTVName, p.LocationName, p.Status, duration)
+	case p.Kind == "flapping":
+		subject = fmt.Sprintf("[CCTV Alert] %s is flapping", p.CCTVName)
+		summary = fmt.Sprintf("%s at %s keeps changing status and is currently %s.", p.CCTVName, p.LocationName, p.Status)
+	default:
+		subject = fmt.Sprintf("[CCTV Alert] %s is offline", p.CCTVName)
+		summary = fmt.Sprintf("%s at %s has been offline for %s.", p.CCTVName, p.LocationName, duration)
+	}
+
+	var body strings.Builder
+	body.WriteString(summary + "\n\n")
+	body.WriteString("Rule: " + p.RuleName + "\n")
+	body.WriteString("Opened: " + p.OpenedAt.In(location).Format("02 Jan 2006 15:04 MST") + "\n")
+	if p.ResolvedAt != nil {
+		body.WriteString("Resolved: " + p.ResolvedAt.In(location).Format("02 Jan 2006 15:04 MST") + "\n")
+	}
+	if p.Detail != "" {
+		body.WriteString("Last check: " + p.Detail + "\n")
+	}
+	return subject, body.String()
+}
+
+func (as *AlertService) adminEmails() ([]string, error) {
+	rows, err := as.db.Query("SELECT email FROM users WHERE role = 'admin' AND email <> '' ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var emails []string
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			return nil, err
+		}
+		emails = append(emails, email)
+	}
+	return emails, rows.Err()
+}
+
+func (as *AlertService) postWebhook(url, secret string, payload models.AlertEvent) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Event", payload.Event)
+	if secret != "" {
+		req.Header.Set(webhooks.SignatureHeader, webhooks.Sign(secret, time.Now(), body))
+	}
+
+	resp, err := as.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// RunAlertJob evaluates the alert rules every interval until ctx is cancelled.
+func (as *AlertService) RunAlertJob(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := as.Evaluate(time.Now()); err != nil {
+			log.Printf("Failed to evaluate alert rules: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cctv-api/internal/models"
+	"cctv-api/internal/netguard"
+)
+
+func TestAlertServicePostWebhook(t *testing.T) {
+	var received int
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received++
+		if r.URL.Path == "/moved" {
+			http.Redirect(w, r, "/hook", http.StatusFound)
+		}
+	}))
+	defer receiver.Close()
+
+	allowLoopback, err := netguard.Parse("127.0.0.1, ::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := models.AlertEvent{Event: "alert.opened"}
+
+	if err := NewAlertService(nil, nil, nil, nil, nil).postWebhook(receiver.URL+"/hook", "", event); !errors.Is(err, netguard.ErrBlocked) {
+		t.Errorf("postWebhook(loopback) = %v, want ErrBlocked", err)
+	}
+
+	alerts := NewAlertService(nil, allowLoopback, nil, nil, nil)
+	if err := alerts.postWebhook(receiver.URL+"/hook", "secret", event); err != nil {
+		t.Errorf("postWebhook(allowed) = %v", err)
+	}
+	if err := alerts.postWebhook(receiver.URL+"/moved", "secret", event); err == nil {
+		t.Error("postWebhook followed a redirect")
+	}
+	if received != 2 {
+		t.Errorf("receiver got %d requests, want 2", received)
+	}
+}
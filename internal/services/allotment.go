@@ -0,0 +1,522 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"cctv-api/internal/models"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrAllotmentTooLarge     = errors.New("more cameras than the plan allows")
+	ErrAllotmentInvalidCCTV  = errors.New("selection contains unknown or inactive cameras")
+	ErrAllotmentSwapLimit    = errors.New("swap limit reached for this period")
+	ErrAllotmentNotAllotted  = errors.New("camera is not in the allotment")
+	ErrAllotmentAlreadyAdded = errors.New("camera is already in the allotment")
+)
+
+// AllotmentService manages the fixed set of cameras that users on a plan
+// with a camera quota may watch. Users pick their own cameras; until they
+// do, cameras are assigned using the admin-configured strategy. Cameras that
+// are deactivated or deleted are replaced using the same strategy.
+type AllotmentService struct {
+	db            *sql.DB
+	plans         *PlanService
+	notifications *NotificationService
+}
+
+func NewAllotmentService(db *sql.DB, plans *PlanService, notifications *NotificationService) *AllotmentService {
+	return &AllotmentService{db: db, plans: plans, notifications: notifications}
+}
+
+var defaultAllotmentSettings = models.AllotmentSettings{
+	Strategy:       models.AllotmentStrategyRandom,
+	SwapsPerPeriod: 3,
+	SwapPeriodDays: 30,
+}
+
+func (as *AllotmentService) Settings() (models.AllotmentSettings, error) {
+	settings := defaultAllotmentSettings
+
+	var raw []byte
+	err := as.db.QueryRow("SELECT value FROM app_settings WHERE key = 'allotment'").Scan(&raw)
+	if err == sql.ErrNoRows {
+		return settings, nil
+	}
+	if err != nil {
+		return settings, err
+	}
+	if err := json.Unmarshal(raw, &settings); err != nil {
+		return settings, err
+	}
+	return settings, nil
+}
+
+func (as *AllotmentService) UpdateSettings(settings models.AllotmentSettings) error {
+	raw, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	_, err = as.db.Exec(`
+		INSERT INTO app_settings (key, value, updated_at) VALUES ('allotment', $1, NOW())
+		ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, updated_at = NOW()
+	`, string(raw))
+	return err
+}
+
+// load returns the user's allotted cameras that are still active.
+func (as *AllotmentService) load(q Queryer, userID int, lock bool) ([]int, sql.NullTime, error) {
+	query := "SELECT allotment_chosen_at FROM users WHERE id = $1"
+	if lock {
+		query += " FOR UPDATE"
+	}
+
+	var chosenAt sql.NullTime
+	if err := q.QueryRow(query, userID).Scan(&chosenAt); err != nil {
+		return nil, chosenAt, err
+	}
+
+	ids, err := queryIDs(q, `
+		SELECT a.cctv_id FROM user_cctv_allotments a
+		JOIN cctvs c ON c.id = a.cctv_id
+		WHERE a.user_id = $1 AND c.is_active = true
+		ORDER BY a.assigned_at, a.cctv_id
+	`, userID)
+	return ids, chosenAt, err
+}
+
+// store makes ids the user's allotment. Cameras the user already had keep
+// their original source and assignment time.
+func (as *AllotmentService) store(q Queryer, userID int, ids []int, source string) error {
+	if ids == nil {
+		ids = []int{}
+	}
+	_, err := q.Exec(`
+		DELETE FROM user_cctv_allotments
+		WHERE user_id = $1 AND NOT (cctv_id = ANY($2))
+	`, userID, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	return as.add(q, userID, ids, source)
+}
+
+func (as *AllotmentService) add(q Queryer, userID int, ids []int, source string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := q.Exec(`
+		INSERT INTO user_cctv_allotments (user_id, cctv_id, source)
+		SELECT $1, id, $3 FROM UNNEST($2::int[]) AS id
+		ON CONFLICT DO NOTHING
+	`, userID, pq.Array(ids), source)
+	return err
+}
+
+// pick selects up to count active cameras not in exclude, using strategy.
+func (as *AllotmentService) pick(q Queryer, userID int, count int, exclude []int, strategy string) ([]int, error) {
+	if count <= 0 {
+		return nil, nil
+	}
+	if exclude == nil {
+		exclude = []int{}
+	}
+
+	var query string
+	args := []interface{}{pq.Array(exclude), count}
+
+	switch strategy {
+	case models.AllotmentStrategyPopular:
+		// Popularity = how many users chose the camera themselves
+		query = `
+			SELECT c.id FROM cctvs c
+			LEFT JOIN (
+				SELECT cctv_id, COUNT(*) AS picks
+				FROM user_cctv_allotments
+				WHERE source = 'chosen'
+				GROUP BY cctv_id
+			) p ON p.cctv_id = c.id
+			WHERE c.is_active = true AND NOT (c.id = ANY($1))
+			ORDER BY COALESCE(p.picks, 0) DESC, RANDOM()
+			LIMIT $2
+		`
+	case models.AllotmentStrategyNearest:
+		// Cameras at the home location first, then by distance between location coordinates
+		query = `
+			SELECT c.id FROM cctvs c
+			JOIN locations l ON l.id = c.location_id
+			LEFT JOIN users u ON u.id = $3
+			LEFT JOIN locations h ON h.id = u.home_location_id
+			WHERE c.is_active = true AND NOT (c.id = ANY($1))
+			ORDER BY
+				(c.location_id = h.id) DESC NULLS LAST,
+				POWER(l.latitude - h.latitude, 2) + POWER((l.longitude - h.longitude) * COS(RADIANS(h.latitude)), 2) ASC NULLS LAST,
+				RANDOM()
+			LIMIT $2
+		`
+		args = append(args, userID)
+	default:
+		query = `
+			SELECT id FROM cctvs
+			WHERE is_active = true AND NOT (id = ANY($1))
+			ORDER BY RANDOM()
+			LIMIT $2
+		`
+	}
+
+	return queryIDs(q, query, args...)
+}
+
+func queryIDs(q Queryer, query string, args ...interface{}) ([]int, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// Ensure returns the user's allotment. Cameras that went inactive are
+// replaced, users who never chose are topped up to their quota with the
+// default strategy, and the allotment is trimmed if the quota shrank.
+func (as *AllotmentService) Ensure(userID, quota int) ([]int, error) {
+	settings, err := as.Settings()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := as.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	ids, chosenAt, err := as.load(tx, userID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	// Usually already handled by ReleaseCCTV, unless a camera was
+	// deactivated outside the API
+	inactive, err := queryIDs(tx, `
+		SELECT a.cctv_id FROM user_cctv_allotments a
+		JOIN cctvs c ON c.id = a.cctv_id
+		WHERE a.user_id = $1 AND c.is_active = false
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, cctvID := range inactive {
+		_, err := tx.Exec("DELETE FROM user_cctv_allotments WHERE user_id = $1 AND cctv_id = $2", userID, cctvID)
+		if err != nil {
+			return nil, err
+		}
+		if len(ids) >= quota {
+			continue
+		}
+		added, err := as.replace(tx, userID, cctvID, settings.Strategy)
+		if err != nil {
+			return nil, err
+		}
+		if added != 0 {
+			ids = append(ids, added)
+		}
+	}
+
+	switch {
+	case len(ids) > quota:
+		ids = ids[:quota]
+		if err := as.store(tx, userID, ids, "auto"); err != nil {
+			return nil, err
+		}
+	case len(ids) < quota && !chosenAt.Valid:
+		picked, err := as.pick(tx, userID, quota-len(ids), ids, settings.Strategy)
+		if err != nil {
+			return nil, err
+		}
+		if err := as.add(tx, userID, picked, "auto"); err != nil {
+			return nil, err
+		}
+		ids = append(ids, picked...)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// replace picks a substitute for removedID, adds it to the user's allotment
+// and tells the user about it. It returns 0 if no camera is available.
+func (as *AllotmentService) replace(q Queryer, userID, removedID int, strategy string) (int, error) {
+	current, err := queryIDs(q, "SELECT cctv_id FROM user_cctv_allotments WHERE user_id = $1", userID)
+	if err != nil {
+		return 0, err
+	}
+
+	picked, err := as.pick(q, userID, 1, append(current, removedID), strategy)
+	if err != nil {
+		return 0, err
+	}
+
+	var removedName string
+	_ = q.QueryRow("SELECT name FROM cctvs WHERE id = $1", removedID).Scan(&removedName)
+	if removedName == "" {
+		removedName = "#" + strconv.Itoa(removedID)
+	}
+
+	if len(picked) == 0 {
+		err = as.notifications.Notify(q, userID, "allotment.camera_removed",
+			"Camera removed",
+			"Camera "+removedName+" is no longer available and no replacement could be found.",
+			map[string]interface{}{"removedCctvId": removedID})
+		return 0, err
+	}
+
+	addedID := picked[0]
+	if err := as.add(q, userID, picked, "replacement"); err != nil {
+		return 0, err
+	}
+
+	var addedName string
+	if err := q.QueryRow("SELECT name FROM cctvs WHERE id = $1", addedID).Scan(&addedName); err != nil {
+		return 0, err
+	}
+
+	err = as.notifications.Notify(q, userID, "allotment.camera_replaced",
+		"Camera replaced",
+		"Camera "+removedName+" is no longer available and has been replaced with "+addedName+".",
+		map[string]interface{}{"removedCctvId": removedID, "addedCctvId": addedID})
+	if err != nil {
+		return 0, err
+	}
+	return addedID, nil
+}
+
+// ReleaseCCTV takes a camera that is being deactivated or deleted out of
+// every allotment and backfills each affected user. Run it in the same
+// transaction as the change, before a delete, so the camera's name is still
+// available for the notification.
+func (as *AllotmentService) ReleaseCCTV(q Queryer, cctvID int) error {
+	settings, err := as.Settings()
+	if err != nil {
+		return err
+	}
+
+	userIDs, err := queryIDs(q, "DELETE FROM user_cctv_allotments WHERE cctv_id = $1 RETURNING user_id", cctvID)
+	if err != nil {
+		return err
+	}
+
+	for _, userID := range userIDs {
+		// Users on unlimited plans keep their saved selection but need no replacement
+		plan, _, err := as.plans.UserPlan(userID)
+		if err != nil {
+			return err
+		}
+		if !plan.HasCameraQuota() {
+			continue
+		}
+		if _, err := as.replace(q, userID, cctvID, settings.Strategy); err != nil {
+			return err
+		}
+	}
+
+	if len(userIDs) > 0 {
+		log.Printf("Released CCTV %d from %d allotment(s)", cctvID, len(userIDs))
+	}
+	return nil
+}
+
+func (as *AllotmentService) swapsUsed(q Queryer, userID int, settings models.AllotmentSettings) (int, *time.Time, error) {
+	var used int
+	var oldest sql.NullTime
+	err := q.QueryRow(`
+		SELECT COUNT(*), MIN(swapped_at) FROM cctv_allotment_swaps
+		WHERE user_id = $1 AND swapped_at > NOW() - ($2 || ' days')::interval
+			AND added_cctv_id IS NOT NULL
+	`, userID, strconv.Itoa(settings.SwapPeriodDays)).Scan(&used, &oldest)
+	if err != nil {
+		return 0, nil, err
+	}
+	if !oldest.Valid {
+		return used, nil, nil
+	}
+	resetsAt := oldest.Time.Add(time.Duration(settings.SwapPeriodDays) * 24 * time.Hour)
+	return used, &resetsAt, nil
+}
+
+func (as *AllotmentService) Status(userID, quota int) (*models.AllotmentStatus, error) {
+	settings, err := as.Settings()
+	if err != nil {
+		return nil, err
+	}
+
+	ids, chosenAt, err := as.load(as.db, userID, false)
+	if err != nil {
+		return nil, err
+	}
+	if ids == nil {
+		ids = []int{}
+	}
+
+	used, resetsAt, err := as.swapsUsed(as.db, userID, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &models.AllotmentStatus{
+		CCTVIDs:        ids,
+		Quota:          quota,
+		RemainingSlots: quota - len(ids),
+		Chosen:         chosenAt.Valid,
+		SwapsPerPeriod: settings.SwapsPerPeriod,
+		SwapsUsed:      used,
+		SwapsRemaining: settings.SwapsPerPeriod - used,
+		PeriodResetsAt: resetsAt,
+	}
+	if status.RemainingSlots < 0 {
+		status.RemainingSlots = 0
+	}
+	if status.SwapsRemaining < 0 {
+		status.SwapsRemaining = 0
+	}
+	return status, nil
+}
+
+// SetSelection replaces the user's allotment with ids. The user's first
+// choice is free; after that every camera added counts as a swap against the
+// per-period limit, whether it replaces another or fills an empty slot, so
+// removing and re-adding across separate calls costs the same as a swap.
+// Freeing a slot is never counted.
+func (as *AllotmentService) SetSelection(userID, quota int, ids []int) error {
+	if len(ids) > quota {
+		return ErrAllotmentTooLarge
+	}
+
+	settings, err := as.Settings()
+	if err != nil {
+		return err
+	}
+
+	tx, err := as.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	current, chosenAt, err := as.load(tx, userID, true)
+	if err != nil {
+		return err
+	}
+
+	if len(ids) > 0 {
+		var activeCount int
+		err = tx.QueryRow("SELECT COUNT(*) FROM cctvs WHERE id = ANY($1) AND is_active = true", pq.Array(ids)).Scan(&activeCount)
+		if err != nil {
+			return err
+		}
+		if activeCount != len(ids) {
+			return ErrAllotmentInvalidCCTV
+		}
+	}
+
+	removed := difference(current, ids)
+	added := difference(ids, current)
+
+	if chosenAt.Valid && len(added) > 0 {
+		used, _, err := as.swapsUsed(tx, userID, settings)
+		if err != nil {
+			return err
+		}
+		if used+len(added) > settings.SwapsPerPeriod {
+			return ErrAllotmentSwapLimit
+		}
+		for i, addedID := range added {
+			// Pair additions with removals where there are any; a filled
+			// empty slot is recorded with no removed camera
+			var removedID *int
+			if i < len(removed) {
+				removedID = &removed[i]
+			}
+			_, err = tx.Exec(`
+				INSERT INTO cctv_allotment_swaps (user_id, removed_cctv_id, added_cctv_id)
+				VALUES ($1, $2, $3)
+			`, userID, removedID, addedID)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := as.store(tx, userID, ids, "chosen"); err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE user_cctv_allotments SET source = 'chosen' WHERE user_id = $1", userID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE users SET allotment_chosen_at = COALESCE(allotment_chosen_at, NOW()) WHERE id = $1", userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Swap replaces a single camera in the user's allotment.
+func (as *AllotmentService) Swap(userID, quota, removeID, addID int) error {
+	current, _, err := as.load(as.db, userID, false)
+	if err != nil {
+		return err
+	}
+
+	ids := make([]int, 0, len(current))
+	found := false
+	for _, id := range current {
+		if id == addID {
+			return ErrAllotmentAlreadyAdded
+		}
+		if id == removeID {
+			found = true
+			ids = append(ids, addID)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	if !found {
+		return ErrAllotmentNotAllotted
+	}
+
+	return as.SetSelection(userID, quota, ids)
+}
+
+// difference returns the elements of a that are not in b, keeping a's order.
+func difference(a, b []int) []int {
+	inB := make(map[int]bool, len(b))
+	for _, id := range b {
+		inB[id] = true
+	}
+	var result []int
+	for _, id := range a {
+		if !inB[id] {
+			result = append(result, id)
+		}
+	}
+	return result
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// expectAllotment expects the default settings and the locked load of user
+// 7's allotment, chosen or not.
+func expectAllotment(mock sqlmock.Sqlmock, chosen bool, ids ...int) {
+	mock.ExpectQuery(`SELECT value FROM app_settings`).WillReturnError(sql.ErrNoRows)
+	mock.ExpectBegin()
+	var chosenAt interface{}
+	if chosen {
+		chosenAt = time.Now().Add(-48 * time.Hour)
+	}
+	mock.ExpectQuery(`SELECT allotment_chosen_at FROM users WHERE id = \$1 FOR UPDATE`).WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"allotment_chosen_at"}).AddRow(chosenAt))
+	rows := sqlmock.NewRows([]string{"cctv_id"})
+	for _, id := range ids {
+		rows.AddRow(id)
+	}
+	mock.ExpectQuery(`FROM user_cctv_allotments a`).WithArgs(7).WillReturnRows(rows)
+}
+
+func TestAllotmentServiceSetSelection(t *testing.T) {
+	tests := []struct {
+		name      string
+		chosen    bool
+		current   []int
+		ids       []int
+		active    int // how many of ids are active cameras
+		swapsUsed int
+		wantSwaps int
+		wantErr   error
+	}{
+		{name: "first choice is free", current: []int{1, 2}, ids: []int{3, 4}, active: 2},
+		{name: "swap within the limit", chosen: true, current: []int{1, 2}, ids: []int{1, 5}, active: 2, swapsUsed: 2, wantSwaps: 1},
+		{name: "swap limit reached", chosen: true, current: []int{1, 2}, ids: []int{1, 5}, active: 2, swapsUsed: 3, wantErr: ErrAllotmentSwapLimit},
+		{name: "freeing a slot is not a swap", chosen: true, current: []int{1, 2}, ids: []int{1}, active: 1, swapsUsed: 3},
+		{name: "inactive camera", current: []int{1}, ids: []int{1, 9}, active: 1, wantErr: ErrAllotmentInvalidCCTV},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			expectAllotment(mock, tt.chosen, tt.current...)
+			mock.ExpectQuery(`SELECT COUNT\(\*\) FROM cctvs WHERE id = ANY`).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(tt.active))
+			if tt.active == len(tt.ids) && tt.chosen && len(difference(tt.ids, tt.current)) > 0 {
+				mock.ExpectQuery(`FROM cctv_allotment_swaps`).WithArgs(7, "30").
+					WillReturnRows(sqlmock.NewRows([]string{"count", "min"}).AddRow(tt.swapsUsed, nil))
+			}
+			for i := 0; i < tt.wantSwaps; i++ {
+				mock.ExpectExec(`INSERT INTO cctv_allotment_swaps`).WillReturnResult(sqlmock.NewResult(1, 1))
+			}
+			if tt.wantErr != nil {
+				mock.ExpectRollback()
+			} else {
+				mock.ExpectExec(`DELETE FROM user_cctv_allotments`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`INSERT INTO user_cctv_allotments`).WithArgs(7, sqlmock.AnyArg(), "chosen").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE user_cctv_allotments SET source = 'chosen'`).WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectExec(`UPDATE users SET allotment_chosen_at`).WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			}
+
+			as := NewAllotmentService(db, NewPlanService(db), NewNotificationService(db))
+			if err := as.SetSelection(7, 2, tt.ids); err != tt.wantErr {
+				t.Errorf("SetSelection() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAllotmentServiceSetSelectionOverQuota(t *testing.T) {
+	db, _ := newMockDB(t)
+	as := NewAllotmentService(db, NewPlanService(db), NewNotificationService(db))
+	if err := as.SetSelection(7, 2, []int{1, 2, 3}); err != ErrAllotmentTooLarge {
+		t.Errorf("SetSelection(3 cameras, quota 2) = %v, want ErrAllotmentTooLarge", err)
+	}
+}
+
+func TestAllotmentServiceEnsure(t *testing.T) {
+	tests := []struct {
+		name    string
+		chosen  bool
+		current []int
+		quota   int
+		picked  []int
+		want    []int
+	}{
+		{name: "topped up until the user chooses", current: []int{1}, quota: 3, picked: []int{4, 5}, want: []int{1, 4, 5}},
+		{name: "chosen allotment left short", chosen: true, current: []int{1}, quota: 3, want: []int{1}},
+		{name: "trimmed when the quota shrank", chosen: true, current: []int{1, 2, 3}, quota: 2, want: []int{1, 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			expectAllotment(mock, tt.chosen, tt.current...)
+			mock.ExpectQuery(`c.is_active = false`).WithArgs(7).WillReturnRows(sqlmock.NewRows([]string{"cctv_id"}))
+			switch {
+			case len(tt.current) > tt.quota:
+				mock.ExpectExec(`DELETE FROM user_cctv_allotments`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`INSERT INTO user_cctv_allotments`).WithArgs(7, sqlmock.AnyArg(), "auto").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			case len(tt.picked) > 0:
+				rows := sqlmock.NewRows([]string{"id"})
+				for _, id := range tt.picked {
+					rows.AddRow(id)
+				}
+				mock.ExpectQuery(`ORDER BY RANDOM\(\)`).WithArgs(sqlmock.AnyArg(), tt.quota-len(tt.current)).WillReturnRows(rows)
+				mock.ExpectExec(`INSERT INTO user_cctv_allotments`).WithArgs(7, sqlmock.AnyArg(), "auto").
+					WillReturnResult(sqlmock.NewResult(0, int64(len(tt.picked))))
+			}
+			mock.ExpectCommit()
+
+			as := NewAllotmentService(db, NewPlanService(db), NewNotificationService(db))
+			got, err := as.Ensure(7, tt.quota)
+			if err != nil {
+				t.Fatalf("Ensure() error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Ensure() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDifference(t *testing.T) {
+	tests := []struct {
+		a, b, want []int
+	}{
+		{[]int{1, 2, 3}, []int{2}, []int{1, 3}},
+		{[]int{3, 1}, nil, []int{3, 1}},
+		{[]int{1}, []int{1, 2}, nil},
+		{nil, []int{1}, nil},
+	}
+
+	for _, tt := range tests {
+		if got := difference(tt.a, tt.b); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("difference(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"cctv-api/internal/models"
+)
+
+// APIKeyPrefix starts every API key, so that keys are easy to recognise
+// (and to tell apart from JWTs and playback tokens).
+const APIKeyPrefix = "cak_"
+
+// maxAPIKeysPerUser bounds how many active keys one user may hold.
+const maxAPIKeysPerUser = 20
+
+var (
+	ErrAPIKeyNotFound = errors.New("API key not found")
+	ErrInvalidAPIKey  = errors.New("invalid API key")
+	ErrTooManyAPIKeys = errors.New("too many API keys")
+)
+
+// APIKeyService manages users' API keys. Keys are shown once when created;
+// only their SHA-256 hash is stored.
+type APIKeyService struct {
+	db *sql.DB
+}
+
+func NewAPIKeyService(db *sql.DB) *APIKeyService {
+	return &APIKeyService{db: db}
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func (ks *APIKeyService) Create(userID int, req models.CreateAPIKeyRequest) (*models.APIKey, error) {
+	var active int
+	err := ks.db.QueryRow(`
+		SELECT COUNT(*) FROM api_keys
+		WHERE user_id = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())
+	`, userID).Scan(&active)
+	if err != nil {
+		return nil, err
+	}
+	if active >= maxAPIKeysPerUser {
+		return nil, ErrTooManyAPIKeys
+	}
+
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	key := &models.APIKey{Name: req.Name, Key: APIKeyPrefix + hex.EncodeToString(b)}
+	key.Prefix = key.Key[:len(APIKeyPrefix)+8]
+	if req.ExpiresInDays != nil {
+		expiresAt := time.Now().AddDate(0, 0, *req.ExpiresInDays)
+		key.ExpiresAt = &expiresAt
+	}
+
+	err = ks.db.QueryRow(`
+		INSERT INTO api_keys (user_id, name, prefix, key_hash, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`, userID, key.Name, key.Prefix, hashAPIKey(key.Key), key.ExpiresAt).Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// List returns the user's keys that have not been revoked, newest first.
+func (ks *APIKeyService) List(userID int) ([]models.APIKey, error) {
+	rows, err := ks.db.Query(`
+		SELECT id, name, prefix, last_used_at, expires_at, created_at
+		FROM api_keys
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at DESC, id DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		var k models.APIKey
+		var lastUsedAt, expiresAt sql.NullTime
+		if err := rows.Scan(&k.ID, &k.Name, &k.Prefix, &lastUsedAt, &expiresAt, &k.CreatedAt); err != nil {
+			return nil, err
+		}
+		if lastUsedAt.Valid {
+			k.LastUsedAt = &lastUsedAt.Time
+		}
+		if expiresAt.Valid {
+			k.ExpiresAt = &expiresAt.Time
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+func (ks *APIKeyService) Revoke(userID, id int) error {
+	result, err := ks.db.Exec(`
+		UPDATE api_keys SET revoked_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`, id, userID)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// Authenticate returns the owner of a valid key and their role.
+func (ks *APIKeyService) Authenticate(key string) (int, string, error) {
+	if !strings.HasPrefix(key, APIKeyPrefix) {
+		return 0, "", ErrInvalidAPIKey
+	}
+
+	var id, userID int
+	var role string
+	err := ks.db.QueryRow(`
+		SELECT k.id, u.id, u.role
+		FROM api_keys k
+		JOIN users u ON u.id = k.user_id
+		WHERE k.key_hash = $1 AND k.revoked_at IS NULL
+		  AND (k.expires_at IS NULL OR k.expires_at > NOW())
+	`, hashAPIKey(key)).Scan(&id, &userID, &role)
+	if err == sql.ErrNoRows {
+		return 0, "", ErrInvalidAPIKey
+	}
+	if err != nil {
+		return 0, "", err
+	}
+
+	// Only touch the row once a minute; media servers authenticate often
+	_, _ = ks.db.Exec(`
+		UPDATE api_keys SET last_used_at = NOW()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+	`, id)
+
+	return userID, role, nil
+}
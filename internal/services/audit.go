@@ -0,0 +1,39 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+
+	"cctv-api/internal/models"
+)
+
+type AuditService struct {
+	db *sql.DB
+}
+
+func NewAuditService(db *sql.DB) *AuditService {
+	return &AuditService{db: db}
+}
+
+// Record writes an entry to the audit log. Failures are logged rather than
+// returned so that auditing never breaks the action being audited.
+func (as *AuditService) Record(entry models.AuditLog) {
+	var details interface{}
+	if entry.Details != nil {
+		raw, err := json.Marshal(entry.Details)
+		if err != nil {
+			log.Printf("Failed to encode audit details for %s: %v", entry.Action, err)
+		} else {
+			details = string(raw)
+		}
+	}
+
+	_, err := as.db.Exec(`
+		INSERT INTO audit_logs (actor_id, user_id, action, ip_address, details)
+		VALUES ($1, $2, $3, $4, $5)
+	`, entry.ActorID, entry.UserID, entry.Action, entry.IPAddress, details)
+	if err != nil {
+		log.Printf("Failed to write audit log %s: %v", entry.Action, err)
+	}
+}
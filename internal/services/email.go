@@ -3,8 +3,10 @@ package services
 import (
 	"cctv-api/internal/config"
 	"fmt"
+	"html/template"
 	"net/smtp"
 	"strings"
+	"time"
 )
 
 type EmailService struct {
@@ -30,6 +32,40 @@ func (es *EmailService) SendResetEmail(to, token string) error {
 	</html>
 	`, token)
 
+	return es.send(to, subject, body)
+}
+
+func (es *EmailService) SendLockoutEmail(to string, until time.Time) error {
+	subject := "Account Temporarily Locked"
+	body := fmt.Sprintf(`
+	<html>
+	<body>
+		<h2>Account Temporarily Locked</h2>
+		<p>We detected several failed sign-in attempts on your account, so it has been locked until <strong>%s</strong>.</p>
+		<p>If this was you, wait until then and try again. If it wasn't, someone may be trying to guess your password; consider changing it or contact an administrator.</p>
+	</body>
+	</html>
+	`, until.Format("02 Jan 2006 15:04 MST"))
+
+	return es.send(to, subject, body)
+}
+
+// SendAlertEmail sends an outage alert or recovery notice. body is plain
+// text and is escaped before being wrapped in HTML.
+func (es *EmailService) SendAlertEmail(to, subject, body string) error {
+	html := fmt.Sprintf(`
+	<html>
+	<body>
+		<h2>%s</h2>
+		<pre style="font-family: inherit">%s</pre>
+	</body>
+	</html>
+	`, template.HTMLEscapeString(subject), template.HTMLEscapeString(body))
+
+	return es.send(to, subject, html)
+}
+
+func (es *EmailService) send(to, subject, body string) error {
 	// SMTP auth
 	auth := smtp.PlainAuth("", es.cfg.SMTPUsername, es.cfg.SMTPPassword, es.cfg.SMTPHost)
 
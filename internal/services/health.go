@@ -0,0 +1,236 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"sync"
+	"time"
+
+	"cctv-api/internal/events"
+	"cctv-api/internal/health"
+	"cctv-api/internal/models"
+)
+
+// HealthMonitor periodically probes every active camera's stream and keeps
+// the result on the camera row plus a history of every check. Status
+// changes are published as cctv.status_changed events.
+type HealthMonitor struct {
+	db          *sql.DB
+	prober      *health.Prober
+	bus         *events.Bus
+	concurrency int
+	retention   time.Duration
+}
+
+func NewHealthMonitor(db *sql.DB, prober *health.Prober, bus *events.Bus, concurrency int, retention time.Duration) *HealthMonitor {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &HealthMonitor{db: db, prober: prober, bus: bus, concurrency: concurrency, retention: retention}
+}
+
+type probeTarget struct {
+	id         int
+	sourceURL  string
+	sourceType string
+}
+
+// CheckAll probes every active camera, at most concurrency at a time, and
+// returns how many were checked. Playlists no camera led to during a full
+// pass are forgotten by the prober afterwards.
+func (hm *HealthMonitor) CheckAll(ctx context.Context) (int, error) {
+	start := time.Now()
+	rows, err := hm.db.QueryContext(ctx, `
+		SELECT id, source_url, source_type FROM cctvs
+		WHERE is_active = true
+		ORDER BY id
+	`)
+	if err != nil {
+		return 0, err
+	}
+	var targets []probeTarget
+	for rows.Next() {
+		var t probeTarget
+		if err := rows.Scan(&t.id, &t.sourceURL, &t.sourceType); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		targets = append(targets, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	sem := make(chan struct{}, hm.concurrency)
+	var wg sync.WaitGroup
+	for _, t := range targets {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return 0, ctx.Err()
+		case sem <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func(t probeTarget) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if _, err := hm.Check(ctx, t.id, t.sourceURL, t.sourceType); err != nil {
+				log.Printf("Failed to record health of CCTV %d: %v", t.id, err)
+			}
+		}(t)
+	}
+	wg.Wait()
+	hm.prober.ForgetUnseen(start)
+
+	return len(targets), nil
+}
+
+// Check probes one camera with the strategy for its source type and records
+// the result.
+func (hm *HealthMonitor) Check(ctx context.Context, cctvID int, sourceURL, sourceType string) (health.Result, error) {
+	result := hm.prober.Probe(ctx, sourceURL, sourceType)
+	return result, hm.record(cctvID, result)
+}
+
+func (hm *HealthMonitor) record(cctvID int, result health.Result) error {
+	change := models.CCTVStatusChange{CCTVID: cctvID, Status: result.Status, ChangedAt: result.CheckedAt}
+	var latencyMs interface{}
+	if result.Latency > 0 {
+		ms := int(result.Latency / time.Millisecond)
+		latencyMs = ms
+		change.LatencyMs = &ms
+	}
+	var detail interface{}
+	if result.Detail != "" {
+		detail = result.Detail
+		change.Detail = &result.Detail
+	}
+
+	tx, err := hm.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var previous sql.NullString
+	err = tx.QueryRow(`
+		SELECT name, location_id, health_status FROM cctvs WHERE id = $1 FOR UPDATE
+	`, cctvID).Scan(&change.Name, &change.LocationID, &previous)
+	if err != nil {
+		return err
+	}
+	change.PreviousStatus = "unknown"
+	if previous.Valid {
+		change.PreviousStatus = previous.String
+	}
+
+	_, err = tx.Exec(`
+		UPDATE cctvs SET
+			health_changed_at = CASE WHEN health_status IS DISTINCT FROM $1 THEN $4 ELSE health_changed_at END,
+			health_status = $1, health_latency_ms = $2, health_detail = $3, health_checked_at = $4
+		WHERE id = $5
+	`, result.Status, latencyMs, detail, result.CheckedAt, cctvID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO cctv_status_history (cctv_id, status, latency_ms, detail, checked_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, cctvID, result.Status, latencyMs, detail, result.CheckedAt)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if change.PreviousStatus != change.Status {
+		hm.bus.Publish(events.CCTVStatusChanged, change)
+	}
+	return nil
+}
+
+// History returns the checks recorded for a camera between from and to,
+// newest first.
+func (hm *HealthMonitor) History(cctvID int, from, to time.Time, limit int) ([]models.StatusHistoryEntry, error) {
+	rows, err := hm.db.Query(`
+		SELECT id, cctv_id, status, latency_ms, detail, checked_at
+		FROM cctv_status_history
+		WHERE cctv_id = $1 AND checked_at >= $2 AND checked_at < $3
+		ORDER BY checked_at DESC
+		LIMIT $4
+	`, cctvID, from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.StatusHistoryEntry{}
+	for rows.Next() {
+		var entry models.StatusHistoryEntry
+		var latencyMs sql.NullInt64
+		var detail sql.NullString
+		if err := rows.Scan(&entry.ID, &entry.CCTVID, &entry.Status, &latencyMs, &detail, &entry.CheckedAt); err != nil {
+			return nil, err
+		}
+		if latencyMs.Valid {
+			ms := int(latencyMs.Int64)
+			entry.LatencyMs = &ms
+		}
+		if detail.Valid {
+			entry.Detail = &detail.String
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// PruneHistory deletes checks older than the retention period.
+func (hm *HealthMonitor) PruneHistory() (int64, error) {
+	if hm.retention <= 0 {
+		return 0, nil
+	}
+	result, err := hm.db.Exec("DELETE FROM cctv_status_history WHERE checked_at < $1", time.Now().Add(-hm.retention))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// RunMonitor probes all cameras every interval until ctx is cancelled.
+func (hm *HealthMonitor) RunMonitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	lastPrune := time.Time{}
+	for {
+		started := time.Now()
+		checked, err := hm.CheckAll(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Stream health check failed: %v", err)
+		} else if checked > 0 {
+			log.Printf("Checked %d stream(s) in %s", checked, time.Since(started).Round(time.Millisecond))
+		}
+
+		if time.Since(lastPrune) > 24*time.Hour {
+			if pruned, err := hm.PruneHistory(); err != nil {
+				log.Printf("Failed to prune stream status history: %v", err)
+			} else if pruned > 0 {
+				log.Printf("Pruned %d stream status history row(s)", pruned)
+			}
+			lastPrune = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
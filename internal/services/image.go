@@ -0,0 +1,261 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"path"
+	"strconv"
+	"strings"
+
+	"cctv-api/internal/imaging"
+	"cctv-api/internal/storage"
+)
+
+var (
+	ErrInvalidImage  = errors.New("file is not a valid image")
+	ErrImageTooLarge = errors.New("image dimensions are too large")
+	ErrImageOwner    = errors.New("image owner not found")
+)
+
+// ImageSize is a stored size of an uploaded image.
+type ImageSize struct {
+	Width, Height int
+}
+
+// PhotoVariants are the square sizes profile photos are cropped to.
+var PhotoVariants = map[string]ImageSize{
+	"small":  {64, 64},
+	"medium": {256, 256},
+	"large":  {512, 512},
+}
+
+// ThumbnailVariants are the 16:9 sizes camera thumbnails are cropped to.
+var ThumbnailVariants = map[string]ImageSize{
+	"small":  {320, 180},
+	"medium": {640, 360},
+	"large":  {1280, 720},
+}
+
+const DefaultImageVariant = "medium"
+
+const imageJPEGQuality = 85
+
+// UploadImageTypes are the image types accepted for upload.
+var UploadImageTypes = []string{"image/jpeg", "image/png", "image/gif"}
+
+// imageKind says where one kind of uploaded image is kept: the storage
+// prefix, the table row that points at it and the API path serving it.
+type imageKind struct {
+	prefix    string
+	table     string
+	keyColumn string
+	urlColumn string
+	path      string
+	// Extra assignments when the image is removed
+	onRemove string
+	variants map[string]ImageSize
+}
+
+var (
+	photoImages = imageKind{
+		prefix:    "photos",
+		table:     "users",
+		keyColumn: "photo_key",
+		urlColumn: "photo_url",
+		path:      "/api/users/{id}/photo",
+		variants:  PhotoVariants,
+	}
+	thumbnailImages = imageKind{
+		prefix:    "thumbnails",
+		table:     "cctvs",
+		keyColumn: "thumbnail_key",
+		urlColumn: "thumbnail_url",
+		path:      "/api/cctvs/{id}/thumbnail",
+		// Forget the last snapshot so the next capture becomes the
+		// thumbnail again
+		onRemove: ", snapshot_hash = NULL",
+		variants: ThumbnailVariants,
+	}
+)
+
+// ImageService takes uploaded profile photos and camera thumbnails: it
+// checks them, turns them upright, crops them to standard sizes and
+// re-encodes them as JPEG, which drops EXIF and any other metadata. Files
+// of a replaced image are deleted.
+type ImageService struct {
+	db        *sql.DB
+	store     storage.Store
+	baseURL   string
+	maxBytes  int64
+	maxPixels int64
+}
+
+// NewImageService keeps images in store and points photo and thumbnail
+// URLs at baseURL, the public address of this API. Uploads may be at most
+// maxBytes long and maxPixels large.
+func NewImageService(db *sql.DB, store storage.Store, baseURL string, maxBytes int64, maxPixels int64) *ImageService {
+	return &ImageService{
+		db:        db,
+		store:     store,
+		baseURL:   strings.TrimSuffix(baseURL, "/"),
+		maxBytes:  maxBytes,
+		maxPixels: maxPixels,
+	}
+}
+
+// MaxBytes is the largest upload accepted.
+func (is *ImageService) MaxBytes() int64 {
+	return is.maxBytes
+}
+
+func imageVariantKey(key, variant string) string {
+	return key + "-" + variant + ".jpg"
+}
+
+func (is *ImageService) SetPhoto(ctx context.Context, userID int, data []byte) (string, error) {
+	return is.set(ctx, photoImages, userID, data)
+}
+
+func (is *ImageService) RemovePhoto(ctx context.Context, userID int) error {
+	return is.remove(ctx, photoImages, userID)
+}
+
+// OpenPhoto returns a size of the user's uploaded photo, or
+// storage.ErrNotFound when they have none.
+func (is *ImageService) OpenPhoto(ctx context.Context, userID int, variant string) (io.ReadCloser, *storage.Object, error) {
+	return is.open(ctx, photoImages, userID, variant)
+}
+
+func (is *ImageService) SetThumbnail(ctx context.Context, cctvID int, data []byte) (string, error) {
+	return is.set(ctx, thumbnailImages, cctvID, data)
+}
+
+func (is *ImageService) RemoveThumbnail(ctx context.Context, cctvID int) error {
+	return is.remove(ctx, thumbnailImages, cctvID)
+}
+
+// OpenThumbnail returns a size of the camera's uploaded thumbnail, or
+// storage.ErrNotFound when it has none.
+func (is *ImageService) OpenThumbnail(ctx context.Context, cctvID int, variant string) (io.ReadCloser, *storage.Object, error) {
+	return is.open(ctx, thumbnailImages, cctvID, variant)
+}
+
+// DiscardThumbnail deletes the files of a thumbnail no camera points at
+// any more, e.g. after the camera was deleted.
+func (is *ImageService) DiscardThumbnail(ctx context.Context, key string) {
+	is.discard(ctx, thumbnailImages, key)
+}
+
+// process checks an upload and returns its sizes as JPEG.
+func (is *ImageService) process(data []byte, variants map[string]ImageSize) (map[string][]byte, error) {
+	if _, _, err := storage.Check(data, is.maxBytes, UploadImageTypes...); err != nil {
+		return nil, err
+	}
+	config, _, err := imaging.DecodeConfig(data)
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	if int64(config.Width)*int64(config.Height) > is.maxPixels {
+		return nil, ErrImageTooLarge
+	}
+	img, _, err := imaging.Decode(data)
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	img = imaging.Orient(img, imaging.Orientation(data))
+
+	out := make(map[string][]byte, len(variants))
+	for variant, size := range variants {
+		jpg, err := imaging.EncodeJPEG(imaging.Fill(img, size.Width, size.Height), imageJPEGQuality)
+		if err != nil {
+			return nil, err
+		}
+		out[variant] = jpg
+	}
+	return out, nil
+}
+
+// set stores an uploaded image under a content-addressed key, points the
+// owner's row at it and deletes the image it replaces.
+func (is *ImageService) set(ctx context.Context, kind imageKind, id int, data []byte) (string, error) {
+	variants, err := is.process(data, kind.variants)
+	if err != nil {
+		return "", err
+	}
+
+	key := storage.ContentKey(kind.prefix+"/"+strconv.Itoa(id), data, "")
+	for variant, jpg := range variants {
+		if _, err := is.store.Put(ctx, imageVariantKey(key, variant), bytes.NewReader(jpg), "image/jpeg"); err != nil {
+			return "", err
+		}
+	}
+
+	// The version parameter changes with the image so that clients
+	// holding the old URL notice the update
+	url := is.baseURL + strings.Replace(kind.path, "{id}", strconv.Itoa(id), 1) + "?v=" + path.Base(key)[:12]
+
+	var old sql.NullString
+	err = is.db.QueryRowContext(ctx, `
+		UPDATE `+kind.table+` t SET `+kind.keyColumn+` = $1, `+kind.urlColumn+` = $2, updated_at = NOW()
+		FROM (SELECT id, `+kind.keyColumn+` AS key FROM `+kind.table+` WHERE id = $3 FOR UPDATE) old
+		WHERE t.id = old.id
+		RETURNING old.key
+	`, key, url, id).Scan(&old)
+	if err == sql.ErrNoRows {
+		is.discard(ctx, kind, key)
+		return "", ErrImageOwner
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if old.Valid && old.String != key {
+		is.discard(ctx, kind, old.String)
+	}
+	return url, nil
+}
+
+func (is *ImageService) remove(ctx context.Context, kind imageKind, id int) error {
+	var old sql.NullString
+	err := is.db.QueryRowContext(ctx, `
+		UPDATE `+kind.table+` t SET `+kind.keyColumn+` = NULL, `+kind.urlColumn+` = NULL, updated_at = NOW()`+kind.onRemove+`
+		FROM (SELECT id, `+kind.keyColumn+` AS key FROM `+kind.table+` WHERE id = $1 FOR UPDATE) old
+		WHERE t.id = old.id AND old.key IS NOT NULL
+		RETURNING old.key
+	`, id).Scan(&old)
+	if err == sql.ErrNoRows {
+		return storage.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	is.discard(ctx, kind, old.String)
+	return nil
+}
+
+func (is *ImageService) open(ctx context.Context, kind imageKind, id int, variant string) (io.ReadCloser, *storage.Object, error) {
+	var key sql.NullString
+	err := is.db.QueryRowContext(ctx, "SELECT "+kind.keyColumn+" FROM "+kind.table+" WHERE id = $1", id).Scan(&key)
+	if err == sql.ErrNoRows || (err == nil && !key.Valid) {
+		return nil, nil, storage.ErrNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return is.store.Get(ctx, imageVariantKey(key.String, variant))
+}
+
+// discard deletes the files of an image. Failures are only logged: the
+// image is no longer referenced either way.
+func (is *ImageService) discard(ctx context.Context, kind imageKind, key string) {
+	for variant := range kind.variants {
+		if err := is.store.Delete(ctx, imageVariantKey(key, variant)); err != nil {
+			log.Printf("Failed to delete %s: %v", imageVariantKey(key, variant), err)
+		}
+	}
+}
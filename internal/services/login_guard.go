@@ -0,0 +1,183 @@
+package services
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+
+	"cctv-api/internal/config"
+)
+
+// LoginGuard tracks failed logins per account and per IP. Every failure
+// delays the next attempt progressively, and a key is locked for a while
+// once it reaches its failure limit.
+type LoginGuard struct {
+	db            *sql.DB
+	maxFailures   int
+	ipMaxFailures int
+	lockDuration  time.Duration
+	failureWindow time.Duration
+	delayBase     time.Duration
+	delayMax      time.Duration
+}
+
+// LoginFailure is the outcome of recording a failed attempt.
+type LoginFailure struct {
+	Locked      bool // the key became locked by this failure
+	LockedUntil time.Time
+}
+
+func NewLoginGuard(db *sql.DB, cfg *config.Config) *LoginGuard {
+	return &LoginGuard{
+		db:            db,
+		maxFailures:   cfg.LoginMaxFailures,
+		ipMaxFailures: cfg.LoginIPMaxFailures,
+		lockDuration:  cfg.LoginLockDuration,
+		failureWindow: cfg.LoginFailureWindow,
+		delayBase:     cfg.LoginDelayBase,
+		delayMax:      cfg.LoginDelayMax,
+	}
+}
+
+func AccountKey(userID int) string {
+	return "user:" + strconv.Itoa(userID)
+}
+
+func LoginNameKey(login string) string {
+	return "name:" + login
+}
+
+func IPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// RetryAfter returns how long the caller must wait before another attempt
+// is accepted for any of the given keys, or zero if it may proceed.
+func (lg *LoginGuard) RetryAfter(keys ...string) (time.Duration, error) {
+	now := time.Now()
+	var wait time.Duration
+
+	for _, key := range keys {
+		var count int
+		var lastFailed, lockedUntil sql.NullTime
+		err := lg.db.QueryRow(`
+			SELECT failure_count, last_failed_at, locked_until
+			FROM login_failures WHERE key = $1
+		`, key).Scan(&count, &lastFailed, &lockedUntil)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		if lockedUntil.Valid && lockedUntil.Time.After(now) {
+			wait = maxDuration(wait, lockedUntil.Time.Sub(now))
+			continue
+		}
+		if lastFailed.Valid && now.Sub(lastFailed.Time) < lg.failureWindow {
+			next := lastFailed.Time.Add(lg.delay(count))
+			if next.After(now) {
+				wait = maxDuration(wait, next.Sub(now))
+			}
+		}
+	}
+
+	return wait, nil
+}
+
+// RecordFailure counts a failed attempt against key. isIP selects the
+// (higher) per-IP failure limit.
+func (lg *LoginGuard) RecordFailure(key string, isIP bool) (LoginFailure, error) {
+	limit := lg.maxFailures
+	if isIP {
+		limit = lg.ipMaxFailures
+	}
+
+	tx, err := lg.db.Begin()
+	if err != nil {
+		return LoginFailure{}, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`INSERT INTO login_failures (key) VALUES ($1) ON CONFLICT (key) DO NOTHING`, key); err != nil {
+		return LoginFailure{}, err
+	}
+
+	var count int
+	var lastFailed, lockedUntil sql.NullTime
+	err = tx.QueryRow(`
+		SELECT failure_count, last_failed_at, locked_until
+		FROM login_failures WHERE key = $1 FOR UPDATE
+	`, key).Scan(&count, &lastFailed, &lockedUntil)
+	if err != nil {
+		return LoginFailure{}, err
+	}
+
+	now := time.Now()
+	lockExpired := lockedUntil.Valid && !lockedUntil.Time.After(now)
+	if lockExpired || !lastFailed.Valid || now.Sub(lastFailed.Time) >= lg.failureWindow {
+		count = 0
+	}
+	count++
+
+	var result LoginFailure
+	newLockedUntil := sql.NullTime{}
+	if lockedUntil.Valid && !lockExpired {
+		newLockedUntil = lockedUntil
+	} else if count >= limit {
+		result.Locked = true
+		result.LockedUntil = now.Add(lg.lockDuration)
+		newLockedUntil = sql.NullTime{Time: result.LockedUntil, Valid: true}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE login_failures
+		SET failure_count = $1, last_failed_at = $2, locked_until = $3
+		WHERE key = $4
+	`, count, now, newLockedUntil, key)
+	if err != nil {
+		return LoginFailure{}, err
+	}
+
+	return result, tx.Commit()
+}
+
+// Reset clears the failure history of key, e.g. after a successful login or
+// when an admin unlocks an account. It reports whether the key was locked.
+func (lg *LoginGuard) Reset(key string) (bool, error) {
+	var lockedUntil sql.NullTime
+	err := lg.db.QueryRow(`
+		DELETE FROM login_failures WHERE key = $1 RETURNING locked_until
+	`, key).Scan(&lockedUntil)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return lockedUntil.Valid && lockedUntil.Time.After(time.Now()), nil
+}
+
+// delay is the wait imposed after count failures: nothing for the first
+// one, then doubling from delayBase up to delayMax.
+func (lg *LoginGuard) delay(count int) time.Duration {
+	if count <= 1 {
+		return 0
+	}
+	delay := lg.delayBase
+	for i := 2; i < count && delay < lg.delayMax; i++ {
+		delay *= 2
+	}
+	if delay > lg.delayMax {
+		delay = lg.delayMax
+	}
+	return delay
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"cctv-api/internal/config"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var loginFailureColumns = []string{"failure_count", "last_failed_at", "locked_until"}
+
+func newTestLoginGuard(db *sql.DB) *LoginGuard {
+	return NewLoginGuard(db, &config.Config{
+		LoginMaxFailures:   3,
+		LoginIPMaxFailures: 10,
+		LoginLockDuration:  15 * time.Minute,
+		LoginFailureWindow: time.Hour,
+		LoginDelayBase:     time.Second,
+		LoginDelayMax:      30 * time.Second,
+	})
+}
+
+func TestLoginGuardDelay(t *testing.T) {
+	guard := newTestLoginGuard(nil)
+
+	tests := []struct {
+		count int
+		want  time.Duration
+	}{
+		{0, 0},
+		{1, 0},
+		{2, time.Second},
+		{3, 2 * time.Second},
+		{5, 8 * time.Second},
+		{6, 16 * time.Second},
+		{7, 30 * time.Second},
+		{50, 30 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := guard.delay(tt.count); got != tt.want {
+			t.Errorf("delay(%d) = %v, want %v", tt.count, got, tt.want)
+		}
+	}
+}
+
+func TestLoginGuardRetryAfter(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		rows    *sqlmock.Rows // nil = no failures recorded
+		wantMin time.Duration
+		wantMax time.Duration
+	}{
+		{"unknown key", nil, 0, 0},
+		{"locked", sqlmock.NewRows(loginFailureColumns).AddRow(3, now, now.Add(10*time.Minute)),
+			9 * time.Minute, 10 * time.Minute},
+		{"lock expired", sqlmock.NewRows(loginFailureColumns).AddRow(3, now.Add(-20*time.Minute), now.Add(-5*time.Minute)), 0, 0},
+		{"first failure", sqlmock.NewRows(loginFailureColumns).AddRow(1, now, nil), 0, 0},
+		{"recent failures delay", sqlmock.NewRows(loginFailureColumns).AddRow(3, now, nil),
+			time.Second, 2 * time.Second},
+		{"delay served", sqlmock.NewRows(loginFailureColumns).AddRow(3, now.Add(-5*time.Second), nil), 0, 0},
+		{"outside window", sqlmock.NewRows(loginFailureColumns).AddRow(30, now.Add(-2*time.Hour), nil), 0, 0},
+	}
+
+	for _, tt := range tests {
+		db, mock := newMockDB(t)
+		query := mock.ExpectQuery(`FROM login_failures WHERE key = \$1`).WithArgs("user:7")
+		if tt.rows == nil {
+			query.WillReturnError(sql.ErrNoRows)
+		} else {
+			query.WillReturnRows(tt.rows)
+		}
+
+		got, err := newTestLoginGuard(db).RetryAfter("user:7")
+		if err != nil {
+			t.Errorf("%s: RetryAfter() error: %v", tt.name, err)
+			continue
+		}
+		if got < tt.wantMin || got > tt.wantMax {
+			t.Errorf("%s: RetryAfter() = %v, want between %v and %v", tt.name, got, tt.wantMin, tt.wantMax)
+		}
+	}
+}
+
+func TestLoginGuardRetryAfterLongestWait(t *testing.T) {
+	db, mock := newMockDB(t)
+	now := time.Now()
+	mock.ExpectQuery(`FROM login_failures`).WithArgs("user:7").
+		WillReturnRows(sqlmock.NewRows(loginFailureColumns).AddRow(2, now, nil))
+	mock.ExpectQuery(`FROM login_failures`).WithArgs("ip:203.0.113.7").
+		WillReturnRows(sqlmock.NewRows(loginFailureColumns).AddRow(10, now, now.Add(15*time.Minute)))
+
+	got, err := newTestLoginGuard(db).RetryAfter("user:7", "ip:203.0.113.7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got < 14*time.Minute {
+		t.Errorf("RetryAfter() = %v, want the IP's lock of about 15m", got)
+	}
+}
+
+func TestLoginGuardRecordFailure(t *testing.T) {
+	now := time.Now()
+	lockedUntil := now.Add(5 * time.Minute)
+
+	tests := []struct {
+		name       string
+		isIP       bool
+		rows       *sqlmock.Rows
+		wantCount  int
+		wantLocked bool
+		wantLock   bool // locked_until is stored
+	}{
+		{"first failure", false, sqlmock.NewRows(loginFailureColumns).AddRow(0, nil, nil), 1, false, false},
+		{"below limit", false, sqlmock.NewRows(loginFailureColumns).AddRow(1, now.Add(-time.Minute), nil), 2, false, false},
+		{"reaches limit", false, sqlmock.NewRows(loginFailureColumns).AddRow(2, now.Add(-time.Minute), nil), 3, true, true},
+		{"IP below its higher limit", true, sqlmock.NewRows(loginFailureColumns).AddRow(2, now.Add(-time.Minute), nil), 3, false, false},
+		{"window passed", false, sqlmock.NewRows(loginFailureColumns).AddRow(2, now.Add(-2*time.Hour), nil), 1, false, false},
+		{"lock expired", false, sqlmock.NewRows(loginFailureColumns).AddRow(3, now.Add(-20*time.Minute), now.Add(-5*time.Minute)), 1, false, false},
+		{"already locked", false, sqlmock.NewRows(loginFailureColumns).AddRow(3, now.Add(-time.Minute), lockedUntil), 4, false, true},
+	}
+
+	for _, tt := range tests {
+		db, mock := newMockDB(t)
+		mock.ExpectBegin()
+		mock.ExpectExec(`INSERT INTO login_failures`).WithArgs("user:7").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(`FOR UPDATE`).WithArgs("user:7").WillReturnRows(tt.rows)
+		mock.ExpectExec(`UPDATE login_failures`).
+			WithArgs(tt.wantCount, sqlmock.AnyArg(), lockArg{tt.wantLock}, "user:7").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		got, err := newTestLoginGuard(db).RecordFailure("user:7", tt.isIP)
+		if err != nil {
+			t.Errorf("%s: RecordFailure() error: %v", tt.name, err)
+			continue
+		}
+		if got.Locked != tt.wantLocked {
+			t.Errorf("%s: RecordFailure() locked = %v, want %v", tt.name, got.Locked, tt.wantLocked)
+		}
+		if tt.wantLocked && got.LockedUntil.Sub(now) < 14*time.Minute {
+			t.Errorf("%s: locked until %v, want about 15m from now", tt.name, got.LockedUntil)
+		}
+	}
+}
+
+// lockArg matches the stored locked_until: set or NULL.
+type lockArg struct{ set bool }
+
+func (a lockArg) Match(v driver.Value) bool {
+	_, isTime := v.(time.Time)
+	return isTime == a.set
+}
+
+func TestLoginGuardReset(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name       string
+		rows       *sqlmock.Rows // nil = no failures recorded
+		wantLocked bool
+	}{
+		{"unknown key", nil, false},
+		{"failures only", sqlmock.NewRows([]string{"locked_until"}).AddRow(nil), false},
+		{"locked", sqlmock.NewRows([]string{"locked_until"}).AddRow(now.Add(time.Minute)), true},
+		{"lock expired", sqlmock.NewRows([]string{"locked_until"}).AddRow(now.Add(-time.Minute)), false},
+	}
+
+	for _, tt := range tests {
+		db, mock := newMockDB(t)
+		query := mock.ExpectQuery(`DELETE FROM login_failures WHERE key = \$1`).WithArgs("user:7")
+		if tt.rows == nil {
+			query.WillReturnError(sql.ErrNoRows)
+		} else {
+			query.WillReturnRows(tt.rows)
+		}
+
+		locked, err := newTestLoginGuard(db).Reset("user:7")
+		if err != nil || locked != tt.wantLocked {
+			t.Errorf("%s: Reset() = %v, %v; want %v", tt.name, locked, err, tt.wantLocked)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"cctv-api/internal/models"
+)
+
+var ErrNotificationNotFound = errors.New("notification not found")
+
+// NotificationService stores in-app notifications shown to users.
+type NotificationService struct {
+	db *sql.DB
+}
+
+func NewNotificationService(db *sql.DB) *NotificationService {
+	return &NotificationService{db: db}
+}
+
+// Notify queues a notification for the user. q lets the notification commit
+// together with the change it describes.
+func (ns *NotificationService) Notify(q Queryer, userID int, notificationType, title, message string, data map[string]interface{}) error {
+	var raw interface{}
+	if data != nil {
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		raw = string(encoded)
+	}
+
+	_, err := q.Exec(`
+		INSERT INTO user_notifications (user_id, type, title, message, data)
+		VALUES ($1, $2, $3, $4, $5)
+	`, userID, notificationType, title, message, raw)
+	return err
+}
+
+func (ns *NotificationService) List(userID int, unreadOnly bool, limit int) ([]models.Notification, error) {
+	query := `
+		SELECT id, user_id, type, title, message, data, read_at, created_at
+		FROM user_notifications
+		WHERE user_id = $1
+	`
+	if unreadOnly {
+		query += " AND read_at IS NULL"
+	}
+	query += " ORDER BY created_at DESC, id DESC LIMIT $2"
+
+	rows, err := ns.db.Query(query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []models.Notification{}
+	for rows.Next() {
+		var n models.Notification
+		var data []byte
+		var readAt sql.NullTime
+		if err := rows.Scan(&n.ID, &n.UserID, &n.Type, &n.Title, &n.Message, &data, &readAt, &n.CreatedAt); err != nil {
+			return nil, err
+		}
+		if data != nil {
+			_ = json.Unmarshal(data, &n.Data)
+		}
+		if readAt.Valid {
+			n.ReadAt = &readAt.Time
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+func (ns *NotificationService) UnreadCount(userID int) (int, error) {
+	var count int
+	err := ns.db.QueryRow("SELECT COUNT(*) FROM user_notifications WHERE user_id = $1 AND read_at IS NULL", userID).Scan(&count)
+	return count, err
+}
+
+func (ns *NotificationService) MarkRead(userID int, id int64) error {
+	result, err := ns.db.Exec(`
+		UPDATE user_notifications SET read_at = COALESCE(read_at, NOW())
+		WHERE id = $1 AND user_id = $2
+	`, id, userID)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return ErrNotificationNotFound
+	}
+	return nil
+}
+
+func (ns *NotificationService) MarkAllRead(userID int) error {
+	_, err := ns.db.Exec("UPDATE user_notifications SET read_at = NOW() WHERE user_id = $1 AND read_at IS NULL", userID)
+	return err
+}
@@ -0,0 +1,365 @@
+package services
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"cctv-api/internal/events"
+	"cctv-api/internal/models"
+	"cctv-api/internal/payments"
+)
+
+var (
+	ErrOrderNotFound      = errors.New("order not found")
+	ErrOrderNotPending    = errors.New("order is not pending")
+	ErrPlanNotPurchasable = errors.New("plan cannot be purchased")
+)
+
+// PaymentService turns plan purchases into orders and applies the
+// provider's webhook notifications to them. Accounts are only upgraded when
+// a verified settlement arrives.
+type PaymentService struct {
+	db       *sql.DB
+	provider payments.Provider
+	plans    *PlanService
+	audit    *AuditService
+	bus      *events.Bus
+}
+
+func NewPaymentService(db *sql.DB, provider payments.Provider, plans *PlanService, audit *AuditService, bus *events.Bus) *PaymentService {
+	return &PaymentService{db: db, provider: provider, plans: plans, audit: audit, bus: bus}
+}
+
+func (ps *PaymentService) Provider() payments.Provider {
+	return ps.provider
+}
+
+const orderColumns = `
+	o.id, o.reference, o.user_id, o.plan_id, p.name, o.amount, o.currency, o.status, o.provider,
+	o.checkout_url, o.subscription_id, o.paid_at, o.created_at, o.updated_at
+`
+
+func scanOrder(row interface{ Scan(...interface{}) error }, order *models.Order) error {
+	var checkoutURL sql.NullString
+	var subscriptionID sql.NullInt64
+	var paidAt sql.NullTime
+	err := row.Scan(&order.ID, &order.Reference, &order.UserID, &order.PlanID, &order.PlanName,
+		&order.Amount, &order.Currency, &order.Status, &order.Provider,
+		&checkoutURL, &subscriptionID, &paidAt, &order.CreatedAt, &order.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	if checkoutURL.Valid {
+		order.CheckoutURL = &checkoutURL.String
+	}
+	if subscriptionID.Valid {
+		id := int(subscriptionID.Int64)
+		order.SubscriptionID = &id
+	}
+	if paidAt.Valid {
+		order.PaidAt = &paidAt.Time
+	}
+	return nil
+}
+
+// CreateOrder opens a pending order for the plan and registers it with the
+// payment provider.
+func (ps *PaymentService) CreateOrder(userID int, planName string) (*models.Order, error) {
+	plan, err := ps.plans.GetPlanByName(ps.db, planName)
+	if err != nil {
+		return nil, err
+	}
+	if !plan.IsActive || plan.IsDefault || plan.Price <= 0 {
+		return nil, ErrPlanNotPurchasable
+	}
+
+	var email string
+	if err := ps.db.QueryRow("SELECT email FROM users WHERE id = $1", userID).Scan(&email); err != nil {
+		return nil, err
+	}
+
+	reference, err := newOrderReference()
+	if err != nil {
+		return nil, err
+	}
+
+	checkout, err := ps.provider.CreateCheckout(payments.CheckoutRequest{
+		Reference:   reference,
+		Amount:      plan.Price,
+		Currency:    plan.Currency,
+		Description: "Upgrade to " + plan.Name,
+		Email:       email,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create checkout: %w", err)
+	}
+
+	var id int
+	err = ps.db.QueryRow(`
+		INSERT INTO orders (reference, user_id, plan_id, amount, currency, provider, provider_ref, checkout_url)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id
+	`, reference, userID, plan.ID, plan.Price, plan.Currency, ps.provider.Name(),
+		checkout.ProviderRef, checkout.URL).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+
+	return ps.GetOrder(reference)
+}
+
+func (ps *PaymentService) GetOrder(reference string) (*models.Order, error) {
+	var order models.Order
+	err := scanOrder(ps.db.QueryRow(`
+		SELECT `+orderColumns+`
+		FROM orders o JOIN plans p ON p.id = o.plan_id
+		WHERE o.reference = $1
+	`, reference), &order)
+	if err == sql.ErrNoRows {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+func (ps *PaymentService) ListOrders(userID int) ([]models.Order, error) {
+	rows, err := ps.db.Query(`
+		SELECT `+orderColumns+`
+		FROM orders o JOIN plans p ON p.id = o.plan_id
+		WHERE o.user_id = $1
+		ORDER BY o.created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders := []models.Order{}
+	for rows.Next() {
+		var order models.Order
+		if err := scanOrder(rows, &order); err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+	return orders, rows.Err()
+}
+
+// CancelOrder lets a user abandon one of their own pending orders.
+func (ps *PaymentService) CancelOrder(userID int, reference string) error {
+	result, err := ps.db.Exec(`
+		UPDATE orders SET status = 'cancelled', updated_at = NOW()
+		WHERE reference = $1 AND user_id = $2 AND status = 'pending'
+	`, reference, userID)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		var status string
+		err := ps.db.QueryRow("SELECT status FROM orders WHERE reference = $1 AND user_id = $2", reference, userID).Scan(&status)
+		if err == sql.ErrNoRows {
+			return ErrOrderNotFound
+		}
+		if err != nil {
+			return err
+		}
+		return ErrOrderNotPending
+	}
+	return nil
+}
+
+// HandleNotification applies a verified webhook. Each provider event is
+// applied at most once, and order transitions only move forward, so
+// redelivered or out-of-order callbacks are harmless.
+func (ps *PaymentService) HandleNotification(n *payments.Notification) error {
+	tx, err := ps.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO payment_events (provider, event_id, order_reference, status, payload)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (provider, event_id) DO NOTHING
+	`, ps.provider.Name(), n.EventID, n.Reference, n.Status, string(n.Payload))
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return nil // already processed
+	}
+
+	var order models.Order
+	err = scanOrder(tx.QueryRow(`
+		SELECT `+orderColumns+`
+		FROM orders o JOIN plans p ON p.id = o.plan_id
+		WHERE o.reference = $1
+		FOR UPDATE OF o
+	`, n.Reference), &order)
+	if err == sql.ErrNoRows {
+		return ErrOrderNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	var auditAction string
+	var upgraded *models.Subscription
+	switch n.Status {
+	case payments.StatusSettlement:
+		if order.Status != "pending" && order.Status != "cancelled" &&
+			order.Status != "expired" && order.Status != "failed" {
+			break
+		}
+		// Money that does not match the order, or that arrives for an order
+		// already abandoned, has to go back rather than buy a plan. The
+		// callback is still acknowledged so the provider stops retrying.
+		mismatch := n.Amount != order.Amount ||
+			(n.Currency != "" && !strings.EqualFold(n.Currency, order.Currency))
+		if mismatch {
+			log.Printf("Payment for order %s does not match: got %d %s, want %d %s",
+				order.Reference, n.Amount, n.Currency, order.Amount, order.Currency)
+		}
+		if mismatch || order.Status != "pending" {
+			_, err = tx.Exec("UPDATE orders SET status = 'refund_required', updated_at = NOW() WHERE id = $1", order.ID)
+			if err != nil {
+				return err
+			}
+			auditAction = "order.refund_required"
+			break
+		}
+
+		sub, err := ps.plans.Subscribe(tx, order.UserID, order.PlanID, nil, "payment")
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`
+			UPDATE orders SET status = 'paid', paid_at = NOW(), subscription_id = $1, updated_at = NOW()
+			WHERE id = $2
+		`, sub.ID, order.ID)
+		if err != nil {
+			return err
+		}
+		auditAction = "user.upgraded"
+		upgraded = sub
+
+	case payments.StatusPartialRefund:
+		// Part of the money went back; access stays as it was
+		if order.Status != "paid" {
+			break
+		}
+		_, err = tx.Exec("UPDATE orders SET status = 'partially_refunded', updated_at = NOW() WHERE id = $1", order.ID)
+		if err != nil {
+			return err
+		}
+		auditAction = "order.partially_refunded"
+
+	case payments.StatusRefund:
+		if order.Status != "paid" && order.Status != "partially_refunded" && order.Status != "refund_required" {
+			break
+		}
+		_, err = tx.Exec("UPDATE orders SET status = 'refunded', updated_at = NOW() WHERE id = $1", order.ID)
+		if err != nil {
+			return err
+		}
+		if order.SubscriptionID != nil {
+			if err := ps.revokeOrderTime(tx, &order); err != nil {
+				return err
+			}
+		}
+		auditAction = "order.refunded"
+
+	case payments.StatusCancel, payments.StatusExpire, payments.StatusDeny:
+		if order.Status != "pending" {
+			break
+		}
+		status := map[string]string{
+			payments.StatusCancel: "cancelled",
+			payments.StatusExpire: "expired",
+			payments.StatusDeny:   "failed",
+		}[n.Status]
+		_, err = tx.Exec("UPDATE orders SET status = $1, updated_at = NOW() WHERE id = $2", status, order.ID)
+		if err != nil {
+			return err
+		}
+		auditAction = "order." + status
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if auditAction != "" {
+		ps.audit.Record(models.AuditLog{
+			UserID: &order.UserID,
+			Action: auditAction,
+			Details: map[string]interface{}{
+				"orderReference": order.Reference,
+				"planId":         order.PlanID,
+				"amount":         order.Amount,
+				"eventId":        n.EventID,
+			},
+		})
+		log.Printf("Order %s: %s", order.Reference, auditAction)
+	}
+
+	if upgraded != nil {
+		PublishUpgrade(ps.bus, upgraded)
+	}
+
+	return nil
+}
+
+// revokeOrderTime takes the time a refunded order bought off the
+// subscription it backs. Renewals stack onto one subscription, so only the
+// refunded order's share is removed; the subscription ends when nothing is
+// left, or when the order bought a plan without expiry.
+func (ps *PaymentService) revokeOrderTime(tx *sql.Tx, order *models.Order) error {
+	var expiresAt sql.NullTime
+	err := tx.QueryRow(`
+		SELECT expires_at FROM subscriptions
+		WHERE id = $1 AND status = 'active'
+		FOR UPDATE
+	`, *order.SubscriptionID).Scan(&expiresAt)
+	if err == sql.ErrNoRows {
+		return nil // the order no longer backs the live subscription
+	}
+	if err != nil {
+		return err
+	}
+
+	plan, err := ps.plans.GetPlan(tx, order.PlanID)
+	if err != nil {
+		return err
+	}
+	if !expiresAt.Valid || plan.DurationDays == nil {
+		return ps.plans.EndSubscription(tx, order.UserID, "cancelled")
+	}
+
+	remaining := expiresAt.Time.Add(-time.Duration(*plan.DurationDays) * 24 * time.Hour)
+	if !remaining.After(time.Now()) {
+		return ps.plans.EndSubscription(tx, order.UserID, "cancelled")
+	}
+	_, err = tx.Exec(`
+		UPDATE subscriptions SET expires_at = $1, updated_at = NOW()
+		WHERE id = $2
+	`, remaining, *order.SubscriptionID)
+	return err
+}
+
+func newOrderReference() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "ORD-" + time.Now().Format("20060102") + "-" + strings.ToUpper(hex.EncodeToString(b)), nil
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"cctv-api/internal/events"
+	"cctv-api/internal/payments"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var orderColumnNames = []string{"id", "reference", "user_id", "plan_id", "name", "amount", "currency", "status", "provider",
+	"checkout_url", "subscription_id", "paid_at", "created_at", "updated_at"}
+
+// orderRow is order ORD-1 of user 7 for 150000 IDR of the 30-day "pro"
+// plan (ID 2), backing subscription 40 once paid.
+func orderRow(status string) *sqlmock.Rows {
+	now := time.Now()
+	var subscriptionID interface{}
+	if status != "pending" && status != "cancelled" {
+		subscriptionID = 40
+	}
+	return sqlmock.NewRows(orderColumnNames).
+		AddRow(5, "ORD-1", 7, 2, "pro", 150000, "IDR", status, "fake", nil, subscriptionID, nil, now, now)
+}
+
+func TestPaymentServiceHandleNotification(t *testing.T) {
+	expectOrderStatus := func(mock sqlmock.Sqlmock, status string) {
+		mock.ExpectExec(`UPDATE orders SET status = '` + status + `'`).WithArgs(5).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	expectSubscriptionEnded := func(mock sqlmock.Sqlmock) {
+		mock.ExpectExec(`UPDATE subscriptions SET status = \$1`).WithArgs("cancelled", 7).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(`FROM plans p WHERE p.is_default`).WillReturnRows(planRow(1, "free", 1, nil))
+		mock.ExpectExec(`UPDATE users SET account_status`).WithArgs("free", 7).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	expectActiveUntil := func(mock sqlmock.Sqlmock, expiresAt time.Time) {
+		mock.ExpectQuery(`SELECT expires_at FROM subscriptions`).WithArgs(40).
+			WillReturnRows(sqlmock.NewRows([]string{"expires_at"}).AddRow(expiresAt))
+		mock.ExpectQuery(`FROM plans p WHERE p.id = \$1`).WithArgs(2).WillReturnRows(planRow(2, "pro", 2, 30))
+	}
+
+	tests := []struct {
+		name        string
+		status      string // order status before the callback
+		n           payments.Notification
+		expect      func(mock sqlmock.Sqlmock)
+		wantAudit   string
+		wantUpgrade bool
+	}{
+		{
+			name:   "settlement upgrades",
+			status: "pending",
+			n:      payments.Notification{Status: payments.StatusSettlement, Amount: 150000, Currency: "IDR"},
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM plans p WHERE p.id = \$1`).WithArgs(2).WillReturnRows(planRow(2, "pro", 2, 30))
+				mock.ExpectQuery(`SELECT id, plan_id, expires_at FROM subscriptions`).WithArgs(7).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "plan_id", "expires_at"}))
+				mock.ExpectQuery(`INSERT INTO subscriptions`).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "starts_at", "created_at"}).AddRow(40, time.Now(), time.Now()))
+				mock.ExpectExec(`UPDATE users SET account_status`).WithArgs("pro", 7).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE orders SET status = 'paid'`).WithArgs(40, 5).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			wantAudit:   "user.upgraded",
+			wantUpgrade: true,
+		},
+		{
+			name:      "amount mismatch",
+			status:    "pending",
+			n:         payments.Notification{Status: payments.StatusSettlement, Amount: 1500, Currency: "IDR"},
+			expect:    func(mock sqlmock.Sqlmock) { expectOrderStatus(mock, "refund_required") },
+			wantAudit: "order.refund_required",
+		},
+		{
+			name:      "currency mismatch",
+			status:    "pending",
+			n:         payments.Notification{Status: payments.StatusSettlement, Amount: 150000, Currency: "USD"},
+			expect:    func(mock sqlmock.Sqlmock) { expectOrderStatus(mock, "refund_required") },
+			wantAudit: "order.refund_required",
+		},
+		{
+			name:      "settlement of an abandoned order",
+			status:    "cancelled",
+			n:         payments.Notification{Status: payments.StatusSettlement, Amount: 150000},
+			expect:    func(mock sqlmock.Sqlmock) { expectOrderStatus(mock, "refund_required") },
+			wantAudit: "order.refund_required",
+		},
+		{
+			name:   "refund of a renewal keeps the earlier time",
+			status: "paid",
+			n:      payments.Notification{Status: payments.StatusRefund, Amount: 150000},
+			expect: func(mock sqlmock.Sqlmock) {
+				expectOrderStatus(mock, "refunded")
+				expectActiveUntil(mock, time.Now().Add(50*24*time.Hour))
+				mock.ExpectExec(`UPDATE subscriptions SET expires_at = \$1`).WithArgs(sqlmock.AnyArg(), 40).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			wantAudit: "order.refunded",
+		},
+		{
+			name:   "refund of the only order ends the subscription",
+			status: "paid",
+			n:      payments.Notification{Status: payments.StatusRefund, Amount: 150000},
+			expect: func(mock sqlmock.Sqlmock) {
+				expectOrderStatus(mock, "refunded")
+				expectActiveUntil(mock, time.Now().Add(20*24*time.Hour))
+				expectSubscriptionEnded(mock)
+			},
+			wantAudit: "order.refunded",
+		},
+		{
+			name:   "refund after the subscription moved on",
+			status: "paid",
+			n:      payments.Notification{Status: payments.StatusRefund, Amount: 150000},
+			expect: func(mock sqlmock.Sqlmock) {
+				expectOrderStatus(mock, "refunded")
+				mock.ExpectQuery(`SELECT expires_at FROM subscriptions`).WithArgs(40).
+					WillReturnRows(sqlmock.NewRows([]string{"expires_at"}))
+			},
+			wantAudit: "order.refunded",
+		},
+		{
+			name:   "late cancel ignored",
+			status: "paid",
+			n:      payments.Notification{Status: payments.StatusCancel},
+			expect: func(mock sqlmock.Sqlmock) {},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			n := tt.n
+			n.EventID, n.Reference = "evt-1", "ORD-1"
+
+			mock.ExpectBegin()
+			mock.ExpectExec(`INSERT INTO payment_events`).WithArgs("fake", "evt-1", "ORD-1", n.Status, "").
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectQuery(`FOR UPDATE OF o`).WithArgs("ORD-1").WillReturnRows(orderRow(tt.status))
+			tt.expect(mock)
+			mock.ExpectCommit()
+			if tt.wantAudit != "" {
+				mock.ExpectExec(`INSERT INTO audit_logs`).WithArgs(nil, 7, tt.wantAudit, nil, sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			}
+
+			bus := events.NewBus()
+			upgraded := false
+			bus.Subscribe(func(e events.Event) { upgraded = upgraded || e.Type == events.UserUpgraded })
+
+			ps := NewPaymentService(db, payments.NewFakeProvider("secret", ""), NewPlanService(db), NewAuditService(db), bus)
+			if err := ps.HandleNotification(&n); err != nil {
+				t.Fatalf("HandleNotification() error: %v", err)
+			}
+			if upgraded != tt.wantUpgrade {
+				t.Errorf("user.upgraded published = %v, want %v", upgraded, tt.wantUpgrade)
+			}
+		})
+	}
+}
+
+func TestPaymentServiceHandleNotificationOnce(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO payment_events`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	ps := NewPaymentService(db, payments.NewFakeProvider("secret", ""), NewPlanService(db), NewAuditService(db), events.NewBus())
+	n := &payments.Notification{EventID: "evt-1", Reference: "ORD-1", Status: payments.StatusSettlement, Amount: 150000}
+	if err := ps.HandleNotification(n); err != nil {
+		t.Errorf("HandleNotification(redelivered) = %v, want nil", err)
+	}
+}
@@ -0,0 +1,315 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"cctv-api/internal/events"
+	"cctv-api/internal/models"
+)
+
+var ErrPlanNotFound = errors.New("plan not found")
+
+// Queryer is satisfied by both *sql.DB and *sql.Tx so that plan changes can
+// take part in a caller's transaction.
+type Queryer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+type PlanService struct {
+	db *sql.DB
+}
+
+func NewPlanService(db *sql.DB) *PlanService {
+	return &PlanService{db: db}
+}
+
+const planColumns = `
+	p.id, p.name, p.camera_quota, p.device_limit, p.concurrent_sessions, p.can_export, p.max_stream_quality, p.price, p.currency,
+	p.duration_days, p.is_default, p.is_active, p.created_at, p.updated_at
+`
+
+func scanPlan(row interface{ Scan(...interface{}) error }, plan *models.Plan) error {
+	var cameraQuota, durationDays sql.NullInt64
+	err := row.Scan(&plan.ID, &plan.Name, &cameraQuota, &plan.DeviceLimit, &plan.ConcurrentSessions, &plan.CanExport,
+		&plan.MaxStreamQuality, &plan.Price, &plan.Currency, &durationDays, &plan.IsDefault, &plan.IsActive,
+		&plan.CreatedAt, &plan.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	if cameraQuota.Valid {
+		quota := int(cameraQuota.Int64)
+		plan.CameraQuota = &quota
+	}
+	if durationDays.Valid {
+		days := int(durationDays.Int64)
+		plan.DurationDays = &days
+	}
+	return nil
+}
+
+func (ps *PlanService) ListPlans(includeInactive bool) ([]models.Plan, error) {
+	query := "SELECT " + planColumns + " FROM plans p"
+	if !includeInactive {
+		query += " WHERE p.is_active = true"
+	}
+	query += " ORDER BY p.price ASC, p.name ASC"
+
+	rows, err := ps.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	plans := []models.Plan{}
+	for rows.Next() {
+		var plan models.Plan
+		if err := scanPlan(rows, &plan); err != nil {
+			return nil, err
+		}
+		plans = append(plans, plan)
+	}
+	return plans, rows.Err()
+}
+
+func (ps *PlanService) GetPlan(q Queryer, planID int) (*models.Plan, error) {
+	var plan models.Plan
+	err := scanPlan(q.QueryRow("SELECT "+planColumns+" FROM plans p WHERE p.id = $1", planID), &plan)
+	if err == sql.ErrNoRows {
+		return nil, ErrPlanNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+func (ps *PlanService) GetPlanByName(q Queryer, name string) (*models.Plan, error) {
+	var plan models.Plan
+	err := scanPlan(q.QueryRow("SELECT "+planColumns+" FROM plans p WHERE p.name = $1", name), &plan)
+	if err == sql.ErrNoRows {
+		return nil, ErrPlanNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+func (ps *PlanService) DefaultPlan(q Queryer) (*models.Plan, error) {
+	var plan models.Plan
+	err := scanPlan(q.QueryRow("SELECT "+planColumns+" FROM plans p WHERE p.is_default = true"), &plan)
+	if err == sql.ErrNoRows {
+		return nil, ErrPlanNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+// UserPlan returns the plan that currently applies to the user together with
+// the subscription granting it. Users without a live subscription get the
+// default plan and a nil subscription.
+func (ps *PlanService) UserPlan(userID int) (*models.Plan, *models.Subscription, error) {
+	return ps.UserPlanIn(ps.db, userID)
+}
+
+// UserPlanIn is UserPlan read through q, so that a transaction decides on
+// the same rows it goes on to change.
+func (ps *PlanService) UserPlanIn(q Queryer, userID int) (*models.Plan, *models.Subscription, error) {
+	var sub models.Subscription
+	var expiresAt sql.NullTime
+	err := q.QueryRow(`
+		SELECT id, user_id, plan_id, status, source, starts_at, expires_at, created_at
+		FROM subscriptions
+		WHERE user_id = $1 AND status = 'active'
+			AND starts_at <= NOW() AND (expires_at IS NULL OR expires_at > NOW())
+	`, userID).Scan(&sub.ID, &sub.UserID, &sub.PlanID, &sub.Status, &sub.Source,
+		&sub.StartsAt, &expiresAt, &sub.CreatedAt)
+	if err == sql.ErrNoRows {
+		plan, err := ps.DefaultPlan(q)
+		return plan, nil, err
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if expiresAt.Valid {
+		sub.ExpiresAt = &expiresAt.Time
+	}
+
+	plan, err := ps.GetPlan(q, sub.PlanID)
+	if err != nil {
+		return nil, nil, err
+	}
+	sub.Plan = plan
+	return plan, &sub, nil
+}
+
+// Subscribe puts the user on planID for duration (nil = the plan's own
+// duration, or no expiry if the plan has none). Renewing the plan the user
+// already holds extends the current subscription; switching plans ends it.
+func (ps *PlanService) Subscribe(q Queryer, userID, planID int, duration *time.Duration, source string) (*models.Subscription, error) {
+	plan, err := ps.GetPlan(q, planID)
+	if err != nil {
+		return nil, err
+	}
+
+	if duration == nil && plan.DurationDays != nil {
+		d := time.Duration(*plan.DurationDays) * 24 * time.Hour
+		duration = &d
+	}
+
+	var currentID, currentPlanID int
+	var currentExpiry sql.NullTime
+	err = q.QueryRow(`
+		SELECT id, plan_id, expires_at FROM subscriptions
+		WHERE user_id = $1 AND status = 'active'
+		FOR UPDATE
+	`, userID).Scan(&currentID, &currentPlanID, &currentExpiry)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	hasCurrent := err == nil
+
+	now := time.Now()
+	sub := models.Subscription{UserID: userID, PlanID: planID, Plan: plan, Status: "active", Source: source}
+
+	if hasCurrent && currentPlanID == planID && (!currentExpiry.Valid || currentExpiry.Time.After(now)) {
+		// Extend from the current expiry so renewals stack
+		var newExpiry interface{}
+		if currentExpiry.Valid && duration != nil {
+			expiry := currentExpiry.Time.Add(*duration)
+			newExpiry = expiry
+			sub.ExpiresAt = &expiry
+		}
+		err = q.QueryRow(`
+			UPDATE subscriptions SET expires_at = $1, updated_at = NOW()
+			WHERE id = $2
+			RETURNING id, starts_at, created_at
+		`, newExpiry, currentID).Scan(&sub.ID, &sub.StartsAt, &sub.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		if hasCurrent {
+			_, err = q.Exec(`
+				UPDATE subscriptions SET status = 'cancelled', updated_at = NOW()
+				WHERE id = $1
+			`, currentID)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		var expiresAt interface{}
+		if duration != nil {
+			expiry := now.Add(*duration)
+			expiresAt = expiry
+			sub.ExpiresAt = &expiry
+		}
+		err = q.QueryRow(`
+			INSERT INTO subscriptions (user_id, plan_id, status, source, starts_at, expires_at)
+			VALUES ($1, $2, 'active', $3, $4, $5)
+			RETURNING id, starts_at, created_at
+		`, userID, planID, source, now, expiresAt).Scan(&sub.ID, &sub.StartsAt, &sub.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// account_status mirrors the plan name for display only
+	_, err = q.Exec("UPDATE users SET account_status = $1, updated_at = NOW() WHERE id = $2", plan.Name, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sub, nil
+}
+
+// PublishUpgrade announces a committed subscription as a user.upgraded event.
+func PublishUpgrade(bus *events.Bus, sub *models.Subscription) {
+	bus.Publish(events.UserUpgraded, models.UserUpgradedEvent{UserID: sub.UserID, Subscription: sub})
+}
+
+// EndSubscription closes the user's active subscription with the given
+// status ("cancelled" or "expired") and returns them to the default plan.
+func (ps *PlanService) EndSubscription(q Queryer, userID int, status string) error {
+	_, err := q.Exec(`
+		UPDATE subscriptions SET status = $1, updated_at = NOW()
+		WHERE user_id = $2 AND status = 'active'
+	`, status, userID)
+	if err != nil {
+		return err
+	}
+	return ps.applyDefaultPlan(q, userID)
+}
+
+func (ps *PlanService) applyDefaultPlan(q Queryer, userID int) error {
+	defaultPlan, err := ps.DefaultPlan(q)
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec("UPDATE users SET account_status = $1, updated_at = NOW() WHERE id = $2", defaultPlan.Name, userID)
+	return err
+}
+
+// ExpireSubscriptions downgrades every user whose subscription has run out
+// and returns their IDs.
+func (ps *PlanService) ExpireSubscriptions() ([]int, error) {
+	rows, err := ps.db.Query(`
+		UPDATE subscriptions SET status = 'expired', updated_at = NOW()
+		WHERE status = 'active' AND expires_at IS NOT NULL AND expires_at <= NOW()
+		RETURNING user_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var userIDs []int
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, userID := range userIDs {
+		if err := ps.applyDefaultPlan(ps.db, userID); err != nil {
+			log.Printf("Failed to downgrade user %d after subscription expiry: %v", userID, err)
+		}
+	}
+
+	return userIDs, nil
+}
+
+// RunExpiryJob expires subscriptions every interval until ctx is cancelled.
+func (ps *PlanService) RunExpiryJob(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		userIDs, err := ps.ExpireSubscriptions()
+		if err != nil {
+			log.Printf("Failed to expire subscriptions: %v", err)
+		} else if len(userIDs) > 0 {
+			log.Printf("Expired %d subscription(s)", len(userIDs))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
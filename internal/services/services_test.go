@@ -0,0 +1,44 @@
+package services
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// newMockDB returns a database whose every statement must be expected in
+// order, checked when the test ends.
+func newMockDB(t *testing.T) (*sql.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	})
+	return db, mock
+}
+
+var planColumnNames = []string{"id", "name", "camera_quota", "device_limit", "concurrent_sessions", "can_export", "max_stream_quality",
+	"price", "currency", "duration_days", "is_default", "is_active", "created_at", "updated_at"}
+
+// planRow is a plan allowing concurrentSessions that lasts durationDays
+// (nil = no expiry). Only "free" is the default plan.
+func planRow(id int, name string, concurrentSessions int, durationDays interface{}) *sqlmock.Rows {
+	now := time.Now()
+	return sqlmock.NewRows(planColumnNames).
+		AddRow(id, name, 10, 3, concurrentSessions, name != "free", "sub", 0, "IDR", durationDays, name == "free", true, now, now)
+}
+
+// expectDefaultPlan expects the lookup of a user without a subscription,
+// who is on a default plan allowing concurrentSessions.
+func expectDefaultPlan(mock sqlmock.Sqlmock, concurrentSessions int) {
+	mock.ExpectQuery(`FROM subscriptions`).WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(`FROM plans p WHERE p.is_default`).WillReturnRows(planRow(1, "free", concurrentSessions, nil))
+}
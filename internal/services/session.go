@@ -0,0 +1,117 @@
+package services
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+var (
+	ErrSessionNotFound     = errors.New("session not found")
+	ErrSessionLimitReached = errors.New("session limit reached")
+)
+
+// SessionService keeps one login session per device and holds each user to
+// their plan's concurrent sessions. Only the SHA-256 of a session token is
+// stored.
+type SessionService struct {
+	db    *sql.DB
+	plans *PlanService
+}
+
+func NewSessionService(db *sql.DB, plans *PlanService) *SessionService {
+	return &SessionService{db: db, plans: plans}
+}
+
+func hashSessionToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Start makes token the session of the user's device until expiresAt,
+// replacing any session the device had. It fails with
+// ErrSessionLimitReached while other devices hold as many live sessions as
+// the plan allows.
+func (ss *SessionService) Start(userID int, deviceID, token string, expiresAt time.Time) error {
+	tx, err := ss.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Serialize concurrent logins for the same user
+	if _, err := tx.Exec("SELECT id FROM users WHERE id = $1 FOR UPDATE", userID); err != nil {
+		return err
+	}
+
+	plan, _, err := ss.plans.UserPlanIn(tx, userID)
+	if err != nil {
+		return err
+	}
+
+	var others int
+	err = tx.QueryRow(`
+		SELECT COUNT(*) FROM user_sessions
+		WHERE user_id = $1 AND device_id <> $2 AND expires_at > NOW()
+	`, userID, deviceID).Scan(&others)
+	if err != nil {
+		return err
+	}
+	if others >= plan.ConcurrentSessions {
+		return ErrSessionLimitReached
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO user_sessions (user_id, device_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, device_id) DO UPDATE
+		SET token_hash = EXCLUDED.token_hash, created_at = NOW(), expires_at = EXCLUDED.expires_at
+	`, userID, deviceID, hashSessionToken(token), expiresAt)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM user_sessions WHERE user_id = $1 AND expires_at <= NOW()", userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Check reports whether token is a live session of the user. When a plan
+// change leaves more sessions than the plan allows, only the most recently
+// started ones are honoured and the rest fail with ErrSessionLimitReached.
+func (ss *SessionService) Check(userID int, token string) error {
+	var rank int
+	err := ss.db.QueryRow(`
+		SELECT rank FROM (
+			SELECT token_hash, ROW_NUMBER() OVER (ORDER BY created_at DESC, id DESC) AS rank
+			FROM user_sessions
+			WHERE user_id = $1 AND expires_at > NOW()
+		) s
+		WHERE token_hash = $2
+	`, userID, hashSessionToken(token)).Scan(&rank)
+	if err == sql.ErrNoRows {
+		return ErrSessionNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	plan, _, err := ss.plans.UserPlan(userID)
+	if err != nil {
+		return err
+	}
+	if rank > plan.ConcurrentSessions {
+		return ErrSessionLimitReached
+	}
+	return nil
+}
+
+// End signs out the session of token.
+func (ss *SessionService) End(token string) error {
+	_, err := ss.db.Exec("DELETE FROM user_sessions WHERE token_hash = $1", hashSessionToken(token))
+	return err
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestSessionServiceStart(t *testing.T) {
+	tests := []struct {
+		name               string
+		concurrentSessions int
+		others             int // live sessions on other devices
+		wantErr            error
+	}{
+		{name: "first session", concurrentSessions: 1},
+		{name: "within the limit", concurrentSessions: 2, others: 1},
+		{name: "limit reached", concurrentSessions: 2, others: 2, wantErr: ErrSessionLimitReached},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			expiresAt := time.Now().Add(time.Hour)
+
+			mock.ExpectBegin()
+			mock.ExpectExec(`FOR UPDATE`).WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 1))
+			expectDefaultPlan(mock, tt.concurrentSessions)
+			mock.ExpectQuery(`SELECT COUNT\(\*\) FROM user_sessions`).WithArgs(7, "tablet").
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(tt.others))
+			if tt.wantErr == nil {
+				mock.ExpectExec(`INSERT INTO user_sessions`).
+					WithArgs(7, "tablet", hashSessionToken("token"), expiresAt).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(`DELETE FROM user_sessions`).WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+			} else {
+				mock.ExpectRollback()
+			}
+
+			ss := NewSessionService(db, NewPlanService(db))
+			if err := ss.Start(7, "tablet", "token", expiresAt); err != tt.wantErr {
+				t.Errorf("Start() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSessionServiceCheck(t *testing.T) {
+	tests := []struct {
+		name               string
+		rank               int // 0 when the token has no live session
+		concurrentSessions int
+		wantErr            error
+	}{
+		{name: "only session", rank: 1, concurrentSessions: 1},
+		{name: "within the limit", rank: 2, concurrentSessions: 2},
+		{name: "beyond the limit after a downgrade", rank: 2, concurrentSessions: 1, wantErr: ErrSessionLimitReached},
+		{name: "ended or expired", wantErr: ErrSessionNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			query := mock.ExpectQuery(`ROW_NUMBER\(\)`).WithArgs(7, hashSessionToken("token"))
+			if tt.rank == 0 {
+				query.WillReturnError(sql.ErrNoRows)
+			} else {
+				query.WillReturnRows(sqlmock.NewRows([]string{"rank"}).AddRow(tt.rank))
+				expectDefaultPlan(mock, tt.concurrentSessions)
+			}
+
+			ss := NewSessionService(db, NewPlanService(db))
+			if err := ss.Check(7, "token"); err != tt.wantErr {
+				t.Errorf("Check() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHashSessionToken(t *testing.T) {
+	if hashSessionToken("a") == hashSessionToken("b") {
+		t.Error("different tokens hash alike")
+	}
+	if got := len(hashSessionToken("token")); got != 64 {
+		t.Errorf("hash length %d, want 64 to fit token_hash", got)
+	}
+}
@@ -0,0 +1,254 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cctv-api/internal/health"
+	"cctv-api/internal/imaging"
+	"cctv-api/internal/storage"
+)
+
+// SnapshotVariants maps each stored size of a snapshot to the square box
+// it is scaled down to fit.
+var SnapshotVariants = map[string]int{
+	"small":  320,
+	"medium": 640,
+	"large":  1280,
+}
+
+const DefaultSnapshotVariant = "medium"
+
+const snapshotJPEGQuality = 85
+
+// SnapshotService captures still frames from cameras with snapshot or MJPEG
+// sources (or a snapshot stream) and keeps resized copies in storage. Each
+// new frame becomes the camera's thumbnail, unless one was uploaded, and is
+// announced through onUpdate. Frames are passed on to activity, when set,
+// for motion detection.
+type SnapshotService struct {
+	db          *sql.DB
+	store       storage.Store
+	prober      *health.Prober
+	activity    *ActivityService
+	baseURL     string
+	maxPixels   int64
+	concurrency int
+	onUpdate    func(cctvID int)
+}
+
+// NewSnapshotService stores frames in store and points thumbnails at
+// baseURL, the public address of this API. Frames larger than maxPixels are
+// refused before they are decoded.
+func NewSnapshotService(db *sql.DB, store storage.Store, prober *health.Prober, activity *ActivityService, baseURL string, maxPixels int64, concurrency int, onUpdate func(cctvID int)) *SnapshotService {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &SnapshotService{
+		db:          db,
+		store:       store,
+		prober:      prober,
+		activity:    activity,
+		baseURL:     strings.TrimSuffix(baseURL, "/"),
+		maxPixels:   maxPixels,
+		concurrency: concurrency,
+		onUpdate:    onUpdate,
+	}
+}
+
+func snapshotKey(cctvID int, variant string) string {
+	return "snapshots/" + strconv.Itoa(cctvID) + "/" + variant + ".jpg"
+}
+
+type snapshotTarget struct {
+	id         int
+	sourceURL  string
+	sourceType string
+	hash       string
+}
+
+// CaptureAll captures a frame from every active camera that has one to
+// give, at most concurrency at a time, and returns how many frames were new.
+func (ss *SnapshotService) CaptureAll(ctx context.Context) (int, error) {
+	rows, err := ss.db.QueryContext(ctx, `
+		SELECT c.id,
+			COALESCE(s.url, c.source_url),
+			CASE WHEN s.url IS NOT NULL THEN 'snapshot' ELSE c.source_type END,
+			COALESCE(c.snapshot_hash, '')
+		FROM cctvs c
+		LEFT JOIN cctv_streams s ON s.cctv_id = c.id AND s.role = 'snapshot'
+		WHERE c.is_active = true AND (s.url IS NOT NULL OR c.source_type IN ('snapshot', 'mjpeg'))
+		ORDER BY c.id
+	`)
+	if err != nil {
+		return 0, err
+	}
+	var targets []snapshotTarget
+	for rows.Next() {
+		var t snapshotTarget
+		if err := rows.Scan(&t.id, &t.sourceURL, &t.sourceType, &t.hash); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		targets = append(targets, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	sem := make(chan struct{}, ss.concurrency)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	captured := 0
+	for _, t := range targets {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return captured, ctx.Err()
+		case sem <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func(t snapshotTarget) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			changed, err := ss.capture(ctx, t)
+			if err != nil {
+				log.Printf("Failed to capture snapshot of CCTV %d: %v", t.id, err)
+				return
+			}
+			if changed {
+				mu.Lock()
+				captured++
+				mu.Unlock()
+			}
+		}(t)
+	}
+	wg.Wait()
+
+	return captured, nil
+}
+
+// capture grabs a frame and, unless it is the same as the last one, stores
+// its variants and makes it the camera's thumbnail.
+func (ss *SnapshotService) capture(ctx context.Context, t snapshotTarget) (bool, error) {
+	frame, err := ss.prober.GrabFrame(ctx, t.sourceURL, t.sourceType)
+	if err != nil {
+		return false, err
+	}
+	sum := sha256.Sum256(frame)
+	hash := hex.EncodeToString(sum[:])
+	if hash == t.hash {
+		if ss.activity != nil {
+			if err := ss.activity.ObserveStill(ctx, t.id); err != nil {
+				log.Printf("Failed to record activity of CCTV %d: %v", t.id, err)
+			}
+		}
+		return false, nil
+	}
+
+	config, _, err := imaging.DecodeConfig(frame)
+	if err != nil {
+		return false, fmt.Errorf("frame is not an image: %w", err)
+	}
+	if int64(config.Width)*int64(config.Height) > ss.maxPixels {
+		return false, fmt.Errorf("frame of %dx%d exceeds the pixel limit", config.Width, config.Height)
+	}
+	img, _, err := imaging.Decode(frame)
+	if err != nil {
+		return false, fmt.Errorf("frame is not an image: %w", err)
+	}
+	if ss.activity != nil {
+		if err := ss.activity.Observe(ctx, t.id, img); err != nil {
+			log.Printf("Failed to record activity of CCTV %d: %v", t.id, err)
+		}
+	}
+	for variant, size := range SnapshotVariants {
+		data, err := imaging.EncodeJPEG(imaging.Fit(img, size, size), snapshotJPEGQuality)
+		if err != nil {
+			return false, err
+		}
+		if _, err := ss.store.Put(ctx, snapshotKey(t.id, variant), bytes.NewReader(data), "image/jpeg"); err != nil {
+			return false, err
+		}
+	}
+
+	// The version parameter changes with every frame so that clients
+	// holding the old URL notice the update
+	thumbnailURL := ss.baseURL + "/api/cctvs/" + strconv.Itoa(t.id) + "/snapshot?v=" + hash[:12]
+	// An uploaded thumbnail stays in place
+	var isThumbnail bool
+	err = ss.db.QueryRow(`
+		UPDATE cctvs SET snapshot_hash = $1, snapshot_captured_at = NOW(),
+			thumbnail_url = CASE WHEN thumbnail_key IS NULL THEN $2 ELSE thumbnail_url END
+		WHERE id = $3
+		RETURNING thumbnail_key IS NULL
+	`, hash, thumbnailURL, t.id).Scan(&isThumbnail)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if isThumbnail && ss.onUpdate != nil {
+		ss.onUpdate(t.id)
+	}
+	return true, nil
+}
+
+// Open returns a variant of a camera's latest snapshot, or
+// storage.ErrNotFound when none has been captured.
+func (ss *SnapshotService) Open(ctx context.Context, cctvID int, variant string) (io.ReadCloser, *storage.Object, error) {
+	return ss.store.Get(ctx, snapshotKey(cctvID, variant))
+}
+
+// SignedURL returns a download link to a captured frame that works until
+// expiresAt, without checking the frame exists.
+func (ss *SnapshotService) SignedURL(cctvID int, variant string, expiresAt time.Time) (string, error) {
+	return ss.store.SignedURL(snapshotKey(cctvID, variant), expiresAt)
+}
+
+// Remove deletes a camera's stored snapshots, e.g. once it is deleted.
+func (ss *SnapshotService) Remove(ctx context.Context, cctvID int) error {
+	for variant := range SnapshotVariants {
+		if err := ss.store.Delete(ctx, snapshotKey(cctvID, variant)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunCaptureJob captures snapshots every interval until ctx is cancelled.
+func (ss *SnapshotService) RunCaptureJob(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		started := time.Now()
+		captured, err := ss.CaptureAll(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Snapshot capture failed: %v", err)
+		} else if captured > 0 {
+			log.Printf("Captured %d snapshot(s) in %s", captured, time.Since(started).Round(time.Millisecond))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+
+	"cctv-api/internal/models"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrStreamNotFound  = errors.New("stream not found")
+	ErrStreamRoleTaken = errors.New("camera already has a stream with this role")
+)
+
+const streamColumns = "id, cctv_id, role, url, codec, width, height, bitrate_kbps, created_at, updated_at"
+
+// StreamService manages the alternative streams of cameras (cctv_streams).
+type StreamService struct {
+	db *sql.DB
+}
+
+func NewStreamService(db *sql.DB) *StreamService {
+	return &StreamService{db: db}
+}
+
+func scanStream(row interface{ Scan(...interface{}) error }, stream *models.CCTVStream) error {
+	var codec sql.NullString
+	var width, height, bitrate sql.NullInt64
+	err := row.Scan(&stream.ID, &stream.CCTVID, &stream.Role, &stream.URL, &codec, &width, &height, &bitrate,
+		&stream.CreatedAt, &stream.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	if codec.Valid {
+		stream.Codec = &codec.String
+	}
+	if width.Valid {
+		w := int(width.Int64)
+		stream.Width = &w
+	}
+	if height.Valid {
+		h := int(height.Int64)
+		stream.Height = &h
+	}
+	if bitrate.Valid {
+		kbps := int(bitrate.Int64)
+		stream.BitrateKbps = &kbps
+	}
+	return nil
+}
+
+// List returns a camera's streams, best quality first.
+func (ss *StreamService) List(cctvID int) ([]models.CCTVStream, error) {
+	byCCTV, err := ss.ForCCTVs([]int{cctvID})
+	if err != nil {
+		return nil, err
+	}
+	if streams := byCCTV[cctvID]; streams != nil {
+		return streams, nil
+	}
+	return []models.CCTVStream{}, nil
+}
+
+// ForCCTVs returns the streams of several cameras at once, keyed by camera
+// and best quality first.
+func (ss *StreamService) ForCCTVs(cctvIDs []int) (map[int][]models.CCTVStream, error) {
+	rows, err := ss.db.Query(`
+		SELECT `+streamColumns+` FROM cctv_streams
+		WHERE cctv_id = ANY($1)
+		ORDER BY cctv_id, CASE role WHEN 'main' THEN 0 WHEN 'sub' THEN 1 ELSE 2 END
+	`, pq.Array(cctvIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byCCTV := make(map[int][]models.CCTVStream)
+	for rows.Next() {
+		var stream models.CCTVStream
+		if err := scanStream(rows, &stream); err != nil {
+			return nil, err
+		}
+		byCCTV[stream.CCTVID] = append(byCCTV[stream.CCTVID], stream)
+	}
+	return byCCTV, rows.Err()
+}
+
+func (ss *StreamService) Get(cctvID, id int) (*models.CCTVStream, error) {
+	var stream models.CCTVStream
+	err := scanStream(ss.db.QueryRow("SELECT "+streamColumns+" FROM cctv_streams WHERE id = $1 AND cctv_id = $2", id, cctvID), &stream)
+	if err == sql.ErrNoRows {
+		return nil, ErrStreamNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &stream, nil
+}
+
+func (ss *StreamService) Create(cctvID int, req models.CreateCCTVStreamRequest) (*models.CCTVStream, error) {
+	var stream models.CCTVStream
+	err := scanStream(ss.db.QueryRow(`
+		INSERT INTO cctv_streams (cctv_id, role, url, codec, width, height, bitrate_kbps)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING `+streamColumns,
+		cctvID, req.Role, req.URL, req.Codec, req.Width, req.Height, req.BitrateKbps), &stream)
+	if err != nil {
+		if err.Error() == `pq: duplicate key value violates unique constraint "cctv_streams_cctv_id_role_key"` {
+			return nil, ErrStreamRoleTaken
+		}
+		return nil, err
+	}
+	return &stream, nil
+}
+
+// Update changes the given fields of a stream. An empty codec clears it.
+func (ss *StreamService) Update(cctvID, id int, req models.UpdateCCTVStreamRequest) (*models.CCTVStream, error) {
+	query := "UPDATE cctv_streams SET updated_at = NOW()"
+	args := []interface{}{}
+	argPos := 1
+
+	if req.URL != nil {
+		query += ", url = $" + strconv.Itoa(argPos)
+		args = append(args, *req.URL)
+		argPos++
+	}
+
+	if req.Codec != nil {
+		query += ", codec = NULLIF($" + strconv.Itoa(argPos) + ", '')"
+		args = append(args, *req.Codec)
+		argPos++
+	}
+
+	if req.Width != nil {
+		query += ", width = $" + strconv.Itoa(argPos)
+		args = append(args, *req.Width)
+		argPos++
+	}
+
+	if req.Height != nil {
+		query += ", height = $" + strconv.Itoa(argPos)
+		args = append(args, *req.Height)
+		argPos++
+	}
+
+	if req.BitrateKbps != nil {
+		query += ", bitrate_kbps = $" + strconv.Itoa(argPos)
+		args = append(args, *req.BitrateKbps)
+		argPos++
+	}
+
+	query += " WHERE id = $" + strconv.Itoa(argPos) + " AND cctv_id = $" + strconv.Itoa(argPos+1) + " RETURNING " + streamColumns
+	args = append(args, id, cctvID)
+
+	var stream models.CCTVStream
+	err := scanStream(ss.db.QueryRow(query, args...), &stream)
+	if err == sql.ErrNoRows {
+		return nil, ErrStreamNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &stream, nil
+}
+
+func (ss *StreamService) Delete(cctvID, id int) error {
+	result, err := ss.db.Exec("DELETE FROM cctv_streams WHERE id = $1 AND cctv_id = $2", id, cctvID)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return ErrStreamNotFound
+	}
+	return nil
+}
@@ -0,0 +1,596 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"cctv-api/internal/models"
+
+	"github.com/lib/pq"
+)
+
+var ErrUptimeScopeNotFound = errors.New("camera or location not found")
+
+// UptimeService turns the stream status history into availability figures.
+// Whole months come from the monthly rollup table; the partial months at
+// either end of a range are computed from the raw history.
+type UptimeService struct {
+	db        *sql.DB
+	maxGap    time.Duration
+	slaTarget float64
+}
+
+// NewUptimeService takes the longest gap between two checks that still
+// counts as observed time, normally a few monitor intervals.
+func NewUptimeService(db *sql.DB, maxGap time.Duration, slaTarget float64) *UptimeService {
+	if maxGap <= 0 {
+		maxGap = 3 * time.Minute
+	}
+	return &UptimeService{db: db, maxGap: maxGap, slaTarget: slaTarget}
+}
+
+// uptimeTotals accumulates raw durations before they are turned into stats.
+type uptimeTotals struct {
+	observed, up, degraded, down time.Duration
+	outages, ongoing, resolved   int
+	resolvedDuration, longest    time.Duration
+}
+
+func (t *uptimeTotals) add(o uptimeTotals) {
+	t.observed += o.observed
+	t.up += o.up
+	t.degraded += o.degraded
+	t.down += o.down
+	t.outages += o.outages
+	t.ongoing += o.ongoing
+	t.resolved += o.resolved
+	t.resolvedDuration += o.resolvedDuration
+	if o.longest > t.longest {
+		t.longest = o.longest
+	}
+}
+
+func (t *uptimeTotals) stats(slaTarget float64) models.UptimeStats {
+	stats := models.UptimeStats{
+		ObservedSeconds:      int64(t.observed / time.Second),
+		UpSeconds:            int64(t.up / time.Second),
+		DegradedSeconds:      int64(t.degraded / time.Second),
+		DownSeconds:          int64(t.down / time.Second),
+		OutageCount:          t.outages,
+		OngoingOutages:       t.ongoing,
+		LongestOutageSeconds: int64(t.longest / time.Second),
+	}
+	if t.observed > 0 {
+		percent := float64(t.up) / float64(t.observed) * 100
+		meets := percent >= slaTarget
+		stats.UptimePercent = &percent
+		stats.MeetsSLA = &meets
+	}
+	if t.resolved > 0 {
+		mttr := t.resolvedDuration.Seconds() / float64(t.resolved)
+		stats.MTTRSeconds = &mttr
+	}
+	return stats
+}
+
+type statusSample struct {
+	at     time.Time
+	status string
+}
+
+// summarize computes totals for one camera over [from, to). samples are in
+// time order and may start with the last check before from. recoveredAt
+// looks up when an outage still open at the end of the samples ended.
+func (us *UptimeService) summarize(samples []statusSample, from, to, now time.Time, recoveredAt func(since time.Time) (time.Time, bool)) uptimeTotals {
+	var t uptimeTotals
+	end := to
+	if now.Before(end) {
+		end = now
+	}
+
+	var outageStart time.Time
+	inOutage, countOutage := false, false
+	closeOutage := func(at time.Time, resolved bool) {
+		if !countOutage {
+			return
+		}
+		duration := at.Sub(outageStart)
+		t.outages++
+		if resolved {
+			t.resolved++
+			t.resolvedDuration += duration
+		} else {
+			t.ongoing++
+		}
+		if duration > t.longest {
+			t.longest = duration
+		}
+	}
+
+	for i, s := range samples {
+		spanEnd := end
+		if i+1 < len(samples) && samples[i+1].at.Before(spanEnd) {
+			spanEnd = samples[i+1].at
+		}
+		if limit := s.at.Add(us.maxGap); limit.Before(spanEnd) {
+			spanEnd = limit
+		}
+		spanStart := s.at
+		if spanStart.Before(from) {
+			spanStart = from
+		}
+		if span := spanEnd.Sub(spanStart); span > 0 {
+			t.observed += span
+			switch s.status {
+			case "online":
+				t.up += span
+			case "degraded":
+				t.up += span
+				t.degraded += span
+			default:
+				t.down += span
+			}
+		}
+
+		offline := s.status == "offline"
+		switch {
+		case offline && !inOutage:
+			inOutage = true
+			outageStart = s.at
+			// Outages belong to the period they began in
+			countOutage = !s.at.Before(from) && s.at.Before(to)
+		case !offline && inOutage:
+			closeOutage(s.at, true)
+			inOutage = false
+		}
+	}
+
+	if inOutage && countOutage {
+		if at, ok := recoveredAt(outageStart); ok {
+			closeOutage(at, true)
+		} else {
+			closeOutage(now, false)
+		}
+	}
+	return t
+}
+
+// computeRaw returns per-camera totals for [from, to) straight from the
+// status history.
+func (us *UptimeService) computeRaw(ids []int, from, to time.Time) (map[int]uptimeTotals, error) {
+	result := make(map[int]uptimeTotals)
+	if len(ids) == 0 || !from.Before(to) {
+		return result, nil
+	}
+
+	samples := make(map[int][]statusSample)
+
+	// The last check before the range says what state each camera was in
+	// when the range began
+	rows, err := us.db.Query(`
+		SELECT c.id, s.checked_at, s.status
+		FROM UNNEST($1::int[]) AS c(id)
+		CROSS JOIN LATERAL (
+			SELECT checked_at, status FROM cctv_status_history
+			WHERE cctv_id = c.id AND checked_at < $2
+			ORDER BY checked_at DESC
+			LIMIT 1
+		) s
+	`, pq.Array(ids), from)
+	if err != nil {
+		return nil, err
+	}
+	if err := appendSamples(rows, samples); err != nil {
+		return nil, err
+	}
+
+	rows, err = us.db.Query(`
+		SELECT cctv_id, checked_at, status FROM cctv_status_history
+		WHERE cctv_id = ANY($1) AND checked_at >= $2 AND checked_at < $3
+		ORDER BY cctv_id, checked_at
+	`, pq.Array(ids), from, to)
+	if err != nil {
+		return nil, err
+	}
+	if err := appendSamples(rows, samples); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for id, list := range samples {
+		cctvID := id
+		result[id] = us.summarize(list, from, to, now, func(since time.Time) (time.Time, bool) {
+			var at sql.NullTime
+			err := us.db.QueryRow(`
+				SELECT MIN(checked_at) FROM cctv_status_history
+				WHERE cctv_id = $1 AND checked_at > $2 AND status <> 'offline'
+			`, cctvID, since).Scan(&at)
+			if err != nil || !at.Valid {
+				return time.Time{}, false
+			}
+			return at.Time, true
+		})
+	}
+	return result, nil
+}
+
+func appendSamples(rows *sql.Rows, samples map[int][]statusSample) error {
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var s statusSample
+		if err := rows.Scan(&id, &s.at, &s.status); err != nil {
+			return err
+		}
+		samples[id] = append(samples[id], s)
+	}
+	return rows.Err()
+}
+
+// computeRollup returns per-camera totals for the months in [from, to),
+// both of which must be month starts.
+func (us *UptimeService) computeRollup(ids []int, from, to time.Time) (map[int]uptimeTotals, error) {
+	result := make(map[int]uptimeTotals)
+	if len(ids) == 0 || !from.Before(to) {
+		return result, nil
+	}
+
+	rows, err := us.db.Query(`
+		SELECT cctv_id, SUM(observed_seconds), SUM(up_seconds), SUM(degraded_seconds), SUM(down_seconds),
+			SUM(outage_count), SUM(resolved_outage_count), SUM(resolved_outage_seconds), MAX(longest_outage_seconds)
+		FROM cctv_uptime_monthly
+		WHERE cctv_id = ANY($1) AND month >= $2 AND month < $3
+		GROUP BY cctv_id
+	`, pq.Array(ids), from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var observed, up, degraded, down, resolvedSeconds, longest int64
+		var outages, resolved int
+		if err := rows.Scan(&id, &observed, &up, &degraded, &down, &outages, &resolved, &resolvedSeconds, &longest); err != nil {
+			return nil, err
+		}
+		result[id] = uptimeTotals{
+			observed:         time.Duration(observed) * time.Second,
+			up:               time.Duration(up) * time.Second,
+			degraded:         time.Duration(degraded) * time.Second,
+			down:             time.Duration(down) * time.Second,
+			outages:          outages,
+			resolved:         resolved,
+			resolvedDuration: time.Duration(resolvedSeconds) * time.Second,
+			longest:          time.Duration(longest) * time.Second,
+		}
+	}
+	return result, rows.Err()
+}
+
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// rolledUpUntil returns the end of the run of computed months starting at
+// from, so that [from, result) can be read from the rollup table.
+func (us *UptimeService) rolledUpUntil(from, to time.Time) (time.Time, error) {
+	until := from
+	for next := until.AddDate(0, 1, 0); !next.After(to); next = until.AddDate(0, 1, 0) {
+		var exists bool
+		err := us.db.QueryRow("SELECT EXISTS(SELECT 1 FROM cctv_uptime_rollup_months WHERE month = $1)", until).Scan(&exists)
+		if err != nil {
+			return from, err
+		}
+		if !exists {
+			break
+		}
+		until = next
+	}
+	return until, nil
+}
+
+// perCamera computes totals for each camera over [from, to), using the
+// rollup for whole computed months and raw history for the rest.
+func (us *UptimeService) perCamera(ids []int, from, to time.Time) (map[int]uptimeTotals, error) {
+	totals := make(map[int]uptimeTotals)
+	merge := func(part map[int]uptimeTotals) {
+		for id, t := range part {
+			sum := totals[id]
+			sum.add(t)
+			totals[id] = sum
+		}
+	}
+
+	firstMonth := monthStart(from)
+	if firstMonth.Before(from) {
+		firstMonth = firstMonth.AddDate(0, 1, 0)
+	}
+	rolledUntil := firstMonth
+	if firstMonth.Before(to) {
+		var err error
+		rolledUntil, err = us.rolledUpUntil(firstMonth, to)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if rolledUntil.After(firstMonth) {
+		head, err := us.computeRaw(ids, from, firstMonth)
+		if err != nil {
+			return nil, err
+		}
+		merge(head)
+
+		months, err := us.computeRollup(ids, firstMonth, rolledUntil)
+		if err != nil {
+			return nil, err
+		}
+		merge(months)
+
+		tail, err := us.computeRaw(ids, rolledUntil, to)
+		if err != nil {
+			return nil, err
+		}
+		merge(tail)
+	} else {
+		raw, err := us.computeRaw(ids, from, to)
+		if err != nil {
+			return nil, err
+		}
+		merge(raw)
+	}
+	return totals, nil
+}
+
+type uptimeCamera struct {
+	id           int
+	name         string
+	locationID   int
+	locationName string
+}
+
+func (us *UptimeService) cameras(where string, args ...interface{}) ([]uptimeCamera, error) {
+	rows, err := us.db.Query(`
+		SELECT c.id, c.name, l.id, l.name
+		FROM cctvs c JOIN locations l ON l.id = c.location_id
+		`+where+`
+		ORDER BY l.name, c.name
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cameras []uptimeCamera
+	for rows.Next() {
+		var c uptimeCamera
+		if err := rows.Scan(&c.id, &c.name, &c.locationID, &c.locationName); err != nil {
+			return nil, err
+		}
+		cameras = append(cameras, c)
+	}
+	return cameras, rows.Err()
+}
+
+// CCTVReport reports on a single camera.
+func (us *UptimeService) CCTVReport(cctvID int, from, to time.Time) (*models.UptimeReport, error) {
+	cameras, err := us.cameras("WHERE c.id = $1", cctvID)
+	if err != nil {
+		return nil, err
+	}
+	if len(cameras) == 0 {
+		return nil, ErrUptimeScopeNotFound
+	}
+
+	totals, err := us.perCamera([]int{cctvID}, from, to)
+	if err != nil {
+		return nil, err
+	}
+	t := totals[cctvID]
+
+	return &models.UptimeReport{
+		Scope:            "cctv",
+		ID:               &cctvID,
+		Name:             cameras[0].name,
+		From:             from,
+		To:               to,
+		SLATargetPercent: us.slaTarget,
+		Summary:          t.stats(us.slaTarget),
+	}, nil
+}
+
+// LocationReport reports on every camera at a location, broken down by camera.
+func (us *UptimeService) LocationReport(locationID int, from, to time.Time) (*models.UptimeReport, error) {
+	var name string
+	err := us.db.QueryRow("SELECT name FROM locations WHERE id = $1", locationID).Scan(&name)
+	if err == sql.ErrNoRows {
+		return nil, ErrUptimeScopeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cameras, err := us.cameras("WHERE c.location_id = $1", locationID)
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := us.report(cameras, from, to, "cctv")
+	if err != nil {
+		return nil, err
+	}
+	report.Scope = "location"
+	report.ID = &locationID
+	report.Name = name
+	return report, nil
+}
+
+// NetworkReport reports on every camera, broken down by location.
+func (us *UptimeService) NetworkReport(from, to time.Time) (*models.UptimeReport, error) {
+	cameras, err := us.cameras("")
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := us.report(cameras, from, to, "location")
+	if err != nil {
+		return nil, err
+	}
+	report.Scope = "network"
+	report.Name = "All cameras"
+	return report, nil
+}
+
+func (us *UptimeService) report(cameras []uptimeCamera, from, to time.Time, groupBy string) (*models.UptimeReport, error) {
+	ids := make([]int, len(cameras))
+	for i, c := range cameras {
+		ids[i] = c.id
+	}
+
+	totals, err := us.perCamera(ids, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var summary uptimeTotals
+	groups := []models.UptimeGroup{}
+	groupTotals := make(map[int]*uptimeTotals)
+	for _, c := range cameras {
+		t := totals[c.id]
+		summary.add(t)
+
+		if groupBy == "cctv" {
+			groups = append(groups, models.UptimeGroup{Scope: "cctv", ID: c.id, Name: c.name, UptimeStats: t.stats(us.slaTarget)})
+			continue
+		}
+		if _, ok := groupTotals[c.locationID]; !ok {
+			groupTotals[c.locationID] = &uptimeTotals{}
+			groups = append(groups, models.UptimeGroup{Scope: "location", ID: c.locationID, Name: c.locationName})
+		}
+		groupTotals[c.locationID].add(t)
+	}
+	if groupBy == "location" {
+		for i := range groups {
+			groups[i].UptimeStats = groupTotals[groups[i].ID].stats(us.slaTarget)
+		}
+	}
+
+	return &models.UptimeReport{
+		From:             from,
+		To:               to,
+		SLATargetPercent: us.slaTarget,
+		Summary:          summary.stats(us.slaTarget),
+		Breakdown:        groups,
+	}, nil
+}
+
+// RollupMonth computes and stores the monthly totals of every camera for
+// the month starting at month.
+func (us *UptimeService) RollupMonth(month time.Time) error {
+	month = monthStart(month)
+	next := month.AddDate(0, 1, 0)
+
+	ids, err := queryIDs(us.db, `
+		SELECT DISTINCT cctv_id FROM cctv_status_history
+		WHERE checked_at >= $1 AND checked_at < $2
+	`, month.Add(-us.maxGap), next)
+	if err != nil {
+		return err
+	}
+
+	totals, err := us.computeRaw(ids, month, next)
+	if err != nil {
+		return err
+	}
+
+	tx, err := us.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for id, t := range totals {
+		_, err := tx.Exec(`
+			INSERT INTO cctv_uptime_monthly (cctv_id, month, observed_seconds, up_seconds, degraded_seconds, down_seconds,
+				outage_count, resolved_outage_count, resolved_outage_seconds, longest_outage_seconds)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			ON CONFLICT (cctv_id, month) DO UPDATE SET
+				observed_seconds = EXCLUDED.observed_seconds, up_seconds = EXCLUDED.up_seconds,
+				degraded_seconds = EXCLUDED.degraded_seconds, down_seconds = EXCLUDED.down_seconds,
+				outage_count = EXCLUDED.outage_count, resolved_outage_count = EXCLUDED.resolved_outage_count,
+				resolved_outage_seconds = EXCLUDED.resolved_outage_seconds, longest_outage_seconds = EXCLUDED.longest_outage_seconds
+		`, id, month, int64(t.observed/time.Second), int64(t.up/time.Second), int64(t.degraded/time.Second),
+			int64(t.down/time.Second), t.outages, t.resolved, int64(t.resolvedDuration/time.Second),
+			int64(t.longest/time.Second))
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO cctv_uptime_rollup_months (month) VALUES ($1)
+		ON CONFLICT (month) DO UPDATE SET computed_at = NOW()
+	`, month)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RollupCompletedMonths computes every finished month that has status
+// history but no rollup yet, and returns how many it computed.
+func (us *UptimeService) RollupCompletedMonths() (int, error) {
+	var earliest sql.NullTime
+	if err := us.db.QueryRow("SELECT MIN(checked_at) FROM cctv_status_history").Scan(&earliest); err != nil {
+		return 0, err
+	}
+	if !earliest.Valid {
+		return 0, nil
+	}
+
+	current := monthStart(time.Now())
+	computed := 0
+	for month := monthStart(earliest.Time); month.Before(current); month = month.AddDate(0, 1, 0) {
+		var exists bool
+		err := us.db.QueryRow("SELECT EXISTS(SELECT 1 FROM cctv_uptime_rollup_months WHERE month = $1)", month).Scan(&exists)
+		if err != nil {
+			return computed, err
+		}
+		if exists {
+			continue
+		}
+		if err := us.RollupMonth(month); err != nil {
+			return computed, err
+		}
+		computed++
+	}
+	return computed, nil
+}
+
+// RunRollupJob rolls up finished months every interval until ctx is
+// cancelled. It must run more often than the history retention period.
+func (us *UptimeService) RunRollupJob(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		computed, err := us.RollupCompletedMonths()
+		if err != nil {
+			log.Printf("Failed to roll up uptime: %v", err)
+		} else if computed > 0 {
+			log.Printf("Rolled up uptime for %d month(s)", computed)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
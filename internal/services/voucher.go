@@ -0,0 +1,201 @@
+package services
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"cctv-api/internal/events"
+	"cctv-api/internal/models"
+)
+
+var (
+	ErrVoucherNotFound     = errors.New("voucher not found")
+	ErrVoucherNotValid     = errors.New("voucher is not valid at this time")
+	ErrVoucherExhausted    = errors.New("voucher has been fully redeemed")
+	ErrVoucherUserLimit    = errors.New("voucher already redeemed by this user")
+	ErrVoucherPlanConflict = errors.New("user already holds a different plan")
+)
+
+type VoucherService struct {
+	db    *sql.DB
+	plans *PlanService
+	audit *AuditService
+	bus   *events.Bus
+}
+
+func NewVoucherService(db *sql.DB, plans *PlanService, audit *AuditService, bus *events.Bus) *VoucherService {
+	return &VoucherService{db: db, plans: plans, audit: audit, bus: bus}
+}
+
+const voucherColumns = `
+	v.id, v.code, v.description, v.plan_id, p.name, v.duration_days, v.max_redemptions, v.per_user_limit,
+	(SELECT COUNT(*) FROM voucher_redemptions r WHERE r.voucher_id = v.id),
+	v.valid_from, v.valid_until, v.is_active, v.created_at, v.updated_at
+`
+
+func scanVoucher(row interface{ Scan(...interface{}) error }, voucher *models.Voucher) error {
+	var description sql.NullString
+	var maxRedemptions sql.NullInt64
+	var validFrom, validUntil sql.NullTime
+	err := row.Scan(&voucher.ID, &voucher.Code, &description, &voucher.PlanID, &voucher.PlanName,
+		&voucher.DurationDays, &maxRedemptions, &voucher.PerUserLimit, &voucher.Redemptions,
+		&validFrom, &validUntil, &voucher.IsActive, &voucher.CreatedAt, &voucher.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	if description.Valid {
+		voucher.Description = &description.String
+	}
+	if maxRedemptions.Valid {
+		limit := int(maxRedemptions.Int64)
+		voucher.MaxRedemptions = &limit
+	}
+	if validFrom.Valid {
+		voucher.ValidFrom = &validFrom.Time
+	}
+	if validUntil.Valid {
+		voucher.ValidUntil = &validUntil.Time
+	}
+	return nil
+}
+
+func (vs *VoucherService) ListVouchers() ([]models.Voucher, error) {
+	rows, err := vs.db.Query(`
+		SELECT ` + voucherColumns + `
+		FROM vouchers v JOIN plans p ON p.id = v.plan_id
+		ORDER BY v.created_at DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	vouchers := []models.Voucher{}
+	for rows.Next() {
+		var voucher models.Voucher
+		if err := scanVoucher(rows, &voucher); err != nil {
+			return nil, err
+		}
+		vouchers = append(vouchers, voucher)
+	}
+	return vouchers, rows.Err()
+}
+
+// NormalizeVoucherCode makes codes case-insensitive.
+func NormalizeVoucherCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// GenerateVoucherCode returns a random code without look-alike characters.
+func GenerateVoucherCode() (string, error) {
+	const charset = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = charset[int(b[i])%len(charset)]
+	}
+	return string(b), nil
+}
+
+// Redeem applies the voucher's plan to the user for the voucher's duration.
+// When the resulting subscription runs out, the expiry job downgrades the
+// user as with any other subscription.
+func (vs *VoucherService) Redeem(userID int, code, ip string) (*models.Subscription, error) {
+	tx, err := vs.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Lock the voucher so concurrent redemptions respect the limits
+	var voucherID, planID, durationDays, perUserLimit int
+	var maxRedemptions sql.NullInt64
+	var validFrom, validUntil sql.NullTime
+	var isActive bool
+	err = tx.QueryRow(`
+		SELECT id, plan_id, duration_days, max_redemptions, per_user_limit, valid_from, valid_until, is_active
+		FROM vouchers WHERE code = $1
+		FOR UPDATE
+	`, NormalizeVoucherCode(code)).Scan(&voucherID, &planID, &durationDays, &maxRedemptions,
+		&perUserLimit, &validFrom, &validUntil, &isActive)
+	if err == sql.ErrNoRows {
+		return nil, ErrVoucherNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if !isActive || (validFrom.Valid && now.Before(validFrom.Time)) || (validUntil.Valid && !now.Before(validUntil.Time)) {
+		return nil, ErrVoucherNotValid
+	}
+
+	var total, byUser int
+	err = tx.QueryRow(`
+		SELECT COUNT(*), COUNT(*) FILTER (WHERE user_id = $2)
+		FROM voucher_redemptions WHERE voucher_id = $1
+	`, voucherID, userID).Scan(&total, &byUser)
+	if err != nil {
+		return nil, err
+	}
+	if maxRedemptions.Valid && total >= int(maxRedemptions.Int64) {
+		return nil, ErrVoucherExhausted
+	}
+	if byUser >= perUserLimit {
+		return nil, ErrVoucherUserLimit
+	}
+
+	// A voucher can extend the user's current plan but never swap it out.
+	// Locking the user serializes redemptions of different vouchers, so the
+	// plan read here is still the plan when the subscription is written.
+	if _, err := tx.Exec("SELECT id FROM users WHERE id = $1 FOR UPDATE", userID); err != nil {
+		return nil, err
+	}
+	currentPlan, currentSub, err := vs.plans.UserPlanIn(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if currentSub != nil && currentPlan.ID != planID {
+		return nil, ErrVoucherPlanConflict
+	}
+
+	duration := time.Duration(durationDays) * 24 * time.Hour
+	sub, err := vs.plans.Subscribe(tx, userID, planID, &duration, "voucher")
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO voucher_redemptions (voucher_id, user_id, subscription_id)
+		VALUES ($1, $2, $3)
+	`, voucherID, userID, sub.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	vs.audit.Record(models.AuditLog{
+		ActorID:   &userID,
+		UserID:    &userID,
+		Action:    "voucher.redeemed",
+		IPAddress: &ip,
+		Details: map[string]interface{}{
+			"voucherId":      voucherID,
+			"code":           NormalizeVoucherCode(code),
+			"planId":         planID,
+			"subscriptionId": sub.ID,
+			"expiresAt":      sub.ExpiresAt,
+		},
+	})
+	PublishUpgrade(vs.bus, sub)
+
+	return sub, nil
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"cctv-api/internal/events"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestVoucherServiceRedeem(t *testing.T) {
+	voucherColumns := []string{"id", "plan_id", "duration_days", "max_redemptions", "per_user_limit", "valid_from", "valid_until", "is_active"}
+	now := time.Now()
+
+	tests := []struct {
+		name        string
+		voucher     []driver.Value // nil when the code is unknown
+		total       int
+		byUser      int
+		currentPlan int // plan of the user's active subscription; 0 for none
+		wantErr     error
+	}{
+		{name: "unknown code", wantErr: ErrVoucherNotFound},
+		{name: "inactive", voucher: []driver.Value{3, 2, 7, nil, 1, nil, nil, false}, wantErr: ErrVoucherNotValid},
+		{name: "not yet valid", voucher: []driver.Value{3, 2, 7, nil, 1, now.Add(time.Hour), nil, true}, wantErr: ErrVoucherNotValid},
+		{name: "expired", voucher: []driver.Value{3, 2, 7, nil, 1, nil, now.Add(-time.Hour), true}, wantErr: ErrVoucherNotValid},
+		{name: "fully redeemed", voucher: []driver.Value{3, 2, 7, 100, 1, nil, nil, true}, total: 100, wantErr: ErrVoucherExhausted},
+		{name: "already redeemed by the user", voucher: []driver.Value{3, 2, 7, nil, 1, nil, nil, true}, total: 5, byUser: 1, wantErr: ErrVoucherUserLimit},
+		{name: "other paid plan", voucher: []driver.Value{3, 2, 7, nil, 1, nil, nil, true}, currentPlan: 4, wantErr: ErrVoucherPlanConflict},
+		{name: "redeemed", voucher: []driver.Value{3, 2, 7, 100, 2, now.Add(-time.Hour), now.Add(time.Hour), true}, total: 10, byUser: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			mock.ExpectBegin()
+			query := mock.ExpectQuery(`FROM vouchers WHERE code = \$1`).WithArgs("TRIAL7")
+			if tt.voucher == nil {
+				query.WillReturnError(sql.ErrNoRows)
+			} else {
+				query.WillReturnRows(sqlmock.NewRows(voucherColumns).AddRow(tt.voucher...))
+			}
+			reachesCounts := tt.voucher != nil && tt.wantErr != ErrVoucherNotValid
+			if reachesCounts {
+				mock.ExpectQuery(`FROM voucher_redemptions`).WithArgs(3, 7).
+					WillReturnRows(sqlmock.NewRows([]string{"total", "by_user"}).AddRow(tt.total, tt.byUser))
+			}
+			if reachesCounts && tt.wantErr != ErrVoucherExhausted && tt.wantErr != ErrVoucherUserLimit {
+				mock.ExpectExec(`SELECT id FROM users WHERE id = \$1 FOR UPDATE`).WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 1))
+				if tt.currentPlan != 0 {
+					mock.ExpectQuery(`FROM subscriptions`).WithArgs(7).
+						WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "plan_id", "status", "source", "starts_at", "expires_at", "created_at"}).
+							AddRow(40, 7, tt.currentPlan, "active", "payment", now, nil, now))
+					mock.ExpectQuery(`FROM plans p WHERE p.id = \$1`).WithArgs(tt.currentPlan).WillReturnRows(planRow(tt.currentPlan, "business", 3, 30))
+				} else {
+					expectDefaultPlan(mock, 1)
+				}
+			}
+			if tt.wantErr == nil {
+				mock.ExpectQuery(`FROM plans p WHERE p.id = \$1`).WithArgs(2).WillReturnRows(planRow(2, "pro", 2, 30))
+				mock.ExpectQuery(`SELECT id, plan_id, expires_at FROM subscriptions`).WithArgs(7).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "plan_id", "expires_at"}))
+				mock.ExpectQuery(`INSERT INTO subscriptions`).WithArgs(7, 2, "voucher", sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "starts_at", "created_at"}).AddRow(41, now, now))
+				mock.ExpectExec(`UPDATE users SET account_status`).WithArgs("pro", 7).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`INSERT INTO voucher_redemptions`).WithArgs(3, 7, 41).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+				mock.ExpectExec(`INSERT INTO audit_logs`).WithArgs(7, 7, "voucher.redeemed", "203.0.113.7", sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			} else {
+				mock.ExpectRollback()
+			}
+
+			vs := NewVoucherService(db, NewPlanService(db), NewAuditService(db), events.NewBus())
+			sub, err := vs.Redeem(7, " trial7 ", "203.0.113.7")
+			if err != tt.wantErr {
+				t.Fatalf("Redeem() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if sub.ExpiresAt == nil || sub.ExpiresAt.Sub(now) < 7*24*time.Hour-time.Minute {
+				t.Errorf("Redeem() subscription expires at %v, want 7 days out", sub.ExpiresAt)
+			}
+		})
+	}
+}
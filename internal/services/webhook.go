@@ -0,0 +1,566 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	mathrand "math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"cctv-api/internal/events"
+	"cctv-api/internal/models"
+	"cctv-api/internal/netguard"
+	"cctv-api/internal/webhooks"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrWebhookNotFound         = errors.New("webhook subscription not found")
+	ErrWebhookDeliveryNotFound = errors.New("webhook delivery not found")
+	ErrInvalidEventType        = errors.New("unknown event type")
+)
+
+const (
+	webhookBatchSize       = 100
+	webhookResponseLimit   = 4 << 10
+	webhookLease           = 5 * time.Minute
+	webhookMaxRetryBackoff = 6 * time.Hour
+)
+
+// WebhookService fans published events out to the subscriptions that want
+// them. Every event becomes one delivery row per subscription; a dispatcher
+// POSTs pending deliveries and retries failures with exponential backoff
+// until maxAttempts is reached. Deliveries are not ordered, so receivers
+// should de-duplicate on the event ID and order by occurredAt.
+type WebhookService struct {
+	db          *sql.DB
+	client      *http.Client
+	maxAttempts int
+	retryBase   time.Duration
+	concurrency int
+	retention   time.Duration
+	wake        chan struct{}
+}
+
+// NewWebhookService delivers through guard, so a subscription URL cannot
+// reach the server's own network. Receivers answering with a redirect are
+// not followed; the delivery fails like any other non-2xx response.
+func NewWebhookService(db *sql.DB, guard *netguard.Guard, maxAttempts int, retryBase time.Duration, concurrency int, retention time.Duration) *WebhookService {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = guard.Dialer(10 * time.Second).DialContext
+
+	return &WebhookService{
+		db: db,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   10 * time.Second,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		maxAttempts: maxAttempts,
+		retryBase:   retryBase,
+		concurrency: concurrency,
+		retention:   retention,
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+const webhookColumns = "id, url, event_types, description, is_active, created_at, updated_at"
+
+func scanWebhook(row interface{ Scan(...interface{}) error }, sub *models.WebhookSubscription) error {
+	var description sql.NullString
+	err := row.Scan(&sub.ID, &sub.URL, pq.Array(&sub.EventTypes), &description, &sub.IsActive, &sub.CreatedAt, &sub.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	if description.Valid {
+		sub.Description = &description.String
+	}
+	return nil
+}
+
+func validateEventTypes(patterns []string) error {
+	for _, p := range patterns {
+		if !events.ValidPattern(p) {
+			return fmt.Errorf("%w %q", ErrInvalidEventType, p)
+		}
+	}
+	return nil
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+func (ws *WebhookService) List() ([]models.WebhookSubscription, error) {
+	rows, err := ws.db.Query("SELECT " + webhookColumns + " FROM webhook_subscriptions ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := []models.WebhookSubscription{}
+	for rows.Next() {
+		var sub models.WebhookSubscription
+		if err := scanWebhook(rows, &sub); err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+func (ws *WebhookService) Get(id int) (*models.WebhookSubscription, error) {
+	var sub models.WebhookSubscription
+	err := scanWebhook(ws.db.QueryRow("SELECT "+webhookColumns+" FROM webhook_subscriptions WHERE id = $1", id), &sub)
+	if err == sql.ErrNoRows {
+		return nil, ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// Create registers a subscription. The returned subscription carries the
+// signing secret, which is not shown again.
+func (ws *WebhookService) Create(req models.CreateWebhookSubscriptionRequest, createdBy int) (*models.WebhookSubscription, error) {
+	if err := validateEventTypes(req.EventTypes); err != nil {
+		return nil, err
+	}
+
+	var secret string
+	if req.Secret != nil {
+		secret = *req.Secret
+	} else {
+		var err error
+		if secret, err = newWebhookSecret(); err != nil {
+			return nil, err
+		}
+	}
+
+	var sub models.WebhookSubscription
+	err := scanWebhook(ws.db.QueryRow(`
+		INSERT INTO webhook_subscriptions (url, secret, event_types, description, created_by)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+webhookColumns,
+		req.URL, secret, pq.Array(req.EventTypes), req.Description, createdBy), &sub)
+	if err != nil {
+		return nil, err
+	}
+	sub.Secret = secret
+	return &sub, nil
+}
+
+// Update changes the given fields. With RotateSecret a new secret is
+// generated and returned on the subscription.
+func (ws *WebhookService) Update(id int, req models.UpdateWebhookSubscriptionRequest) (*models.WebhookSubscription, error) {
+	if req.EventTypes != nil {
+		if err := validateEventTypes(req.EventTypes); err != nil {
+			return nil, err
+		}
+	}
+
+	query := "UPDATE webhook_subscriptions SET updated_at = NOW()"
+	args := []interface{}{}
+	argPos := 1
+
+	if req.URL != nil {
+		query += ", url = $" + strconv.Itoa(argPos)
+		args = append(args, *req.URL)
+		argPos++
+	}
+
+	if req.EventTypes != nil {
+		query += ", event_types = $" + strconv.Itoa(argPos)
+		args = append(args, pq.Array(req.EventTypes))
+		argPos++
+	}
+
+	if req.Description != nil {
+		query += ", description = $" + strconv.Itoa(argPos)
+		args = append(args, *req.Description)
+		argPos++
+	}
+
+	if req.IsActive != nil {
+		query += ", is_active = $" + strconv.Itoa(argPos)
+		args = append(args, *req.IsActive)
+		argPos++
+	}
+
+	var secret string
+	if req.RotateSecret {
+		var err error
+		if secret, err = newWebhookSecret(); err != nil {
+			return nil, err
+		}
+		query += ", secret = $" + strconv.Itoa(argPos)
+		args = append(args, secret)
+		argPos++
+	}
+
+	query += " WHERE id = $" + strconv.Itoa(argPos) + " RETURNING " + webhookColumns
+	args = append(args, id)
+
+	var sub models.WebhookSubscription
+	err := scanWebhook(ws.db.QueryRow(query, args...), &sub)
+	if err == sql.ErrNoRows {
+		return nil, ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	sub.Secret = secret
+	return &sub, nil
+}
+
+func (ws *WebhookService) Delete(id int) error {
+	result, err := ws.db.Exec("DELETE FROM webhook_subscriptions WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+const deliveryColumns = `
+	id, subscription_id, event_id, event_type, payload, status, attempts, next_attempt_at, last_attempt_at,
+	response_status, response_body, error, redelivery_of, created_at, delivered_at
+`
+
+func scanDelivery(row interface{ Scan(...interface{}) error }, d *models.WebhookDelivery) error {
+	var payload []byte
+	var nextAttemptAt, lastAttemptAt, deliveredAt sql.NullTime
+	var responseStatus, redeliveryOf sql.NullInt64
+	var responseBody, errText sql.NullString
+	err := row.Scan(&d.ID, &d.SubscriptionID, &d.EventID, &d.EventType, &payload, &d.Status, &d.Attempts,
+		&nextAttemptAt, &lastAttemptAt, &responseStatus, &responseBody, &errText, &redeliveryOf,
+		&d.CreatedAt, &deliveredAt)
+	if err != nil {
+		return err
+	}
+	d.Payload = payload
+	if nextAttemptAt.Valid {
+		d.NextAttemptAt = &nextAttemptAt.Time
+	}
+	if lastAttemptAt.Valid {
+		d.LastAttemptAt = &lastAttemptAt.Time
+	}
+	if deliveredAt.Valid {
+		d.DeliveredAt = &deliveredAt.Time
+	}
+	if responseStatus.Valid {
+		status := int(responseStatus.Int64)
+		d.ResponseStatus = &status
+	}
+	if responseBody.Valid {
+		d.ResponseBody = &responseBody.String
+	}
+	if errText.Valid {
+		d.Error = &errText.String
+	}
+	if redeliveryOf.Valid {
+		d.RedeliveryOf = &redeliveryOf.Int64
+	}
+	return nil
+}
+
+// Deliveries returns a subscription's delivery log, newest first,
+// optionally filtered by status.
+func (ws *WebhookService) Deliveries(subscriptionID int, status string, limit int) ([]models.WebhookDelivery, error) {
+	if _, err := ws.Get(subscriptionID); err != nil {
+		return nil, err
+	}
+
+	query := "SELECT " + deliveryColumns + " FROM webhook_deliveries WHERE subscription_id = $1"
+	args := []interface{}{subscriptionID}
+	if status != "" {
+		query += " AND status = $2"
+		args = append(args, status)
+	}
+	query += " ORDER BY created_at DESC, id DESC LIMIT $" + strconv.Itoa(len(args)+1)
+	args = append(args, limit)
+
+	rows, err := ws.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		var d models.WebhookDelivery
+		if err := scanDelivery(rows, &d); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// Redeliver queues a fresh copy of a delivery with the same event ID and
+// payload, whatever the outcome of the original was.
+func (ws *WebhookService) Redeliver(deliveryID int64) (*models.WebhookDelivery, error) {
+	var d models.WebhookDelivery
+	err := scanDelivery(ws.db.QueryRow(`
+		INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload, next_attempt_at, redelivery_of)
+		SELECT subscription_id, event_id, event_type, payload, NOW(), id
+		FROM webhook_deliveries WHERE id = $1
+		RETURNING `+deliveryColumns, deliveryID), &d)
+	if err == sql.ErrNoRows {
+		return nil, ErrWebhookDeliveryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	ws.notify()
+	return &d, nil
+}
+
+// Enqueue records a delivery of e for every active subscription whose
+// event types match it. It is subscribed to the event bus.
+func (ws *WebhookService) Enqueue(e events.Event) {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("Failed to encode %s event for webhooks: %v", e.Type, err)
+		return
+	}
+
+	// 'location.*' matches 'location.created' through LIKE 'location.%'
+	result, err := ws.db.Exec(`
+		INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload, next_attempt_at)
+		SELECT s.id, $1::text, $2::text, $3::jsonb, NOW()
+		FROM webhook_subscriptions s
+		WHERE s.is_active = true AND EXISTS (
+			SELECT 1 FROM unnest(s.event_types) AS p
+			WHERE p = $2::text OR p = '*' OR (p LIKE '%.*' AND $2::text LIKE left(p, -1) || '%')
+		)
+	`, e.ID, e.Type, string(payload))
+	if err != nil {
+		log.Printf("Failed to queue webhook deliveries for %s event %s: %v", e.Type, e.ID, err)
+		return
+	}
+	if queued, _ := result.RowsAffected(); queued > 0 {
+		ws.notify()
+	}
+}
+
+func (ws *WebhookService) notify() {
+	select {
+	case ws.wake <- struct{}{}:
+	default:
+	}
+}
+
+type dueDelivery struct {
+	id        int64
+	url       string
+	secret    string
+	eventID   string
+	eventType string
+	payload   []byte
+	attempts  int
+}
+
+// DispatchDue sends up to one batch of due deliveries and returns how many
+// it attempted. Claimed rows are leased so that another instance does not
+// send them at the same time.
+func (ws *WebhookService) DispatchDue(ctx context.Context) (int, error) {
+	rows, err := ws.db.QueryContext(ctx, `
+		UPDATE webhook_deliveries d SET next_attempt_at = $1
+		FROM webhook_subscriptions s
+		WHERE s.id = d.subscription_id AND d.id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING d.id, s.url, s.secret, d.event_id, d.event_type, d.payload, d.attempts
+	`, time.Now().Add(webhookLease), webhookBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	var due []dueDelivery
+	for rows.Next() {
+		var d dueDelivery
+		if err := rows.Scan(&d.id, &d.url, &d.secret, &d.eventID, &d.eventType, &d.payload, &d.attempts); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		due = append(due, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	sem := make(chan struct{}, ws.concurrency)
+	var wg sync.WaitGroup
+	for _, d := range due {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(d dueDelivery) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if err := ws.attempt(ctx, d); err != nil {
+				log.Printf("Failed to record webhook delivery %d: %v", d.id, err)
+			}
+		}(d)
+	}
+	wg.Wait()
+
+	return len(due), nil
+}
+
+// attempt POSTs one delivery and records the outcome.
+func (ws *WebhookService) attempt(ctx context.Context, d dueDelivery) error {
+	now := time.Now()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.url, bytes.NewReader(d.payload))
+	if err != nil {
+		return ws.recordAttempt(d, now, nil, "", err.Error())
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "cctv-api-webhooks/1")
+	req.Header.Set("X-Webhook-Event", d.eventType)
+	req.Header.Set("X-Webhook-Event-Id", d.eventID)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatInt(d.id, 10))
+	req.Header.Set(webhooks.SignatureHeader, webhooks.Sign(d.secret, now, d.payload))
+
+	resp, err := ws.client.Do(req)
+	if err != nil {
+		return ws.recordAttempt(d, now, nil, "", err.Error())
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, webhookResponseLimit))
+	resp.Body.Close()
+
+	status := resp.StatusCode
+	if status >= 200 && status <= 299 {
+		return ws.recordAttempt(d, now, &status, string(body), "")
+	}
+	return ws.recordAttempt(d, now, &status, string(body), "receiver responded with HTTP "+strconv.Itoa(status))
+}
+
+func (ws *WebhookService) recordAttempt(d dueDelivery, at time.Time, responseStatus *int, responseBody, errText string) error {
+	attempts := d.attempts + 1
+
+	var status string
+	var nextAttemptAt, deliveredAt interface{}
+	switch {
+	case errText == "":
+		status = "succeeded"
+		deliveredAt = time.Now()
+	case attempts >= ws.maxAttempts:
+		status = "failed"
+	default:
+		status = "pending"
+		nextAttemptAt = time.Now().Add(ws.backoff(attempts))
+	}
+
+	var body, errValue interface{}
+	if responseBody != "" {
+		body = responseBody
+	}
+	if errText != "" {
+		errValue = errText
+	}
+
+	_, err := ws.db.Exec(`
+		UPDATE webhook_deliveries SET
+			status = $1, attempts = $2, next_attempt_at = $3, last_attempt_at = $4,
+			response_status = $5, response_body = $6, error = $7, delivered_at = $8
+		WHERE id = $9
+	`, status, attempts, nextAttemptAt, at, responseStatus, body, errValue, deliveredAt, d.id)
+	return err
+}
+
+// backoff doubles the delay after every failed attempt, with up to 10%
+// jitter so that retries to one receiver do not arrive in lockstep.
+func (ws *WebhookService) backoff(attempts int) time.Duration {
+	delay := ws.retryBase
+	for i := 1; i < attempts && delay < webhookMaxRetryBackoff; i++ {
+		delay *= 2
+	}
+	if delay > webhookMaxRetryBackoff {
+		delay = webhookMaxRetryBackoff
+	}
+	return delay + time.Duration(mathrand.Int64N(int64(delay/10)+1))
+}
+
+// PruneDeliveries deletes finished deliveries older than the retention period.
+func (ws *WebhookService) PruneDeliveries() (int64, error) {
+	if ws.retention <= 0 {
+		return 0, nil
+	}
+	result, err := ws.db.Exec(`
+		DELETE FROM webhook_deliveries WHERE status <> 'pending' AND created_at < $1
+	`, time.Now().Add(-ws.retention))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// RunDispatcher sends due deliveries every interval, and straight away when
+// new ones are queued, until ctx is cancelled.
+func (ws *WebhookService) RunDispatcher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	lastPrune := time.Time{}
+	for {
+		sent, err := ws.DispatchDue(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Failed to dispatch webhooks: %v", err)
+		}
+
+		if time.Since(lastPrune) > 24*time.Hour {
+			if pruned, err := ws.PruneDeliveries(); err != nil {
+				log.Printf("Failed to prune webhook deliveries: %v", err)
+			} else if pruned > 0 {
+				log.Printf("Pruned %d webhook delivery row(s)", pruned)
+			}
+			lastPrune = time.Now()
+		}
+
+		// A full batch means more are probably due
+		if sent == webhookBatchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-ws.wake:
+		}
+	}
+}
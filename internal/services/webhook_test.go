@@ -0,0 +1,42 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cctv-api/internal/netguard"
+)
+
+func TestWebhookClient(t *testing.T) {
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("internal"))
+	}))
+	defer internal.Close()
+	redirect := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, internal.URL, http.StatusFound)
+	}))
+	defer redirect.Close()
+
+	// httptest listens on loopback, which the guard refuses unless allowed
+	allowLoopback, err := netguard.Parse("127.0.0.1, ::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blocked := NewWebhookService(nil, nil, 1, 0, 1, 0)
+	if _, err := blocked.client.Post(internal.URL, "application/json", nil); !errors.Is(err, netguard.ErrBlocked) {
+		t.Errorf("POST to loopback error = %v, want ErrBlocked", err)
+	}
+
+	allowed := NewWebhookService(nil, allowLoopback, 1, 0, 1, 0)
+	resp, err := allowed.client.Post(redirect.URL, "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Errorf("status %d, want the receiver's own 302 rather than the redirect target", resp.StatusCode)
+	}
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidLink = errors.New("invalid download link")
+	ErrLinkExpired = errors.New("download link expired")
+)
+
+// LinkPath is where this API serves signed downloads: LinkPath + key.
+const LinkPath = "/files/"
+
+// URLSigner signs download links served by this API under LinkPath, for
+// backends that cannot sign their own.
+type URLSigner struct {
+	secret  []byte
+	baseURL string
+}
+
+// NewURLSigner signs links with secret; baseURL is the public address of
+// this API.
+func NewURLSigner(secret, baseURL string) *URLSigner {
+	return &URLSigner{secret: []byte(secret), baseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+// URL returns a link to key that works until expiresAt.
+func (s *URLSigner) URL(key string, expiresAt time.Time) string {
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+	return s.baseURL + LinkPath + (&url.URL{Path: key}).EscapedPath() +
+		"?expires=" + expires + "&sig=" + s.sign(key, expires)
+}
+
+// Verify checks the expires and sig parameters of a link to key.
+func (s *URLSigner) Verify(key, expires, sig string, now time.Time) error {
+	if !hmac.Equal([]byte(sig), []byte(s.sign(key, expires))) {
+		return ErrInvalidLink
+	}
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return ErrInvalidLink
+	}
+	if !now.Before(time.Unix(unix, 0)) {
+		return ErrLinkExpired
+	}
+	return nil
+}
+
+func (s *URLSigner) sign(key, expires string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(key + "\n" + expires))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestURLSigner(t *testing.T) {
+	signer := NewURLSigner("secret", "https://api.example.com/")
+	now := time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)
+	const key = "recordings/cam 1/clip.mp4"
+
+	link := signer.URL(key, now.Add(time.Hour))
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "https://api.example.com/files/recordings/cam%201/clip.mp4"; !strings.HasPrefix(link, want+"?") {
+		t.Fatalf("URL() = %q, want it below %q", link, want)
+	}
+	gotKey := strings.TrimPrefix(u.Path, LinkPath)
+	expires, sig := u.Query().Get("expires"), u.Query().Get("sig")
+
+	tests := []struct {
+		name    string
+		signer  *URLSigner
+		key     string
+		expires string
+		sig     string
+		at      time.Time
+		wantErr error
+	}{
+		{"valid", signer, gotKey, expires, sig, now, nil},
+		{"valid a second before expiry", signer, gotKey, expires, sig, now.Add(time.Hour - time.Second), nil},
+		{"expired", signer, gotKey, expires, sig, now.Add(time.Hour), ErrLinkExpired},
+		{"other key", signer, "recordings/cam 1/other.mp4", expires, sig, now, ErrInvalidLink},
+		{"extended expiry", signer, gotKey, "99999999999", sig, now, ErrInvalidLink},
+		{"tampered signature", signer, gotKey, expires, sig[:len(sig)-1] + "A", now, ErrInvalidLink},
+		{"missing signature", signer, gotKey, expires, "", now, ErrInvalidLink},
+		{"other secret", NewURLSigner("other", "https://api.example.com"), gotKey, expires, sig, now, ErrInvalidLink},
+	}
+
+	for _, tt := range tests {
+		if err := tt.signer.Verify(tt.key, tt.expires, tt.sig, tt.at); err != tt.wantErr {
+			t.Errorf("%s: Verify() = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestURLSignerRejectsUnparsableExpiry(t *testing.T) {
+	signer := NewURLSigner("secret", "")
+	// A signature over a malformed expiry is still not a valid link
+	sig := signer.sign("a.jpg", "soon")
+	if err := signer.Verify("a.jpg", "soon", sig, time.Now()); err != ErrInvalidLink {
+		t.Errorf("Verify() = %v, want ErrInvalidLink", err)
+	}
+}
@@ -0,0 +1,322 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	sigAlgorithm      = "AWS4-HMAC-SHA256"
+	unsignedPayload   = "UNSIGNED-PAYLOAD"
+	maxPresignSeconds = 7 * 24 * 60 * 60
+)
+
+type S3Options struct {
+	// e.g. "https://s3.eu-west-1.amazonaws.com" or "http://localhost:9000"
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// Address the bucket as endpoint/bucket instead of bucket.endpoint, as
+	// MinIO and most self-hosted servers expect
+	PathStyle bool
+	Timeout   time.Duration
+}
+
+// S3 stores objects in a bucket of an S3-compatible server, signing
+// requests with AWS Signature Version 4.
+type S3 struct {
+	opts     S3Options
+	endpoint *url.URL
+	client   *http.Client
+	now      func() time.Time
+}
+
+func NewS3(opts S3Options) (*S3, error) {
+	endpoint, err := url.Parse(strings.TrimSuffix(opts.Endpoint, "/"))
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, errors.New("S3 endpoint must be an http or https URL")
+	}
+	if opts.Bucket == "" {
+		return nil, errors.New("S3 bucket is required")
+	}
+	if opts.Region == "" {
+		opts.Region = "us-east-1"
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 30 * time.Second
+	}
+	return &S3{
+		opts:     opts,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: opts.Timeout},
+		now:      time.Now,
+	}, nil
+}
+
+// objectURL returns the URL of key, with its path already escaped the way
+// the signature expects.
+func (s *S3) objectURL(key string) (string, string) {
+	host := s.endpoint.Host
+	path := s.endpoint.Path + "/" + uriEncode(key, false)
+	if s.opts.PathStyle {
+		path = s.endpoint.Path + "/" + uriEncode(s.opts.Bucket, true) + "/" + uriEncode(key, false)
+	} else {
+		host = s.opts.Bucket + "." + host
+	}
+	return s.endpoint.Scheme + "://" + host + path, host
+}
+
+func (s *S3) Put(ctx context.Context, key string, body io.Reader, contentType string) (*Object, error) {
+	if !ValidKey(key) {
+		return nil, ErrInvalidKey
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+
+	resp, err := s.do(ctx, http.MethodPut, key, data, hex.EncodeToString(sum[:]), contentType)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, s.errorFrom(resp, http.MethodPut, key)
+	}
+	return &Object{
+		Key:         key,
+		Size:        int64(len(data)),
+		ContentType: contentType,
+		ETag:        resp.Header.Get("ETag"),
+		ModTime:     s.now().UTC().Truncate(time.Second),
+	}, nil
+}
+
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, *Object, error) {
+	if !ValidKey(key) {
+		return nil, nil, ErrInvalidKey
+	}
+	resp, err := s.do(ctx, http.MethodGet, key, nil, emptySHA256, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, nil, s.errorFrom(resp, http.MethodGet, key)
+	}
+	return resp.Body, objectFromHeader(key, resp), nil
+}
+
+func (s *S3) Stat(ctx context.Context, key string) (*Object, error) {
+	if !ValidKey(key) {
+		return nil, ErrInvalidKey
+	}
+	resp, err := s.do(ctx, http.MethodHead, key, nil, emptySHA256, "")
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, s.errorFrom(resp, http.MethodHead, key)
+	}
+	return objectFromHeader(key, resp), nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	if !ValidKey(key) {
+		return ErrInvalidKey
+	}
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, emptySHA256, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusNotFound:
+		return nil
+	}
+	return s.errorFrom(resp, http.MethodDelete, key)
+}
+
+// SignedURL presigns a GET of key. S3 accepts at most seven days.
+func (s *S3) SignedURL(key string, expiresAt time.Time) (string, error) {
+	if !ValidKey(key) {
+		return "", ErrInvalidKey
+	}
+	now := s.now().UTC()
+	seconds := int64(expiresAt.Sub(now) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	if seconds > maxPresignSeconds {
+		seconds = maxPresignSeconds
+	}
+
+	rawURL, host := s.objectURL(key)
+	amzDate := now.Format("20060102T150405Z")
+	query := url.Values{
+		"X-Amz-Algorithm":     {sigAlgorithm},
+		"X-Amz-Credential":    {s.opts.AccessKey + "/" + s.scope(amzDate)},
+		"X-Amz-Date":          {amzDate},
+		"X-Amz-Expires":       {strconv.FormatInt(seconds, 10)},
+		"X-Amz-SignedHeaders": {"host"},
+	}
+	path := rawURL[strings.Index(rawURL, host)+len(host):]
+	canonicalQuery := canonicalQueryString(query)
+	canonical := http.MethodGet + "\n" + path + "\n" + canonicalQuery + "\n" +
+		"host:" + host + "\n\n" + "host\n" + unsignedPayload
+	signature := s.signature(amzDate, canonical)
+
+	return rawURL + "?" + canonicalQuery + "&X-Amz-Signature=" + signature, nil
+}
+
+// emptySHA256 is the payload hash of requests without a body.
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+func (s *S3) do(ctx context.Context, method, key string, body []byte, payloadHash, contentType string) (*http.Response, error) {
+	rawURL, host := s.objectURL(key)
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		req.Body = http.NoBody
+		req.ContentLength = 0
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	amzDate := s.now().UTC().Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{
+		"host":                 host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           amzDate,
+	}
+	if contentType != "" {
+		headers["content-type"] = contentType
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := rawURL[strings.Index(rawURL, host)+len(host):]
+	canonical := method + "\n" + path + "\n\n" + canonicalHeaders.String() + "\n" + signedHeaders + "\n" + payloadHash
+	req.Header.Set("Authorization", sigAlgorithm+" Credential="+s.opts.AccessKey+"/"+s.scope(amzDate)+
+		", SignedHeaders="+signedHeaders+", Signature="+s.signature(amzDate, canonical))
+
+	return s.client.Do(req)
+}
+
+// scope is the credential scope of a request made at amzDate.
+func (s *S3) scope(amzDate string) string {
+	return amzDate[:8] + "/" + s.opts.Region + "/s3/aws4_request"
+}
+
+func (s *S3) signature(amzDate, canonicalRequest string) string {
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := sigAlgorithm + "\n" + amzDate + "\n" + s.scope(amzDate) + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.opts.SecretKey), amzDate[:8])
+	key = hmacSHA256(key, s.opts.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// uriEncode escapes everything but unreserved characters, as SigV4
+// requires. Slashes are kept in object keys.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func canonicalQueryString(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func objectFromHeader(key string, resp *http.Response) *Object {
+	obj := &Object{
+		Key:         key,
+		Size:        resp.ContentLength,
+		ContentType: resp.Header.Get("Content-Type"),
+		ETag:        resp.Header.Get("ETag"),
+	}
+	if modTime, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		obj.ModTime = modTime
+	}
+	return obj
+}
+
+// errorFrom turns a failed response into ErrNotFound or an error carrying
+// S3's error code.
+func (s *S3) errorFrom(resp *http.Response, method, key string) error {
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	var body struct {
+		Code string `xml:"Code"`
+	}
+	xml.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&body)
+	if body.Code != "" {
+		return fmt.Errorf("S3 %s %s: HTTP %d (%s)", method, key, resp.StatusCode, body.Code)
+	}
+	return fmt.Errorf("S3 %s %s: HTTP %d", method, key, resp.StatusCode)
+}
@@ -0,0 +1,85 @@
+// Package storage keeps files such as camera snapshots, profile photos and
+// report exports behind a small blob interface, with a local filesystem
+// backend and an S3-compatible one, so that where they live can change
+// without touching the code that produces them.
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+var (
+	ErrNotFound        = errors.New("object not found")
+	ErrInvalidKey      = errors.New("invalid object key")
+	ErrTooLarge        = errors.New("file too large")
+	ErrUnsupportedType = errors.New("unsupported file type")
+)
+
+// Object describes a stored object.
+type Object struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ETag        string
+	ModTime     time.Time
+}
+
+// Store holds objects under slash-separated keys such as
+// "snapshots/12/medium.jpg".
+type Store interface {
+	Put(ctx context.Context, key string, body io.Reader, contentType string) (*Object, error)
+	// Get returns the object's content; the caller closes it
+	Get(ctx context.Context, key string) (io.ReadCloser, *Object, error)
+	Stat(ctx context.Context, key string) (*Object, error)
+	// Delete does not fail for objects that do not exist
+	Delete(ctx context.Context, key string) error
+	// SignedURL returns a URL that downloads the object without any other
+	// credentials until expiresAt
+	SignedURL(key string, expiresAt time.Time) (string, error)
+}
+
+// ValidKey reports whether key is a relative, slash-separated path that
+// stays inside the store.
+func ValidKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.ContainsAny(key, "\\\x00") {
+		return false
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// ContentKey returns a content-addressed key for data below prefix, such as
+// "photos/3f/3fa4…e1.jpg". Identical content always gets the same key, so
+// storing it twice costs nothing and keys can be cached forever.
+func ContentKey(prefix string, data []byte, ext string) string {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	return strings.TrimSuffix(prefix, "/") + "/" + hash[:2] + "/" + hash + ext
+}
+
+// Check sniffs the type of data from its content, not its name, and returns
+// the MIME type and its usual extension. It fails with ErrTooLarge for data
+// over maxBytes and with ErrUnsupportedType when allowed is not empty and
+// does not include the type.
+func Check(data []byte, maxBytes int64, allowed ...string) (string, string, error) {
+	if maxBytes > 0 && int64(len(data)) > maxBytes {
+		return "", "", ErrTooLarge
+	}
+	mtype := mimetype.Detect(data)
+	if len(allowed) > 0 && !mimetype.EqualsAny(mtype.String(), allowed...) {
+		return "", "", ErrUnsupportedType
+	}
+	return mtype.String(), mtype.Extension(), nil
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestValidKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"photo.jpg", true},
+		{"photos/3f/3fa4.jpg", true},
+		{"recordings/cam 1/clip..mp4", true},
+		{".hidden", true},
+		{"", false},
+		{"/etc/passwd", false},
+		{"../secret", false},
+		{"photos/../../secret", false},
+		{"photos/./a.jpg", false},
+		{"photos//a.jpg", false},
+		{"photos/", false},
+		{".", false},
+		{"..", false},
+		{`photos\..\secret`, false},
+		{"photo\x00.jpg", false},
+	}
+
+	for _, tt := range tests {
+		if got := ValidKey(tt.key); got != tt.want {
+			t.Errorf("ValidKey(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestContentKey(t *testing.T) {
+	tests := []struct {
+		prefix string
+		data   string
+		ext    string
+		want   string
+	}{
+		{"photos", "", ".jpg", "photos/e3/e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855.jpg"},
+		{"photos/", "", ".jpg", "photos/e3/e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855.jpg"},
+		{"snapshots", "abc", "", "snapshots/ba/ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+	}
+
+	for _, tt := range tests {
+		got := ContentKey(tt.prefix, []byte(tt.data), tt.ext)
+		if got != tt.want {
+			t.Errorf("ContentKey(%q, %q, %q) = %q, want %q", tt.prefix, tt.data, tt.ext, got, tt.want)
+		}
+		if !ValidKey(got) {
+			t.Errorf("ContentKey(%q, %q, %q) = %q is not a valid key", tt.prefix, tt.data, tt.ext, got)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00\x1f\x15\xc4\x89")
+	jpeg := append([]byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00"), bytes.Repeat([]byte{0}, 32)...)
+	html := []byte("<!DOCTYPE html><html><body>photo.jpg</body></html>")
+
+	tests := []struct {
+		name     string
+		data     []byte
+		maxBytes int64
+		allowed  []string
+		wantType string
+		wantExt  string
+		wantErr  error
+	}{
+		{"png", png, 1024, []string{"image/jpeg", "image/png"}, "image/png", ".png", nil},
+		{"jpeg", jpeg, 1024, []string{"image/jpeg", "image/png"}, "image/jpeg", ".jpg", nil},
+		{"any type allowed", html, 0, nil, "text/html; charset=utf-8", ".html", nil},
+		{"html posing as an image", html, 1024, []string{"image/jpeg", "image/png"}, "", "", ErrUnsupportedType},
+		{"exactly the limit", png, int64(len(png)), nil, "image/png", ".png", nil},
+		{"over the limit", png, int64(len(png)) - 1, nil, "", "", ErrTooLarge},
+		{"size checked before type", []byte(strings.Repeat("x", 10)), 5, []string{"image/png"}, "", "", ErrTooLarge},
+	}
+
+	for _, tt := range tests {
+		mtype, ext, err := Check(tt.data, tt.maxBytes, tt.allowed...)
+		if err != tt.wantErr || mtype != tt.wantType || ext != tt.wantExt {
+			t.Errorf("%s: Check() = %q, %q, %v; want %q, %q, %v", tt.name, mtype, ext, err, tt.wantType, tt.wantExt, tt.wantErr)
+		}
+	}
+}
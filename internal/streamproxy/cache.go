@@ -0,0 +1,106 @@
+package streamproxy
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Object is an upstream response held in memory.
+type Object struct {
+	ContentType  string
+	ETag         string
+	LastModified time.Time
+	Body         []byte
+	Playlist     bool
+
+	expires time.Time
+}
+
+// Cache keeps recently fetched objects up to a total size, evicting the
+// least recently used first. Concurrent requests for the same key share a
+// single fetch. It is safe for concurrent use.
+type Cache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	lru      *list.List // of *cacheEntry, most recently used at the front
+	entries  map[string]*list.Element
+	inflight map[string]*fetchCall
+}
+
+type cacheEntry struct {
+	key string
+	obj *Object
+}
+
+type fetchCall struct {
+	done chan struct{}
+	obj  *Object
+	err  error
+}
+
+func NewCache(maxBytes int64) *Cache {
+	return &Cache{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+		inflight: make(map[string]*fetchCall),
+	}
+}
+
+// Get returns the cached object for key, or calls fetch once for all
+// concurrent callers. fetch returns the object and how long it may be
+// cached; objects with no TTL, or too big for the cache, are only shared
+// with the callers already waiting.
+func (c *Cache) Get(key string, fetch func() (*Object, time.Duration, error)) (*Object, error) {
+	c.mu.Lock()
+	if el, ok := c.entries[key]; ok {
+		entry := el.Value.(*cacheEntry)
+		if time.Now().Before(entry.obj.expires) {
+			c.lru.MoveToFront(el)
+			c.mu.Unlock()
+			return entry.obj, nil
+		}
+		c.remove(el)
+	}
+	if call, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+		<-call.done
+		return call.obj, call.err
+	}
+	call := &fetchCall{done: make(chan struct{})}
+	c.inflight[key] = call
+	c.mu.Unlock()
+
+	obj, ttl, err := fetch()
+	call.obj, call.err = obj, err
+
+	c.mu.Lock()
+	delete(c.inflight, key)
+	if err == nil && ttl > 0 && int64(len(obj.Body)) <= c.maxBytes/4 {
+		obj.expires = time.Now().Add(ttl)
+		c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, obj: obj})
+		c.size += int64(len(obj.Body))
+		for c.size > c.maxBytes {
+			c.remove(c.lru.Back())
+		}
+	}
+	c.mu.Unlock()
+	close(call.done)
+
+	return obj, err
+}
+
+func (c *Cache) remove(el *list.Element) {
+	entry := c.lru.Remove(el).(*cacheEntry)
+	delete(c.entries, entry.key)
+	c.size -= int64(len(entry.obj.Body))
+}
+
+// Size returns the number of bytes cached.
+func (c *Cache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
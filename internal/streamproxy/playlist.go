@@ -0,0 +1,67 @@
+package streamproxy
+
+import (
+	"bufio"
+	"bytes"
+	"mime"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// uriAttribute matches URI="..." in tags such as EXT-X-KEY, EXT-X-MAP,
+// EXT-X-MEDIA and EXT-X-PART.
+var uriAttribute = regexp.MustCompile(`URI="([^"]*)"`)
+
+func isPlaylist(contentType, path string, body []byte) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/vnd.apple.mpegurl", "application/x-mpegurl", "audio/mpegurl", "audio/x-mpegurl":
+		return true
+	}
+	if strings.HasSuffix(strings.ToLower(path), ".m3u8") {
+		return true
+	}
+	return bytes.HasPrefix(body, []byte("#EXTM3U"))
+}
+
+// isMasterPlaylist reports whether an HLS playlist lists variant streams
+// rather than segments.
+func isMasterPlaylist(body []byte) bool {
+	return bytes.Contains(body, []byte("#EXT-X-STREAM-INF"))
+}
+
+// rewritePlaylist replaces every URI in an HLS playlist fetched from base
+// with what mapURI returns for it after resolving it against base.
+func rewritePlaylist(body []byte, base *url.URL, mapURI func(*url.URL) string) []byte {
+	resolve := func(ref string) string {
+		u, err := base.Parse(strings.TrimSpace(ref))
+		if err != nil {
+			return ref
+		}
+		return mapURI(u)
+	}
+
+	var out bytes.Buffer
+	out.Grow(len(body) + len(body)/2)
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			out.WriteString(line)
+		case strings.HasPrefix(trimmed, "#"):
+			out.WriteString(uriAttribute.ReplaceAllStringFunc(line, func(attr string) string {
+				ref := uriAttribute.FindStringSubmatch(attr)[1]
+				return `URI="` + resolve(ref) + `"`
+			}))
+		default:
+			out.WriteString(resolve(trimmed))
+		}
+		out.WriteByte('\n')
+	}
+	return out.Bytes()
+}
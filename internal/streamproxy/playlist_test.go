@@ -0,0 +1,89 @@
+package streamproxy
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestIsPlaylist(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		path        string
+		body        string
+		want        bool
+	}{
+		{"apple content type", "application/vnd.apple.mpegurl", "/live", "", true},
+		{"content type with parameters", "application/x-mpegURL; charset=utf-8", "/live", "", true},
+		{"m3u8 extension", "application/octet-stream", "/cam/INDEX.M3U8", "", true},
+		{"EXTM3U body", "text/plain", "/live", "#EXTM3U\n#EXT-X-VERSION:3\n", true},
+		{"segment", "video/mp2t", "/cam/seg-1.ts", "G@\x00", false},
+		{"fragmented mp4", "video/mp4", "/cam/init.mp4", "\x00\x00\x00\x18ftyp", false},
+	}
+
+	for _, tt := range tests {
+		if got := isPlaylist(tt.contentType, tt.path, []byte(tt.body)); got != tt.want {
+			t.Errorf("%s: isPlaylist() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestIsMasterPlaylist(t *testing.T) {
+	tests := []struct {
+		body string
+		want bool
+	}{
+		{"#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=800000\nlow.m3u8\n", true},
+		{"#EXTM3U\n#EXT-X-TARGETDURATION:2\n#EXTINF:2.0,\nseg-1.ts\n", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := isMasterPlaylist([]byte(tt.body)); got != tt.want {
+			t.Errorf("isMasterPlaylist(%q) = %v, want %v", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestRewritePlaylist(t *testing.T) {
+	base, _ := url.Parse("https://origin.example.com/cam/1/index.m3u8?auth=abc")
+	mapURI := func(u *url.URL) string { return "[" + u.String() + "]" }
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "relative segments",
+			in:   "#EXTM3U\n#EXTINF:2.0,\nseg-1.ts\n#EXTINF:2.0,\n  seg-2.ts  \n",
+			want: "#EXTM3U\n#EXTINF:2.0,\n[https://origin.example.com/cam/1/seg-1.ts]\n#EXTINF:2.0,\n[https://origin.example.com/cam/1/seg-2.ts]\n",
+		},
+		{
+			name: "absolute and root-relative URIs",
+			in:   "https://cdn.example.net/a.ts\n/other/b.ts\n../c.ts\n",
+			want: "[https://cdn.example.net/a.ts]\n[https://origin.example.com/other/b.ts]\n[https://origin.example.com/cam/c.ts]\n",
+		},
+		{
+			name: "URI attributes",
+			in:   "#EXT-X-KEY:METHOD=AES-128,URI=\"key.bin\",IV=0x1\n#EXT-X-MAP:URI=\"init.mp4\"\n",
+			want: "#EXT-X-KEY:METHOD=AES-128,URI=\"[https://origin.example.com/cam/1/key.bin]\",IV=0x1\n#EXT-X-MAP:URI=\"[https://origin.example.com/cam/1/init.mp4]\"\n",
+		},
+		{
+			name: "tags without URIs and blank lines kept",
+			in:   "#EXTM3U\n\n#EXT-X-MEDIA-SEQUENCE:7\n",
+			want: "#EXTM3U\n\n#EXT-X-MEDIA-SEQUENCE:7\n",
+		},
+		{
+			name: "CRLF line endings",
+			in:   "#EXTM3U\r\nseg-1.ts\r\n",
+			want: "#EXTM3U\n[https://origin.example.com/cam/1/seg-1.ts]\n",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := string(rewritePlaylist([]byte(tt.in), base, mapURI)); got != tt.want {
+			t.Errorf("%s: rewritePlaylist() =\n%q\nwant\n%q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,441 @@
+// Package streamproxy serves camera streams through this API so that
+// players never talk to the origin. HLS playlists are rewritten so that
+// every segment, key and sub-playlist URI points back at the proxy, and
+// upstream responses are cached briefly so that many viewers of one camera
+// cost a single upstream fetch. MJPEG streams and snapshot images are
+// relayed as they are.
+package streamproxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"cctv-api/internal/models"
+	"cctv-api/internal/netguard"
+)
+
+// Paths, below /stream/{id}/, of a camera's source URL by source type
+const (
+	RootPlaylist = "index.m3u8"
+	RootMJPEG    = "video.mjpeg"
+	RootSnapshot = "snapshot.jpg"
+)
+
+// sealedPrefix marks paths that carry an encrypted upstream URL, used for
+// URIs outside the source playlist's directory.
+const sealedPrefix = "_/"
+
+// nominalBandwidth is declared for the single variant of a wrapped media
+// playlist; with nothing to choose between, players do not act on it.
+const nominalBandwidth = 2_000_000
+
+var (
+	ErrNotFound = errors.New("stream resource not found")
+	errTooLarge = errors.New("upstream object too large to cache")
+)
+
+// UpstreamError is a non-2xx answer from the origin.
+type UpstreamError struct {
+	Status int
+}
+
+func (e *UpstreamError) Error() string {
+	return fmt.Sprintf("upstream returned HTTP %d", e.Status)
+}
+
+type Options struct {
+	Timeout time.Duration
+	// Idle upstream connections kept per origin host
+	MaxIdleConnsPerHost int
+	// Total size of the in-memory cache and the largest single object
+	// fetched into it; larger responses are streamed straight through
+	CacheBytes     int64
+	MaxObjectBytes int64
+	// How long playlists and segments are served from the cache
+	PlaylistTTL time.Duration
+	SegmentTTL  time.Duration
+	// Key material for sealing upstream URLs into proxy paths
+	Secret string
+	// Addresses upstreams may resolve to, including URIs named inside
+	// playlists; nil refuses internal addresses
+	Guard *netguard.Guard
+}
+
+// Proxy fetches and rewrites camera streams. It is safe for concurrent use.
+type Proxy struct {
+	client *http.Client
+	cache  *Cache
+	opts   Options
+	aead   cipher.AEAD
+	macKey []byte
+}
+
+func New(opts Options) *Proxy {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 15 * time.Second
+	}
+	if opts.MaxIdleConnsPerHost <= 0 {
+		opts.MaxIdleConnsPerHost = 32
+	}
+	if opts.CacheBytes <= 0 {
+		opts.CacheBytes = 64 << 20
+	}
+	if opts.MaxObjectBytes <= 0 {
+		opts.MaxObjectBytes = 8 << 20
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = opts.Guard.Dialer(opts.Timeout).DialContext
+	transport.MaxIdleConns = 0
+	transport.MaxIdleConnsPerHost = opts.MaxIdleConnsPerHost
+	transport.ResponseHeaderTimeout = opts.Timeout
+
+	key := sha256.Sum256([]byte("stream-proxy:" + opts.Secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		// A 32-byte key is always valid
+		panic(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		panic(err)
+	}
+
+	macKey := sha256.Sum256([]byte("stream-proxy-nonce:" + opts.Secret))
+
+	return &Proxy{
+		client: &http.Client{Transport: transport},
+		cache:  NewCache(opts.CacheBytes),
+		opts:   opts,
+		aead:   aead,
+		macKey: macKey[:],
+	}
+}
+
+// Serve answers a player's request for rest, the path below
+// /stream/{cctvID}/, of the camera streamed from sourceURL. query is added
+// to every URI in rewritten playlists so that follow-up requests carry
+// credentials; it may differ from what the request itself carried.
+func (p *Proxy) Serve(w http.ResponseWriter, r *http.Request, cctvID int, sourceURL, sourceType, rest string, query url.Values) {
+	switch sourceType {
+	case models.SourceMJPEG:
+		p.serveMJPEG(w, r, sourceURL, rest)
+		return
+	case models.SourceSnapshot:
+		p.serveSnapshot(w, r, sourceURL, rest)
+		return
+	case models.SourceHLS:
+	default:
+		// RTSP and embeds are not played through the proxy
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	upstream, err := p.upstreamURL(cctvID, sourceURL, rest)
+	if err != nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	key := upstream.String()
+	obj, err := p.cache.Get(key, func() (*Object, time.Duration, error) {
+		return p.fetch(key)
+	})
+	if err == errTooLarge {
+		p.streamThrough(w, r, key)
+		return
+	}
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+
+	if obj.Playlist {
+		prefix := "/stream/" + strconv.Itoa(cctvID) + "/"
+		suffix := ""
+		if encoded := query.Encode(); encoded != "" {
+			suffix = "?" + encoded
+		}
+		var body []byte
+		if rest == RootPlaylist && !isMasterPlaylist(obj.Body) {
+			// Players reload a live media playlist from the URL they opened,
+			// whose credentials may be short-lived. Wrapped in a master
+			// playlist with one variant, they reload the variant URI instead,
+			// which carries query.
+			body = []byte("#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=" + strconv.Itoa(nominalBandwidth) + "\n" +
+				prefix + sealedPrefix + p.seal(cctvID, sourceURL) + suffix + "\n")
+		} else {
+			body = rewritePlaylist(obj.Body, upstream, func(u *url.URL) string {
+				return prefix + p.proxyPath(cctvID, sourceURL, u) + suffix
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		// Live playlists change every segment
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(http.StatusOK)
+		if r.Method != http.MethodHead {
+			w.Write(body)
+		}
+		return
+	}
+
+	if obj.ContentType != "" {
+		w.Header().Set("Content-Type", obj.ContentType)
+	}
+	w.Header().Set("ETag", obj.ETag)
+	// URLs carry per-viewer tokens, so only the player may cache them
+	w.Header().Set("Cache-Control", "private, max-age="+strconv.Itoa(int(p.opts.SegmentTTL.Seconds())))
+	http.ServeContent(w, r, "", obj.LastModified, bytes.NewReader(obj.Body))
+}
+
+// serveMJPEG relays a live MJPEG stream. Every viewer gets their own
+// upstream connection since the stream never ends.
+func (p *Proxy) serveMJPEG(w http.ResponseWriter, r *http.Request, sourceURL, rest string) {
+	if rest != RootMJPEG || !isHTTPURL(sourceURL) {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	p.relay(w, r, sourceURL, "no-store")
+}
+
+// serveSnapshot serves a camera's still image. Viewers reload it every few
+// seconds, so it is cached for as long as a playlist.
+func (p *Proxy) serveSnapshot(w http.ResponseWriter, r *http.Request, sourceURL, rest string) {
+	if rest != RootSnapshot || !isHTTPURL(sourceURL) {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	obj, err := p.cache.Get(sourceURL, func() (*Object, time.Duration, error) {
+		obj, _, err := p.fetch(sourceURL)
+		return obj, p.opts.PlaylistTTL, err
+	})
+	if err == errTooLarge {
+		p.relay(w, r, sourceURL, "no-cache")
+		return
+	}
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+
+	if obj.ContentType != "" {
+		w.Header().Set("Content-Type", obj.ContentType)
+	}
+	w.Header().Set("ETag", obj.ETag)
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeContent(w, r, "", obj.LastModified, bytes.NewReader(obj.Body))
+}
+
+func isHTTPURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https")
+}
+
+// upstreamURL maps a proxy path back to the origin URL it stands for.
+func (p *Proxy) upstreamURL(cctvID int, sourceURL, rest string) (*url.URL, error) {
+	source, err := url.Parse(sourceURL)
+	if err != nil || (source.Scheme != "http" && source.Scheme != "https") {
+		return nil, ErrNotFound
+	}
+
+	switch {
+	case rest == RootPlaylist:
+		return source, nil
+	case strings.HasPrefix(rest, sealedPrefix):
+		return p.unseal(cctvID, strings.TrimPrefix(rest, sealedPrefix))
+	}
+
+	// Plain paths are relative to the source playlist's directory and may
+	// not climb out of it
+	cleaned := path.Clean("/" + rest)
+	if cleaned != "/"+rest || strings.Contains(rest, "..") || strings.ContainsAny(rest, "?#%\\") {
+		return nil, ErrNotFound
+	}
+	return source.Parse(rest)
+}
+
+// proxyPath is the inverse of upstreamURL.
+func (p *Proxy) proxyPath(cctvID int, sourceURL string, u *url.URL) string {
+	if u.String() == sourceURL {
+		return RootPlaylist
+	}
+
+	source, err := url.Parse(sourceURL)
+	if err == nil && u.Scheme == source.Scheme && u.Host == source.Host && u.RawQuery == "" && u.Fragment == "" {
+		dir := source.Path[:strings.LastIndex(source.Path, "/")+1]
+		// Only paths that need no escaping, so they read back unchanged
+		rel, ok := strings.CutPrefix(u.Path, dir)
+		if ok && u.EscapedPath() == u.Path && rel != "" && rel != RootPlaylist &&
+			!strings.HasPrefix(rel, sealedPrefix) && !strings.Contains(rel, "..") && path.Clean("/"+rel) == "/"+rel {
+			return rel
+		}
+	}
+	return sealedPrefix + p.seal(cctvID, u.String())
+}
+
+// seal encrypts an upstream URL so that it can be handed to players without
+// revealing the origin. The nonce is derived from the URL, so the same URL
+// always seals to the same path and stays cacheable by players.
+func (p *Proxy) seal(cctvID int, rawURL string) string {
+	mac := hmac.New(sha256.New, p.macKey)
+	mac.Write([]byte(rawURL))
+	nonce := mac.Sum(nil)[:p.aead.NonceSize()]
+	sealed := p.aead.Seal(nonce, nonce, []byte(rawURL), []byte(strconv.Itoa(cctvID)))
+	return base64.RawURLEncoding.EncodeToString(sealed)
+}
+
+func (p *Proxy) unseal(cctvID int, token string) (*url.URL, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(data) < p.aead.NonceSize() {
+		return nil, ErrNotFound
+	}
+	nonce, ciphertext := data[:p.aead.NonceSize()], data[p.aead.NonceSize():]
+	plain, err := p.aead.Open(nil, nonce, ciphertext, []byte(strconv.Itoa(cctvID)))
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	return url.Parse(string(plain))
+}
+
+// fetch loads an upstream object into memory. It runs on behalf of every
+// waiting viewer, so it is not tied to any one request's context.
+func (p *Proxy) fetch(rawURL string) (*Object, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.opts.Timeout)
+	defer cancel()
+
+	resp, err := p.get(ctx, rawURL)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, 0, &UpstreamError{Status: resp.StatusCode}
+	}
+	if resp.ContentLength > p.opts.MaxObjectBytes {
+		return nil, 0, errTooLarge
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, p.opts.MaxObjectBytes+1))
+	if err != nil {
+		return nil, 0, err
+	}
+	if int64(len(body)) > p.opts.MaxObjectBytes {
+		return nil, 0, errTooLarge
+	}
+
+	obj := &Object{
+		ContentType: resp.Header.Get("Content-Type"),
+		ETag:        resp.Header.Get("ETag"),
+		Body:        body,
+	}
+	obj.Playlist = isPlaylist(obj.ContentType, resp.Request.URL.Path, body)
+	if lm, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		obj.LastModified = lm
+	}
+	if obj.ETag == "" {
+		sum := sha1.Sum(body)
+		obj.ETag = `"` + hex.EncodeToString(sum[:]) + `"`
+	}
+
+	if obj.Playlist {
+		return obj, p.opts.PlaylistTTL, nil
+	}
+	return obj, p.opts.SegmentTTL, nil
+}
+
+// streamThrough relays a response too big for the cache without holding
+// it in memory.
+func (p *Proxy) streamThrough(w http.ResponseWriter, r *http.Request, rawURL string) {
+	p.relay(w, r, rawURL, "private, max-age="+strconv.Itoa(int(p.opts.SegmentTTL.Seconds())))
+}
+
+// relay copies an upstream response to the player as it arrives, flushing
+// as it goes so that live streams are not held in buffers.
+func (p *Proxy) relay(w http.ResponseWriter, r *http.Request, rawURL, cacheControl string) {
+	resp, err := p.get(r.Context(), rawURL)
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		writeUpstreamError(w, &UpstreamError{Status: resp.StatusCode})
+		return
+	}
+
+	for _, h := range []string{"Content-Type", "Content-Length", "ETag", "Last-Modified"} {
+		if v := resp.Header.Get(h); v != "" {
+			w.Header().Set(h, v)
+		}
+	}
+	w.Header().Set("Cache-Control", cacheControl)
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (p *Proxy) get(ctx context.Context, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "cctv-api-proxy/1.0")
+	return p.client.Do(req)
+}
+
+func writeUpstreamError(w http.ResponseWriter, err error) {
+	var upstream *UpstreamError
+	switch {
+	case errors.As(err, &upstream) && upstream.Status == http.StatusNotFound:
+		http.Error(w, "Not found", http.StatusNotFound)
+	case errors.Is(err, context.DeadlineExceeded):
+		http.Error(w, "Upstream timed out", http.StatusGatewayTimeout)
+	default:
+		http.Error(w, "Upstream unavailable", http.StatusBadGateway)
+	}
+}
+
+// CacheSize returns the bytes currently held in the segment cache.
+func (p *Proxy) CacheSize() int64 {
+	return p.cache.Size()
+}
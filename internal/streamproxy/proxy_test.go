@@ -0,0 +1,228 @@
+package streamproxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"cctv-api/internal/models"
+	"cctv-api/internal/netguard"
+)
+
+const testSource = "https://origin.example.com/cam/1/index.m3u8"
+
+func TestUpstreamURL(t *testing.T) {
+	p := New(Options{Secret: "secret"})
+
+	tests := []struct {
+		rest    string
+		want    string
+		wantErr bool
+	}{
+		{rest: RootPlaylist, want: testSource},
+		{rest: "seg-1.ts", want: "https://origin.example.com/cam/1/seg-1.ts"},
+		{rest: "low/index.m3u8", want: "https://origin.example.com/cam/1/low/index.m3u8"},
+		{rest: "../2/seg-1.ts", wantErr: true},
+		{rest: "low/../../2/seg-1.ts", wantErr: true},
+		{rest: "low//seg.ts", wantErr: true},
+		{rest: "seg.ts?x=1", wantErr: true},
+		{rest: "%2e%2e/seg.ts", wantErr: true},
+		{rest: `..\seg.ts`, wantErr: true},
+		{rest: sealedPrefix + "not-sealed", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := p.upstreamURL(1, testSource, tt.rest)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("upstreamURL(%q) = %s, want error", tt.rest, got)
+			}
+			continue
+		}
+		if err != nil || got.String() != tt.want {
+			t.Errorf("upstreamURL(%q) = %v, %v; want %s", tt.rest, got, err, tt.want)
+		}
+	}
+
+	if _, err := p.upstreamURL(1, "rtsp://origin.example.com/live", RootPlaylist); err == nil {
+		t.Error("upstreamURL accepted a non-HTTP source")
+	}
+}
+
+func TestProxyPathRoundTrip(t *testing.T) {
+	p := New(Options{Secret: "secret"})
+
+	tests := []struct {
+		upstream   string
+		wantPlain  string // "" when the URL must be sealed
+		wantSealed bool
+	}{
+		{upstream: testSource, wantPlain: RootPlaylist},
+		{upstream: "https://origin.example.com/cam/1/seg-1.ts", wantPlain: "seg-1.ts"},
+		{upstream: "https://origin.example.com/cam/1/low/index.m3u8", wantPlain: "low/index.m3u8"},
+		{upstream: "https://origin.example.com/cam/2/seg-1.ts", wantSealed: true},
+		{upstream: "https://cdn.example.net/cam/1/seg-1.ts", wantSealed: true},
+		{upstream: "http://origin.example.com/cam/1/seg-1.ts", wantSealed: true},
+		{upstream: "https://origin.example.com/cam/1/seg-1.ts?sig=abc", wantSealed: true},
+		{upstream: "https://origin.example.com/cam/1/seg%201.ts", wantSealed: true},
+		{upstream: "https://origin.example.com/cam/1/_/seg.ts", wantSealed: true},
+	}
+
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.upstream)
+		rest := p.proxyPath(1, testSource, u)
+		if tt.wantSealed != strings.HasPrefix(rest, sealedPrefix) || (!tt.wantSealed && rest != tt.wantPlain) {
+			t.Errorf("proxyPath(%s) = %q", tt.upstream, rest)
+			continue
+		}
+		back, err := p.upstreamURL(1, testSource, rest)
+		if err != nil || back.String() != tt.upstream {
+			t.Errorf("upstreamURL(proxyPath(%s)) = %v, %v", tt.upstream, back, err)
+		}
+	}
+}
+
+func TestSealIsBoundToCamera(t *testing.T) {
+	p := New(Options{Secret: "secret"})
+	const upstream = "https://cdn.example.net/seg-1.ts"
+
+	sealed := p.seal(1, upstream)
+	if again := p.seal(1, upstream); again != sealed {
+		t.Errorf("seal is not deterministic: %q then %q", sealed, again)
+	}
+
+	tests := []struct {
+		name    string
+		proxy   *Proxy
+		cctvID  int
+		token   string
+		wantErr bool
+	}{
+		{"same camera", p, 1, sealed, false},
+		{"other camera", p, 2, sealed, true},
+		{"other secret", New(Options{Secret: "other"}), 1, sealed, true},
+		{"truncated", p, 1, sealed[:len(sealed)-2], true},
+		{"not base64", p, 1, "!!!", true},
+		{"empty", p, 1, "", true},
+	}
+
+	for _, tt := range tests {
+		u, err := tt.proxy.unseal(tt.cctvID, tt.token)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: unseal() = %s, want error", tt.name, u)
+			}
+			continue
+		}
+		if err != nil || u.String() != upstream {
+			t.Errorf("%s: unseal() = %v, %v; want %s", tt.name, u, err, upstream)
+		}
+	}
+}
+
+func TestServe(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cam/master.m3u8":
+			w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+			w.Write([]byte("#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=800000\nlow/index.m3u8\n"))
+		case "/cam/media.m3u8":
+			w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+			w.Write([]byte("#EXTM3U\n#EXT-X-TARGETDURATION:2\n#EXTINF:2.0,\nseg-1.ts\n"))
+		case "/cam/seg-1.ts":
+			w.Header().Set("Content-Type", "video/mp2t")
+			w.Write([]byte("segment"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer origin.Close()
+
+	// httptest listens on loopback, which the guard refuses unless allowed
+	allowLoopback, err := netguard.Parse("127.0.0.1, ::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := url.Values{"token": {"session"}}
+
+	tests := []struct {
+		name       string
+		guard      *netguard.Guard
+		source     string
+		rest       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"loopback refused", nil, origin.URL + "/cam/media.m3u8", RootPlaylist, http.StatusBadGateway, ""},
+		{"master playlist rewritten", allowLoopback, origin.URL + "/cam/master.m3u8", RootPlaylist, http.StatusOK,
+			"#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=800000\n/stream/5/low/index.m3u8?token=session\n"},
+		{"media playlist wrapped", allowLoopback, origin.URL + "/cam/media.m3u8", RootPlaylist, http.StatusOK,
+			"#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=2000000\n/stream/5/_/"},
+		{"segment", allowLoopback, origin.URL + "/cam/media.m3u8", "seg-1.ts", http.StatusOK, "segment"},
+		{"missing segment", allowLoopback, origin.URL + "/cam/media.m3u8", "seg-2.ts", http.StatusNotFound, ""},
+		{"path traversal", allowLoopback, origin.URL + "/cam/media.m3u8", "../secret", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		p := New(Options{Secret: "secret", Guard: tt.guard, Timeout: 5 * time.Second, PlaylistTTL: time.Second, SegmentTTL: time.Minute})
+		rec := httptest.NewRecorder()
+		p.Serve(rec, httptest.NewRequest(http.MethodGet, "/stream/5/"+tt.rest, nil), 5, tt.source, models.SourceHLS, tt.rest, query)
+
+		if rec.Code != tt.wantStatus {
+			t.Errorf("%s: status %d, want %d", tt.name, rec.Code, tt.wantStatus)
+			continue
+		}
+		if tt.wantBody != "" && !strings.HasPrefix(rec.Body.String(), tt.wantBody) {
+			t.Errorf("%s: body %q, want prefix %q", tt.name, rec.Body.String(), tt.wantBody)
+		}
+	}
+}
+
+func TestServeWrappedVariantReloadsMediaPlaylist(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		w.Write([]byte("#EXTM3U\n#EXTINF:2.0,\nseg-1.ts\n"))
+	}))
+	defer origin.Close()
+
+	guard, _ := netguard.Parse("127.0.0.1, ::1")
+	p := New(Options{Secret: "secret", Guard: guard, PlaylistTTL: time.Second})
+	source := origin.URL + "/cam/index.m3u8"
+	query := url.Values{"token": {"session"}}
+
+	// The variant of the wrapper is the source itself, sealed
+	rest := sealedPrefix + p.seal(5, source)
+	rec := httptest.NewRecorder()
+	p.Serve(rec, httptest.NewRequest(http.MethodGet, "/stream/5/"+rest, nil), 5, source, models.SourceHLS, rest, query)
+
+	if want := "#EXTM3U\n#EXTINF:2.0,\n/stream/5/seg-1.ts?token=session\n"; rec.Body.String() != want {
+		t.Errorf("variant playlist %q, want %q", rec.Body.String(), want)
+	}
+}
+
+func TestServeSourceTypes(t *testing.T) {
+	p := New(Options{Secret: "secret"})
+
+	tests := []struct {
+		sourceType string
+		source     string
+		rest       string
+	}{
+		{models.SourceRTSP, "rtsp://origin.example.com/live", RootPlaylist},
+		{models.SourceEmbed, "https://origin.example.com/embed", RootPlaylist},
+		{models.SourceMJPEG, "https://origin.example.com/video", "other.mjpeg"},
+		{models.SourceMJPEG, "rtsp://origin.example.com/video", RootMJPEG},
+		{models.SourceSnapshot, "https://origin.example.com/still.jpg", "other.jpg"},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		p.Serve(rec, httptest.NewRequest(http.MethodGet, "/stream/1/"+tt.rest, nil), 1, tt.source, tt.sourceType, tt.rest, nil)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s %s %s: status %d, want 404", tt.sourceType, tt.source, tt.rest, rec.Code)
+		}
+	}
+}
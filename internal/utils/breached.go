@@ -0,0 +1,176 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var errHashLineTooLong = errors.New("breached password file has an overlong line")
+
+// BreachedPasswords looks passwords up in a local copy of a breached
+// password corpus keyed by SHA-1. Nothing is loaded into memory, since the
+// corpus runs to tens of gigabytes.
+//
+// The source is either a single file of "HASH[:count]" lines sorted by hash
+// (such as the HIBP ordered-by-hash dump), which is binary searched on
+// disk, or a directory of range files named after the 5-character hash
+// prefix ("ABCDE" or "ABCDE.txt") holding "SUFFIX[:count]" lines, the way
+// the HIBP range API serves them.
+type BreachedPasswords struct {
+	dir  string
+	file *os.File
+	size int64
+}
+
+// maxHashLine bounds a line of the sorted file; HIBP lines are about 50
+// bytes including the count.
+const maxHashLine = 256
+
+func LoadBreachedPasswords(path string) (*BreachedPasswords, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return &BreachedPasswords{dir: path}, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	bp := &BreachedPasswords{file: file, size: info.Size()}
+
+	// Catch a wrong file early rather than on the first registration
+	first, ok, err := bp.hashAt(0)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if !ok || len(first) != sha1.Size*2 {
+		file.Close()
+		return nil, fmt.Errorf("%s does not start with a SHA-1 hash line", path)
+	}
+	return bp, nil
+}
+
+func (bp *BreachedPasswords) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	if bp.dir == "" {
+		return bp.fileContains(hash)
+	}
+	return bp.rangeFileContains(hash[:5], hash[5:])
+}
+
+// fileContains binary searches the sorted file by byte offset for the first
+// line whose hash is not below hash.
+func (bp *BreachedPasswords) fileContains(hash string) (bool, error) {
+	lo, hi := int64(0), bp.size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		candidate, ok, err := bp.hashAt(mid)
+		if err != nil {
+			return false, err
+		}
+		if !ok || candidate >= hash {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+
+	candidate, ok, err := bp.hashAt(lo)
+	if err != nil {
+		return false, err
+	}
+	return ok && candidate == hash, nil
+}
+
+// hashAt returns the hash on the first line that starts at or after off.
+// ok is false when no line does.
+func (bp *BreachedPasswords) hashAt(off int64) (string, bool, error) {
+	start := off
+	if off > 0 {
+		// Look at the preceding byte to tell whether off starts a line
+		start = off - 1
+	}
+	buf := make([]byte, 2*maxHashLine)
+	n, err := bp.file.ReadAt(buf, start)
+	if err != nil && err != io.EOF {
+		return "", false, err
+	}
+	atEOF := start+int64(n) >= bp.size
+	data := buf[:n]
+
+	for {
+		if off > 0 {
+			i := bytes.IndexByte(data, '\n')
+			if i < 0 {
+				if atEOF {
+					return "", false, nil
+				}
+				return "", false, errHashLineTooLong
+			}
+			data = data[i+1:]
+		}
+		off = 1 // every later line follows a newline
+
+		line := data
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line = data[:i]
+		} else if !atEOF {
+			return "", false, errHashLineTooLong
+		}
+		if len(line) == 0 && len(data) == 0 {
+			return "", false, nil
+		}
+		if hash, ok := parseHashLine(string(line)); ok {
+			return hash, true, nil
+		}
+		// Skip blank lines
+	}
+}
+
+func (bp *BreachedPasswords) rangeFileContains(prefix, suffix string) (bool, error) {
+	var file *os.File
+	var err error
+	for _, name := range []string{prefix, prefix + ".txt"} {
+		file, err = os.Open(filepath.Join(bp.dir, name))
+		if err == nil {
+			break
+		}
+		if !os.IsNotExist(err) {
+			return false, err
+		}
+	}
+	if file == nil {
+		return false, nil
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if candidate, ok := parseHashLine(scanner.Text()); ok && candidate == suffix {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+func parseHashLine(line string) (string, bool) {
+	hash, _, _ := strings.Cut(strings.TrimSpace(line), ":")
+	if hash == "" {
+		return "", false
+	}
+	return strings.ToUpper(hash), true
+}
@@ -0,0 +1,117 @@
+package utils
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func TestBreachedPasswordsSortedFile(t *testing.T) {
+	var lines []string
+	for i := 0; i < 2000; i++ {
+		lines = append(lines, fmt.Sprintf("%s:%d", sha1Hex(fmt.Sprintf("leaked-%d", i)), i+1))
+	}
+	sort.Strings(lines)
+	first := strings.SplitN(lines[0], ":", 2)[0]
+	last := strings.SplitN(lines[len(lines)-1], ":", 2)[0]
+
+	tests := []struct {
+		name      string
+		separator string
+		trailing  string
+	}{
+		{"LF", "\n", "\n"},
+		{"CRLF without final newline", "\r\n", ""},
+	}
+
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "pwned.txt")
+		if err := os.WriteFile(path, []byte(strings.Join(lines, tt.separator)+tt.trailing), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		bp, err := LoadBreachedPasswords(path)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		for _, i := range []int{0, 1, 999, 1998, 1999} {
+			password := fmt.Sprintf("leaked-%d", i)
+			if ok, err := bp.Contains(password); err != nil || !ok {
+				t.Errorf("%s: Contains(%q) = %v, %v; want true", tt.name, password, ok, err)
+			}
+		}
+		for _, password := range []string{"", "safe", "leaked-2000", "leaked--1"} {
+			if ok, err := bp.Contains(password); err != nil || ok {
+				t.Errorf("%s: Contains(%q) = %v, %v; want false", tt.name, password, ok, err)
+			}
+		}
+
+		// The very first and last lines sit on the edges of the search
+		for _, hash := range []string{first, last} {
+			if ok, err := bp.fileContains(hash); err != nil || !ok {
+				t.Errorf("%s: fileContains(%s) = %v, %v; want true", tt.name, hash, ok, err)
+			}
+		}
+		for _, hash := range []string{strings.Repeat("0", 40), strings.Repeat("F", 40)} {
+			if ok, err := bp.fileContains(hash); err != nil || ok {
+				t.Errorf("%s: fileContains(%s) = %v, %v; want false", tt.name, hash, ok, err)
+			}
+		}
+	}
+}
+
+func TestBreachedPasswordsRangeDirectory(t *testing.T) {
+	dir := t.TempDir()
+	hash := sha1Hex("password")
+	// Range files hold suffixes only, in either naming style
+	if err := os.WriteFile(filepath.Join(dir, hash[:5]+".txt"), []byte("0018A45C4D1DEF81644B54AB7F969B88D65:1\n"+hash[5:]+":9545824\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	other := sha1Hex("letmein")
+	if err := os.WriteFile(filepath.Join(dir, other[:5]), []byte(strings.ToLower(other[5:])+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	bp, err := LoadBreachedPasswords(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		password string
+		want     bool
+	}{
+		{"password", true},
+		{"letmein", true},
+		{"Password", false}, // no range file
+		{"letmein!", false},
+	}
+	for _, tt := range tests {
+		if got, err := bp.Contains(tt.password); err != nil || got != tt.want {
+			t.Errorf("Contains(%q) = %v, %v; want %v", tt.password, got, err, tt.want)
+		}
+	}
+}
+
+func TestLoadBreachedPasswordsRejectsOtherFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "words.txt")
+	if err := os.WriteFile(path, []byte("password\n123456\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadBreachedPasswords(path); err == nil {
+		t.Error("LoadBreachedPasswords accepted a plain word list")
+	}
+	if _, err := LoadBreachedPasswords(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("LoadBreachedPasswords accepted a missing file")
+	}
+}
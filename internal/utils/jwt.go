@@ -44,6 +44,11 @@ func (j *JWTUtil) GenerateToken(userID int, role string) (string, error) {
 	return token.SignedString([]byte(j.secretKey))
 }
 
+// Expiration is how long generated tokens stay valid.
+func (j *JWTUtil) Expiration() time.Duration {
+	return j.expiration
+}
+
 func (j *JWTUtil) ValidateToken(tokenString string) (*Claims, error) {
 	claims := &Claims{}
 
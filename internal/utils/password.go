@@ -0,0 +1,215 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrUnknownHashFormat = errors.New("unknown password hash format")
+
+// PasswordHasher hashes new passwords and verifies stored hashes. Verify
+// reports needsRehash when a matching hash was produced by an older
+// algorithm or with different parameters than the hasher would use today.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(encoded, password string) (ok bool, needsRehash bool, err error)
+}
+
+// Argon2Params are the argon2id cost parameters. Memory is in KiB.
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// Bounds on argon2id cost parameters, applied to the configured ones and to
+// every stored hash: zero parallelism makes argon2 panic, and a huge memory
+// or iteration count would let a single hash stall the server.
+const (
+	MaxArgon2Memory     = 1 << 20 // KiB, 1 GiB
+	MaxArgon2Iterations = 100
+)
+
+// Validate checks the parameters against the bounds above.
+func (p Argon2Params) Validate() error {
+	if p.Iterations < 1 || p.Iterations > MaxArgon2Iterations {
+		return fmt.Errorf("argon2 iterations must be between 1 and %d", MaxArgon2Iterations)
+	}
+	if p.Parallelism < 1 {
+		return errors.New("argon2 parallelism must be at least 1")
+	}
+	if p.Memory < 8*uint32(p.Parallelism) || p.Memory > MaxArgon2Memory {
+		return fmt.Errorf("argon2 memory must be between %d and %d KiB", 8*uint32(p.Parallelism), MaxArgon2Memory)
+	}
+	return nil
+}
+
+// argon2Slots bounds how many argon2id hashes run at once. Each one holds
+// Memory KiB for its whole run, so a burst of logins would otherwise add up
+// to far more memory than the CPUs can work through; extra callers queue.
+var argon2Slots = make(chan struct{}, runtime.GOMAXPROCS(0))
+
+func argon2IDKey(password, salt []byte, p Argon2Params, keyLength uint32) []byte {
+	argon2Slots <- struct{}{}
+	defer func() { <-argon2Slots }()
+	return argon2.IDKey(password, salt, p.Iterations, p.Memory, p.Parallelism, keyLength)
+}
+
+var DefaultArgon2Params = Argon2Params{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// Argon2idHasher hashes with argon2id using the PHC string format
+// ($argon2id$v=19$m=...,t=...,p=...$salt$hash) and still accepts legacy
+// bcrypt hashes, which always need a rehash.
+type Argon2idHasher struct {
+	params Argon2Params
+}
+
+func NewArgon2idHasher(params Argon2Params) *Argon2idHasher {
+	if params.SaltLength == 0 {
+		params.SaltLength = DefaultArgon2Params.SaltLength
+	}
+	if params.KeyLength == 0 {
+		params.KeyLength = DefaultArgon2Params.KeyLength
+	}
+	return &Argon2idHasher{params: params}
+}
+
+func (h *Argon2idHasher) Params() Argon2Params {
+	return h.params
+}
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2IDKey([]byte(password), salt, h.params, h.params.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.params.Memory, h.params.Iterations, h.params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h *Argon2idHasher) Verify(encoded, password string) (bool, bool, error) {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		params, salt, key, err := decodeArgon2id(encoded)
+		if err != nil {
+			return false, false, err
+		}
+
+		computed := argon2IDKey([]byte(password), salt, params, uint32(len(key)))
+		if subtle.ConstantTimeCompare(computed, key) != 1 {
+			return false, false, nil
+		}
+
+		needsRehash := params.Memory != h.params.Memory ||
+			params.Iterations != h.params.Iterations ||
+			params.Parallelism != h.params.Parallelism ||
+			uint32(len(key)) != h.params.KeyLength ||
+			uint32(len(salt)) != h.params.SaltLength
+		return true, needsRehash, nil
+
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, false, nil
+		}
+		if err != nil {
+			return false, false, err
+		}
+		return true, true, nil
+	}
+
+	return false, false, ErrUnknownHashFormat
+}
+
+func decodeArgon2id(encoded string) (Argon2Params, []byte, []byte, error) {
+	var params Argon2Params
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+	if version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2 version %d", version)
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+	if err := params.Validate(); err != nil {
+		return params, nil, nil, err
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(salt) == 0 || len(key) == 0 {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
+}
+
+// CalibrateArgon2 benchmarks argon2id on this machine and returns the
+// smallest iteration count at the given memory and parallelism whose hash
+// time reaches target. If a single iteration is already too slow, memory is
+// halved (down to 19 MiB, the OWASP minimum) instead.
+func CalibrateArgon2(target time.Duration, memory uint32, parallelism uint8) Argon2Params {
+	const minMemory = 19 * 1024
+	const maxIterations = 20
+
+	params := DefaultArgon2Params
+	params.Memory = memory
+	params.Parallelism = parallelism
+	params.Iterations = 1
+
+	password := []byte("calibration-password")
+	salt := make([]byte, params.SaltLength)
+
+	measure := func(p Argon2Params) time.Duration {
+		start := time.Now()
+		argon2.IDKey(password, salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+		return time.Since(start)
+	}
+
+	for measure(params) > target && params.Memory/2 >= minMemory {
+		params.Memory /= 2
+	}
+
+	for params.Iterations < maxIterations && measure(params) < target {
+		params.Iterations++
+	}
+
+	return params
+}
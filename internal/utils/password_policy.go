@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"cctv-api/internal/responses"
+)
+
+// PasswordPolicy describes the rules a new password must satisfy.
+type PasswordPolicy struct {
+	MinLength        int
+	MaxLength        int
+	RequireUpper     bool
+	RequireLower     bool
+	RequireDigit     bool
+	RequireSymbol    bool
+	DisallowIdentity bool // reject passwords containing the username or email
+	Breached         *BreachedPasswords
+}
+
+// Check returns one validation error per rule the password breaks, using
+// validator-style tags as messages.
+func (p PasswordPolicy) Check(password, username, email string) ([]responses.ValidationError, error) {
+	var errors []responses.ValidationError
+	fail := func(tag string) {
+		errors = append(errors, responses.ValidationError{Field: "Password", Message: tag})
+	}
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		fail("min")
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		fail("max")
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			hasSymbol = true
+		}
+	}
+	if p.RequireUpper && !hasUpper {
+		fail("uppercase")
+	}
+	if p.RequireLower && !hasLower {
+		fail("lowercase")
+	}
+	if p.RequireDigit && !hasDigit {
+		fail("digit")
+	}
+	if p.RequireSymbol && !hasSymbol {
+		fail("symbol")
+	}
+
+	if p.DisallowIdentity {
+		lower := strings.ToLower(password)
+		if username != "" && strings.Contains(lower, strings.ToLower(username)) {
+			fail("contains_username")
+		}
+		if local, _, _ := strings.Cut(email, "@"); len(local) >= 3 && strings.Contains(lower, strings.ToLower(local)) {
+			fail("contains_email")
+		}
+	}
+
+	if p.Breached != nil {
+		breached, err := p.Breached.Contains(password)
+		if err != nil {
+			return nil, err
+		}
+		if breached {
+			fail("breached")
+		}
+	}
+
+	return errors, nil
+}
@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	strict := PasswordPolicy{
+		MinLength:        10,
+		MaxLength:        20,
+		RequireUpper:     true,
+		RequireLower:     true,
+		RequireDigit:     true,
+		RequireSymbol:    true,
+		DisallowIdentity: true,
+	}
+
+	tests := []struct {
+		name     string
+		policy   PasswordPolicy
+		password string
+		username string
+		email    string
+		want     []string
+	}{
+		{"meets every rule", strict, "Tr0ub4dor&3x", "alice", "alice@example.com", nil},
+		{"too short", strict, "Sh0rt!", "alice", "alice@example.com", []string{"min"}},
+		{"too long", strict, "Waaaaaaaaaaaaaaaay2long!", "alice", "alice@example.com", []string{"max"}},
+		{"length counts runes", PasswordPolicy{MinLength: 4, MaxLength: 4}, "ñóéá", "", "", nil},
+		{"missing classes", strict, "alllowercaseletters", "bob", "bob@example.com", []string{"uppercase", "digit", "symbol"}},
+		{"space counts as symbol", strict, "Pass phrase 42", "bob", "bob@example.com", nil},
+		{"contains username", strict, "xAlice-2024x", "alice", "", []string{"contains_username"}},
+		{"contains email local part", strict, "Carol.w#1984", "cw", "carol.w@example.com", []string{"contains_email"}},
+		{"short email local part ignored", strict, "Jo-Jo-Jo-99", "x", "jo@example.com", nil},
+		{"identity allowed when disabled", PasswordPolicy{MinLength: 1}, "alice", "alice", "alice@example.com", nil},
+		{"no max length", PasswordPolicy{MinLength: 1}, "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", "", "", nil},
+	}
+
+	for _, tt := range tests {
+		errs, err := tt.policy.Check(tt.password, tt.username, tt.email)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		var got []string
+		for _, e := range errs {
+			if e.Field != "Password" {
+				t.Errorf("%s: error on field %q, want Password", tt.name, e.Field)
+			}
+			got = append(got, e.Message)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Check(%q) = %v, want %v", tt.name, tt.password, got, tt.want)
+		}
+	}
+}
+
+func TestPasswordPolicyCheckBreached(t *testing.T) {
+	// SHA-1 of "password" is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8
+	path := filepath.Join(t.TempDir(), "pwned.txt")
+	lines := "000000005AD76BD555C1D6D771DE417A4B87E4B4:4\n" +
+		"5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824\n" +
+		"FFFFFFFEE791CBAC0F6305CAF0CEE06BBE131160:2\n"
+	if err := os.WriteFile(path, []byte(lines), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	breached, err := LoadBreachedPasswords(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := PasswordPolicy{MinLength: 1, Breached: breached}
+
+	errs, err := policy.Check("password", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 1 || errs[0].Message != "breached" {
+		t.Errorf("Check(breached password) = %v, want [breached]", errs)
+	}
+
+	errs, err = policy.Check("not in the list", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 0 {
+		t.Errorf("Check(unlisted password) = %v, want none", errs)
+	}
+}
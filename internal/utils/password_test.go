@@ -0,0 +1,162 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testArgon2Params keep hashing fast; production parameters come from config.
+var testArgon2Params = Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestArgon2idHasherVerify(t *testing.T) {
+	hasher := NewArgon2idHasher(testArgon2Params)
+	encoded, err := hasher.Hash("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Fatalf("Hash() = %q, want argon2id PHC string with the hasher's parameters", encoded)
+	}
+
+	legacy, err := bcrypt.GenerateFromPassword([]byte("hunter2"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stronger := testArgon2Params
+	stronger.Iterations = 2
+
+	tests := []struct {
+		name            string
+		hasher          *Argon2idHasher
+		encoded         string
+		password        string
+		wantOK          bool
+		wantNeedsRehash bool
+		wantErr         bool
+	}{
+		{"argon2id match", hasher, encoded, "correct horse battery staple", true, false, false},
+		{"argon2id mismatch", hasher, encoded, "correct horse battery stapler", false, false, false},
+		{"argon2id with old parameters", NewArgon2idHasher(stronger), encoded, "correct horse battery staple", true, true, false},
+		{"bcrypt match needs rehash", hasher, string(legacy), "hunter2", true, true, false},
+		{"bcrypt mismatch", hasher, string(legacy), "hunter3", false, false, false},
+		{"unknown format", hasher, "plaintext", "plaintext", false, false, true},
+		{"argon2id zero parallelism", hasher, "$argon2id$v=19$m=64,t=1,p=0$c2FsdHNhbHRzYWx0c2FsdA$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5", "x", false, false, true},
+	}
+
+	for _, tt := range tests {
+		ok, needsRehash, err := tt.hasher.Verify(tt.encoded, tt.password)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if ok != tt.wantOK || needsRehash != tt.wantNeedsRehash {
+			t.Errorf("%s: Verify() = (%v, %v), want (%v, %v)", tt.name, ok, needsRehash, tt.wantOK, tt.wantNeedsRehash)
+		}
+	}
+}
+
+func TestDecodeArgon2id(t *testing.T) {
+	const salt = "c2FsdHNhbHRzYWx0c2FsdA" // 16 bytes
+	const key = "a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U"
+
+	tests := []struct {
+		encoded string
+		want    Argon2Params
+		wantErr bool
+	}{
+		{
+			encoded: "$argon2id$v=19$m=65536,t=3,p=2$" + salt + "$" + key,
+			want:    Argon2Params{Memory: 65536, Iterations: 3, Parallelism: 2, SaltLength: 16, KeyLength: 32},
+		},
+		{encoded: "$argon2id$v=16$m=65536,t=3,p=2$" + salt + "$" + key, wantErr: true},
+		{encoded: "$argon2id$v=19$m=65536,t=0,p=2$" + salt + "$" + key, wantErr: true},
+		{encoded: "$argon2id$v=19$m=65536,t=101,p=2$" + salt + "$" + key, wantErr: true},
+		{encoded: "$argon2id$v=19$m=65536,t=3,p=0$" + salt + "$" + key, wantErr: true},
+		{encoded: "$argon2id$v=19$m=65536,t=3,p=256$" + salt + "$" + key, wantErr: true},
+		{encoded: "$argon2id$v=19$m=2097152,t=3,p=2$" + salt + "$" + key, wantErr: true},
+		{encoded: "$argon2id$v=19$m=8,t=3,p=2$" + salt + "$" + key, wantErr: true},
+		{encoded: "$argon2id$v=19$m=65536,t=3,p=2$$" + key, wantErr: true},
+		{encoded: "$argon2id$v=19$m=65536,t=3,p=2$" + salt + "$", wantErr: true},
+		{encoded: "$argon2id$v=19$m=65536,t=3,p=2$not base64!$" + key, wantErr: true},
+		{encoded: "$argon2id$v=19$m=65536,t=3,p=2$" + salt, wantErr: true},
+		{encoded: "$argon2id$v=19$t=3,p=2$" + salt + "$" + key, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		params, _, _, err := decodeArgon2id(tt.encoded)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("decodeArgon2id(%q) = %+v, want error", tt.encoded, params)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("decodeArgon2id(%q) error: %v", tt.encoded, err)
+			continue
+		}
+		if params != tt.want {
+			t.Errorf("decodeArgon2id(%q) = %+v, want %+v", tt.encoded, params, tt.want)
+		}
+	}
+}
+
+func TestArgon2ParamsValidate(t *testing.T) {
+	tests := []struct {
+		params  Argon2Params
+		wantErr bool
+	}{
+		{DefaultArgon2Params, false},
+		{Argon2Params{Memory: 8, Iterations: 1, Parallelism: 1}, false},
+		{Argon2Params{Memory: MaxArgon2Memory, Iterations: MaxArgon2Iterations, Parallelism: 255}, false},
+		{Argon2Params{Memory: 64 * 1024, Iterations: 0, Parallelism: 2}, true},
+		{Argon2Params{Memory: 64 * 1024, Iterations: MaxArgon2Iterations + 1, Parallelism: 2}, true},
+		{Argon2Params{Memory: 64 * 1024, Iterations: 3, Parallelism: 0}, true},
+		{Argon2Params{Memory: 15, Iterations: 3, Parallelism: 2}, true},
+		{Argon2Params{Memory: MaxArgon2Memory + 1, Iterations: 3, Parallelism: 2}, true},
+	}
+
+	for _, tt := range tests {
+		if err := tt.params.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%+v.Validate() = %v, want error %v", tt.params, err, tt.wantErr)
+		}
+	}
+}
+
+func TestArgon2idHasherRejectsUnknownFormat(t *testing.T) {
+	_, _, err := NewArgon2idHasher(testArgon2Params).Verify("$pbkdf2$whatever", "x")
+	if !errors.Is(err, ErrUnknownHashFormat) {
+		t.Errorf("Verify() error = %v, want ErrUnknownHashFormat", err)
+	}
+}
+
+func TestArgon2idHasherWaitsForSlot(t *testing.T) {
+	// Occupy every slot, as a burst of concurrent logins would
+	for i := 0; i < cap(argon2Slots); i++ {
+		argon2Slots <- struct{}{}
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := NewArgon2idHasher(testArgon2Params).Hash("hunter2")
+		done <- err
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("Hash() ran while every slot was taken")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	<-argon2Slots
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < cap(argon2Slots); i++ {
+		<-argon2Slots
+	}
+}
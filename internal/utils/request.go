@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// TrustProxyHeaders makes ClientIP honour X-Forwarded-For / X-Real-IP. Only
+// enable it when the API sits behind a reverse proxy that sets them.
+var TrustProxyHeaders bool
+
+// TrustedProxies are the networks of the reverse proxies in front of the
+// API. Forwarding headers are only believed when they were added by one.
+var TrustedProxies []*net.IPNet
+
+// ClientIP returns the IP address of the client that made the request.
+// Behind trusted proxies this is the rightmost X-Forwarded-For address that
+// is not itself a trusted proxy; the entries left of it are whatever the
+// client chose to send.
+func ClientIP(r *http.Request) string {
+	peer, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		peer = r.RemoteAddr
+	}
+	if !TrustProxyHeaders || !isTrustedProxy(peer) {
+		return peer
+	}
+
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+		client := peer
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if net.ParseIP(hop) == nil {
+				break
+			}
+			client = hop
+			if !isTrustedProxy(hop) {
+				break
+			}
+		}
+		return client
+	}
+
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(realIP) != nil {
+		return realIP
+	}
+	return peer
+}
+
+func isTrustedProxy(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, network := range TrustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+	TrustedProxies = []*net.IPNet{proxies}
+	defer func() { TrustProxyHeaders, TrustedProxies = false, nil }()
+
+	tests := []struct {
+		name       string
+		trust      bool
+		remoteAddr string
+		forwarded  []string
+		realIP     string
+		want       string
+	}{
+		{name: "headers not trusted", remoteAddr: "10.0.0.1:443", forwarded: []string{"198.51.100.9"}, want: "10.0.0.1"},
+		{name: "direct client", trust: true, remoteAddr: "203.0.113.7:50000", forwarded: []string{"198.51.100.9"}, realIP: "198.51.100.9", want: "203.0.113.7"},
+		{name: "one proxy", trust: true, remoteAddr: "10.0.0.1:443", forwarded: []string{"198.51.100.9"}, want: "198.51.100.9"},
+		{name: "spoofed entries left of the client", trust: true, remoteAddr: "10.0.0.1:443", forwarded: []string{"1.2.3.4, 198.51.100.9"}, want: "198.51.100.9"},
+		{name: "chain of proxies", trust: true, remoteAddr: "10.0.0.1:443", forwarded: []string{"1.2.3.4, 198.51.100.9, 10.0.0.2"}, want: "198.51.100.9"},
+		{name: "repeated headers", trust: true, remoteAddr: "10.0.0.1:443", forwarded: []string{"1.2.3.4", "198.51.100.9, 10.0.0.2"}, want: "198.51.100.9"},
+		{name: "every hop a proxy", trust: true, remoteAddr: "10.0.0.1:443", forwarded: []string{"10.0.0.3, 10.0.0.2"}, want: "10.0.0.3"},
+		{name: "garbage hop", trust: true, remoteAddr: "10.0.0.1:443", forwarded: []string{"1.2.3.4, unknown, 10.0.0.2"}, want: "10.0.0.2"},
+		{name: "real IP from a proxy", trust: true, remoteAddr: "10.0.0.1:443", realIP: "198.51.100.9", want: "198.51.100.9"},
+		{name: "invalid real IP", trust: true, remoteAddr: "10.0.0.1:443", realIP: "unknown", want: "10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		TrustProxyHeaders = tt.trust
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tt.remoteAddr
+		for _, forwarded := range tt.forwarded {
+			r.Header.Add("X-Forwarded-For", forwarded)
+		}
+		if tt.realIP != "" {
+			r.Header.Set("X-Real-IP", tt.realIP)
+		}
+		if got := ClientIP(r); got != tt.want {
+			t.Errorf("%s: ClientIP() = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
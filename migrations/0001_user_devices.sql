@@ -0,0 +1,20 @@
+-- +migrate Up
+CREATE TABLE user_devices (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    device_id VARCHAR(255) NOT NULL,
+    device_name VARCHAR(255),
+    platform VARCHAR(50),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    last_seen_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, device_id)
+);
+
+CREATE INDEX idx_user_devices_user_id ON user_devices(user_id);
+
+-- Carry over any device already recorded on the users table
+INSERT INTO user_devices (user_id, device_id)
+SELECT id, device_id FROM users WHERE device_id IS NOT NULL;
+
+-- +migrate Down
+DROP TABLE user_devices;
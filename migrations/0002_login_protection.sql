@@ -0,0 +1,26 @@
+-- +migrate Up
+CREATE TABLE audit_logs (
+    id BIGSERIAL PRIMARY KEY,
+    actor_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    action VARCHAR(100) NOT NULL,
+    ip_address VARCHAR(64),
+    details JSONB,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_audit_logs_user_id ON audit_logs(user_id);
+CREATE INDEX idx_audit_logs_action ON audit_logs(action);
+CREATE INDEX idx_audit_logs_created_at ON audit_logs(created_at);
+
+-- Failed login counters, keyed by account ("user:<id>" or "name:<login>") or IP ("ip:<addr>")
+CREATE TABLE login_failures (
+    key VARCHAR(320) PRIMARY KEY,
+    failure_count INTEGER NOT NULL DEFAULT 0,
+    last_failed_at TIMESTAMP,
+    locked_until TIMESTAMP
+);
+
+-- +migrate Down
+DROP TABLE login_failures;
+DROP TABLE audit_logs;
@@ -0,0 +1,6 @@
+-- +migrate Up
+-- argon2id PHC strings are longer than the 60-character bcrypt hashes
+ALTER TABLE users ALTER COLUMN password TYPE TEXT;
+
+-- +migrate Down
+ALTER TABLE users ALTER COLUMN password TYPE VARCHAR(255);
@@ -0,0 +1,49 @@
+-- +migrate Up
+CREATE TABLE plans (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(50) NOT NULL UNIQUE,
+    camera_quota INTEGER,                    -- NULL means every active camera
+    concurrent_sessions INTEGER NOT NULL DEFAULT 1,
+    can_export BOOLEAN NOT NULL DEFAULT false,
+    price BIGINT NOT NULL DEFAULT 0,         -- in the smallest currency unit
+    currency VARCHAR(3) NOT NULL DEFAULT 'IDR',
+    duration_days INTEGER,                   -- NULL means the subscription never expires
+    is_default BOOLEAN NOT NULL DEFAULT false,
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Exactly one plan applies to users without an active subscription
+CREATE UNIQUE INDEX idx_plans_default ON plans(is_default) WHERE is_default;
+
+INSERT INTO plans (name, camera_quota, concurrent_sessions, can_export, price, duration_days, is_default)
+VALUES
+    ('free', 10, 1, false, 0, NULL, true),
+    ('paid', NULL, 3, true, 50000, 30, false);
+
+CREATE TABLE subscriptions (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    plan_id INTEGER NOT NULL REFERENCES plans(id),
+    status VARCHAR(20) NOT NULL DEFAULT 'active', -- active, expired, cancelled
+    source VARCHAR(30) NOT NULL DEFAULT 'manual',
+    starts_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX idx_subscriptions_active_user ON subscriptions(user_id) WHERE status = 'active';
+CREATE INDEX idx_subscriptions_expiry ON subscriptions(expires_at) WHERE status = 'active';
+
+-- Existing paid accounts keep their access without an expiry
+INSERT INTO subscriptions (user_id, plan_id, status, source)
+SELECT u.id, p.id, 'active', 'migration'
+FROM users u
+JOIN plans p ON p.name = u.account_status
+WHERE NOT p.is_default;
+
+-- +migrate Down
+DROP TABLE subscriptions;
+DROP TABLE plans;
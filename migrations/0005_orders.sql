@@ -0,0 +1,35 @@
+-- +migrate Up
+CREATE TABLE orders (
+    id SERIAL PRIMARY KEY,
+    reference VARCHAR(64) NOT NULL UNIQUE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    plan_id INTEGER NOT NULL REFERENCES plans(id),
+    amount BIGINT NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- pending, paid, partially_refunded, refunded, refund_required, cancelled, expired, failed
+    provider VARCHAR(30) NOT NULL,
+    provider_ref VARCHAR(255),
+    checkout_url TEXT,
+    subscription_id INTEGER REFERENCES subscriptions(id) ON DELETE SET NULL,
+    paid_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_orders_user_id ON orders(user_id);
+
+-- Every webhook notification we accepted; the unique key makes redelivery a no-op
+CREATE TABLE payment_events (
+    id SERIAL PRIMARY KEY,
+    provider VARCHAR(30) NOT NULL,
+    event_id VARCHAR(255) NOT NULL,
+    order_reference VARCHAR(64) NOT NULL,
+    status VARCHAR(30) NOT NULL,
+    payload JSONB,
+    received_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (provider, event_id)
+);
+
+-- +migrate Down
+DROP TABLE payment_events;
+DROP TABLE orders;
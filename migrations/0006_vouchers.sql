@@ -0,0 +1,30 @@
+-- +migrate Up
+CREATE TABLE vouchers (
+    id SERIAL PRIMARY KEY,
+    code VARCHAR(50) NOT NULL UNIQUE,
+    description TEXT,
+    plan_id INTEGER NOT NULL REFERENCES plans(id),
+    duration_days INTEGER NOT NULL,
+    max_redemptions INTEGER,                 -- NULL means unlimited
+    per_user_limit INTEGER NOT NULL DEFAULT 1,
+    valid_from TIMESTAMP,
+    valid_until TIMESTAMP,
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE voucher_redemptions (
+    id SERIAL PRIMARY KEY,
+    voucher_id INTEGER NOT NULL REFERENCES vouchers(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    subscription_id INTEGER REFERENCES subscriptions(id) ON DELETE SET NULL,
+    redeemed_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_voucher_redemptions_voucher_user ON voucher_redemptions(voucher_id, user_id);
+
+-- +migrate Down
+DROP TABLE voucher_redemptions;
+DROP TABLE vouchers;
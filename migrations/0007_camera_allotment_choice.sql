@@ -0,0 +1,34 @@
+-- +migrate Up
+ALTER TABLE locations ADD COLUMN latitude DOUBLE PRECISION;
+ALTER TABLE locations ADD COLUMN longitude DOUBLE PRECISION;
+
+ALTER TABLE users ADD COLUMN home_location_id INTEGER REFERENCES locations(id) ON DELETE SET NULL;
+-- NULL until the user picks cameras themselves; the first pick does not count as a swap
+ALTER TABLE users ADD COLUMN allotment_chosen_at TIMESTAMP;
+
+CREATE TABLE app_settings (
+    key VARCHAR(100) PRIMARY KEY,
+    value JSONB NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO app_settings (key, value)
+VALUES ('allotment', '{"strategy": "random", "swapsPerPeriod": 3, "swapPeriodDays": 30}');
+
+CREATE TABLE cctv_allotment_swaps (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    removed_cctv_id INTEGER,
+    added_cctv_id INTEGER,
+    swapped_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_cctv_allotment_swaps_user ON cctv_allotment_swaps(user_id, swapped_at);
+
+-- +migrate Down
+DROP TABLE cctv_allotment_swaps;
+DROP TABLE app_settings;
+ALTER TABLE users DROP COLUMN allotment_chosen_at;
+ALTER TABLE users DROP COLUMN home_location_id;
+ALTER TABLE locations DROP COLUMN longitude;
+ALTER TABLE locations DROP COLUMN latitude;
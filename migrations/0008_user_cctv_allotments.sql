@@ -0,0 +1,47 @@
+-- +migrate Up
+CREATE TABLE user_cctv_allotments (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    cctv_id INTEGER NOT NULL REFERENCES cctvs(id) ON DELETE CASCADE,
+    source VARCHAR(20) NOT NULL DEFAULT 'auto' CHECK (source IN ('auto', 'chosen', 'replacement')),
+    assigned_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, cctv_id)
+);
+
+CREATE INDEX idx_user_cctv_allotments_cctv ON user_cctv_allotments(cctv_id);
+
+INSERT INTO user_cctv_allotments (user_id, cctv_id, source)
+SELECT u.id, elem::int, CASE WHEN u.allotment_chosen_at IS NULL THEN 'auto' ELSE 'chosen' END
+FROM users u, jsonb_array_elements_text(u.fixed_cctv_ids::jsonb) elem
+WHERE u.fixed_cctv_ids IS NOT NULL
+    AND EXISTS (SELECT 1 FROM cctvs c WHERE c.id = elem::int)
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE users DROP COLUMN fixed_cctv_ids;
+
+CREATE TABLE user_notifications (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type VARCHAR(50) NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    message TEXT NOT NULL,
+    data JSONB,
+    read_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_user_notifications_user ON user_notifications(user_id, created_at DESC);
+
+-- +migrate Down
+DROP TABLE user_notifications;
+
+ALTER TABLE users ADD COLUMN fixed_cctv_ids JSON;
+
+UPDATE users u SET fixed_cctv_ids = a.ids
+FROM (
+    SELECT user_id, json_agg(cctv_id ORDER BY assigned_at, cctv_id) AS ids
+    FROM user_cctv_allotments
+    GROUP BY user_id
+) a
+WHERE a.user_id = u.id;
+
+DROP TABLE user_cctv_allotments;
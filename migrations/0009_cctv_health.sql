@@ -0,0 +1,27 @@
+-- +migrate Up
+-- Current probe result; NULL status means the camera has not been checked yet
+ALTER TABLE cctvs ADD COLUMN health_status VARCHAR(20) CHECK (health_status IN ('online', 'offline', 'degraded'));
+ALTER TABLE cctvs ADD COLUMN health_latency_ms INTEGER;
+ALTER TABLE cctvs ADD COLUMN health_detail TEXT;
+ALTER TABLE cctvs ADD COLUMN health_checked_at TIMESTAMP;
+ALTER TABLE cctvs ADD COLUMN health_changed_at TIMESTAMP;
+
+CREATE TABLE cctv_status_history (
+    id BIGSERIAL PRIMARY KEY,
+    cctv_id INTEGER NOT NULL REFERENCES cctvs(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL CHECK (status IN ('online', 'offline', 'degraded')),
+    latency_ms INTEGER,
+    detail TEXT,
+    checked_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_cctv_status_history_cctv ON cctv_status_history(cctv_id, checked_at DESC);
+CREATE INDEX idx_cctv_status_history_checked_at ON cctv_status_history(checked_at);
+
+-- +migrate Down
+DROP TABLE cctv_status_history;
+ALTER TABLE cctvs DROP COLUMN health_changed_at;
+ALTER TABLE cctvs DROP COLUMN health_checked_at;
+ALTER TABLE cctvs DROP COLUMN health_detail;
+ALTER TABLE cctvs DROP COLUMN health_latency_ms;
+ALTER TABLE cctvs DROP COLUMN health_status;
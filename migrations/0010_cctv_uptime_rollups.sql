@@ -0,0 +1,28 @@
+-- +migrate Up
+-- Uptime per camera per calendar month, computed from cctv_status_history
+-- once the month is over. Outages are attributed to the month they began in.
+CREATE TABLE cctv_uptime_monthly (
+    cctv_id INTEGER NOT NULL REFERENCES cctvs(id) ON DELETE CASCADE,
+    month DATE NOT NULL,
+    observed_seconds BIGINT NOT NULL DEFAULT 0,
+    up_seconds BIGINT NOT NULL DEFAULT 0,
+    degraded_seconds BIGINT NOT NULL DEFAULT 0,
+    down_seconds BIGINT NOT NULL DEFAULT 0,
+    outage_count INTEGER NOT NULL DEFAULT 0,
+    resolved_outage_count INTEGER NOT NULL DEFAULT 0,
+    resolved_outage_seconds BIGINT NOT NULL DEFAULT 0,
+    longest_outage_seconds BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (cctv_id, month)
+);
+
+CREATE INDEX idx_cctv_uptime_monthly_month ON cctv_uptime_monthly(month);
+
+-- Months whose rollup has been computed
+CREATE TABLE cctv_uptime_rollup_months (
+    month DATE PRIMARY KEY,
+    computed_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- +migrate Down
+DROP TABLE cctv_uptime_rollup_months;
+DROP TABLE cctv_uptime_monthly;
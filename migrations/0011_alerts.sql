@@ -0,0 +1,65 @@
+-- +migrate Up
+CREATE TABLE alert_rules (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    -- 'all' covers every camera; otherwise exactly one of cctv_id / location_id is set
+    scope VARCHAR(20) NOT NULL CHECK (scope IN ('all', 'location', 'cctv')),
+    cctv_id INTEGER REFERENCES cctvs(id) ON DELETE CASCADE,
+    location_id INTEGER REFERENCES locations(id) ON DELETE CASCADE,
+    offline_minutes INTEGER CHECK (offline_minutes > 0),
+    flap_changes INTEGER CHECK (flap_changes > 1),
+    flap_window_minutes INTEGER CHECK (flap_window_minutes > 0),
+    -- Empty means every admin
+    notify_emails TEXT[] NOT NULL DEFAULT '{}',
+    webhook_url TEXT,
+    webhook_secret TEXT,
+    notify_recovery BOOLEAN NOT NULL DEFAULT true,
+    -- HH:MM in ALERT_TIMEZONE; the window may wrap past midnight
+    quiet_hours_start VARCHAR(5),
+    quiet_hours_end VARCHAR(5),
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    CHECK (offline_minutes IS NOT NULL OR flap_changes IS NOT NULL),
+    CHECK ((flap_changes IS NULL) = (flap_window_minutes IS NULL)),
+    CHECK ((scope = 'cctv') = (cctv_id IS NOT NULL)),
+    CHECK ((scope = 'location') = (location_id IS NOT NULL))
+);
+
+CREATE TABLE maintenance_windows (
+    id SERIAL PRIMARY KEY,
+    -- Both NULL means the whole network
+    cctv_id INTEGER REFERENCES cctvs(id) ON DELETE CASCADE,
+    location_id INTEGER REFERENCES locations(id) ON DELETE CASCADE,
+    starts_at TIMESTAMP NOT NULL,
+    ends_at TIMESTAMP NOT NULL,
+    reason TEXT,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    CHECK (ends_at > starts_at)
+);
+
+CREATE INDEX idx_maintenance_windows_ends_at ON maintenance_windows(ends_at);
+
+CREATE TABLE alert_incidents (
+    id BIGSERIAL PRIMARY KEY,
+    rule_id INTEGER NOT NULL REFERENCES alert_rules(id) ON DELETE CASCADE,
+    cctv_id INTEGER NOT NULL REFERENCES cctvs(id) ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('offline', 'flapping')),
+    opened_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    resolved_at TIMESTAMP,
+    -- Opened during a maintenance window; never notified
+    suppressed BOOLEAN NOT NULL DEFAULT false,
+    notified_at TIMESTAMP,
+    recovery_notified_at TIMESTAMP
+);
+
+-- One open incident per rule, camera and kind
+CREATE UNIQUE INDEX idx_alert_incidents_open ON alert_incidents(rule_id, cctv_id, kind) WHERE resolved_at IS NULL;
+CREATE INDEX idx_alert_incidents_opened_at ON alert_incidents(opened_at DESC);
+
+-- +migrate Down
+DROP TABLE alert_incidents;
+DROP TABLE maintenance_windows;
+DROP TABLE alert_rules;
@@ -0,0 +1,7 @@
+-- +migrate Up
+ALTER TABLE alert_incidents ADD COLUMN acknowledged_at TIMESTAMP;
+ALTER TABLE alert_incidents ADD COLUMN acknowledged_by INTEGER REFERENCES users(id) ON DELETE SET NULL;
+
+-- +migrate Down
+ALTER TABLE alert_incidents DROP COLUMN acknowledged_by;
+ALTER TABLE alert_incidents DROP COLUMN acknowledged_at;
@@ -0,0 +1,24 @@
+-- +migrate Up
+-- Long-lived credentials for integrations such as media servers. Only a
+-- SHA-256 hash of the key is stored; prefix identifies it in listings.
+CREATE TABLE api_keys (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    prefix VARCHAR(16) NOT NULL,
+    key_hash CHAR(64) NOT NULL UNIQUE,
+    last_used_at TIMESTAMP,
+    expires_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_api_keys_user ON api_keys(user_id);
+
+-- Path name of the camera on the media server (e.g. MediaMTX), for the
+-- media auth hook
+ALTER TABLE cctvs ADD COLUMN media_path VARCHAR(255) UNIQUE;
+
+-- +migrate Down
+ALTER TABLE cctvs DROP COLUMN media_path;
+DROP TABLE api_keys;
@@ -0,0 +1,23 @@
+-- +migrate Up
+-- How a camera's source is played and probed. rtsp_transport only applies
+-- to RTSP (NULL lets the media server choose) and snapshot_refresh_seconds
+-- only to still-image snapshots.
+ALTER TABLE cctvs ADD COLUMN source_type VARCHAR(20) NOT NULL DEFAULT 'hls'
+    CHECK (source_type IN ('hls', 'rtsp', 'mjpeg', 'snapshot', 'embed'));
+ALTER TABLE cctvs ADD COLUMN rtsp_transport VARCHAR(10) CHECK (rtsp_transport IN ('tcp', 'udp', 'multicast'));
+ALTER TABLE cctvs ADD COLUMN snapshot_refresh_seconds INTEGER CHECK (snapshot_refresh_seconds > 0);
+
+-- Best guess for existing cameras from their URLs
+UPDATE cctvs SET source_type = 'rtsp' WHERE source_url ILIKE 'rtsp://%' OR source_url ILIKE 'rtsps://%';
+UPDATE cctvs SET source_type = 'mjpeg' WHERE source_type = 'hls' AND (source_url ILIKE '%.mjpg%' OR source_url ILIKE '%.mjpeg%' OR source_url ILIKE '%mjpg/video%');
+UPDATE cctvs SET source_type = 'snapshot', snapshot_refresh_seconds = 10
+    WHERE source_type = 'hls' AND (source_url ILIKE '%.jpg' OR source_url ILIKE '%.jpeg' OR source_url ILIKE '%.png' OR source_url ILIKE '%snapshot%');
+UPDATE cctvs SET source_type = 'embed' WHERE source_type = 'hls' AND (source_url ILIKE '%youtube.com/embed/%' OR source_url ILIKE '%/embed/%');
+
+CREATE INDEX idx_cctvs_source_type ON cctvs(source_type);
+
+-- +migrate Down
+DROP INDEX idx_cctvs_source_type;
+ALTER TABLE cctvs DROP COLUMN snapshot_refresh_seconds;
+ALTER TABLE cctvs DROP COLUMN rtsp_transport;
+ALTER TABLE cctvs DROP COLUMN source_type;
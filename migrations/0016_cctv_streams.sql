@@ -0,0 +1,26 @@
+-- +migrate Up
+-- Alternative streams of a camera. The main stream falls back to the
+-- camera's own source_url; sub-streams are lighter encodes for slow
+-- connections and snapshot streams are still images.
+CREATE TABLE cctv_streams (
+    id SERIAL PRIMARY KEY,
+    cctv_id INTEGER NOT NULL REFERENCES cctvs(id) ON DELETE CASCADE,
+    role VARCHAR(10) NOT NULL CHECK (role IN ('main', 'sub', 'snapshot')),
+    url TEXT NOT NULL,
+    codec VARCHAR(20),
+    width INTEGER CHECK (width > 0),
+    height INTEGER CHECK (height > 0),
+    bitrate_kbps INTEGER CHECK (bitrate_kbps > 0),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (cctv_id, role)
+);
+
+-- The best stream quality a plan may watch
+ALTER TABLE plans ADD COLUMN max_stream_quality VARCHAR(10) NOT NULL DEFAULT 'main'
+    CHECK (max_stream_quality IN ('main', 'sub', 'snapshot'));
+UPDATE plans SET max_stream_quality = 'sub' WHERE name = 'free';
+
+-- +migrate Down
+ALTER TABLE plans DROP COLUMN max_stream_quality;
+DROP TABLE cctv_streams;
@@ -0,0 +1,9 @@
+-- +migrate Up
+-- Latest still frame captured from snapshot and MJPEG sources. The frame
+-- itself lives in file storage; the hash lets unchanged frames be skipped.
+ALTER TABLE cctvs ADD COLUMN snapshot_hash CHAR(64);
+ALTER TABLE cctvs ADD COLUMN snapshot_captured_at TIMESTAMP;
+
+-- +migrate Down
+ALTER TABLE cctvs DROP COLUMN snapshot_captured_at;
+ALTER TABLE cctvs DROP COLUMN snapshot_hash;
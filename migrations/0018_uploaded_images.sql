@@ -0,0 +1,10 @@
+-- +migrate Up
+-- Uploaded profile photos and camera thumbnails live in file storage under
+-- these keys; photo_url and thumbnail_url point at the API that serves
+-- them. NULL means none was uploaded (the URL may still be external).
+ALTER TABLE users ADD COLUMN photo_key VARCHAR(255);
+ALTER TABLE cctvs ADD COLUMN thumbnail_key VARCHAR(255);
+
+-- +migrate Down
+ALTER TABLE cctvs DROP COLUMN thumbnail_key;
+ALTER TABLE users DROP COLUMN photo_key;
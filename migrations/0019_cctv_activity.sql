@@ -0,0 +1,41 @@
+-- +migrate Up
+-- Activity seen by comparing consecutive snapshots: the share of the frame
+-- that changed (0-100), whether that counts as motion, and parts of the
+-- frame to leave out, as [{"x":0,"y":0,"width":0.2,"height":0.1}, ...]
+ALTER TABLE cctvs ADD COLUMN activity_score REAL;
+ALTER TABLE cctvs ADD COLUMN activity_motion BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE cctvs ADD COLUMN activity_measured_at TIMESTAMP;
+ALTER TABLE cctvs ADD COLUMN last_motion_at TIMESTAMP;
+ALTER TABLE cctvs ADD COLUMN motion_ignore_zones JSONB NOT NULL DEFAULT '[]';
+
+CREATE TABLE cctv_activity_samples (
+    id BIGSERIAL PRIMARY KEY,
+    cctv_id INTEGER NOT NULL REFERENCES cctvs(id) ON DELETE CASCADE,
+    score REAL NOT NULL,
+    motion BOOLEAN NOT NULL,
+    measured_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_cctv_activity_samples_cctv ON cctv_activity_samples(cctv_id, measured_at DESC);
+CREATE INDEX idx_cctv_activity_samples_measured_at ON cctv_activity_samples(measured_at);
+
+-- A run of consecutive samples with motion; ended_at is NULL while it lasts
+CREATE TABLE cctv_motion_events (
+    id BIGSERIAL PRIMARY KEY,
+    cctv_id INTEGER NOT NULL REFERENCES cctvs(id) ON DELETE CASCADE,
+    started_at TIMESTAMP NOT NULL,
+    ended_at TIMESTAMP,
+    peak_score REAL NOT NULL
+);
+
+CREATE INDEX idx_cctv_motion_events_cctv ON cctv_motion_events(cctv_id, started_at DESC);
+CREATE INDEX idx_cctv_motion_events_started_at ON cctv_motion_events(started_at);
+
+-- +migrate Down
+DROP TABLE cctv_motion_events;
+DROP TABLE cctv_activity_samples;
+ALTER TABLE cctvs DROP COLUMN motion_ignore_zones;
+ALTER TABLE cctvs DROP COLUMN last_motion_at;
+ALTER TABLE cctvs DROP COLUMN activity_measured_at;
+ALTER TABLE cctvs DROP COLUMN activity_motion;
+ALTER TABLE cctvs DROP COLUMN activity_score;
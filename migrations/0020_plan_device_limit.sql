@@ -0,0 +1,7 @@
+-- +migrate Up
+-- The column has only ever limited how many devices an account may be bound
+-- to (it took over from DEVICE_LIMIT_FREE and DEVICE_LIMIT_PAID)
+ALTER TABLE plans RENAME COLUMN concurrent_sessions TO device_limit;
+
+-- +migrate Down
+ALTER TABLE plans RENAME COLUMN device_limit TO concurrent_sessions;
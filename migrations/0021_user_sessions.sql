@@ -0,0 +1,26 @@
+-- +migrate Up
+-- How many devices may be signed in at once, separate from how many devices
+-- an account may be bound to
+ALTER TABLE plans ADD COLUMN concurrent_sessions INTEGER NOT NULL DEFAULT 1;
+UPDATE plans SET concurrent_sessions = device_limit;
+
+-- One session per signed-in device; only a hash of the token is stored
+CREATE TABLE user_sessions (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    device_id VARCHAR(255) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP NOT NULL,
+    UNIQUE (user_id, device_id)
+);
+
+CREATE INDEX idx_user_sessions_user_id ON user_sessions(user_id);
+
+-- Replaced by user_sessions; everyone signs in again once
+ALTER TABLE users DROP COLUMN session_token;
+
+-- +migrate Down
+ALTER TABLE users ADD COLUMN session_token TEXT;
+DROP TABLE user_sessions;
+ALTER TABLE plans DROP COLUMN concurrent_sessions;